@@ -1,6 +1,6 @@
 module github.com/nahojkap/ghmon
 
-go 1.15
+go 1.16
 
 require (
 	github.com/andanhm/go-prettytime v1.1.0
@@ -8,4 +8,6 @@ require (
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/kirsle/configdir v0.0.0-20170128060238-e45d2f54772f
 	gitlab.com/tslocum/cview v0.0.0-20210207045010-d776e728ef6d
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/sys v0.0.0-20210124154548-22da62e12c0c
 )
@@ -0,0 +1,255 @@
+package ghmon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Version of the archive format, pull requests in it carry their own schema version on top of it
+const archiveVersion = 1
+
+/* Types of the records of an archive */
+const (
+	archiveRecordHeader      = "ghmon-export"
+	archiveRecordPullRequest = "pull-request"
+	archiveRecordHistory     = "history"
+	archiveRecordPreferences = "preferences"
+)
+
+// archiveRecord is a line of an archive.  Pull requests are kept as stored, so that importing them goes through the
+// same schema migrations as loading them.
+type archiveRecord struct {
+	Type        string              `json:"type"`
+	Version     int                 `json:"version,omitempty"`
+	ExportedAt  *time.Time          `json:"exported_at,omitempty"`
+	PullRequest json.RawMessage     `json:"pull_request,omitempty"`
+	History     *PullRequestHistory `json:"history,omitempty"`
+	Preferences *Preferences        `json:"preferences,omitempty"`
+}
+
+// ArchiveSummary counts what was exported or imported, merged records were already stored
+type ArchiveSummary struct {
+	PullRequests       int
+	MergedPullRequests int
+	Histories          int
+	MergedHistories    int
+	Preferences        bool
+}
+
+// ExportArchive writes the stored pull requests with their seen, hidden and snoozed state and notes, their histories
+// and the preferences as JSON lines.  Cached diffs are left out, they are retrieved again when needed.
+func (ghm *GHMon) ExportArchive(writer io.Writer) (*ArchiveSummary, error) {
+
+	pullRequestWrappers, err := ghm.store.LoadPullRequestWrappers()
+	if err != nil {
+		return nil, err
+	}
+	histories, err := ghm.store.LoadPullRequestHistories()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pullRequestWrappers, func(i, j int) bool {
+		return pullRequestWrappers[i].Id < pullRequestWrappers[j].Id
+	})
+	sort.Slice(histories, func(i, j int) bool {
+		return histories[i].Id < histories[j].Id
+	})
+
+	encoder := json.NewEncoder(writer)
+	now := time.Now()
+	if err = encoder.Encode(&archiveRecord{Type: archiveRecordHeader, Version: archiveVersion, ExportedAt: &now}); err != nil {
+		return nil, err
+	}
+
+	summary := &ArchiveSummary{}
+	for _, pullRequestWrapper := range pullRequestWrappers {
+		bytes, err := encodePullRequestWrapper(pullRequestWrapper)
+		if err != nil {
+			return nil, fmt.Errorf("could not export pull request %d: %s", pullRequestWrapper.Id, err)
+		}
+		if err = encoder.Encode(&archiveRecord{Type: archiveRecordPullRequest, PullRequest: bytes}); err != nil {
+			return nil, err
+		}
+		summary.PullRequests++
+	}
+	for _, history := range histories {
+		if err = encoder.Encode(&archiveRecord{Type: archiveRecordHistory, History: history}); err != nil {
+			return nil, err
+		}
+		summary.Histories++
+	}
+	if err = encoder.Encode(&archiveRecord{Type: archiveRecordPreferences, Preferences: ghm.store.LoadPreferences()}); err != nil {
+		return nil, err
+	}
+	summary.Preferences = true
+	return summary, nil
+}
+
+// ImportArchive merges an archive written by ExportArchive into the store.  The whole archive is read before anything
+// is stored, so an archive that cannot be read changes nothing.
+func (ghm *GHMon) ImportArchive(reader io.Reader) (*ArchiveSummary, error) {
+
+	pullRequestWrappers := make([]*PullRequestWrapper, 0)
+	histories := make([]*PullRequestHistory, 0)
+	var preferences *Preferences
+
+	decoder := json.NewDecoder(reader)
+	for line := 1; ; line++ {
+		var record archiveRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			if line == 1 {
+				return nil, fmt.Errorf("the archive is empty")
+			}
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("record %d: %s", line, err)
+		}
+
+		if line == 1 {
+			if record.Type != archiveRecordHeader {
+				return nil, fmt.Errorf("not a ghmon archive")
+			}
+			if record.Version > archiveVersion {
+				return nil, fmt.Errorf("archive version %d was written by a newer ghmon, this one knows up to %d", record.Version, archiveVersion)
+			}
+			continue
+		}
+
+		switch record.Type {
+		case archiveRecordPullRequest:
+			pullRequestWrapper, err := decodePullRequestWrapper(record.PullRequest)
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %s", line, err)
+			}
+			pullRequestWrappers = append(pullRequestWrappers, pullRequestWrapper)
+		case archiveRecordHistory:
+			if record.History == nil {
+				return nil, fmt.Errorf("record %d: history missing", line)
+			}
+			histories = append(histories, record.History)
+		case archiveRecordPreferences:
+			preferences = record.Preferences
+		default:
+			// Written by a newer ghmon, what this one knows is still worth importing
+			ghm.logger.Printf("Skipping record %d of unknown type %s", line, record.Type)
+		}
+	}
+
+	summary := &ArchiveSummary{}
+	for i, pullRequestWrapper := range pullRequestWrappers {
+		storedPullRequestWrapper, err := ghm.store.LoadPullRequestWrapper(pullRequestWrapper.Id)
+		if err != nil {
+			return nil, err
+		}
+		if storedPullRequestWrapper != nil {
+			pullRequestWrappers[i] = mergePullRequestWrapper(storedPullRequestWrapper, pullRequestWrapper)
+			summary.MergedPullRequests++
+		}
+		summary.PullRequests++
+	}
+	// Written by the store writer, after whatever the monitor queued before
+	var err error
+	ghm.writeStore(func() {
+		// Stored all at once, or not at all with the bolt storage
+		if err = ghm.store.StorePullRequestWrappers(pullRequestWrappers); err != nil {
+			summary = nil
+			return
+		}
+		for _, history := range histories {
+			storedHistory, loadError := ghm.store.LoadPullRequestHistory(history.Id)
+			if loadError != nil {
+				err = loadError
+				return
+			}
+			if storedHistory != nil {
+				history = mergePullRequestHistory(storedHistory, history)
+				summary.MergedHistories++
+			}
+			if err = ghm.store.StorePullRequestHistory(history); err != nil {
+				err = fmt.Errorf("could not store the history of %d: %s", history.Id, err)
+				return
+			}
+			summary.Histories++
+		}
+	})
+	if err != nil {
+		return summary, err
+	}
+
+	if preferences != nil {
+		ghm.StorePreferences(preferences)
+		summary.Preferences = true
+	}
+	return summary, nil
+}
+
+func laterTime(left time.Time, right time.Time) time.Time {
+	if right.After(left) {
+		return right
+	}
+	return left
+}
+
+func earlierNonZeroTime(left time.Time, right time.Time) time.Time {
+	if left.IsZero() || (!right.IsZero() && right.Before(left)) {
+		return right
+	}
+	return left
+}
+
+// mergePullRequestWrapper keeps the most recently updated pull request from GitHub, and what the user did on either
+// side: seen on one side is seen, hidden on one side is hidden, snoozing lasts until the later time and the note and
+// tags written last are kept
+func mergePullRequestWrapper(stored *PullRequestWrapper, imported *PullRequestWrapper) *PullRequestWrapper {
+
+	merged := stored
+	if imported.PullRequest.UpdatedAt.After(stored.PullRequest.UpdatedAt) {
+		merged.PullRequest = imported.PullRequest
+		merged.Deleted = imported.Deleted
+		merged.Score = imported.Score
+	}
+	merged.Seen = stored.Seen || imported.Seen
+	merged.Hidden = stored.Hidden || imported.Hidden
+	merged.SnoozedUntil = laterTime(stored.SnoozedUntil, imported.SnoozedUntil)
+	merged.LastViewed = laterTime(stored.LastViewed, imported.LastViewed)
+	merged.FirstSeen = earlierNonZeroTime(stored.FirstSeen, imported.FirstSeen)
+	merged.ReviewRequestedAt = earlierNonZeroTime(stored.ReviewRequestedAt, imported.ReviewRequestedAt)
+	if imported.NoteUpdatedAt.After(stored.NoteUpdatedAt) {
+		merged.Note = imported.Note
+		merged.Tags = imported.Tags
+		merged.NoteUpdatedAt = imported.NoteUpdatedAt
+	}
+	return merged
+}
+
+// mergePullRequestHistory keeps the events of both sides once.  The side that saw the pull request last says what it
+// looked like then and whether it is closed.
+func mergePullRequestHistory(stored *PullRequestHistory, imported *PullRequestHistory) *PullRequestHistory {
+
+	latest := func(history *PullRequestHistory) time.Time {
+		if len(history.Events) == 0 {
+			return time.Time{}
+		}
+		return history.Events[len(history.Events)-1].Time
+	}
+	merged := *stored
+	if latest(imported).After(latest(stored)) {
+		merged = *imported
+	}
+
+	merged.Events = make([]*PullRequestHistoryEvent, 0, len(stored.Events)+len(imported.Events))
+	knownEvents := make(map[string]bool)
+	for _, events := range [][]*PullRequestHistoryEvent{stored.Events, imported.Events} {
+		for _, event := range events {
+			key := fmt.Sprintf("%d %s %s %s", event.Time.UnixNano(), event.Kind, event.Actor, event.Details)
+			if !knownEvents[key] {
+				knownEvents[key] = true
+				merged.appendEvent(event)
+			}
+		}
+	}
+	return &merged
+}
@@ -0,0 +1,204 @@
+package ghmon
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newArchivedPullRequestWrapper(t *testing.T, pullRequestId uint32, title string, updatedAt time.Time) *PullRequestWrapper {
+	t.Helper()
+	pullRequest := newRetrievedPullRequest(t, pullRequestId, title)
+	pullRequest.UpdatedAt = updatedAt
+	return &PullRequestWrapper{Id: pullRequestId, PullRequest: pullRequest, FirstSeen: updatedAt}
+}
+
+func TestArchiveExportAndImportMergesWithTheStore(t *testing.T) {
+
+	earlier := time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+
+	exporting := newTestMonitor(t)
+	exported := newArchivedPullRequestWrapper(t, 1, "exported", later)
+	exported.Seen = true
+	exported.Note = "older note"
+	exported.NoteUpdatedAt = earlier
+	onlyExported := newArchivedPullRequestWrapper(t, 2, "only exported", earlier)
+	if err := exporting.store.StorePullRequestWrappers([]*PullRequestWrapper{onlyExported, exported}); err != nil {
+		t.Fatal(err)
+	}
+	for _, history := range []*PullRequestHistory{
+		{Id: 1, Title: "exported", Events: []*PullRequestHistoryEvent{{Time: earlier, Kind: HistoryEventOpened}, {Time: later, Kind: HistoryEventApproved, Actor: "bob"}}},
+		{Id: 2, Title: "only exported", Events: []*PullRequestHistoryEvent{{Time: earlier, Kind: HistoryEventOpened}}},
+	} {
+		if err := exporting.store.StorePullRequestHistory(history); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exporting.StorePreferences(&Preferences{Filter: "is:review", SortMode: SortByCreated, ListPaneWeight: 3})
+
+	var archive bytes.Buffer
+	summary, err := exporting.ExportArchive(&archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *summary != (ArchiveSummary{PullRequests: 2, Histories: 2, Preferences: true}) {
+		t.Errorf("unexpected export summary %+v", *summary)
+	}
+	lines := strings.Split(strings.TrimSpace(archive.String()), "\n")
+	if len(lines) != 6 || !strings.Contains(lines[0], `"type":"ghmon-export"`) || !strings.Contains(lines[1], `"type":"pull-request"`) || !strings.Contains(lines[5], `"type":"preferences"`) {
+		t.Errorf("unexpected archive\n%s", archive.String())
+	}
+
+	importing := newTestMonitor(t)
+	stored := newArchivedPullRequestWrapper(t, 1, "stored", earlier)
+	stored.Hidden = true
+	stored.Note = "newer note"
+	stored.NoteUpdatedAt = later
+	if err = importing.store.StorePullRequestWrappers([]*PullRequestWrapper{stored}); err != nil {
+		t.Fatal(err)
+	}
+	if err = importing.store.StorePullRequestHistory(&PullRequestHistory{Id: 1, Title: "stored", Events: []*PullRequestHistoryEvent{{Time: earlier, Kind: HistoryEventOpened}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if summary, err = importing.ImportArchive(&archive); err != nil {
+		t.Fatal(err)
+	}
+	if *summary != (ArchiveSummary{PullRequests: 2, MergedPullRequests: 1, Histories: 2, MergedHistories: 1, Preferences: true}) {
+		t.Errorf("unexpected import summary %+v", *summary)
+	}
+
+	merged, err := importing.store.LoadPullRequestWrapper(1)
+	if err != nil || merged == nil {
+		t.Fatalf("merged pull request not stored: %v", err)
+	}
+	if merged.PullRequest.Title != "exported" || !merged.Seen || !merged.Hidden || merged.Note != "newer note" {
+		t.Errorf("unexpected merged pull request %q, seen %v, hidden %v, note %q", merged.PullRequest.Title, merged.Seen, merged.Hidden, merged.Note)
+	}
+	if imported, err := importing.store.LoadPullRequestWrapper(2); err != nil || imported == nil || imported.PullRequest.Title != "only exported" {
+		t.Errorf("imported pull request not stored: %v", err)
+	}
+	mergedHistory, err := importing.store.LoadPullRequestHistory(1)
+	if err != nil || mergedHistory == nil {
+		t.Fatalf("merged history not stored: %v", err)
+	}
+	if mergedHistory.Title != "exported" || len(mergedHistory.Events) != 2 {
+		t.Errorf("unexpected merged history %q with %v", mergedHistory.Title, eventKinds(mergedHistory))
+	}
+	if preferences := importing.store.LoadPreferences(); preferences.Filter != "is:review" || preferences.SortMode != SortByCreated || preferences.ListPaneWeight != 3 {
+		t.Errorf("unexpected preferences %+v", *preferences)
+	}
+}
+
+func TestImportArchiveRefusesWhatItCannotRead(t *testing.T) {
+
+	ghm := newTestMonitor(t)
+	header := `{"type":"ghmon-export","version":1}` + "\n"
+
+	tests := []struct {
+		name    string
+		archive string
+		err     string
+	}{
+		{"empty", "", "the archive is empty"},
+		{"no header", `{"type":"history","history":{"Id":1}}` + "\n", "not a ghmon archive"},
+		{"newer version", `{"type":"ghmon-export","version":2}` + "\n", "archive version 2 was written by a newer ghmon"},
+		{"not JSON", header + "pull request\n", "record 2"},
+		{"history missing", header + `{"type":"pull-request","pull_request":` + string(loadFixture(t, "pull-request-v2.json")) + "}\n" + `{"type":"history"}` + "\n", "record 3: history missing"},
+	}
+	for _, test := range tests {
+		if _, err := ghm.ImportArchive(strings.NewReader(test.archive)); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got %v, expected %s", test.name, err, test.err)
+		}
+	}
+
+	// Nothing is stored from an archive that could not be read to the end
+	if pullRequestWrappers, err := ghm.store.LoadPullRequestWrappers(); err != nil || len(pullRequestWrappers) != 0 {
+		t.Errorf("stored %d pull requests (%v)", len(pullRequestWrappers), err)
+	}
+
+	// Records of a newer ghmon are skipped
+	summary, err := ghm.ImportArchive(strings.NewReader(header + `{"type":"something-new"}` + "\n"))
+	if err != nil || *summary != (ArchiveSummary{}) {
+		t.Errorf("unexpected import %+v (%v)", summary, err)
+	}
+}
+
+func TestMergePullRequestWrapper(t *testing.T) {
+
+	earlier := time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+
+	stored := &PullRequestWrapper{
+		Id: 1, PullRequest: &PullRequest{Id: 1, Title: "stored", UpdatedAt: later}, Score: PullRequestScore{Total: 10},
+		Seen: true, SnoozedUntil: earlier, LastViewed: later, FirstSeen: later, ReviewRequestedAt: time.Time{},
+		Note: "stored note", Tags: []string{"stored"}, NoteUpdatedAt: earlier,
+	}
+	imported := &PullRequestWrapper{
+		Id: 1, PullRequest: &PullRequest{Id: 1, Title: "imported", UpdatedAt: earlier}, Score: PullRequestScore{Total: 90}, Deleted: true,
+		Hidden: true, SnoozedUntil: later, LastViewed: earlier, FirstSeen: earlier, ReviewRequestedAt: later,
+		Note: "imported note", Tags: []string{"imported"}, NoteUpdatedAt: later,
+	}
+
+	merged := mergePullRequestWrapper(stored, imported)
+
+	// The stored pull request was updated on GitHub last, the note was written last in the archive
+	if merged.PullRequest.Title != "stored" || merged.Deleted || merged.Score.Total != 10 {
+		t.Errorf("unexpected pull request %q, deleted %v, score %.0f", merged.PullRequest.Title, merged.Deleted, merged.Score.Total)
+	}
+	if !merged.Seen || !merged.Hidden {
+		t.Errorf("seen %v and hidden %v, expected both", merged.Seen, merged.Hidden)
+	}
+	times := []struct {
+		name     string
+		merged   time.Time
+		expected time.Time
+	}{
+		{"snoozed until", merged.SnoozedUntil, later},
+		{"last viewed", merged.LastViewed, later},
+		{"first seen", merged.FirstSeen, earlier},
+		{"review requested at", merged.ReviewRequestedAt, later},
+		{"note updated at", merged.NoteUpdatedAt, later},
+	}
+	for _, test := range times {
+		if !test.merged.Equal(test.expected) {
+			t.Errorf("%s is %s, expected %s", test.name, test.merged, test.expected)
+		}
+	}
+	if merged.Note != "imported note" || !reflect.DeepEqual(merged.Tags, []string{"imported"}) {
+		t.Errorf("note %q with tags %v, expected the imported ones", merged.Note, merged.Tags)
+	}
+}
+
+func TestMergePullRequestHistory(t *testing.T) {
+
+	opened := time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)
+	reviewed := opened.Add(time.Hour)
+	closed := opened.Add(2 * time.Hour)
+
+	stored := &PullRequestHistory{Id: 1, Title: "stored", Events: []*PullRequestHistoryEvent{
+		{Time: opened, Kind: HistoryEventOpened, Actor: "author"},
+		{Time: reviewed, Kind: HistoryEventApproved, Actor: "bob"},
+	}}
+	imported := &PullRequestHistory{Id: 1, Title: "imported", ClosedAt: closed, Events: []*PullRequestHistoryEvent{
+		{Time: opened, Kind: HistoryEventOpened, Actor: "author"},
+		{Time: reviewed, Kind: HistoryEventCommented, Actor: "carol"},
+		{Time: closed, Kind: HistoryEventMerged, Actor: "bob"},
+	}}
+
+	merged := mergePullRequestHistory(stored, imported)
+
+	if merged.Title != "imported" || !merged.ClosedAt.Equal(closed) {
+		t.Errorf("merged %q closed at %s, expected the imported history that saw it merged", merged.Title, merged.ClosedAt)
+	}
+	expectedKinds := []HistoryEventKind{HistoryEventOpened, HistoryEventApproved, HistoryEventCommented, HistoryEventMerged}
+	if kinds := eventKinds(merged); !reflect.DeepEqual(kinds, expectedKinds) {
+		t.Errorf("events %v, expected %v", kinds, expectedKinds)
+	}
+	if len(stored.Events) != 2 || len(imported.Events) != 3 {
+		t.Error("the merged histories were changed")
+	}
+}
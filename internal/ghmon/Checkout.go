@@ -0,0 +1,160 @@
+package ghmon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	checkoutModeWorktree = "worktree"
+	checkoutModeGh       = "gh"
+)
+
+// reportStatus shows progress of a longer running operation in the status bar
+func (ghm *GHMon) reportStatus(format string, arguments ...interface{}) {
+	status := fmt.Sprintf(format, arguments...)
+	ghm.logger.Print(status)
+	ghm.publish(Event{eventType: Status, payload: status})
+}
+
+// runGit runs git in the given directory, returning the output or an error carrying what git printed
+func runGit(ctx context.Context, directory string, arguments ...string) (string, error) {
+
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", directory}, arguments...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		return string(output), ctx.Err()
+	}
+	if err != nil {
+		return string(output), fmt.Errorf("git %s: %s (%w)", arguments[0], strings.TrimSpace(stderr.String()), err)
+	}
+	return string(output), nil
+}
+
+// getLocalClonePath looks up the local clone of a repository in the configured repository paths
+func (ghm *GHMon) getLocalClonePath(repo *Repo) (string, error) {
+	for fullName, path := range ghm.configuration.RepoPaths {
+		if strings.EqualFold(strings.TrimSpace(fullName), repo.FullName) {
+			if strings.HasPrefix(path, "~/") {
+				if home, err := os.UserHomeDir(); err == nil {
+					path = filepath.Join(home, path[2:])
+				}
+			}
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no local clone configured for %s (see GHMON_REPO_PATHS)", repo.FullName)
+}
+
+// getWorktreePath is where the worktree of a pull request lives, by default next to the clone
+func (ghm *GHMon) getWorktreePath(clonePath string, pullRequest *PullRequest) string {
+	worktreeFolder := ghm.configuration.WorktreeFolder
+	if worktreeFolder == "" {
+		worktreeFolder = filepath.Clean(clonePath) + "-worktrees"
+	}
+	return filepath.Join(worktreeFolder, fmt.Sprintf("%s-pr-%d", pullRequest.Repo.Name, pullRequest.Number))
+}
+
+// CheckoutPullRequest checks out the head of the pull request locally, either in a git worktree of the configured
+// clone (created or updated) or by running 'gh pr checkout' in the clone itself.  The configured checkout command is
+// launched afterwards.  Returns the directory the pull request was checked out in.
+func (ghm *GHMon) CheckoutPullRequest(pullRequestWrapper *PullRequestWrapper) (string, error) {
+
+	pullRequest := pullRequestWrapper.PullRequest
+	clonePath, err := ghm.getLocalClonePath(pullRequest.Repo)
+	if err != nil {
+		return "", err
+	}
+	if pullRequest.Number == 0 {
+		return "", fmt.Errorf("pull request details have not been retrieved yet")
+	}
+
+	checkoutPath := clonePath
+	switch ghm.configuration.CheckoutMode {
+	case checkoutModeGh:
+		ghm.reportStatus("Running gh pr checkout %d in %s", pullRequest.Number, clonePath)
+		cmd := exec.CommandContext(ghm.context, "gh", "pr", "checkout", fmt.Sprint(pullRequest.Number))
+		cmd.Dir = clonePath
+		if output, err := cmd.CombinedOutput(); ghm.context.Err() != nil {
+			return "", ghm.context.Err()
+		} else if err != nil {
+			return "", fmt.Errorf("gh pr checkout: %s (%w)", strings.TrimSpace(string(output)), err)
+		}
+	case checkoutModeWorktree, "":
+		if checkoutPath, err = ghm.checkoutPullRequestWorktree(clonePath, pullRequest); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unknown checkout mode %s (use %s or %s)", ghm.configuration.CheckoutMode, checkoutModeWorktree, checkoutModeGh)
+	}
+
+	if ghm.configuration.CheckoutCommand != "" {
+		if err := ghm.launchCheckoutCommand(checkoutPath, pullRequest); err != nil {
+			return checkoutPath, err
+		}
+	}
+	return checkoutPath, nil
+}
+
+func (ghm *GHMon) checkoutPullRequestWorktree(clonePath string, pullRequest *PullRequest) (string, error) {
+
+	// Pull requests from forks are available from the base repository under refs/pull
+	ref := fmt.Sprintf("refs/remotes/origin/pr/%d", pullRequest.Number)
+	ghm.reportStatus("Fetching %s#%d into %s", pullRequest.Repo.FullName, pullRequest.Number, clonePath)
+	if _, err := runGit(ghm.context, clonePath, "fetch", "--force", "origin", fmt.Sprintf("refs/pull/%d/head:%s", pullRequest.Number, ref)); err != nil {
+		return "", err
+	}
+
+	worktreePath := ghm.getWorktreePath(clonePath, pullRequest)
+	if _, err := os.Stat(worktreePath); err == nil {
+		ghm.reportStatus("Updating worktree %s", worktreePath)
+		if _, err := runGit(ghm.context, worktreePath, "checkout", "--detach", ref); err != nil {
+			return "", err
+		}
+		return worktreePath, nil
+	}
+
+	ghm.reportStatus("Creating worktree %s", worktreePath)
+	if _, err := runGit(ghm.context, clonePath, "worktree", "add", "--detach", worktreePath, ref); err != nil {
+		return "", err
+	}
+	return worktreePath, nil
+}
+
+// launchCheckoutCommand starts the configured command (e.g. an editor or 'tmux split-window') without waiting for
+// it.  {path}, {repo}, {number} and {branch} are replaced with the details of the checkout, quoted for the shell as
+// the branch comes from the author of the pull request.  They are in GHMON_CHECKOUT_PATH, GHMON_REPO, GHMON_NUMBER and
+// GHMON_BRANCH as well.  The command is left running when ghmon exits.
+func (ghm *GHMon) launchCheckoutCommand(checkoutPath string, pullRequest *PullRequest) error {
+
+	command := strings.NewReplacer(
+		"{path}", quoteForShell(checkoutPath), "{repo}", quoteForShell(pullRequest.Repo.FullName),
+		"{number}", quoteForShell(fmt.Sprint(pullRequest.Number)), "{branch}", quoteForShell(pullRequest.HeadRef),
+	).Replace(ghm.configuration.CheckoutCommand)
+
+	ghm.logger.Printf("Launching %s", command)
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = checkoutPath
+	cmd.Env = append(os.Environ(),
+		"GHMON_CHECKOUT_PATH="+checkoutPath, "GHMON_REPO="+pullRequest.Repo.FullName,
+		"GHMON_NUMBER="+fmt.Sprint(pullRequest.Number), "GHMON_BRANCH="+pullRequest.HeadRef,
+	)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// quoteForShell single quotes the value so that 'sh -c' takes it as one word, whatever it contains
+func quoteForShell(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,19 @@
+package ghmon
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestQuoteForShellKeepsBranchNamesInert(t *testing.T) {
+
+	for _, branch := range []string{"feature/toggles", "$(touch pwned)", "a;b|c", "x${IFS}y", "it's", "`id`", "'; echo '"} {
+		output, err := exec.Command("sh", "-c", "printf %s "+quoteForShell(branch)).Output()
+		if err != nil {
+			t.Fatalf("%s: %s", branch, err)
+		}
+		if string(output) != branch {
+			t.Errorf("%s came out of the shell as %s", branch, output)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package ghmon
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type PullRequestCommentKind int
+
+const (
+	PullRequestCommentKindComment PullRequestCommentKind = iota
+	PullRequestCommentKindReview
+	PullRequestCommentKindReviewComment
+)
+
+type PullRequestComment struct {
+	Id        uint64
+	Kind      PullRequestCommentKind
+	User      *User
+	Body      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	/* Only set for review bodies */
+	ReviewStatus PullRequestReviewStatus
+}
+
+type PullRequestReviewThread struct {
+	Path     string
+	Line     uint32
+	DiffHunk string
+	Resolved bool
+	Outdated bool
+	Comments []*PullRequestComment
+}
+
+// PullRequestConversation holds what has been said on a pull request - the general conversation (issue comments and
+// review bodies) in chronological order and the inline review comments threaded by file and line
+type PullRequestConversation struct {
+	Id          uint32
+	RetrievedAt time.Time
+	Comments    []*PullRequestComment
+	Threads     []*PullRequestReviewThread
+}
+
+const reviewThreadsQuery = `query($owner: String!, $name: String!, $number: Int!, $after: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100, after: $after) {
+        nodes { isResolved isOutdated comments(first: 1) { nodes { databaseId } } }
+        pageInfo { hasNextPage endCursor }
+      }
+    }
+  }
+}`
+
+type reviewThreadState struct {
+	resolved bool
+	outdated bool
+}
+
+// LastActivity is the latest time anything was said in the thread
+func (thread *PullRequestReviewThread) LastActivity() time.Time {
+	lastActivity := time.Time{}
+	for _, comment := range thread.Comments {
+		if comment.UpdatedAt.After(lastActivity) {
+			lastActivity = comment.UpdatedAt
+		}
+	}
+	return lastActivity
+}
+
+// IsNewSince reports whether the comment was written or edited after the given time, a zero time means the pull
+// request was never viewed so everything is new
+func (comment *PullRequestComment) IsNewSince(lastViewed time.Time) bool {
+	return lastViewed.IsZero() || comment.CreatedAt.After(lastViewed) || comment.UpdatedAt.After(lastViewed)
+}
+
+// ViewedSince gives the time from which conversation activity should be considered new for the pull request
+func ViewedSince(pullRequestWrapper *PullRequestWrapper) time.Time {
+	if !pullRequestWrapper.LastViewed.IsZero() {
+		return pullRequestWrapper.LastViewed
+	}
+	if pullRequestWrapper.Seen {
+		// Seen before views were tracked, only activity since it was first seen can be new
+		return pullRequestWrapper.FirstSeen
+	}
+	return time.Time{}
+}
+
+// RetrievePullRequestConversation fetches the issue comments, reviews and inline review comments of a pull request.
+// Resolved state is only available through the GraphQL API, failing to retrieve it is not fatal.
+func (ghm *GHMon) RetrievePullRequestConversation(pullRequestWrapper *PullRequestWrapper) (*PullRequestConversation, error) {
+
+	pullRequest := pullRequestWrapper.PullRequest
+	pullRequestPath := pullRequest.PullRequestURL.Path
+	issuePath := strings.Replace(pullRequestPath, "/pulls/", "/issues/", 1)
+
+	conversation := &PullRequestConversation{Id: pullRequest.Id, RetrievedAt: time.Now(), Comments: make([]*PullRequestComment, 0), Threads: make([]*PullRequestReviewThread, 0)}
+
+	issueCommentItems, err := retrieveAllPages(ghm.context, issuePath + "/comments")
+	if err != nil {
+		return nil, err
+	}
+	for _, issueCommentItem := range issueCommentItems {
+		conversation.Comments = append(conversation.Comments, ghm.parsePullRequestComment(PullRequestCommentKindComment, issueCommentItem))
+	}
+
+	reviewItems, err := retrieveAllPages(ghm.context, pullRequestPath + "/reviews")
+	if err != nil {
+		return nil, err
+	}
+	for _, reviewItem := range reviewItems {
+		comment := ghm.parsePullRequestComment(PullRequestCommentKindReview, reviewItem)
+		if state, ok := reviewItem["state"].(string); ok {
+			comment.ReviewStatus = ghm.ConvertToPullRequestReviewState(state)
+		}
+		// Reviews without a body that only comment are containers for inline comments, pending ones are not visible
+		if comment.ReviewStatus == PullRequestReviewStatusPending || (comment.Body == "" && comment.ReviewStatus == PullRequestReviewStatusCommented) {
+			continue
+		}
+		conversation.Comments = append(conversation.Comments, comment)
+	}
+
+	sort.SliceStable(conversation.Comments, func(i, j int) bool {
+		return conversation.Comments[i].CreatedAt.Before(conversation.Comments[j].CreatedAt)
+	})
+
+	reviewCommentItems, err := retrieveAllPages(ghm.context, pullRequestPath + "/comments")
+	if err != nil {
+		return nil, err
+	}
+
+	threadStates, err := ghm.retrieveReviewThreadStates(pullRequest)
+	if err != nil {
+		ghm.logger.Printf("Could not retrieve review thread states for %d: %s", pullRequest.Id, err)
+	}
+
+	threadsByRootComment := make(map[uint64]*PullRequestReviewThread)
+	for _, reviewCommentItem := range reviewCommentItems {
+
+		comment := ghm.parsePullRequestComment(PullRequestCommentKindReviewComment, reviewCommentItem)
+
+		// GitHub points all replies at the first comment of the thread
+		if inReplyTo, ok := reviewCommentItem["in_reply_to_id"].(float64); ok {
+			if thread, ok := threadsByRootComment[uint64(inReplyTo)]; ok {
+				thread.Comments = append(thread.Comments, comment)
+				continue
+			}
+		}
+
+		thread := &PullRequestReviewThread{Comments: []*PullRequestComment{comment}}
+		thread.Path, _ = reviewCommentItem["path"].(string)
+		thread.DiffHunk, _ = reviewCommentItem["diff_hunk"].(string)
+		if line, ok := reviewCommentItem["line"].(float64); ok {
+			thread.Line = uint32(line)
+		} else if originalLine, ok := reviewCommentItem["original_line"].(float64); ok {
+			thread.Line = uint32(originalLine)
+		}
+		// Without a position the comment no longer applies to the current diff
+		thread.Outdated = reviewCommentItem["position"] == nil
+		if threadState, ok := threadStates[comment.Id]; ok {
+			thread.Resolved = threadState.resolved
+			thread.Outdated = threadState.outdated
+		}
+
+		threadsByRootComment[comment.Id] = thread
+		conversation.Threads = append(conversation.Threads, thread)
+	}
+
+	sort.SliceStable(conversation.Threads, func(i, j int) bool {
+		left := conversation.Threads[i]
+		right := conversation.Threads[j]
+		if left.Path != right.Path {
+			return left.Path < right.Path
+		}
+		return left.Line < right.Line
+	})
+
+	return conversation, nil
+}
+
+func (ghm *GHMon) parsePullRequestComment(kind PullRequestCommentKind, item map[string]interface{}) *PullRequestComment {
+
+	comment := &PullRequestComment{Kind: kind, User: &User{}}
+	if id, ok := item["id"].(float64); ok {
+		comment.Id = uint64(id)
+	}
+	if user, ok := item["user"].(map[string]interface{}); ok {
+		if id, ok := user["id"].(float64); ok {
+			comment.User.Id = uint32(id)
+		}
+		comment.User.Username, _ = user["login"].(string)
+	}
+	comment.Body, _ = item["body"].(string)
+
+	// Reviews only carry the time they were submitted
+	for _, field := range []string{"created_at", "submitted_at"} {
+		if timeString, ok := item[field].(string); ok {
+			comment.CreatedAt, _ = time.Parse(time.RFC3339, timeString)
+			break
+		}
+	}
+	comment.UpdatedAt = comment.CreatedAt
+	if timeString, ok := item["updated_at"].(string); ok {
+		comment.UpdatedAt, _ = time.Parse(time.RFC3339, timeString)
+	}
+	return comment
+}
+
+// retrieveReviewThreadStates returns the resolved and outdated state of each review thread keyed by the identifier
+// of its first comment
+func (ghm *GHMon) retrieveReviewThreadStates(pullRequest *PullRequest) (map[uint64]reviewThreadState, error) {
+
+	threadStates := make(map[uint64]reviewThreadState)
+
+	names := strings.SplitN(pullRequest.Repo.FullName, "/", 2)
+	if len(names) != 2 {
+		return threadStates, fmt.Errorf("unexpected repository name %s", pullRequest.Repo.FullName)
+	}
+
+	// 100 threads at a time, the cursor of the previous page picks up where it ended
+	variables := []string{"owner=" + names[0], "name=" + names[1], fmt.Sprintf("number=%d", pullRequest.Number)}
+	for {
+		response, err := runGraphQLRequest(ghm.context, reviewThreadsQuery, variables...)
+		if err != nil {
+			return threadStates, err
+		}
+
+		var result struct {
+			Data struct {
+				Repository struct {
+					PullRequest struct {
+						ReviewThreads struct {
+							Nodes []struct {
+								IsResolved bool
+								IsOutdated bool
+								Comments   struct {
+									Nodes []struct {
+										DatabaseId uint64
+									}
+								}
+							}
+							PageInfo struct {
+								HasNextPage bool
+								EndCursor   string
+							}
+						}
+					}
+				}
+			}
+		}
+		if err = json.Unmarshal(response, &result); err != nil {
+			return threadStates, err
+		}
+
+		reviewThreads := result.Data.Repository.PullRequest.ReviewThreads
+		for _, node := range reviewThreads.Nodes {
+			if len(node.Comments.Nodes) > 0 {
+				threadStates[node.Comments.Nodes[0].DatabaseId] = reviewThreadState{resolved: node.IsResolved, outdated: node.IsOutdated}
+			}
+		}
+		if !reviewThreads.PageInfo.HasNextPage || reviewThreads.PageInfo.EndCursor == "" {
+			break
+		}
+		variables = append(variables[:3], "after="+reviewThreads.PageInfo.EndCursor)
+	}
+	return threadStates, nil
+}
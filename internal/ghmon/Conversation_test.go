@@ -0,0 +1,206 @@
+package ghmon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeGHResponse is what the fake 'gh' prints when its arguments contain the given text
+type fakeGHResponse struct {
+	arguments string
+	output    string
+}
+
+// withFakeGH puts a 'gh' on the PATH answering with the first response whose arguments it was run with, any other
+// command fails
+func withFakeGH(t *testing.T, responses ...fakeGHResponse) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake gh is a shell script")
+	}
+
+	folder := t.TempDir()
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\ncase \"$*\" in\n")
+	for index, response := range responses {
+		responseFile := filepath.Join(folder, fmt.Sprintf("response-%d", index))
+		if err := ioutil.WriteFile(responseFile, []byte(response.output), 0644); err != nil {
+			t.Fatal(err)
+		}
+		script.WriteString(fmt.Sprintf("*'%s'*) cat '%s' ;;\n", response.arguments, responseFile))
+	}
+	script.WriteString("*) echo \"unexpected gh $*\" >&2; exit 1 ;;\nesac\n")
+	if err := ioutil.WriteFile(filepath.Join(folder, "gh"), []byte(script.String()), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	path := os.Getenv("PATH")
+	if err := os.Setenv("PATH", folder+string(os.PathListSeparator)+path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Setenv("PATH", path)
+	})
+}
+
+func newConversationPullRequestWrapper(t *testing.T) *PullRequestWrapper {
+	t.Helper()
+	pullRequestURL, err := url.Parse("https://api.github.com/repos/owner/repo/pulls/7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &PullRequestWrapper{
+		Id: 1,
+		PullRequest: &PullRequest{
+			Id:             1,
+			Number:         7,
+			Repo:           &Repo{Name: "repo", FullName: "owner/repo"},
+			Creator:        &User{Id: 2, Username: "author"},
+			PullRequestURL: pullRequestURL,
+		},
+	}
+}
+
+func TestRetrievePullRequestConversationThreadsTheReviewComments(t *testing.T) {
+	withFakeGH(t,
+		fakeGHResponse{"repos/owner/repo/issues/7/comments", `[
+			{"id": 1, "user": {"id": 3, "login": "alice"}, "body": "second", "created_at": "2021-03-01T12:00:00Z", "updated_at": "2021-03-01T12:30:00Z"},
+			{"id": 2, "user": {"id": 4, "login": "bob"}, "body": "first", "created_at": "2021-03-01T10:00:00Z", "updated_at": "2021-03-01T10:00:00Z"}
+		]`},
+		fakeGHResponse{"repos/owner/repo/pulls/7/reviews", `[
+			{"id": 10, "user": {"id": 3, "login": "alice"}, "body": "looks good", "state": "APPROVED", "submitted_at": "2021-03-01T11:00:00Z"},
+			{"id": 11, "user": {"id": 4, "login": "bob"}, "body": "", "state": "COMMENTED", "submitted_at": "2021-03-01T11:30:00Z"},
+			{"id": 12, "user": {"id": 4, "login": "bob"}, "body": "not sent yet", "state": "PENDING"}
+		]`},
+		fakeGHResponse{"repos/owner/repo/pulls/7/comments", `[
+			{"id": 20, "user": {"id": 4, "login": "bob"}, "body": "rename this", "path": "b.go", "line": 12, "position": 3, "diff_hunk": "@@ -1 +1 @@", "created_at": "2021-03-01T11:30:00Z"},
+			{"id": 21, "user": {"id": 3, "login": "alice"}, "body": "old remark", "path": "b.go", "original_line": 4, "created_at": "2021-03-01T11:00:00Z"},
+			{"id": 22, "user": {"id": 2, "login": "author"}, "body": "done", "in_reply_to_id": 20, "created_at": "2021-03-01T13:00:00Z"},
+			{"id": 23, "user": {"id": 3, "login": "alice"}, "body": "typo", "path": "a.go", "line": 30, "position": 8, "created_at": "2021-03-01T11:10:00Z"}
+		]`},
+		// The second page of the review threads is asked for with the cursor the first one ended at
+		fakeGHResponse{"after=cursor", `{"data": {"repository": {"pullRequest": {"reviewThreads": {
+			"nodes": [{"isResolved": true, "isOutdated": false, "comments": {"nodes": [{"databaseId": 20}]}}],
+			"pageInfo": {"hasNextPage": false, "endCursor": ""}
+		}}}}}`},
+		fakeGHResponse{"graphql", `{"data": {"repository": {"pullRequest": {"reviewThreads": {
+			"nodes": [{"isResolved": false, "isOutdated": true, "comments": {"nodes": [{"databaseId": 23}]}}],
+			"pageInfo": {"hasNextPage": true, "endCursor": "cursor"}
+		}}}}}`},
+	)
+	ghm := newTestMonitor(t)
+
+	conversation, err := ghm.RetrievePullRequestConversation(newConversationPullRequestWrapper(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Comments and reviews with a body in the order they were written, pending reviews are not visible yet
+	bodies := make([]string, 0)
+	for _, comment := range conversation.Comments {
+		bodies = append(bodies, comment.Body)
+	}
+	if strings.Join(bodies, ",") != "first,looks good,second" {
+		t.Errorf("comments %v, expected first, looks good and second", bodies)
+	}
+	if review := conversation.Comments[1]; review.Kind != PullRequestCommentKindReview || review.ReviewStatus != PullRequestReviewStatusApproved || review.User.Username != "alice" {
+		t.Errorf("unexpected review %+v", review)
+	}
+	if edited := conversation.Comments[2]; !edited.UpdatedAt.After(edited.CreatedAt) {
+		t.Errorf("the edit of %q is lost", edited.Body)
+	}
+
+	// Threads by file and line, with the replies in the thread of the comment they answer
+	if len(conversation.Threads) != 3 {
+		t.Fatalf("%d threads, expected 3", len(conversation.Threads))
+	}
+	tests := []struct {
+		path     string
+		line     uint32
+		comments int
+		resolved bool
+		outdated bool
+	}{
+		{"a.go", 30, 1, false, true},
+		{"b.go", 4, 1, false, true},
+		{"b.go", 12, 2, true, false},
+	}
+	for index, test := range tests {
+		thread := conversation.Threads[index]
+		if thread.Path != test.path || thread.Line != test.line || len(thread.Comments) != test.comments || thread.Resolved != test.resolved || thread.Outdated != test.outdated {
+			t.Errorf("thread %d is %s:%d with %d comments, resolved %v and outdated %v, expected %+v",
+				index, thread.Path, thread.Line, len(thread.Comments), thread.Resolved, thread.Outdated, test)
+		}
+	}
+	if reply := conversation.Threads[2].Comments[1]; reply.Body != "done" || reply.Kind != PullRequestCommentKindReviewComment {
+		t.Errorf("unexpected reply %+v", reply)
+	}
+	if lastActivity := conversation.Threads[2].LastActivity(); !lastActivity.Equal(time.Date(2021, 3, 1, 13, 0, 0, 0, time.UTC)) {
+		t.Errorf("last activity %s, expected the reply", lastActivity)
+	}
+}
+
+func TestRetrievePullRequestConversationWithoutThreadStates(t *testing.T) {
+	withFakeGH(t,
+		fakeGHResponse{"repos/owner/repo/issues/7/comments", `[]`},
+		fakeGHResponse{"repos/owner/repo/pulls/7/reviews", `[]`},
+		fakeGHResponse{"repos/owner/repo/pulls/7/comments", `[
+			{"id": 20, "user": {"id": 4, "login": "bob"}, "body": "rename this", "path": "b.go", "line": 12, "position": 3, "created_at": "2021-03-01T11:30:00Z"}
+		]`},
+	)
+	ghm := newTestMonitor(t)
+
+	// The resolved state is only missing when GraphQL fails, the threads are still shown
+	conversation, err := ghm.RetrievePullRequestConversation(newConversationPullRequestWrapper(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversation.Threads) != 1 || conversation.Threads[0].Resolved || conversation.Threads[0].Outdated {
+		t.Errorf("unexpected threads %+v", conversation.Threads)
+	}
+}
+
+func TestConversationActivityIsNewSinceTheLastView(t *testing.T) {
+
+	firstSeen := time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)
+	lastViewed := firstSeen.Add(2 * time.Hour)
+
+	viewedSinceTests := []struct {
+		name               string
+		pullRequestWrapper *PullRequestWrapper
+		viewedSince        time.Time
+	}{
+		{"never viewed", &PullRequestWrapper{FirstSeen: firstSeen}, time.Time{}},
+		{"seen before views were tracked", &PullRequestWrapper{FirstSeen: firstSeen, Seen: true}, firstSeen},
+		{"viewed", &PullRequestWrapper{FirstSeen: firstSeen, Seen: true, LastViewed: lastViewed}, lastViewed},
+	}
+	for _, test := range viewedSinceTests {
+		if viewedSince := ViewedSince(test.pullRequestWrapper); !viewedSince.Equal(test.viewedSince) {
+			t.Errorf("%s: viewed since %s, expected %s", test.name, viewedSince, test.viewedSince)
+		}
+	}
+
+	isNewSinceTests := []struct {
+		name        string
+		comment     *PullRequestComment
+		viewedSince time.Time
+		isNew       bool
+	}{
+		{"never viewed", &PullRequestComment{CreatedAt: firstSeen, UpdatedAt: firstSeen}, time.Time{}, true},
+		{"written before", &PullRequestComment{CreatedAt: firstSeen, UpdatedAt: firstSeen}, lastViewed, false},
+		{"edited after", &PullRequestComment{CreatedAt: firstSeen, UpdatedAt: lastViewed.Add(time.Minute)}, lastViewed, true},
+		{"written after", &PullRequestComment{CreatedAt: lastViewed.Add(time.Minute), UpdatedAt: lastViewed.Add(time.Minute)}, lastViewed, true},
+	}
+	for _, test := range isNewSinceTests {
+		if isNew := test.comment.IsNewSince(test.viewedSince); isNew != test.isNew {
+			t.Errorf("%s: new %v, expected %v", test.name, isNew, test.isNew)
+		}
+	}
+}
@@ -0,0 +1,482 @@
+package ghmon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const daemonSocketName = "ghmon.sock"
+
+// daemonClientHeader has to be on every API request, a web page cannot add it to a request without the daemon
+// agreeing to it first
+const daemonClientHeader = "X-Ghmon-Client"
+
+// Daemon owns fetching and scoring the pull requests and serves them over a local HTTP API, so that several frontends
+// can share one monitor.  Events of the monitor are streamed to clients as Server-Sent Events.
+type Daemon struct {
+	ghMon *GHMon
+
+	/* Copy of what the monitor reported, kept up to date from its events */
+	lock                      sync.RWMutex
+	pullRequestWrappers       map[uint32]*PullRequestWrapper
+	sortedPullRequestWrappers []*PullRequestWrapper
+
+	subscribersLock sync.Mutex
+	subscribers     map[chan *daemonEvent]bool
+}
+
+// daemonPullRequestNote is the body of a request setting the note and tags of a pull request
+type daemonPullRequestNote struct {
+	Text string   `json:"text"`
+	Tags []string `json:"tags"`
+}
+
+type daemonEvent struct {
+	name string
+	data []byte
+}
+
+func NewDaemon(ghMon *GHMon) *Daemon {
+	return &Daemon{
+		ghMon:                     ghMon,
+		pullRequestWrappers:       make(map[uint32]*PullRequestWrapper),
+		sortedPullRequestWrappers: make([]*PullRequestWrapper, 0),
+		subscribers:               make(map[chan *daemonEvent]bool),
+	}
+}
+
+// DaemonAddress is where the daemon listens - GHMON_DAEMON_ADDRESS or a unix socket in the configuration folder
+func (ghm *GHMon) DaemonAddress() string {
+	if ghm.configuration.DaemonAddress != "" {
+		return ghm.configuration.DaemonAddress
+	}
+	return "unix:" + filepath.Join(ghm.configPath, daemonSocketName)
+}
+
+// parseDaemonAddress splits an address into a network and an address for it, paths (optionally prefixed with
+// 'unix:') are unix sockets and anything else is a TCP host:port
+func parseDaemonAddress(address string) (string, string) {
+	if strings.HasPrefix(address, "unix:") {
+		return "unix", strings.TrimPrefix(address, "unix:")
+	}
+	if strings.Contains(address, "/") {
+		return "unix", address
+	}
+	return "tcp", address
+}
+
+// checkDaemonListenAddress refuses TCP addresses other interfaces can reach, the API is not authenticated and can
+// hide, snooze, refresh and purge pull requests
+func checkDaemonListenAddress(network string, address string) error {
+	if network != "tcp" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("the daemon only listens on unix sockets and loopback addresses (e.g. localhost:7777), not %s", address)
+}
+
+// Serve starts monitoring GitHub and serves the API until interrupted
+func (daemon *Daemon) Serve(address string) error {
+
+	ghMon := daemon.ghMon
+	network, networkAddress := parseDaemonAddress(address)
+	if err := checkDaemonListenAddress(network, networkAddress); err != nil {
+		return err
+	}
+
+	if network == "unix" {
+		// A socket left behind by a daemon that did not shut down cleanly is in the way
+		if connection, err := net.Dial(network, networkAddress); err == nil {
+			connection.Close()
+			return fmt.Errorf("a daemon is already listening on %s", address)
+		}
+		os.Remove(networkAddress)
+	}
+
+	listener, err := net.Listen(network, networkAddress)
+	if err != nil {
+		return err
+	}
+
+	// Serve what was stored straight away, the first refresh replaces it
+	sortedPullRequestWrappers, err := ghMon.LoadStoredPullRequests()
+	if err != nil {
+		ghMon.logger.Printf("Could not load stored pull requests: %s", err)
+	} else {
+		daemon.sortedPullRequestWrappers = sortedPullRequestWrappers
+	}
+	for _, pullRequestWrapper := range ghMon.GetPullRequestWrappers() {
+		daemon.pullRequestWrappers[pullRequestWrapper.Id] = pullRequestWrapper
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		// Ends the refresh running, so that no gh command is left behind
+		ghMon.Stop()
+		listener.Close()
+	}()
+
+	go daemon.pollEvents()
+	go ghMon.Initialize()
+
+	ghMon.logger.Printf("Daemon listening on %s", address)
+	err = http.Serve(listener, daemon.createHandler(network))
+
+	if network == "unix" {
+		os.Remove(networkAddress)
+	}
+	// Interrupting the daemon closes the listener, which is a clean shutdown
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+func (daemon *Daemon) pollEvents() {
+	for event := range daemon.ghMon.Events() {
+		switch event.eventType {
+		case Status:
+			daemon.publish("status", event.payload)
+		case PullRequestUpdated:
+			pullRequestWrapper := event.payload.(*PullRequestWrapper)
+			daemon.lock.Lock()
+			daemon.pullRequestWrappers[pullRequestWrapper.Id] = pullRequestWrapper
+			daemon.lock.Unlock()
+			daemon.publish("pull-request-updated", pullRequestWrapper)
+		case PullRequestDeleted:
+			pullRequestWrapper := event.payload.(*PullRequestWrapper)
+			daemon.lock.Lock()
+			delete(daemon.pullRequestWrappers, pullRequestWrapper.Id)
+			daemon.lock.Unlock()
+			daemon.publish("pull-request-deleted", pullRequestWrapper)
+		case PullRequestsUpdates:
+			pullRequestWrappers := event.payload.(PullRequestsUpdatesEvent).pullRequestWrappers
+			daemon.lock.Lock()
+			daemon.sortedPullRequestWrappers = pullRequestWrappers
+			for _, pullRequestWrapper := range pullRequestWrappers {
+				daemon.pullRequestWrappers[pullRequestWrapper.Id] = pullRequestWrapper
+			}
+			daemon.lock.Unlock()
+			daemon.publish("pull-requests", pullRequestWrappers)
+		}
+	}
+}
+
+// publish sends an event to every connected client, clients that cannot keep up miss events rather than holding up
+// the monitor
+func (daemon *Daemon) publish(name string, payload interface{}) {
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		daemon.ghMon.logger.Printf("Could not serialize %s event: %s", name, err)
+		return
+	}
+
+	daemon.subscribersLock.Lock()
+	defer daemon.subscribersLock.Unlock()
+	for subscriber := range daemon.subscribers {
+		select {
+		case subscriber <- &daemonEvent{name: name, data: data}:
+		default:
+			daemon.ghMon.logger.Printf("Dropping %s event for a slow client", name)
+		}
+	}
+}
+
+func (daemon *Daemon) subscribe() chan *daemonEvent {
+	subscriber := make(chan *daemonEvent, 64)
+	daemon.subscribersLock.Lock()
+	daemon.subscribers[subscriber] = true
+	daemon.subscribersLock.Unlock()
+	return subscriber
+}
+
+func (daemon *Daemon) unsubscribe(subscriber chan *daemonEvent) {
+	daemon.subscribersLock.Lock()
+	delete(daemon.subscribers, subscriber)
+	daemon.subscribersLock.Unlock()
+}
+
+func (daemon *Daemon) createHandler(network string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/user", daemon.handleUser)
+	mux.HandleFunc("/api/pull-requests", daemon.handlePullRequests)
+	mux.HandleFunc("/api/pull-requests/", daemon.handlePullRequest)
+	mux.HandleFunc("/api/refresh", daemon.handleRefresh)
+	mux.HandleFunc("/api/purge", daemon.handlePurge)
+	mux.HandleFunc("/api/events", daemon.handleEvents)
+	mux.Handle("/metrics", metrics)
+	return guardRequests(network, mux)
+}
+
+// guardRequests only lets through requests that a web page open in a browser cannot make.  Pages of other sites
+// send an Origin, pages on a name resolving to the loopback address (DNS rebinding) send their own name as the Host,
+// and neither can add the client header without the daemon allowing it.
+func guardRequests(network string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if network == "tcp" && !isLoopbackHost(request.Host) {
+			writeError(writer, http.StatusForbidden, "requests have to be addressed to localhost, not %s", request.Host)
+			return
+		}
+		if request.Header.Get("Origin") != "" {
+			writeError(writer, http.StatusForbidden, "requests from web pages are refused")
+			return
+		}
+		if strings.HasPrefix(request.URL.Path, "/api/") && request.Header.Get(daemonClientHeader) == "" {
+			writeError(writer, http.StatusForbidden, "requests need an %s header", daemonClientHeader)
+			return
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// isLoopbackHost reports whether the Host of a request names this machine by localhost or a loopback address
+func isLoopbackHost(host string) bool {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(value)
+}
+
+func writeError(writer http.ResponseWriter, status int, format string, arguments ...interface{}) {
+	writeJSON(writer, status, map[string]string{"error": fmt.Sprintf(format, arguments...)})
+}
+
+func allowMethods(writer http.ResponseWriter, request *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if request.Method == method {
+			return true
+		}
+	}
+	writer.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(writer, http.StatusMethodNotAllowed, "%s is not allowed", request.Method)
+	return false
+}
+
+func (daemon *Daemon) handleUser(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	user := daemon.ghMon.currentUser()
+	if user == nil {
+		writeError(writer, http.StatusServiceUnavailable, "the user has not been retrieved yet")
+		return
+	}
+	writeJSON(writer, http.StatusOK, user)
+}
+
+// handlePullRequests lists the pull requests in score order, hidden and snoozed ones are only included with ?all=true
+func (daemon *Daemon) handlePullRequests(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	daemon.lock.RLock()
+	defer daemon.lock.RUnlock()
+	if request.URL.Query().Get("all") == "true" {
+		writeJSON(writer, http.StatusOK, daemon.ghMon.sortPullRequestWrappers(daemon.pullRequestWrappers))
+		return
+	}
+	writeJSON(writer, http.StatusOK, daemon.sortedPullRequestWrappers)
+}
+
+// handlePullRequest serves /api/pull-requests/{id} and the actions below it
+func (daemon *Daemon) handlePullRequest(writer http.ResponseWriter, request *http.Request) {
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(request.URL.Path, "/api/pull-requests/"), "/"), "/")
+	id, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid pull request identifier %s", parts[0])
+		return
+	}
+
+	daemon.lock.RLock()
+	pullRequestWrapper, ok := daemon.pullRequestWrappers[uint32(id)]
+	daemon.lock.RUnlock()
+	if !ok {
+		writeError(writer, http.StatusNotFound, "no pull request %d", id)
+		return
+	}
+
+	ghMon := daemon.ghMon
+	action := ""
+	if len(parts) > 1 {
+		action = parts[1]
+	}
+
+	switch action {
+	case "":
+		if allowMethods(writer, request, http.MethodGet) {
+			writeJSON(writer, http.StatusOK, pullRequestWrapper)
+		}
+	case "score":
+		if allowMethods(writer, request, http.MethodGet) {
+			writeJSON(writer, http.StatusOK, pullRequestWrapper.Score)
+		}
+	case "history":
+		if !allowMethods(writer, request, http.MethodGet) {
+			return
+		}
+		history, err := ghMon.LoadPullRequestHistory(pullRequestWrapper.Id)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, "could not load the history of %d: %s", id, err)
+			return
+		}
+		writeJSON(writer, http.StatusOK, history)
+	case "hide":
+		if allowMethods(writer, request, http.MethodPost, http.MethodDelete) {
+			ghMon.HidePullRequest(pullRequestWrapper, request.Method == http.MethodPost)
+			writeJSON(writer, http.StatusOK, ghMon.GetPullRequestWrapper(pullRequestWrapper.Id))
+		}
+	case "snooze":
+		if !allowMethods(writer, request, http.MethodPost, http.MethodDelete) {
+			return
+		}
+		snoozedUntil := time.Time{}
+		if request.Method == http.MethodPost {
+			if snoozedUntil, err = parseSnoozedUntil(request, ghMon.SnoozeDuration()); err != nil {
+				writeError(writer, http.StatusBadRequest, "%s", err)
+				return
+			}
+		}
+		ghMon.SnoozePullRequest(pullRequestWrapper, snoozedUntil)
+		writeJSON(writer, http.StatusOK, ghMon.GetPullRequestWrapper(pullRequestWrapper.Id))
+	case "note":
+		if !allowMethods(writer, request, http.MethodPost, http.MethodDelete) {
+			return
+		}
+		var pullRequestNote daemonPullRequestNote
+		if request.Method == http.MethodPost {
+			if err = json.NewDecoder(http.MaxBytesReader(writer, request.Body, 1<<20)).Decode(&pullRequestNote); err != nil {
+				writeError(writer, http.StatusBadRequest, "invalid note: %s", err)
+				return
+			}
+		}
+		ghMon.UpdatePullRequestNote(pullRequestWrapper, pullRequestNote.Text, pullRequestNote.Tags)
+		writeJSON(writer, http.StatusOK, ghMon.GetPullRequestWrapper(pullRequestWrapper.Id))
+	case "seen":
+		if allowMethods(writer, request, http.MethodPost, http.MethodDelete) {
+			ghMon.UpdateSeen(pullRequestWrapper, request.Method == http.MethodPost)
+			writeJSON(writer, http.StatusOK, ghMon.GetPullRequestWrapper(pullRequestWrapper.Id))
+		}
+	case "viewed":
+		if !allowMethods(writer, request, http.MethodPost) {
+			return
+		}
+		lastViewed := time.Now()
+		if at := request.URL.Query().Get("at"); at != "" {
+			if lastViewed, err = time.Parse(time.RFC3339Nano, at); err != nil {
+				writeError(writer, http.StatusBadRequest, "invalid time %s", at)
+				return
+			}
+		}
+		ghMon.UpdateLastViewed(pullRequestWrapper, lastViewed)
+		writeJSON(writer, http.StatusOK, ghMon.GetPullRequestWrapper(pullRequestWrapper.Id))
+	case "refresh":
+		if allowMethods(writer, request, http.MethodPost) {
+			ghMon.RefreshPullRequest(pullRequestWrapper)
+			writeJSON(writer, http.StatusOK, ghMon.GetPullRequestWrapper(pullRequestWrapper.Id))
+		}
+	default:
+		writeError(writer, http.StatusNotFound, "unknown action %s", action)
+	}
+}
+
+// parseSnoozedUntil reads ?until=<RFC 3339 time> or ?for=<duration>, snoozing for the default duration otherwise
+func parseSnoozedUntil(request *http.Request, defaultDuration time.Duration) (time.Time, error) {
+	query := request.URL.Query()
+	if until := query.Get("until"); until != "" {
+		return time.Parse(time.RFC3339Nano, until)
+	}
+	duration := defaultDuration
+	if durationString := query.Get("for"); durationString != "" {
+		var err error
+		if duration, err = time.ParseDuration(durationString); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Now().Add(duration), nil
+}
+
+func (daemon *Daemon) handleRefresh(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodPost) {
+		return
+	}
+	go daemon.ghMon.RetrievePullRequests()
+	writeJSON(writer, http.StatusAccepted, map[string]string{"status": "refreshing"})
+}
+
+func (daemon *Daemon) handlePurge(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodPost) {
+		return
+	}
+	writeJSON(writer, http.StatusOK, map[string]int{"purged": daemon.ghMon.PurgeDeletedPullRequests()})
+}
+
+// handleEvents streams the events of the monitor until the client goes away
+func (daemon *Daemon) handleEvents(writer http.ResponseWriter, request *http.Request) {
+
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writeError(writer, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	subscriber := daemon.subscribe()
+	defer daemon.unsubscribe(subscriber)
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Comments keep idle connections from being dropped along the way
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(writer, ": keep-alive\n\n")
+		case event := <-subscriber:
+			fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", event.name, event.data)
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,337 @@
+package ghmon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DaemonClient talks to a running daemon, letting the UI show the pull requests the daemon monitors instead of
+// retrieving them itself
+type DaemonClient struct {
+	address    string
+	baseURL    string
+	httpClient *http.Client
+	/* The event stream stays open, so it cannot share the timeout of the other requests */
+	streamClient *http.Client
+	/* Cancelling it ends the requests to the daemon, the event stream included */
+	context context.Context
+}
+
+func NewDaemonClient(ctx context.Context, address string) *DaemonClient {
+
+	network, networkAddress := parseDaemonAddress(address)
+	baseURL := "http://" + networkAddress
+	transport := &http.Transport{}
+	if network == "unix" {
+		// The host is ignored when dialling the socket
+		baseURL = "http://ghmon"
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, networkAddress)
+		}
+	}
+
+	return &DaemonClient{
+		address:      address,
+		baseURL:      baseURL,
+		httpClient:   &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		streamClient: &http.Client{Transport: transport},
+		context:      ctx,
+	}
+}
+
+// UseDaemon makes the monitor follow the daemon at the given address rather than retrieving pull requests itself
+func (ghm *GHMon) UseDaemon(address string) {
+	ghm.daemonClient = NewDaemonClient(ghm.context, address)
+}
+
+// newRequest creates a request to the daemon, which only answers requests carrying the client header
+func (daemonClient *DaemonClient) newRequest(method string, requestURL string, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(daemonClient.context, method, requestURL, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set(daemonClientHeader, "ghmon")
+	return request, nil
+}
+
+func (daemonClient *DaemonClient) request(method string, path string, query url.Values, result interface{}) error {
+	return daemonClient.requestWithBody(method, path, query, nil, result)
+}
+
+// requestWithBody sends the payload as a JSON body, unless it is nil
+func (daemonClient *DaemonClient) requestWithBody(method string, path string, query url.Values, payload interface{}, result interface{}) error {
+
+	requestURL := daemonClient.baseURL + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+	var requestBody io.Reader
+	if payload != nil {
+		encodedPayload, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(encodedPayload)
+	}
+	request, err := daemonClient.newRequest(method, requestURL, requestBody)
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := daemonClient.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode >= 300 {
+		var errorResponse struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &errorResponse) == nil && errorResponse.Error != "" {
+			return fmt.Errorf("%s %s: %s", method, path, errorResponse.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, response.Status)
+	}
+	if result != nil {
+		return json.Unmarshal(body, result)
+	}
+	return nil
+}
+
+func (daemonClient *DaemonClient) pullRequestPath(id uint32, action string) string {
+	return fmt.Sprintf("/api/pull-requests/%d/%s", id, action)
+}
+
+func (daemonClient *DaemonClient) RetrieveUser() (*User, error) {
+	var user User
+	if err := daemonClient.request(http.MethodGet, "/api/user", nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (daemonClient *DaemonClient) RetrievePullRequestWrappers() ([]*PullRequestWrapper, error) {
+	pullRequestWrappers := make([]*PullRequestWrapper, 0)
+	if err := daemonClient.request(http.MethodGet, "/api/pull-requests", nil, &pullRequestWrappers); err != nil {
+		return nil, err
+	}
+	return pullRequestWrappers, nil
+}
+
+// RetrievePullRequests asks the daemon to refresh from GitHub, the result arrives as events
+func (daemonClient *DaemonClient) RetrievePullRequests() error {
+	return daemonClient.request(http.MethodPost, "/api/refresh", nil, nil)
+}
+
+func (daemonClient *DaemonClient) RefreshPullRequest(id uint32) error {
+	return daemonClient.request(http.MethodPost, daemonClient.pullRequestPath(id, "refresh"), nil, nil)
+}
+
+// RetrievePullRequestHistory returns nil when the daemon has not recorded anything for the pull request yet
+func (daemonClient *DaemonClient) RetrievePullRequestHistory(id uint32) (*PullRequestHistory, error) {
+	var history *PullRequestHistory
+	if err := daemonClient.request(http.MethodGet, daemonClient.pullRequestPath(id, "history"), nil, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func (daemonClient *DaemonClient) PurgeDeletedPullRequests() (int, error) {
+	var result struct {
+		Purged int `json:"purged"`
+	}
+	err := daemonClient.request(http.MethodPost, "/api/purge", nil, &result)
+	return result.Purged, err
+}
+
+func (daemonClient *DaemonClient) setOrClear(set bool, path string, query url.Values) error {
+	method := http.MethodDelete
+	if set {
+		method = http.MethodPost
+	}
+	return daemonClient.request(method, path, query, nil)
+}
+
+func (daemonClient *DaemonClient) UpdateSeen(id uint32, seen bool) error {
+	return daemonClient.setOrClear(seen, daemonClient.pullRequestPath(id, "seen"), nil)
+}
+
+func (daemonClient *DaemonClient) UpdateLastViewed(id uint32, lastViewed time.Time) error {
+	return daemonClient.request(http.MethodPost, daemonClient.pullRequestPath(id, "viewed"), url.Values{"at": {lastViewed.Format(time.RFC3339Nano)}}, nil)
+}
+
+func (daemonClient *DaemonClient) HidePullRequest(id uint32, hidden bool) error {
+	return daemonClient.setOrClear(hidden, daemonClient.pullRequestPath(id, "hide"), nil)
+}
+
+func (daemonClient *DaemonClient) SnoozePullRequest(id uint32, snoozedUntil time.Time) error {
+	return daemonClient.setOrClear(!snoozedUntil.IsZero(), daemonClient.pullRequestPath(id, "snooze"), url.Values{"until": {snoozedUntil.Format(time.RFC3339Nano)}})
+}
+
+func (daemonClient *DaemonClient) UpdatePullRequestNote(id uint32, note string, tags []string) error {
+	if note == "" && len(tags) == 0 {
+		return daemonClient.request(http.MethodDelete, daemonClient.pullRequestPath(id, "note"), nil, nil)
+	}
+	return daemonClient.requestWithBody(http.MethodPost, daemonClient.pullRequestPath(id, "note"), nil, daemonPullRequestNote{Text: note, Tags: tags}, nil)
+}
+
+// followEvents reads the event stream of the daemon, calling handleEvent for each event until the stream ends
+func (daemonClient *DaemonClient) followEvents(handleEvent func(name string, data []byte)) error {
+
+	request, err := daemonClient.newRequest(http.MethodGet, daemonClient.baseURL+"/api/events", nil)
+	if err != nil {
+		return err
+	}
+	response, err := daemonClient.streamClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET /api/events: %s", response.Status)
+	}
+
+	scanner := bufio.NewScanner(response.Body)
+	// Events carry the whole list of pull requests
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	name := ""
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if name != "" || data.Len() > 0 {
+				handleEvent(name, data.Bytes())
+			}
+			name = ""
+			data.Reset()
+		case strings.HasPrefix(line, ":"):
+			// Comment
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("the daemon closed the connection")
+}
+
+// followDaemon feeds the pull requests and events of the daemon to the UI, reconnecting whenever the connection is lost
+func (ghm *GHMon) followDaemon() {
+
+	daemonClient := ghm.daemonClient
+	for {
+		ghm.publish(Event{eventType: Status, payload: fmt.Sprintf("connecting to daemon at %s", daemonClient.address)})
+
+		err := ghm.synchronizeWithDaemon()
+		if err == nil {
+			err = daemonClient.followEvents(ghm.handleDaemonEvent)
+		}
+		if ghm.context.Err() != nil {
+			return
+		}
+
+		ghm.logger.Printf("Lost connection to daemon at %s: %s", daemonClient.address, err)
+		ghm.publish(Event{eventType: Status, payload: fmt.Sprintf("no connection to daemon at %s (%s), retrying", daemonClient.address, err)})
+		select {
+		case <-time.After(5 * time.Second):
+		case <-ghm.context.Done():
+			return
+		}
+	}
+}
+
+// synchronizeWithDaemon retrieves the user and the current list of pull requests from the daemon
+func (ghm *GHMon) synchronizeWithDaemon() error {
+
+	user, err := ghm.daemonClient.RetrieveUser()
+	if err != nil {
+		return err
+	}
+	ghm.setUser(user)
+	ghm.publish(Event{eventType: Status, payload: fmt.Sprintf("Running as %s via daemon at %s", user.Username, ghm.daemonClient.address)})
+
+	pullRequestWrappers, err := ghm.daemonClient.RetrievePullRequestWrappers()
+	if err != nil {
+		return err
+	}
+	ghm.handleDaemonPullRequests(pullRequestWrappers)
+	return nil
+}
+
+func (ghm *GHMon) handleDaemonPullRequests(pullRequestWrappers []*PullRequestWrapper) {
+	ghm.withState(func(state *monitorState) {
+		for _, pullRequestWrapper := range pullRequestWrappers {
+			ghm.acceptDaemonPullRequestWrapper(state, pullRequestWrapper)
+		}
+		metrics.updatePullRequests(pullRequestWrappers)
+		state.publish(Event{eventType: PullRequestsUpdates, payload: PullRequestsUpdatesEvent{pullRequestType: Reviewer, pullRequestWrappers: pullRequestWrappers}})
+	})
+}
+
+// acceptDaemonPullRequestWrapper takes a pull request from the daemon in place of the known one, scored here
+func (ghm *GHMon) acceptDaemonPullRequestWrapper(state *monitorState, pullRequestWrapper *PullRequestWrapper) {
+	ghm.scorePullRequestWrapper(state, pullRequestWrapper)
+	state.pullRequestWrappers[pullRequestWrapper.Id] = pullRequestWrapper
+	state.publish(Event{eventType: PullRequestUpdated, payload: pullRequestWrapper})
+}
+
+func (ghm *GHMon) handleDaemonEvent(name string, data []byte) {
+
+	var err error
+	switch name {
+	case "status":
+		var status string
+		if err = json.Unmarshal(data, &status); err == nil {
+			ghm.publish(Event{eventType: Status, payload: status})
+		}
+	case "pull-request-updated", "pull-request-deleted":
+		var pullRequestWrapper PullRequestWrapper
+		if err = json.Unmarshal(data, &pullRequestWrapper); err == nil {
+			ghm.withState(func(state *monitorState) {
+				if name == "pull-request-deleted" {
+					delete(state.pullRequestWrappers, pullRequestWrapper.Id)
+					state.publish(Event{eventType: PullRequestDeleted, payload: &pullRequestWrapper})
+				} else {
+					ghm.acceptDaemonPullRequestWrapper(state, &pullRequestWrapper)
+				}
+			})
+		}
+	case "pull-requests":
+		pullRequestWrappers := make([]*PullRequestWrapper, 0)
+		if err = json.Unmarshal(data, &pullRequestWrappers); err == nil {
+			ghm.handleDaemonPullRequests(pullRequestWrappers)
+		}
+	default:
+		ghm.logger.Printf("Ignoring unknown daemon event %s", name)
+	}
+	if err != nil {
+		ghm.logger.Printf("Could not parse daemon event %s: %s", name, err)
+	}
+}
@@ -0,0 +1,118 @@
+package ghmon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckDaemonListenAddressOnlyAllowsLocalAddresses(t *testing.T) {
+
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"/tmp/ghmon.sock", true},
+		{"unix:ghmon.sock", true},
+		{"localhost:7777", true},
+		{"127.0.0.1:7777", true},
+		{"[::1]:7777", true},
+		{":7777", false},
+		{"0.0.0.0:7777", false},
+		{"192.168.1.10:7777", false},
+		{"example.com:7777", false},
+	}
+
+	for _, test := range tests {
+		err := checkDaemonListenAddress(parseDaemonAddress(test.address))
+		if allowed := err == nil; allowed != test.allowed {
+			t.Errorf("%s allowed %v, expected %v (%v)", test.address, allowed, test.allowed, err)
+		}
+	}
+}
+
+func newTestDaemon(t *testing.T) (*Daemon, *GHMon) {
+	t.Helper()
+	ghm := newTestMonitor(t)
+	ghm.updatePullRequest(newRetrievedPullRequest(t, 1, "retrieved"))
+	daemon := NewDaemon(ghm)
+	daemon.pullRequestWrappers[1] = ghm.GetPullRequestWrapper(1)
+	return daemon, ghm
+}
+
+func TestDaemonRefusesRequestsWebPagesCanMake(t *testing.T) {
+
+	daemon, _ := newTestDaemon(t)
+
+	tests := []struct {
+		name    string
+		network string
+		method  string
+		target  string
+		header  map[string]string
+		status  int
+	}{
+		{"client", "tcp", http.MethodGet, "http://localhost:7777/api/user", map[string]string{daemonClientHeader: "test"}, http.StatusOK},
+		{"client on a loopback address", "tcp", http.MethodPost, "http://127.0.0.1:7777/api/pull-requests/1/seen", map[string]string{daemonClientHeader: "test"}, http.StatusOK},
+		{"client on a socket", "unix", http.MethodGet, "http://ghmon/api/pull-requests", map[string]string{daemonClientHeader: "test"}, http.StatusOK},
+		{"no client header", "tcp", http.MethodPost, "http://localhost:7777/api/refresh", nil, http.StatusForbidden},
+		{"no client header on a socket", "unix", http.MethodGet, "http://ghmon/api/user", nil, http.StatusForbidden},
+		{"web page", "tcp", http.MethodPost, "http://localhost:7777/api/pull-requests/1/hide", map[string]string{daemonClientHeader: "test", "Origin": "https://example.com"}, http.StatusForbidden},
+		{"rebound name", "tcp", http.MethodGet, "http://rebound.example.com:7777/api/pull-requests", map[string]string{daemonClientHeader: "test"}, http.StatusForbidden},
+		{"rebound name for the metrics", "tcp", http.MethodGet, "http://rebound.example.com:7777/metrics", nil, http.StatusForbidden},
+		{"metrics", "tcp", http.MethodGet, "http://localhost:7777/metrics", nil, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, test.target, nil)
+			for name, value := range test.header {
+				request.Header.Set(name, value)
+			}
+			recorder := httptest.NewRecorder()
+			daemon.createHandler(test.network).ServeHTTP(recorder, request)
+			if recorder.Code != test.status {
+				t.Errorf("answered %d, expected %d: %s", recorder.Code, test.status, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestDaemonClientSendsTheNoteAsJSON(t *testing.T) {
+
+	daemon, ghm := newTestDaemon(t)
+	server := httptest.NewServer(daemon.createHandler("tcp"))
+	t.Cleanup(server.Close)
+	daemonClient := NewDaemonClient(context.Background(), strings.TrimPrefix(server.URL, "http://"))
+
+	if _, err := daemonClient.RetrieveUser(); err != nil {
+		t.Fatal(err)
+	}
+
+	note := "check the migration & the backup?tags=ignored"
+	if err := daemonClient.UpdatePullRequestNote(1, note, []string{"later", "db, schema"}); err != nil {
+		t.Fatal(err)
+	}
+	pullRequestWrapper := ghm.GetPullRequestWrapper(1)
+	if pullRequestWrapper.Note != note || strings.Join(pullRequestWrapper.Tags, "|") != "later|db|schema" {
+		t.Errorf("stored note %q and tags %q", pullRequestWrapper.Note, pullRequestWrapper.Tags)
+	}
+
+	if err := daemonClient.UpdatePullRequestNote(1, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if pullRequestWrapper = ghm.GetPullRequestWrapper(1); pullRequestWrapper.HasNote() {
+		t.Errorf("note %q and tags %q were not cleared", pullRequestWrapper.Note, pullRequestWrapper.Tags)
+	}
+
+	// The note is no longer read from the URL
+	request := httptest.NewRequest(http.MethodPost, "http://localhost/api/pull-requests/1/note?text=from+the+url", nil)
+	request.Header.Set(daemonClientHeader, "test")
+	recorder := httptest.NewRecorder()
+	daemon.createHandler("tcp").ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusBadRequest || ghm.GetPullRequestWrapper(1).HasNote() {
+		t.Errorf("a note without a body answered %d and left %q", recorder.Code, ghm.GetPullRequestWrapper(1).Note)
+	}
+}
@@ -0,0 +1,337 @@
+package ghmon
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// PullRequestFilter is a parsed filter expression.  Expressions consist of free text terms, which are fuzzy matched
+// against the title, repository, author, labels, body, note and tags of a pull request, and structured conditions of
+// the form 'key:value' (e.g. 'repo:ghmon author:bob state:changes heat:>50 tag:infra').  Prefixing a term or condition with '-'
+// negates it.  All terms and conditions must match for a pull request to be included.
+type PullRequestFilter struct {
+	Expression string
+	terms      []*filterTerm
+	conditions []*filterCondition
+}
+
+type filterTerm struct {
+	text   string
+	negate bool
+}
+
+type filterCondition struct {
+	key      string
+	operator string
+	value    string
+	negate   bool
+}
+
+var filterKeys = map[string]string{
+	"repo":       "repo",
+	"repository": "repo",
+	"author":     "author",
+	"user":       "author",
+	"label":      "label",
+	"state":      "state",
+	"heat":       "heat",
+	"score":      "heat",
+	"size":       "size",
+	"is":         "is",
+	"milestone":  "milestone",
+	"title":      "title",
+	"tag":        "tag",
+	"note":       "note",
+}
+
+func ParsePullRequestFilter(expression string) *PullRequestFilter {
+
+	filter := &PullRequestFilter{Expression: strings.TrimSpace(expression), terms: make([]*filterTerm, 0), conditions: make([]*filterCondition, 0)}
+
+	for _, token := range tokenizeFilterExpression(filter.Expression) {
+
+		negate := false
+		if strings.HasPrefix(token, "-") && len(token) > 1 {
+			negate = true
+			token = token[1:]
+		}
+
+		if index := strings.Index(token, ":"); index > 0 {
+			if key, ok := filterKeys[strings.ToLower(token[:index])]; ok {
+				operator, value := splitFilterOperator(token[index+1:])
+				filter.conditions = append(filter.conditions, &filterCondition{key: key, operator: operator, value: strings.ToLower(value), negate: negate})
+				continue
+			}
+		}
+
+		filter.terms = append(filter.terms, &filterTerm{text: strings.ToLower(token), negate: negate})
+	}
+
+	return filter
+}
+
+// tokenizeFilterExpression splits on whitespace while keeping double quoted sections (e.g. label:"needs review") together
+func tokenizeFilterExpression(expression string) []string {
+
+	tokens := make([]string, 0)
+	var current strings.Builder
+	inQuotes := false
+
+	for _, r := range expression {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case unicode.IsSpace(r) && !inQuotes:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+func splitFilterOperator(value string) (string, string) {
+	for _, operator := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, operator) {
+			return operator, value[len(operator):]
+		}
+	}
+	return "", value
+}
+
+func (filter *PullRequestFilter) IsEmpty() bool {
+	return filter == nil || (len(filter.terms) == 0 && len(filter.conditions) == 0)
+}
+
+func (filter *PullRequestFilter) Matches(pullRequestWrapper *PullRequestWrapper) bool {
+
+	if filter.IsEmpty() {
+		return true
+	}
+
+	for _, term := range filter.terms {
+		if filter.matchesTerm(term, pullRequestWrapper) == term.negate {
+			return false
+		}
+	}
+
+	for _, condition := range filter.conditions {
+		if filter.matchesCondition(condition, pullRequestWrapper) == condition.negate {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (filter *PullRequestFilter) Filter(pullRequestWrappers []*PullRequestWrapper) []*PullRequestWrapper {
+
+	if filter.IsEmpty() {
+		return pullRequestWrappers
+	}
+
+	filteredPullRequestWrappers := make([]*PullRequestWrapper, 0)
+	for _, pullRequestWrapper := range pullRequestWrappers {
+		if filter.Matches(pullRequestWrapper) {
+			filteredPullRequestWrappers = append(filteredPullRequestWrappers, pullRequestWrapper)
+		}
+	}
+	return filteredPullRequestWrappers
+}
+
+func (filter *PullRequestFilter) matchesTerm(term *filterTerm, pullRequestWrapper *PullRequestWrapper) bool {
+
+	pullRequest := pullRequestWrapper.PullRequest
+
+	candidates := []string{pullRequest.Title, pullRequest.Creator.Username}
+	if pullRequest.Repo != nil {
+		candidates = append(candidates, pullRequest.Repo.FullName)
+	}
+	for _, label := range pullRequest.Labels {
+		candidates = append(candidates, label.Name)
+	}
+	candidates = append(candidates, pullRequestWrapper.Tags...)
+	if pullRequestWrapper.Note != "" {
+		candidates = append(candidates, pullRequestWrapper.Note)
+	}
+
+	for _, candidate := range candidates {
+		if FuzzyMatch(term.text, candidate) {
+			return true
+		}
+	}
+
+	// The body is usually long enough to fuzzy match almost anything, only accept exact substrings there
+	return strings.Contains(strings.ToLower(pullRequest.Body), term.text)
+}
+
+func (filter *PullRequestFilter) matchesCondition(condition *filterCondition, pullRequestWrapper *PullRequestWrapper) bool {
+
+	pullRequest := pullRequestWrapper.PullRequest
+	score := pullRequestWrapper.Score
+
+	switch condition.key {
+	case "repo":
+		if pullRequest.Repo == nil {
+			return false
+		}
+		return FuzzyMatch(condition.value, pullRequest.Repo.FullName)
+	case "author":
+		return FuzzyMatch(condition.value, pullRequest.Creator.Username)
+	case "title":
+		return strings.Contains(strings.ToLower(pullRequest.Title), condition.value)
+	case "label":
+		for _, label := range pullRequest.Labels {
+			if strings.Contains(strings.ToLower(label.Name), condition.value) {
+				return true
+			}
+		}
+		return false
+	case "tag":
+		for _, tag := range pullRequestWrapper.Tags {
+			if strings.Contains(strings.ToLower(tag), condition.value) {
+				return true
+			}
+		}
+		return false
+	case "note":
+		return strings.Contains(strings.ToLower(pullRequestWrapper.Note), condition.value)
+	case "milestone":
+		if pullRequest.Milestone == nil {
+			return condition.value == "none"
+		}
+		return strings.Contains(strings.ToLower(pullRequest.Milestone.Title), condition.value)
+	case "heat":
+		threshold, err := strconv.ParseFloat(condition.value, 32)
+		if err != nil {
+			return false
+		}
+		return compareFilterValues(condition.operator, float64(score.Total), threshold)
+	case "size":
+		size := parsePullRequestSize(condition.value)
+		if size == PullRequestSizeUnknown {
+			return false
+		}
+		return compareFilterValues(condition.operator, float64(score.Size), float64(size))
+	case "state":
+		switch condition.value {
+		case "changes", "changes-requested", "blocked":
+			return hasPullRequestReviewStatus(PullRequestReviewStatusChangesRequested, pullRequestWrapper)
+		case "approved":
+			return isApprovedByAllReviewers(pullRequestWrapper)
+		case "commented":
+			return hasPullRequestReviewStatus(PullRequestReviewStatusCommented, pullRequestWrapper)
+		case "requested":
+			return hasPullRequestReviewStatus(PullRequestReviewStatusRequested, pullRequestWrapper)
+		case "pending":
+			return hasPullRequestReviewStatus(PullRequestReviewStatusPending, pullRequestWrapper)
+		case "dismissed":
+			return hasPullRequestReviewStatus(PullRequestReviewStatusDismissed, pullRequestWrapper)
+		case "deleted":
+			return pullRequestWrapper.Deleted
+		}
+		return false
+	case "is":
+		switch condition.value {
+		case "own", "mine":
+			return pullRequestWrapper.PullRequestType == Own
+		case "review", "reviewer":
+			return pullRequestWrapper.PullRequestType == Reviewer
+		case "seen":
+			return pullRequestWrapper.Seen
+		case "unseen", "new":
+			return !pullRequestWrapper.Seen
+		case "deleted":
+			return pullRequestWrapper.Deleted
+		case "noted":
+			return pullRequestWrapper.Note != ""
+		case "tagged":
+			return len(pullRequestWrapper.Tags) > 0
+		}
+		return false
+	}
+
+	return false
+}
+
+func compareFilterValues(operator string, value float64, threshold float64) bool {
+	switch operator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	default:
+		return value == threshold
+	}
+}
+
+func parsePullRequestSize(value string) PullRequestSize {
+	switch strings.ToLower(value) {
+	case "xs":
+		return PullRequestSizeXS
+	case "s":
+		return PullRequestSizeS
+	case "m":
+		return PullRequestSizeM
+	case "l":
+		return PullRequestSizeL
+	case "xl":
+		return PullRequestSizeXL
+	default:
+		return PullRequestSizeUnknown
+	}
+}
+
+// hasPullRequestReviewStatus reports whether a reviewer is currently at the status, going by their latest review only
+func hasPullRequestReviewStatus(pullRequestReviewStatus PullRequestReviewStatus, pullRequestWrapper *PullRequestWrapper) bool {
+	for _, pullRequestReviews := range pullRequestWrapper.PullRequest.PullRequestReviewsByUser {
+		if latestPullRequestReview := LatestPullRequestReview(pullRequestReviews); latestPullRequestReview != nil && latestPullRequestReview.Status == pullRequestReviewStatus {
+			return true
+		}
+	}
+	return false
+}
+
+// isApprovedByAllReviewers reports whether the latest review of every reviewer is an approval
+func isApprovedByAllReviewers(pullRequestWrapper *PullRequestWrapper) bool {
+	if len(pullRequestWrapper.PullRequest.PullRequestReviewsByUser) == 0 {
+		return false
+	}
+	for _, pullRequestReviews := range pullRequestWrapper.PullRequest.PullRequestReviewsByUser {
+		if latestPullRequestReview := LatestPullRequestReview(pullRequestReviews); latestPullRequestReview == nil || latestPullRequestReview.Status != PullRequestReviewStatusApproved {
+			return false
+		}
+	}
+	return true
+}
+
+// FuzzyMatch reports whether all characters of pattern appear in text in the same order (case-insensitive)
+func FuzzyMatch(pattern string, text string) bool {
+
+	if pattern == "" {
+		return true
+	}
+
+	patternRunes := []rune(strings.ToLower(pattern))
+	index := 0
+	for _, r := range strings.ToLower(text) {
+		if r == patternRunes[index] {
+			index++
+			if index == len(patternRunes) {
+				return true
+			}
+		}
+	}
+	return false
+}
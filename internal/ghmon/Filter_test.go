@@ -0,0 +1,201 @@
+package ghmon
+
+import (
+	"testing"
+	"time"
+)
+
+func newReviewedPullRequestWrapper(pullRequestReviewsByUser map[uint32][]*PullRequestReview) *PullRequestWrapper {
+	return &PullRequestWrapper{
+		Id:          1,
+		PullRequest: &PullRequest{Id: 1, Creator: &User{Id: 1, Username: "author"}, PullRequestReviewsByUser: pullRequestReviewsByUser},
+	}
+}
+
+func TestStateFilterUsesTheLatestReviewOfEachReviewer(t *testing.T) {
+
+	reviewer := &User{Id: 2, Username: "reviewer"}
+	otherReviewer := &User{Id: 3, Username: "other"}
+	earlier := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+
+	approvedAfterChanges := newReviewedPullRequestWrapper(map[uint32][]*PullRequestReview{
+		reviewer.Id: {
+			{User: reviewer, Status: PullRequestReviewStatusChangesRequested, SubmittedAt: earlier},
+			{User: reviewer, Status: PullRequestReviewStatusApproved, SubmittedAt: later},
+		},
+	})
+	changesAfterApproval := newReviewedPullRequestWrapper(map[uint32][]*PullRequestReview{
+		reviewer.Id: {
+			{User: reviewer, Status: PullRequestReviewStatusApproved, SubmittedAt: earlier},
+			{User: reviewer, Status: PullRequestReviewStatusChangesRequested, SubmittedAt: later},
+		},
+	})
+	partlyApproved := newReviewedPullRequestWrapper(map[uint32][]*PullRequestReview{
+		reviewer.Id:      {{User: reviewer, Status: PullRequestReviewStatusApproved, SubmittedAt: later}},
+		otherReviewer.Id: {{User: otherReviewer, Status: PullRequestReviewStatusCommented, SubmittedAt: later}},
+	})
+
+	tests := []struct {
+		name               string
+		expression         string
+		pullRequestWrapper *PullRequestWrapper
+		matches            bool
+	}{
+		{"approved after changes requested", "state:changes", approvedAfterChanges, false},
+		{"approved after changes requested", "state:approved", approvedAfterChanges, true},
+		{"changes requested after approval", "state:changes", changesAfterApproval, true},
+		{"changes requested after approval", "state:approved", changesAfterApproval, false},
+		{"approved by one of two reviewers", "state:approved", partlyApproved, false},
+		{"approved by one of two reviewers", "state:commented", partlyApproved, true},
+		{"no reviewers", "state:approved", newReviewedPullRequestWrapper(map[uint32][]*PullRequestReview{}), false},
+	}
+
+	for _, test := range tests {
+		if matches := ParsePullRequestFilter(test.expression).Matches(test.pullRequestWrapper); matches != test.matches {
+			t.Errorf("%s: %s matches %v, expected %v", test.name, test.expression, matches, test.matches)
+		}
+	}
+}
+
+func TestParsePullRequestFilter(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		terms      []filterTerm
+		conditions []filterCondition
+	}{
+		{"", nil, nil},
+		{"Fix Bug", []filterTerm{{text: "fix"}, {text: "bug"}}, nil},
+		{`"fix the bug" -wip`, []filterTerm{{text: "fix the bug"}, {text: "wip", negate: true}}, nil},
+		{"-", []filterTerm{{text: "-"}}, nil},
+		{"repository:ghmon user:Bob", nil, []filterCondition{{key: "repo", value: "ghmon"}, {key: "author", value: "bob"}}},
+		{`label:"needs review" -milestone:none`, nil, []filterCondition{{key: "label", value: "needs review"}, {key: "milestone", value: "none", negate: true}}},
+		{"score:>=50 heat:<10 size:xl", nil, []filterCondition{{key: "heat", operator: ">=", value: "50"}, {key: "heat", operator: "<", value: "10"}, {key: "size", value: "xl"}}},
+		{"is:own unknown:value", []filterTerm{{text: "unknown:value"}}, []filterCondition{{key: "is", value: "own"}}},
+	}
+
+	for _, test := range tests {
+		filter := ParsePullRequestFilter(test.expression)
+		if filter.IsEmpty() != (len(test.terms) == 0 && len(test.conditions) == 0) {
+			t.Errorf("%q: empty is %v", test.expression, filter.IsEmpty())
+		}
+		if len(filter.terms) != len(test.terms) {
+			t.Errorf("%q: %d terms, expected %d", test.expression, len(filter.terms), len(test.terms))
+			continue
+		}
+		for index, term := range filter.terms {
+			if *term != test.terms[index] {
+				t.Errorf("%q: term %d is %+v, expected %+v", test.expression, index, *term, test.terms[index])
+			}
+		}
+		if len(filter.conditions) != len(test.conditions) {
+			t.Errorf("%q: %d conditions, expected %d", test.expression, len(filter.conditions), len(test.conditions))
+			continue
+		}
+		for index, condition := range filter.conditions {
+			if *condition != test.conditions[index] {
+				t.Errorf("%q: condition %d is %+v, expected %+v", test.expression, index, *condition, test.conditions[index])
+			}
+		}
+	}
+}
+
+func TestPullRequestFilterMatches(t *testing.T) {
+
+	pullRequestWrapper := &PullRequestWrapper{
+		Id: 1,
+		PullRequest: &PullRequest{
+			Id:        1,
+			Title:     "Refactor the event loop",
+			Body:      "The loop no longer blocks while the pull requests are retrieved",
+			Repo:      &Repo{Name: "ghmon", FullName: "nahojkap/ghmon"},
+			Creator:   &User{Id: 2, Username: "bob"},
+			Labels:    []*Label{{Name: "Needs Review"}, {Name: "backend"}},
+			Milestone: &Milestone{Title: "Release 1.2"},
+		},
+		PullRequestType: Reviewer,
+		Score:           PullRequestScore{Total: 42, Size: PullRequestSizeM},
+		Note:            "check the locking",
+		Tags:            []string{"infra"},
+	}
+	unplanned := &PullRequestWrapper{
+		Id:              2,
+		PullRequest:     &PullRequest{Id: 2, Title: "Update the readme", Creator: &User{Id: 1, Username: "me"}},
+		PullRequestType: Own,
+		Seen:            true,
+	}
+
+	tests := []struct {
+		expression         string
+		pullRequestWrapper *PullRequestWrapper
+		matches            bool
+	}{
+		{"", pullRequestWrapper, true},
+		{"rfctr", pullRequestWrapper, true},
+		{"evnt lp", pullRequestWrapper, true},
+		{"ltor", pullRequestWrapper, false},
+		{`"the event loop"`, pullRequestWrapper, true},
+		{`"loop the event"`, pullRequestWrapper, false},
+		{"-refactor", pullRequestWrapper, false},
+		{"-readme", pullRequestWrapper, true},
+		{"nahojkap", pullRequestWrapper, true},
+		{"bob", pullRequestWrapper, true},
+		{"backend", pullRequestWrapper, true},
+		{"locking", pullRequestWrapper, true},
+		{"infra", pullRequestWrapper, true},
+
+		// The body is matched as a substring only
+		{"retrieved", pullRequestWrapper, true},
+		{"lnger", pullRequestWrapper, false},
+		{`"no longer blocks"`, pullRequestWrapper, true},
+		{"rtrvd", pullRequestWrapper, false},
+
+		{"repo:ghmon", pullRequestWrapper, true},
+		{"repo:nhjkp/ghm", pullRequestWrapper, true},
+		{"repo:cli", pullRequestWrapper, false},
+		{"repo:ghmon", unplanned, false},
+		{"author:bb", pullRequestWrapper, true},
+		{"-author:bob", pullRequestWrapper, false},
+		{`label:"needs review"`, pullRequestWrapper, true},
+		{"label:review", pullRequestWrapper, true},
+		{"label:frontend", pullRequestWrapper, false},
+		{"label:backend", unplanned, false},
+		{"milestone:1.2", pullRequestWrapper, true},
+		{"milestone:none", pullRequestWrapper, false},
+		{"milestone:none", unplanned, true},
+		{"heat:42", pullRequestWrapper, true},
+		{"heat:>40", pullRequestWrapper, true},
+		{"heat:>=42", pullRequestWrapper, true},
+		{"heat:<42", pullRequestWrapper, false},
+		{"heat:<=41", pullRequestWrapper, false},
+		{"heat:hot", pullRequestWrapper, false},
+		{"size:m", pullRequestWrapper, true},
+		{"size:<l", pullRequestWrapper, true},
+		{"size:>m", pullRequestWrapper, false},
+		{"size:huge", pullRequestWrapper, false},
+		{"is:review", pullRequestWrapper, true},
+		{"is:own", pullRequestWrapper, false},
+		{"is:own", unplanned, true},
+		{"is:unseen", pullRequestWrapper, true},
+		{"is:seen", unplanned, true},
+		{"is:noted", pullRequestWrapper, true},
+		{"is:tagged", unplanned, false},
+		{"is:deleted", pullRequestWrapper, false},
+		{"is:anything", pullRequestWrapper, false},
+
+		{"repo:ghmon author:bob -is:own heat:>40 loop", pullRequestWrapper, true},
+		{"repo:ghmon author:bob -is:review", pullRequestWrapper, false},
+	}
+
+	for _, test := range tests {
+		if matches := ParsePullRequestFilter(test.expression).Matches(test.pullRequestWrapper); matches != test.matches {
+			t.Errorf("%q on %q matches %v, expected %v", test.expression, test.pullRequestWrapper.PullRequest.Title, matches, test.matches)
+		}
+	}
+
+	filtered := ParsePullRequestFilter("is:own").Filter([]*PullRequestWrapper{pullRequestWrapper, unplanned})
+	if len(filtered) != 1 || filtered[0] != unplanned {
+		t.Errorf("is:own filtered %v, expected only the own pull request", filtered)
+	}
+}
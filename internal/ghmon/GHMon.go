@@ -1,17 +1,20 @@
 package ghmon
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/kirsle/configdir"
-	"io/ioutil"
 	"log"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -20,21 +23,45 @@ type Configuration struct {
 	OwnQuery string `split_words:"true"`
 	ReviewQuery string `split_words:"true"`
 	RefreshInterval time.Duration `default:"15m" split_words:"true"`
+	PreferSmallPullRequests bool `default:"false" split_words:"true"`
+	LabelFilter []string `split_words:"true"`
+	BoostLabels []string `default:"urgent,hotfix" split_words:"true"`
+	PenaltyLabels []string `default:"wip" split_words:"true"`
+	BoostTags []string `default:"urgent" split_words:"true"`
+	PenaltyTags []string `default:"later,waiting" split_words:"true"`
+	RepoPaths map[string]string `split_words:"true"`
+	WorktreeFolder string `split_words:"true"`
+	CheckoutMode string `default:"worktree" split_words:"true"`
+	CheckoutCommand string `split_words:"true"`
+	SnoozeDuration time.Duration `default:"24h" split_words:"true"`
+	DaemonAddress string `split_words:"true"`
+	StatusTemplate string `split_words:"true"`
+	MetricsAddress string `split_words:"true"`
+	Storage string `default:"files"`
+	HistoryRetention time.Duration `default:"2160h" split_words:"true"`
 }
 
 type GHMon struct {
 	configPath              string
-	cachedPullRequestFolder string
-	cachedRepoInformation   map[*url.URL]*Repo
-	user                    *User
-	pullRequestWrappers     map[uint32]*PullRequestWrapper
-	sortedPullRequestWrappers []*PullRequestWrapper
 	events                  chan Event
 	configuration           *Configuration
-	store                   *Storage
+	store                   Store
+	/* Held while this process is the one writing to the store */
+	storeLock               *StoreLock
+	storeLockError          error
+	/* Told to the user once the store is locked, e.g. that what was stored moved to the database */
+	storeNotice             string
 	logger                  *log.Logger
 	scoreCalculator			*ScoreCalculator
-	internalEvents			chan Event
+	/* Run one at a time by the goroutine owning the state, see runMonitorState */
+	stateCommands			chan *stateCommand
+	/* Handed out by the state to the store writer, see runStoreWriter */
+	storeWrites				chan func()
+	/* Cancelled by Stop, ending whatever is still being retrieved */
+	context					context.Context
+	stop					context.CancelFunc
+	/* Set when the pull requests come from a running daemon rather than from GitHub */
+	daemonClient *DaemonClient
 }
 
 type User struct {
@@ -62,10 +89,31 @@ type Repo struct {
 	FullName string
 	Description string
 	Url *url.URL
+	AllowMergeCommit    bool
+	AllowSquashMerge    bool
+	AllowRebaseMerge    bool
+	AllowAutoMerge      bool
+	DeleteBranchOnMerge bool
+}
+
+type Label struct {
+	Id          uint64
+	Name        string
+	Color       string
+	Description string
+}
+
+type Milestone struct {
+	Id     uint64
+	Number uint32
+	Title  string
+	State  string
+	DueOn  time.Time
 }
 
 type PullRequest struct {
 	Id                           uint32
+	Number                       uint32
 	Repo                         *Repo
 	Creator                      *User
 	Title                        string
@@ -77,7 +125,36 @@ type PullRequest struct {
 	PullRequestReviewsByUser     map[uint32][]*PullRequestReview
 	PullRequestReviewsByPriority [][]*PullRequestReview
 	PullRequestType              PullRequestType
-	Lock                         sync.Mutex
+	Additions                    uint32
+	Deletions                    uint32
+	ChangedFiles                 uint32
+	Commits                      uint32
+	Labels                       []*Label
+	Milestone                    *Milestone
+	HeadSHA                      string
+	HeadRef                      string
+	HeadRepoFullName             string
+	BaseRef                      string
+	NodeId                       string
+	RequestedTeams               []string
+	Draft                        bool
+	MergeableState               string
+}
+
+type PullRequestFile struct {
+	Filename         string
+	PreviousFilename string
+	Status           string
+	Additions        uint32
+	Deletions        uint32
+	Patch            string
+}
+
+type PullRequestDiff struct {
+	Id          uint32
+	HeadSHA     string
+	RetrievedAt time.Time
+	Files       []*PullRequestFile
 }
 
 type PullRequestScore struct {
@@ -91,6 +168,11 @@ type PullRequestScore struct {
 	ChangesRequested uint
 	NumReviewers     uint
 	IsMyPullRequest  bool
+	Size             PullRequestSize
+	BoostedLabels    uint
+	PenalizedLabels  uint
+	BoostedTags      uint
+	PenalizedTags    uint
 }
 
 type PullRequestWrapper struct {
@@ -102,6 +184,18 @@ type PullRequestWrapper struct {
 	Score           PullRequestScore
 	PullRequest     *PullRequest
 	Deleted         bool
+	/* When the current user was first seen as a requested reviewer */
+	ReviewRequestedAt time.Time
+	/* When the user last looked at the pull request, activity after this is new */
+	LastViewed time.Time
+	/* Hidden pull requests are left out of the list until shown again */
+	Hidden bool
+	/* Snoozed pull requests are left out of the list until this time */
+	SnoozedUntil time.Time
+	/* Private note and local tags of the user, never sent to GitHub */
+	Note string
+	Tags []string
+	NoteUpdatedAt time.Time
 }
 
 type PullRequestReviewStatus int
@@ -115,6 +209,16 @@ const (
 	PullRequestReviewStatusDismissed
 )
 
+type PullRequestSize int
+const (
+	PullRequestSizeUnknown PullRequestSize = iota
+	PullRequestSizeXS
+	PullRequestSizeS
+	PullRequestSizeM
+	PullRequestSizeL
+	PullRequestSizeXL
+)
+
 type EventType int
 
 const (
@@ -129,6 +233,8 @@ const (
 type PullRequestsUpdatesEvent struct {
 	pullRequestType     PullRequestType
 	pullRequestWrappers []*PullRequestWrapper
+	/* Why the refresh sending it did not retrieve everything */
+	refreshError        error
 }
 
 type Event struct {
@@ -150,12 +256,6 @@ func NewGHMon() *GHMon {
 		panic(err)
 	}
 
-	cachedPullRequestFolder := filepath.Join(configPath, "pull-requests")
-	err = configdir.MakePath(cachedPullRequestFolder)
-	if err != nil {
-		panic(err)
-	}
-
 	logDirectory := filepath.Join(configPath,"logs")
 	err = configdir.MakePath(logDirectory)
 	if err != nil {
@@ -173,53 +273,39 @@ func NewGHMon() *GHMon {
 	logger.Printf("Initializing GHMon")
 	logger.Printf("Refresh Interval: %s", configuration.RefreshInterval)
 
+	store, err := newStore(&configuration, configPath, logger)
+	if err != nil {
+		logger.Printf("Could not open the store: %s", err)
+		log.Fatalf("Could not open the store: %s", err)
+	}
+
+	return newGHMon(&configuration, configPath, store, logger)
+}
+
+// newGHMon starts the monitor on the given store, what NewGHMon reads from the environment is given
+func newGHMon(configuration *Configuration, configPath string, store Store, logger *log.Logger) *GHMon {
+
 	ghm := GHMon{
-		cachedRepoInformation: make(map[*url.URL]*Repo,0),
 		events : make(chan Event,5),
-		store: &Storage{
-			cachedPullRequestFolder: cachedPullRequestFolder,
-			logger: logger,
-		},
-		cachedPullRequestFolder: cachedPullRequestFolder,
+		store: store,
 		configPath: configPath,
 		logger : logger,
 		scoreCalculator: &ScoreCalculator{
 			logger: logger,
+			configuration: configuration,
 		},
-		configuration: &configuration,
-		internalEvents: make(chan Event, 5),
-		pullRequestWrappers: make(map[uint32]*PullRequestWrapper,0),
+		configuration: configuration,
+		stateCommands: make(chan *stateCommand),
+		storeWrites: make(chan func()),
 	}
+	ghm.context, ghm.stop = context.WithCancel(context.Background())
 
-	go ghm.processInternalEvents()
+	go ghm.runMonitorState()
+	go ghm.runStoreWriter()
 
 	return &ghm
 }
 
-func (ghm *GHMon) processInternalEvents()  {
-
-	for {
-		event := <- ghm.internalEvents
-		switch event.eventType {
-		case PullRequestRefreshStarted:
-			ghm.events <- Event{eventType: Status, payload: "fetching pull requests"}
-		case PullRequestRefreshFinished:
-			ghm.sortedPullRequestWrappers = ghm.sortPullRequestWrappers(ghm.pullRequestWrappers)
-			ghm.events <- Event{eventType: PullRequestsUpdates, payload: PullRequestsUpdatesEvent{pullRequestType: Reviewer, pullRequestWrappers: ghm.sortedPullRequestWrappers}}
-			ghm.events <- Event{eventType: Status, payload: "idle"}
-		case PullRequestDeleted:
-			ghm.events <- event
-		case PullRequestUpdated:
-			pullRequestWrapper := event.payload.(*PullRequestWrapper)
-			ghm.pullRequestWrappers[pullRequestWrapper.Id] = pullRequestWrapper
-			pullRequestWrapper.Score = ghm.scoreCalculator.CalculateScore(ghm.user, pullRequestWrapper)
-			ghm.events <- event
-		case PullRequestsUpdates:
-			ghm.events <- event
-		}
-	}
-}
-
 func (ghm *GHMon) Events() <-chan Event {
 	return ghm.events
 }
@@ -227,127 +313,317 @@ func (ghm *GHMon) Events() <-chan Event {
 func (ghm *GHMon) monitorGithub() {
 	for {
 		ghm.RetrievePullRequests()
-		time.Sleep(15 * time.Minute)
+		select {
+		case <-time.After(ghm.configuration.RefreshInterval):
+		case <-ghm.context.Done():
+			return
+		}
+	}
+}
+
+// Stop cancels whatever the monitor is retrieving, the gh commands still running are killed.  A refresh running and
+// the commands are given a moment to wind down, so that they are gone before the process exits.  The store is closed
+// once what was queued for it is written.
+func (ghm *GHMon) Stop() {
+	ghm.stop()
+	timeout := time.After(5 * time.Second)
+
+	var refreshFinished chan struct{}
+	ghm.withState(func(state *monitorState) {
+		refreshFinished = state.refreshFinished
+	})
+	if refreshFinished != nil {
+		select {
+		case <-refreshFinished:
+		case <-timeout:
+			ghm.logger.Printf("Stopping without waiting for the refresh running")
+			return
+		}
+	}
+
+	// What was queued for the store is written out, the refresh waited for its own writes already
+	storeWritten := make(chan struct{})
+	go func() {
+		ghm.writeStore(func() {})
+		close(storeWritten)
+	}()
+	select {
+	case <-storeWritten:
+		if err := ghm.store.Close(); err != nil {
+			ghm.logger.Printf("Could not close the store: %s", err)
+		}
+	case <-timeout:
+		ghm.logger.Printf("Stopping without waiting for the store writes queued")
+		return
+	}
+
+	// Cancelled commands are killed in the background, left running if the process exits first
+	commandsFinished := make(chan struct{})
+	go func() {
+		runningCommands.Wait()
+		close(commandsFinished)
+	}()
+	select {
+	case <-commandsFinished:
+	case <-timeout:
+		ghm.logger.Printf("Stopping without waiting for the gh commands running")
 	}
 }
 
 func (ghm *GHMon) Initialize() {
 
-	if ghm.IsLoggedIn() {
-		ghm.events <- Event{eventType: Status, payload: "logged in, retrieving user"}
+	if ghm.daemonClient != nil {
+		go ghm.followDaemon()
+		return
+	}
+
+	if ghm.configuration.MetricsAddress != "" {
+		go ghm.serveMetrics()
+	}
+
+	if err := ghm.CheckLoggedIn(); err != nil {
+		if ghm.context.Err() == nil {
+			ghm.reportStatus("%s", err)
+		}
+	} else {
+		ghm.publish(Event{eventType: Status, payload: "logged in, retrieving user"})
 		user := ghm.RetrieveUser()
-		ghm.events <- Event{eventType: Status, payload: fmt.Sprintf("Running as %s", user.Username)}
+		if user == nil {
+			return
+		}
+		if ghm.storeLockError != nil {
+			ghm.publish(Event{eventType: Status, payload: fmt.Sprintf("Running as %s, read-only: %s", user.Username, ghm.storeLockError)})
+		} else if ghm.storeNotice != "" {
+			ghm.publish(Event{eventType: Status, payload: fmt.Sprintf("Running as %s, %s", user.Username, ghm.storeNotice)})
+		} else {
+			ghm.publish(Event{eventType: Status, payload: fmt.Sprintf("Running as %s", user.Username)})
+		}
 		go ghm.monitorGithub()
 	}
 }
 
-func (ghm *GHMon) HasValidSetup() bool {
+// LockStore makes this process the one writing to the store, preparing the store for it.  Until then, or when
+// another process has the lock, the store is only read.
+func (ghm *GHMon) LockStore() error {
 
-	_,err := exec.LookPath("gh")
+	storeLock, err := acquireStoreLock(filepath.Join(ghm.configPath, "ghmon.lock"))
 	if err != nil {
-		log.Fatal("installing 'gh' is in your future ...")
-		return false
+		ghm.logger.Printf("Using the store read-only: %s", err)
+		ghm.storeLockError = err
+		return err
 	}
-	return true
+	ghm.storeLock = storeLock
+	ghm.storeLockError = nil
+
+	notice, err := ghm.store.makeWritable(filepath.Join(ghm.configPath, "backups"))
+	if err != nil {
+		ghm.logger.Printf("Could not prepare the store: %s", err)
+		return err
+	}
+	if notice != "" {
+		ghm.logger.Print(notice)
+		ghm.storeNotice = notice
+	}
+	return nil
 }
 
+// StoreNotice is what the user has to be told about the store having changed, empty when nothing did
+func (ghm *GHMon) StoreNotice() string {
+	return ghm.storeNotice
+}
 
-func makeAPIRequest(apiParams string) map[string]interface{} {
+// LockStoreOrAttach locks the store for the UI.  When another process has the lock, the UI follows it if it is a
+// daemon and only reads the store otherwise.
+func (ghm *GHMon) LockStoreOrAttach() {
 
-	cmd := exec.Command("gh","api", apiParams)
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		log.Fatal("Error getting stdout pipe", err)
+	err := ghm.LockStore()
+	if _, locked := err.(*StoreLockedError); !locked {
+		if err != nil {
+			log.Fatalf("Could not open the store: %s", err)
+		}
+		return
 	}
-	if err := cmd.Start(); err != nil {
-		log.Fatal("Error starting gh", err)
+
+	daemonClient := NewDaemonClient(ghm.context, ghm.DaemonAddress())
+	if _, err = daemonClient.RetrieveUser(); err == nil {
+		ghm.logger.Printf("Attaching to the daemon at %s", daemonClient.address)
+		ghm.daemonClient = daemonClient
 	}
+}
 
-	b, _ := ioutil.ReadAll(stdout)
+// CheckSetup tells why ghmon cannot go to GitHub, the commands only reading the stored pull requests do not need it
+func (ghm *GHMon) CheckSetup() error {
 
-	if err := cmd.Wait(); err != nil {
-		log.Printf("Error while waiting: %s", b)
-		log.Fatal("Error waiting for gh to complete",err)
+	_,err := exec.LookPath("gh")
+	if err != nil {
+		return fmt.Errorf("installing 'gh' is in your future ...")
 	}
+	return nil
+}
 
-	var result map[string]interface{}
 
-	err = json.Unmarshal(b, &result)
+// runningCommands counts the 'gh' commands running, so that stopping can wait for the cancelled ones to be killed
+var runningCommands sync.WaitGroup
+
+// makeAPIRequest runs 'gh api' for the given path and decodes the object it returns
+func makeAPIRequest(ctx context.Context, apiParams string) (map[string]interface{}, error) {
+
+	output, err := runAPIRequest(ctx, apiParams)
 	if err != nil {
-		log.Fatal("Error unmarshalling response", err)
+		return nil, err
 	}
-	return result
 
+	var result map[string]interface{}
+	if err = json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("gh api %s: %s", apiParams, err)
+	}
+	return result, nil
 }
 
-func MakeAPIRequestForArray(apiParams string) []interface{} {
-	cmd := exec.Command("gh","api", apiParams)
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		log.Fatal("Error getting stdout pipe", err)
+// runAPIRequest runs 'gh api' with the given arguments and returns the raw response, errors are returned rather than
+// being fatal so that interactive requests can report them
+func runAPIRequest(ctx context.Context, arguments ...string) ([]byte, error) {
+	runningCommands.Add(1)
+	defer runningCommands.Done()
+
+	cmd := exec.CommandContext(ctx, "gh", append([]string{"api"}, arguments...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
 	}
-	if err := cmd.Start(); err != nil {
-		log.Fatal("Error starting gh", err)
+	if arguments[0] == "graphql" {
+		metrics.countAPIRequest(apiKindGraphQL, err)
+	} else {
+		metrics.countAPIRequest(apiKindREST, err)
 	}
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = strings.TrimSpace(string(output))
+		}
+		return output, fmt.Errorf("gh api %s: %s (%w)", arguments[0], message, err)
+	}
+	return output, nil
+}
 
-	b, _ := ioutil.ReadAll(stdout)
+// retrieveAllPages retrieves every item of a paged GitHub list endpoint, 100 items at a time
+func retrieveAllPages(ctx context.Context, path string) ([]map[string]interface{}, error) {
 
-	if err := cmd.Wait(); err != nil {
-		log.Fatal("Error waiting for gh to complete",err)
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
 	}
 
-	var result []interface{}
-	if err = json.Unmarshal(b, &result); err != nil {
-		log.Fatal("Error unmarshalling response", err)
-	}
+	items := make([]map[string]interface{}, 0)
+	for page := 1; ; page++ {
 
-	return result
+		response, err := runAPIRequest(ctx, fmt.Sprintf("%s%sper_page=100&page=%d", path, separator, page))
+		if err != nil {
+			return nil, err
+		}
+
+		var pageItems []map[string]interface{}
+		if err = json.Unmarshal(response, &pageItems); err != nil {
+			return nil, err
+		}
+		items = append(items, pageItems...)
 
+		if len(pageItems) < 100 {
+			return items, nil
+		}
+	}
+}
+
+// runGraphQLRequest runs a GraphQL query or mutation, variables are given as 'name=value'
+func runGraphQLRequest(ctx context.Context, query string, variables ...string) ([]byte, error) {
+	arguments := []string{"graphql", "-f", "query=" + query}
+	for _, variable := range variables {
+		arguments = append(arguments, "-F", variable)
+	}
+	return runAPIRequest(ctx, arguments...)
 }
 
-func (ghm *GHMon)IsLoggedIn() bool {
+// MakeAPIRequestForArray is makeAPIRequest for endpoints returning a list
+func MakeAPIRequestForArray(ctx context.Context, apiParams string) ([]interface{}, error) {
 
-	ghm.logger.Println("Checking logged in status")
-	cmd := exec.Command("gh","auth", "status")
-	_, err := cmd.StderrPipe()
+	output, err := runAPIRequest(ctx, apiParams)
 	if err != nil {
-		log.Fatal("Error getting stdout pipe", err)
-	}
-	if err := cmd.Start(); err != nil {
-		log.Fatal("Error starting gh", err)
+		return nil, err
 	}
 
-	if err := cmd.Wait(); err != nil {
-		log.Fatal("Error waiting for gh to complete",err)
+	var result []interface{}
+	if err = json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("gh api %s: %s", apiParams, err)
 	}
+	return result, nil
+}
 
-	return true
+// CheckLoggedIn runs 'gh auth status', returning what gh printed when it is not logged in or could not be run
+func (ghm *GHMon) CheckLoggedIn() error {
+	runningCommands.Add(1)
+	defer runningCommands.Done()
+
+	ghm.logger.Println("Checking logged in status")
+	cmd := exec.CommandContext(ghm.context, "gh", "auth", "status")
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	if ghm.context.Err() != nil {
+		return ghm.context.Err()
+	}
+	if err != nil {
+		if message := strings.TrimSpace(output.String()); message != "" {
+			return fmt.Errorf("not logged in, run 'gh auth login': %s (%w)", message, err)
+		}
+		return fmt.Errorf("not logged in, run 'gh auth login' (%w)", err)
+	}
+	return nil
 }
 
+// RetrieveUser returns the logged in user, retrieving it the first time.  Returns nil once the monitor is stopped.
 func (ghm *GHMon) RetrieveUser() *User {
 
-	if ghm.user != nil {
-		return ghm.user
+	if user := ghm.currentUser(); user != nil {
+		return user
 	}
 
 	// Retrieve the current logged in user
-	result := makeAPIRequest("/user")
+	result, err := makeAPIRequest(ghm.context, "/user")
+	if err != nil {
+		if ghm.context.Err() == nil {
+			ghm.reportStatus("Could not retrieve the logged in user: %s", err)
+		}
+		return nil
+	}
 
-	ghm.user = &User{uint32(result["id"].(float64)), result["login"].(string)}
+	user := &User{uint32(result["id"].(float64)), result["login"].(string)}
+	ghm.setUser(user)
 
-	return ghm.user
+	return user
 
 
 }
 
-func (ghm *GHMon) getRepo(repoURL *url.URL) *Repo {
+func (ghm *GHMon) getRepo(ctx context.Context, repoURL *url.URL) (*Repo, error) {
 
-	if repo, ok := ghm.cachedRepoInformation[repoURL]; ok {
-		return repo
+	var cachedRepo *Repo
+	ghm.withState(func(state *monitorState) {
+		cachedRepo = state.repos[repoURL.String()]
+	})
+	if cachedRepo != nil {
+		return cachedRepo, nil
 	}
 
 	// Use the URL but strip out the https://api.github.com/ part
-	result := makeAPIRequest(repoURL.Path)
+	result, err := makeAPIRequest(ctx, repoURL.Path)
+	if err != nil {
+		return nil, err
+	}
 	id := uint32(result["id"].(float64))
 	name := result["name"].(string)
 	fullName := result["full_name"].(string)
@@ -359,40 +635,64 @@ func (ghm *GHMon) getRepo(repoURL *url.URL) *Repo {
 			repo.Description = description.(string)
 		}
 	}
-	ghm.cachedRepoInformation[repoURL] = &repo
-	return &repo
+
+	// The merge settings are only returned to users that can push, assume GitHub's defaults otherwise
+	extractSetting := func(name string, defaultValue bool) bool {
+		if value, ok := result[name].(bool); ok {
+			return value
+		}
+		return defaultValue
+	}
+	repo.AllowMergeCommit = extractSetting("allow_merge_commit", true)
+	repo.AllowSquashMerge = extractSetting("allow_squash_merge", true)
+	repo.AllowRebaseMerge = extractSetting("allow_rebase_merge", true)
+	repo.AllowAutoMerge = extractSetting("allow_auto_merge", false)
+	repo.DeleteBranchOnMerge = extractSetting("delete_branch_on_merge", false)
+
+	ghm.withState(func(state *monitorState) {
+		state.repos[repoURL.String()] = &repo
+	})
+	return &repo, nil
 
 }
 
 
-func (ghm *GHMon) parsePullRequestQueryResult(pullRequestType PullRequestType, result map[string]interface{}) {
+func (ghm *GHMon) parsePullRequestQueryResult(ctx context.Context, user *User, pullRequestType PullRequestType, result map[string]interface{}) {
 
 	pullRequestItems := result["items"].([]interface{})
 	count := len(pullRequestItems)
 
-	ghm.events <- Event{eventType: Status, payload: fmt.Sprintf("Fetched %d pull requests", count)}
+	ghm.publish(Event{eventType: Status, payload: fmt.Sprintf("Fetched %d pull requests", count)})
 
 	for _, pullRequestItem := range pullRequestItems {
 
+		if ctx.Err() != nil {
+			return
+		}
+
 		item := pullRequestItem.(map[string]interface{})
 		pullRequestId := uint32(item["id"].(float64))
 
-		ghm.events <- Event{eventType: Status, payload: fmt.Sprintf("processing pull request %d", pullRequestId)}
+		ghm.publish(Event{eventType: Status, payload: fmt.Sprintf("processing pull request %d", pullRequestId)})
 
-		user := item["user"].(map[string]interface{})
-		userID := uint32(user["id"].(float64))
+		creatorItem := item["user"].(map[string]interface{})
+		userID := uint32(creatorItem["id"].(float64))
 
-		if pullRequestType == Reviewer && userID == ghm.user.Id {
+		if pullRequestType == Reviewer && userID == user.Id {
 			ghm.logger.Printf("Filtering out %d from list of reviewer", pullRequestId)
 			continue
 		}
 
+		ghm.withState(func(state *monitorState) {
+			state.retrievedPullRequestIds[pullRequestId] = true
+		})
+
 		createdAt,_ := time.Parse(time.RFC3339, item["created_at"].(string))
 		updatedAt,_ := time.Parse(time.RFC3339, item["updated_at"].(string))
 
 		pullRequestObj := item["pull_request"].(map[string]interface{})
 
-		creator := &User{Id: userID ,Username: user["login"].(string)}
+		creator := &User{Id: userID ,Username: creatorItem["login"].(string)}
 
 		htmURLURL, err := url.Parse(item["html_url"].(string))
 		if err != nil {
@@ -408,7 +708,15 @@ func (ghm *GHMon) parsePullRequestQueryResult(pullRequestType PullRequestType, r
 		if err != nil {
 			log.Fatal("Could not parse repo url", err)
 		}
-		repo := ghm.getRepo(repoURLURL)
+		repo, err := ghm.getRepo(ctx, repoURLURL)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// Kept as it was, it is still on GitHub
+			ghm.reportStatus("Could not retrieve %s: %s", repoURLURL.Path, err)
+			continue
+		}
 
 		pullRequest := PullRequest {
 			Id: pullRequestId, Title: item["title"].(string), HtmlURL: htmURLURL, PullRequestURL: pullRequestURLURL,
@@ -420,42 +728,78 @@ func (ghm *GHMon) parsePullRequestQueryResult(pullRequestType PullRequestType, r
 				pullRequest.Body = body.(string)
 			}
 		}
+		pullRequest.Labels = ghm.parseLabels(item)
+		pullRequest.Milestone = ghm.parseMilestone(item)
 
-		currentPullRequestWrapper := ghm.getCurrentPullRequestWrapper(pullRequest.Id)
-		pullRequestWrapper := ghm.mergePullRequestWrappers(&pullRequest, currentPullRequestWrapper)
+		if err = ghm.addPullRequestReviewers(ctx, &pullRequest); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			ghm.reportStatus("Could not retrieve the reviews of %s: %s", pullRequest.Title, err)
+			continue
+		}
+		ghm.updatePullRequest(&pullRequest)
 
-		ghm.addPullRequestReviewers(pullRequestWrapper)
+	}
 
-		pullRequestWrapper.Score = ghm.scoreCalculator.CalculateScore(ghm.user, pullRequestWrapper)
+}
 
-		ghm.internalEvents <- Event{eventType: PullRequestUpdated,payload: pullRequestWrapper}
+func (ghm *GHMon) parseLabels(item map[string]interface{}) []*Label {
 
+	labels := make([]*Label, 0)
+	labelItems, ok := item["labels"].([]interface{})
+	if !ok {
+		return labels
 	}
 
+	for _, labelItem := range labelItems {
+		labelObj := labelItem.(map[string]interface{})
+		label := &Label{Id: uint64(labelObj["id"].(float64)), Name: labelObj["name"].(string)}
+		if color, ok := labelObj["color"].(string); ok {
+			label.Color = color
+		}
+		if description, ok := labelObj["description"].(string); ok {
+			label.Description = description
+		}
+		labels = append(labels, label)
+	}
+	return labels
 }
 
-func (ghm *GHMon) updatePullRequestScore(pullRequestWrapper *PullRequestWrapper) {
-	pullRequestWrapper.Score = ghm.scoreCalculator.CalculateScore(ghm.user, pullRequestWrapper)
-}
+func (ghm *GHMon) parseMilestone(item map[string]interface{}) *Milestone {
 
-func (ghm *GHMon) getCurrentPullRequestWrapper(pullRequestId uint32) *PullRequestWrapper {
+	milestoneObj, ok := item["milestone"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
 
-	for _, pullRequestWrapper := range ghm.pullRequestWrappers {
-		pullRequestWrapperInstance := pullRequestWrapper
-		if pullRequestWrapperInstance.Id == pullRequestId {
-			return pullRequestWrapperInstance
-		}
+	milestone := &Milestone{
+		Id: uint64(milestoneObj["id"].(float64)), Number: uint32(milestoneObj["number"].(float64)),
+		Title: milestoneObj["title"].(string), State: milestoneObj["state"].(string),
+	}
+	if dueOn, ok := milestoneObj["due_on"].(string); ok {
+		milestone.DueOn, _ = time.Parse(time.RFC3339, dueOn)
 	}
-	channel := ghm.store.LoadPullRequestWrapper(pullRequestId)
+	return milestone
+}
 
-	return <-channel
+// loadStoredPullRequestWrapper returns the pull request as stored, nil when it is not
+func (ghm *GHMon) loadStoredPullRequestWrapper(pullRequestId uint32) *PullRequestWrapper {
+
+	pullRequestWrapper, err := ghm.store.LoadPullRequestWrapper(pullRequestId)
+	if err != nil {
+		ghm.logger.Printf("Could not load pull request %d: %s", pullRequestId, err)
+	}
+	return pullRequestWrapper
 
 }
 
 func (ghm *GHMon) mergePullRequestWrappers(pullRequest *PullRequest, currentPullRequestWrapper *PullRequestWrapper) *PullRequestWrapper {
 	var pullRequestWrapper *PullRequestWrapper
 	if currentPullRequestWrapper != nil {
-		pullRequestWrapper = currentPullRequestWrapper
+		// A copy, the current version may still be read elsewhere
+		mergedPullRequestWrapper := *currentPullRequestWrapper
+		pullRequestWrapper = &mergedPullRequestWrapper
 		pullRequestWrapper.PullRequest = pullRequest
 		pullRequestWrapper.Deleted = false
 	} else {
@@ -491,22 +835,143 @@ func (ghm *GHMon) sortPullRequestWrappers(pullRequestWrappers map[uint32]*PullRe
 
 }
 
+// filterPullRequestWrappers leaves out hidden and snoozed pull requests and applies the configured label filter.  A
+// pull request is kept if it has at least one of the required labels (if any are configured) and none of the excluded
+// ones (prefixed with '-')
+func (ghm *GHMon) filterPullRequestWrappers(pullRequestWrappers []*PullRequestWrapper) []*PullRequestWrapper {
+
+	now := time.Now()
+	requiredLabels := make([]string, 0)
+	excludedLabels := make([]string, 0)
+	for _, labelFilter := range ghm.configuration.LabelFilter {
+		labelFilter = strings.TrimSpace(labelFilter)
+		if strings.HasPrefix(labelFilter, "-") {
+			excludedLabels = append(excludedLabels, labelFilter[1:])
+		} else if labelFilter != "" {
+			requiredLabels = append(requiredLabels, labelFilter)
+		}
+	}
+
+	filteredPullRequestWrappers := make([]*PullRequestWrapper, 0)
+	for _, pullRequestWrapper := range pullRequestWrappers {
+		if IsHiddenAt(pullRequestWrapper, now) {
+			continue
+		}
+		if len(requiredLabels) > 0 && !HasAnyLabel(pullRequestWrapper.PullRequest, requiredLabels) {
+			continue
+		}
+		if HasAnyLabel(pullRequestWrapper.PullRequest, excludedLabels) {
+			continue
+		}
+		filteredPullRequestWrappers = append(filteredPullRequestWrappers, pullRequestWrapper)
+	}
+	return filteredPullRequestWrappers
+}
+
+// IsHiddenAt reports whether the pull request is hidden or snoozed at the given time
+func IsHiddenAt(pullRequestWrapper *PullRequestWrapper, now time.Time) bool {
+	return pullRequestWrapper.Hidden || pullRequestWrapper.SnoozedUntil.After(now)
+}
+
+// getPullRequestState sums up where a pull request is, for the metrics and the index of the store
+func getPullRequestState(pullRequestWrapper *PullRequestWrapper) string {
+	score := pullRequestWrapper.Score
+	switch {
+	case pullRequestWrapper.Deleted:
+		return "deleted"
+	case score.ChangesRequested > 0:
+		return "changes_requested"
+	case score.Approvals > 0:
+		return "approved"
+	case score.Comments > 0:
+		return "commented"
+	default:
+		return "pending"
+	}
+}
+
+// HasAnyLabel reports whether the pull request carries any of the given label names (case-insensitive)
+func HasAnyLabel(pullRequest *PullRequest, labelNames []string) bool {
+	return CountLabels(pullRequest, labelNames) > 0
+}
+
+// CountLabels returns how many of the pull request labels are in the given list of names (case-insensitive)
+func CountLabels(pullRequest *PullRequest, labelNames []string) uint {
+	var count uint = 0
+	for _, label := range pullRequest.Labels {
+		for _, labelName := range labelNames {
+			if strings.EqualFold(label.Name, strings.TrimSpace(labelName)) {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// ParseTags splits a comma separated list of tags, leaving out empty and repeated (case-insensitive) ones
+func ParseTags(value string) []string {
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" && CountTags(tags, []string{tag}) == 0 {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// CountTags returns how many of the tags are in the given list of names (case-insensitive)
+func CountTags(tags []string, tagNames []string) uint {
+	var count uint = 0
+	for _, tag := range tags {
+		for _, tagName := range tagNames {
+			if strings.EqualFold(tag, strings.TrimSpace(tagName)) {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
 func (ghm *GHMon) RetrievePullRequests() {
 
+	if ghm.daemonClient != nil {
+		if err := ghm.daemonClient.RetrievePullRequests(); err != nil {
+			ghm.reportStatus("Could not ask the daemon to refresh: %s", err)
+		}
+		return
+	}
+
+	// A refresh asked for while one is running is left to the one running
+	ctx, started := ghm.startRefresh()
+	if !started {
+		return
+	}
+
+	user := ghm.RetrieveUser()
+	if user == nil {
+		ghm.finishRefresh(nil)
+		return
+	}
+
 	var retrieveAllPullRequestsWaitGroup sync.WaitGroup
 	retrieveAllPullRequestsWaitGroup.Add(2)
 
-	ghm.internalEvents <- Event{eventType: PullRequestRefreshStarted}
+	// One per query, each written by its own retrieval and read once all of them are done
+	queryErrors := make([]error, 3)
+
+	metrics.refreshStarted()
+
+	ghm.reportStatus("fetching pull requests")
 
 	retrieveMyPullRequests := func() {
 		if ghm.configuration.OwnQuery != "" {
 			// Need the set of PR that has been 'seen' by the user as well as those requested
-			result := makeAPIRequest("/search/issues?q=" + ghm.configuration.OwnQuery)
-			ghm.parsePullRequestQueryResult(Own, result)
+			queryErrors[0] = ghm.retrievePullRequestQuery(ctx, user, Own, ghm.configuration.OwnQuery)
 		} else {
 			// Need the set of PR that has been 'seen' by the user as well as those requested
-			result := makeAPIRequest("/search/issues?q=is:open+is:pr+author:@me+archived:false")
-			ghm.parsePullRequestQueryResult(Own, result)
+			queryErrors[0] = ghm.retrievePullRequestQuery(ctx, user, Own, "is:open+is:pr+author:@me+archived:false")
 		}
 		retrieveAllPullRequestsWaitGroup.Done()
 	}
@@ -514,8 +979,7 @@ func (ghm *GHMon) RetrievePullRequests() {
 	retrievePullRequests := func() {
 		if ghm.configuration.ReviewQuery != "" {
 			// Need the set of PR that has been 'seen' by the user as well as those requested
-			result := makeAPIRequest("/search/issues?q=" + ghm.configuration.ReviewQuery)
-			ghm.parsePullRequestQueryResult(Reviewer,result)
+			queryErrors[1] = ghm.retrievePullRequestQuery(ctx, user, Reviewer, ghm.configuration.ReviewQuery)
 		} else {
 
 			var waitGroup sync.WaitGroup
@@ -523,14 +987,12 @@ func (ghm *GHMon) RetrievePullRequests() {
 
 			retrieveRequestedPullRequests := func() {
 				// Need the set of PR that has been 'seen' by the user as well as those requested
-				result := makeAPIRequest("/search/issues?q=is:open+is:pr+review-requested:@me+archived:false")
-				ghm.parsePullRequestQueryResult(Reviewer,result)
+				queryErrors[1] = ghm.retrievePullRequestQuery(ctx, user, Reviewer, "is:open+is:pr+review-requested:@me+archived:false")
 				waitGroup.Done()
 			}
 
 			retrieveReviewedByPullRequests := func() {
-				result := makeAPIRequest("/search/issues?q=is:open+is:pr+reviewed-by:@me+archived:false")
-				ghm.parsePullRequestQueryResult(Reviewer, result)
+				queryErrors[2] = ghm.retrievePullRequestQuery(ctx, user, Reviewer, "is:open+is:pr+reviewed-by:@me+archived:false")
 				waitGroup.Done()
 			}
 
@@ -545,32 +1007,64 @@ func (ghm *GHMon) RetrievePullRequests() {
 
 	go retrieveMyPullRequests()
 	go retrievePullRequests()
-	go ghm.waitForRetrievalsToFinish(&retrieveAllPullRequestsWaitGroup)
+	go ghm.waitForRetrievalsToFinish(ctx, user, &retrieveAllPullRequestsWaitGroup, queryErrors)
 
 }
 
-func (ghm *GHMon) waitForRetrievalsToFinish(waitGroup *sync.WaitGroup) {
+// retrievePullRequestQuery searches for pull requests and takes in what it finds.  Returns an error when the search
+// failed, what it would have found is not known then.
+func (ghm *GHMon) retrievePullRequestQuery(ctx context.Context, user *User, pullRequestType PullRequestType, query string) error {
+	result, err := makeAPIRequest(ctx, "/search/issues?q=" + query)
+	if err != nil {
+		if ctx.Err() == nil {
+			ghm.reportStatus("Could not search for %s: %s", query, err)
+		}
+		return err
+	}
+	ghm.parsePullRequestQueryResult(ctx, user, pullRequestType, result)
+	return nil
+}
+
+func (ghm *GHMon) waitForRetrievalsToFinish(ctx context.Context, user *User, waitGroup *sync.WaitGroup, queryErrors []error) {
 
 	waitGroup.Wait()
+
+	// Pull requests not retrieved because the refresh was cancelled are not gone from GitHub
+	if ctx.Err() != nil {
+		ghm.finishRefresh(nil)
+		return
+	}
+
+	// Neither are those a failed search would have returned
+	for _, err := range queryErrors {
+		if err != nil {
+			ghm.finishRefresh(err)
+			return
+		}
+	}
+
 	waitGroup.Add(1)
 
 	// Now, we retrieve all saved pull requests & mark them Deleted if they are not in the list of PRs
 	retrieveSavedPullRequests := func() {
 
-		pullRequestIdentifiers, err := ghm.store.loadStoredPullRequestIdentifiers()
+		storedPullRequestWrappers, err := ghm.store.LoadPullRequestWrappers()
 		if err == nil {
-			ghm.logger.Printf("Loaded %d pull requests from disk", len(pullRequestIdentifiers))
-			for _, pullRequestIdentifier := range pullRequestIdentifiers {
-				channel := ghm.store.LoadPullRequestWrapper(pullRequestIdentifier)
-				pullRequestWrapper := <- channel
-				if pullRequestWrapper != nil {
-					if _, ok := ghm.pullRequestWrappers[pullRequestIdentifier]; !ok {
-						// Ok, the PR does not exist on GitHub, lets use the one loaded from
-						// disk and mark it deleted
-						pullRequestWrapper.Deleted = true
-						ghm.updatePullRequestScore(pullRequestWrapper)
-						ghm.internalEvents <- Event{eventType: PullRequestUpdated, payload: pullRequestWrapper}
+			ghm.logger.Printf("Loaded %d pull requests from disk", len(storedPullRequestWrappers))
+			for _, pullRequestWrapper := range storedPullRequestWrappers {
+				// The updates of the retrieved pull requests may not have been processed yet, so check what was
+				// retrieved rather than what is known
+				var retrieved bool
+				ghm.withState(func(state *monitorState) {
+					retrieved = state.retrievedPullRequestIds[pullRequestWrapper.Id]
+				})
+				if !retrieved {
+					// Ok, the PR does not exist on GitHub, lets use the one loaded from
+					// disk and mark it deleted
+					if !pullRequestWrapper.Deleted {
+						ghm.recordPullRequestClosed(ctx, user, pullRequestWrapper)
 					}
+					ghm.markPullRequestDeleted(pullRequestWrapper)
 				}
 			}
 		}
@@ -580,50 +1074,67 @@ func (ghm *GHMon) waitForRetrievalsToFinish(waitGroup *sync.WaitGroup) {
 	go retrieveSavedPullRequests()
 
 	waitGroup.Wait()
+	ghm.writeStore(ghm.expirePullRequestHistories)
 
-	ghm.internalEvents <- Event{eventType: PullRequestRefreshFinished}
+	ghm.finishRefresh(nil)
 }
 
-func (ghm *GHMon) addPullRequestReviewers(pullRequestWrapper *PullRequestWrapper) {
+// addPullRequestReviewers retrieves the details, review requests and reviews of a pull request that is not handed out
+// yet, such as one just retrieved or a copy of a known one.  Returns an error when the context is cancelled or gh
+// failed.
+func (ghm *GHMon) addPullRequestReviewers(ctx context.Context, pullRequest *PullRequest) error {
 
-	pullRequest := pullRequestWrapper.PullRequest
 	pullRequest.PullRequestReviewsByUser = make(map[uint32][]*PullRequestReview,0)
 
+	// Each retrieval collects its own reviews, they are added to the pull request once both are done
+	requestedPullRequestReviews := make([]*PullRequestReview, 0)
+	submittedPullRequestReviews := make([]*PullRequestReview, 0)
+
+	var requestedReviewersError, reviewsError error
+
 	var waitGroup sync.WaitGroup
 	waitGroup.Add(2)
 
 	ghm.logger.Printf("Adding reviewers to : %d/%s", pullRequest.Id, pullRequest.Title)
 
 	retrieveRequestedReviewers := func() {
+		defer waitGroup.Done()
+
 		// Use the pullRequest URL but strip out the https://api.github.com/ part
-		pullRequestResult := makeAPIRequest(pullRequest.PullRequestURL.Path)
+		pullRequestResult, err := makeAPIRequest(ctx, pullRequest.PullRequestURL.Path)
+		if err != nil {
+			requestedReviewersError = err
+			return
+		}
+		ghm.addPullRequestDetails(pullRequest, pullRequestResult)
+
 		requestedReviewers := pullRequestResult["requested_reviewers"].([]interface{})
 
 		for _, requestedReviewerItem := range requestedReviewers {
 			requestedReviewer := requestedReviewerItem.(map[string]interface{})
 			id := uint32(requestedReviewer["id"].(float64))
 
-			if pullRequestWrapper.PullRequest.Creator.Id == id {
-				ghm.logger.Printf("Filtering out review comments on own pull request for %d", pullRequestWrapper.Id)
+			if pullRequest.Creator.Id == id {
+				ghm.logger.Printf("Filtering out review comments on own pull request for %d", pullRequest.Id)
 				continue
 			}
 
 			user := &User{uint32(requestedReviewer["id"].(float64)), requestedReviewer["login"].(string)}
 
-			pullRequest.Lock.Lock()
-			if _, ok := pullRequest.PullRequestReviewsByUser[id]; !ok {
-				pullRequest.PullRequestReviewsByUser[id] = make([]*PullRequestReview,0)
-			}
 			pullRequestReview := &PullRequestReview{User: user,Status: PullRequestReviewStatusRequested}
-			ghm.logger.Printf("Adding review request: %s/%s", pullRequestReview.User.Username, pullRequestReview.Status)
-			pullRequest.PullRequestReviewsByUser[id] = append(pullRequest.PullRequestReviewsByUser[id],pullRequestReview)
-			pullRequest.Lock.Unlock()
+			ghm.logger.Printf("Adding review request: %s/%s", pullRequestReview.User.Username, ghm.ConvertPullRequestReviewStateToString(pullRequestReview.Status))
+			requestedPullRequestReviews = append(requestedPullRequestReviews, pullRequestReview)
 		}
-		waitGroup.Done()
 	}
 
 	retrieveReviews := func() {
-		pullRequestReviewResult := MakeAPIRequestForArray(pullRequest.PullRequestURL.Path + "/reviews")
+		defer waitGroup.Done()
+
+		pullRequestReviewResult, err := MakeAPIRequestForArray(ctx, pullRequest.PullRequestURL.Path + "/reviews")
+		if err != nil {
+			reviewsError = err
+			return
+		}
 		for _, reviewItem := range pullRequestReviewResult {
 
 			requestedReviewer := reviewItem.(map[string]interface{})
@@ -631,8 +1142,8 @@ func (ghm *GHMon) addPullRequestReviewers(pullRequestWrapper *PullRequestWrapper
 
 			id := uint32(user["id"].(float64))
 
-			if pullRequestWrapper.PullRequest.Creator.Id == id {
-				ghm.logger.Printf("Filtering out review comments on own pull request for %d", pullRequestWrapper.Id)
+			if pullRequest.Creator.Id == id {
+				ghm.logger.Printf("Filtering out review comments on own pull request for %d", pullRequest.Id)
 				continue
 			}
 
@@ -643,18 +1154,10 @@ func (ghm *GHMon) addPullRequestReviewers(pullRequestWrapper *PullRequestWrapper
 				pullRequestReview.SubmittedAt, _ = time.Parse(time.RFC3339, timeString)
 			}
 
-			pullRequest.Lock.Lock()
-			if _, ok := pullRequest.PullRequestReviewsByUser[id]; !ok {
-				ghm.logger.Printf("No existing items for %d, will add new list", id)
-				pullRequest.PullRequestReviewsByUser[id] = make([]*PullRequestReview, 0)
-			}
-			
-			ghm.logger.Printf("Adding review: %s/%s", pullRequestReview.User.Username, pullRequestReview.Status)
-			pullRequest.PullRequestReviewsByUser[id] = append(pullRequest.PullRequestReviewsByUser[id], &pullRequestReview)
-			pullRequest.Lock.Unlock()
+			ghm.logger.Printf("Adding review: %s/%s", pullRequestReview.User.Username, ghm.ConvertPullRequestReviewStateToString(pullRequestReview.Status))
+			submittedPullRequestReviews = append(submittedPullRequestReviews, &pullRequestReview)
 
 		}
-		waitGroup.Done()
 	}
 
 	go retrieveRequestedReviewers()
@@ -662,11 +1165,67 @@ func (ghm *GHMon) addPullRequestReviewers(pullRequestWrapper *PullRequestWrapper
 
 	waitGroup.Wait()
 
-	ghm.sortPullRequestReviewers(pullRequestWrapper)
-	ghm.updatePullRequestScore(pullRequestWrapper)
-	go ghm.store.StorePullRequestWrapper(pullRequestWrapper)
+	if requestedReviewersError != nil {
+		return requestedReviewersError
+	}
+	if reviewsError != nil {
+		return reviewsError
+	}
 
-	ghm.internalEvents <- Event{eventType: PullRequestUpdated, payload: pullRequestWrapper}
+	for _, pullRequestReview := range append(requestedPullRequestReviews, submittedPullRequestReviews...) {
+		id := pullRequestReview.User.Id
+		pullRequest.PullRequestReviewsByUser[id] = append(pullRequest.PullRequestReviewsByUser[id], pullRequestReview)
+	}
+	ghm.sortPullRequestReviewers(pullRequest)
+	return nil
+}
+
+func (ghm *GHMon) addPullRequestDetails(pullRequest *PullRequest, pullRequestResult map[string]interface{}) {
+
+	extractCount := func(name string) uint32 {
+		if count, ok := pullRequestResult[name].(float64); ok {
+			return uint32(count)
+		}
+		return 0
+	}
+
+	extractRef := func(name string) (string, string) {
+		if ref, ok := pullRequestResult[name].(map[string]interface{}); ok {
+			sha, _ := ref["sha"].(string)
+			refName, _ := ref["ref"].(string)
+			return sha, refName
+		}
+		return "", ""
+	}
+
+	pullRequest.Number = extractCount("number")
+	pullRequest.Additions = extractCount("additions")
+	pullRequest.Deletions = extractCount("deletions")
+	pullRequest.ChangedFiles = extractCount("changed_files")
+	pullRequest.Commits = extractCount("commits")
+	pullRequest.HeadSHA, pullRequest.HeadRef = extractRef("head")
+	_, pullRequest.BaseRef = extractRef("base")
+	pullRequest.HeadRepoFullName = ""
+	if head, ok := pullRequestResult["head"].(map[string]interface{}); ok {
+		if headRepo, ok := head["repo"].(map[string]interface{}); ok {
+			pullRequest.HeadRepoFullName, _ = headRepo["full_name"].(string)
+		}
+	}
+	pullRequest.NodeId, _ = pullRequestResult["node_id"].(string)
+	pullRequest.RequestedTeams = make([]string, 0)
+	if requestedTeams, ok := pullRequestResult["requested_teams"].([]interface{}); ok {
+		for _, requestedTeamItem := range requestedTeams {
+			if requestedTeam, ok := requestedTeamItem.(map[string]interface{}); ok {
+				if slug, ok := requestedTeam["slug"].(string); ok {
+					pullRequest.RequestedTeams = append(pullRequest.RequestedTeams, slug)
+				}
+			}
+		}
+	}
+	pullRequest.Draft, _ = pullRequestResult["draft"].(bool)
+	pullRequest.MergeableState, _ = pullRequestResult["mergeable_state"].(string)
+
+	ghm.logger.Printf("Pull request %d size: +%d/-%d in %d files, %d commits", pullRequest.Id, pullRequest.Additions, pullRequest.Deletions, pullRequest.ChangedFiles, pullRequest.Commits)
 }
 
 func (ghm *GHMon) ConvertToPullRequestReviewState(pullRequestReviewStatusString string) PullRequestReviewStatus {
@@ -684,7 +1243,7 @@ func (ghm *GHMon) ConvertToPullRequestReviewState(pullRequestReviewStatusString
 	case "DISMISSED":
 		return PullRequestReviewStatusDismissed
 	default:
-		ghm.logger.Print("Unknown pull request review state: %s", pullRequestReviewStatusString)
+		ghm.logger.Printf("Unknown pull request review state: %s", pullRequestReviewStatusString)
 		return PullRequestReviewStatusUnknown
 	}
 }
@@ -710,17 +1269,34 @@ func (ghm *GHMon) ConvertPullRequestReviewStateToString(pullRequestReviewStatus
 }
 
 
-func (ghm *GHMon) sortPullRequestReviewers(pullRequestWrapper *PullRequestWrapper) {
+func (ghm *GHMon) ConvertPullRequestSizeToString(pullRequestSize PullRequestSize) string {
+	switch pullRequestSize {
+	case PullRequestSizeXS:
+		return "XS"
+	case PullRequestSizeS:
+		return "S"
+	case PullRequestSizeM:
+		return "M"
+	case PullRequestSizeL:
+		return "L"
+	case PullRequestSizeXL:
+		return "XL"
+	default:
+		return "?"
+	}
+}
+
+func (ghm *GHMon) sortPullRequestReviewers(pullRequest *PullRequest) {
 
 	keys := make([]uint32,0)
-	for key := range pullRequestWrapper.PullRequest.PullRequestReviewsByUser {
+	for key := range pullRequest.PullRequestReviewsByUser {
 		keys = append(keys, key)
 	}
 
 	sort.Slice(keys, func(i, j int) bool {
 
-		left := ghm.scoreCalculator.ExtractMostImportantFirst(pullRequestWrapper.PullRequest.PullRequestReviewsByUser[keys[i]])
-		right := ghm.scoreCalculator.ExtractMostImportantFirst(pullRequestWrapper.PullRequest.PullRequestReviewsByUser[keys[j]])
+		left := ghm.scoreCalculator.ExtractMostImportantFirst(pullRequest.PullRequestReviewsByUser[keys[i]])
+		right := ghm.scoreCalculator.ExtractMostImportantFirst(pullRequest.PullRequestReviewsByUser[keys[j]])
 
 		rank := ghm.scoreCalculator.RankPullRequestReview(left,right)
 
@@ -733,37 +1309,317 @@ func (ghm *GHMon) sortPullRequestReviewers(pullRequestWrapper *PullRequestWrappe
 
 	sortedPullRequestReviews := make([][]*PullRequestReview, 0)
 	for _,key := range keys {
-		sortedPullRequestReviews = append(sortedPullRequestReviews, pullRequestWrapper.PullRequest.PullRequestReviewsByUser[key])
+		sortedPullRequestReviews = append(sortedPullRequestReviews, pullRequest.PullRequestReviewsByUser[key])
 	}
-	pullRequestWrapper.PullRequest.PullRequestReviewsByPriority = sortedPullRequestReviews
+	pullRequest.PullRequestReviewsByPriority = sortedPullRequestReviews
 
 }
 
+// copyPullRequest copies a pull request so that its reviews can be changed, the reviews themselves are shared
+func copyPullRequest(pullRequest *PullRequest) *PullRequest {
+	copiedPullRequest := *pullRequest
+	copiedPullRequest.PullRequestReviewsByUser = make(map[uint32][]*PullRequestReview, len(pullRequest.PullRequestReviewsByUser))
+	for id, pullRequestReviews := range pullRequest.PullRequestReviewsByUser {
+		copiedPullRequest.PullRequestReviewsByUser[id] = pullRequestReviews
+	}
+	return &copiedPullRequest
+}
+
 func (ghm *GHMon) Logger() *log.Logger {
 	return ghm.logger
 }
 
 func (ghm *GHMon) UpdateSeen(pullRequestWrapper *PullRequestWrapper, seen bool) {
-	pullRequestWrapper.Seen = seen
-	ghm.store.StorePullRequestWrapper(pullRequestWrapper)
+	if ghm.daemonClient != nil {
+		if err := ghm.daemonClient.UpdateSeen(pullRequestWrapper.Id, seen); err != nil {
+			ghm.logger.Printf("Could not update seen of %d on the daemon: %s", pullRequestWrapper.Id, err)
+		}
+		return
+	}
+	ghm.changePullRequestWrapper(pullRequestWrapper, func(pullRequestWrapper *PullRequestWrapper) {
+		pullRequestWrapper.Seen = seen
+		if seen && pullRequestWrapper.LastViewed.IsZero() {
+			pullRequestWrapper.LastViewed = time.Now()
+		}
+	})
+}
+
+func (ghm *GHMon) UpdateLastViewed(pullRequestWrapper *PullRequestWrapper, lastViewed time.Time) {
+	if ghm.daemonClient != nil {
+		if err := ghm.daemonClient.UpdateLastViewed(pullRequestWrapper.Id, lastViewed); err != nil {
+			ghm.logger.Printf("Could not update last viewed of %d on the daemon: %s", pullRequestWrapper.Id, err)
+		}
+		return
+	}
+	ghm.changePullRequestWrapper(pullRequestWrapper, func(pullRequestWrapper *PullRequestWrapper) {
+		pullRequestWrapper.LastViewed = lastViewed
+	})
+}
+
+// HidePullRequest leaves the pull request out of the list until it is shown again
+func (ghm *GHMon) HidePullRequest(pullRequestWrapper *PullRequestWrapper, hidden bool) error {
+	if ghm.daemonClient != nil {
+		return ghm.daemonClient.HidePullRequest(pullRequestWrapper.Id, hidden)
+	}
+	ghm.changePullRequestWrapper(pullRequestWrapper, func(pullRequestWrapper *PullRequestWrapper) {
+		pullRequestWrapper.Hidden = hidden
+	})
+	ghm.withState(func(state *monitorState) {
+		ghm.publishPullRequests(state)
+	})
+	return nil
+}
+
+// SnoozePullRequest leaves the pull request out of the list until the given time, a zero time wakes it up again
+func (ghm *GHMon) SnoozePullRequest(pullRequestWrapper *PullRequestWrapper, snoozedUntil time.Time) error {
+	if ghm.daemonClient != nil {
+		return ghm.daemonClient.SnoozePullRequest(pullRequestWrapper.Id, snoozedUntil)
+	}
+	ghm.changePullRequestWrapper(pullRequestWrapper, func(pullRequestWrapper *PullRequestWrapper) {
+		pullRequestWrapper.SnoozedUntil = snoozedUntil
+	})
+	ghm.withState(func(state *monitorState) {
+		ghm.publishPullRequests(state)
+	})
+	return nil
+}
+
+// UpdatePullRequestNote keeps a private note and local tags with the pull request, tags can change its score
+func (ghm *GHMon) UpdatePullRequestNote(pullRequestWrapper *PullRequestWrapper, note string, tags []string) error {
+	if ghm.daemonClient != nil {
+		return ghm.daemonClient.UpdatePullRequestNote(pullRequestWrapper.Id, note, tags)
+	}
+	ghm.changePullRequestWrapper(pullRequestWrapper, func(pullRequestWrapper *PullRequestWrapper) {
+		pullRequestWrapper.Note = strings.TrimSpace(note)
+		pullRequestWrapper.Tags = ParseTags(strings.Join(tags, ","))
+		pullRequestWrapper.NoteUpdatedAt = time.Now()
+	})
+	ghm.withState(func(state *monitorState) {
+		ghm.publishPullRequests(state)
+	})
+	return nil
+}
+
+// HasNote reports whether the user wrote a note or tagged the pull request
+func (pullRequestWrapper *PullRequestWrapper) HasNote() bool {
+	return pullRequestWrapper.Note != "" || len(pullRequestWrapper.Tags) > 0
+}
+
+// SnoozeDuration is how long pull requests are snoozed for by default
+func (ghm *GHMon) SnoozeDuration() time.Duration {
+	return ghm.configuration.SnoozeDuration
+}
+
+// RetrievePullRequestDiff returns the changed files of a pull request.  Diffs are cached by head commit so asking
+// again for an unchanged pull request does not hit GitHub.
+func (ghm *GHMon) RetrievePullRequestDiff(pullRequestWrapper *PullRequestWrapper) (*PullRequestDiff, error) {
+
+	pullRequest := pullRequestWrapper.PullRequest
+
+	if pullRequest.HeadSHA != "" {
+		if pullRequestDiff := ghm.store.LoadPullRequestDiff(pullRequest.Id, pullRequest.HeadSHA); pullRequestDiff != nil {
+			ghm.logger.Printf("Using cached diff for %d at %s", pullRequest.Id, pullRequest.HeadSHA)
+			return pullRequestDiff, nil
+		}
+	}
+
+	pullRequestDiff := &PullRequestDiff{Id: pullRequest.Id, HeadSHA: pullRequest.HeadSHA, RetrievedAt: time.Now(), Files: make([]*PullRequestFile, 0)}
+
+	fileItems, err := retrieveAllPages(ghm.context, pullRequest.PullRequestURL.Path + "/files")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fileItem := range fileItems {
+		file := &PullRequestFile{}
+		file.Filename, _ = fileItem["filename"].(string)
+		file.PreviousFilename, _ = fileItem["previous_filename"].(string)
+		file.Status, _ = fileItem["status"].(string)
+		file.Patch, _ = fileItem["patch"].(string)
+		if additions, ok := fileItem["additions"].(float64); ok {
+			file.Additions = uint32(additions)
+		}
+		if deletions, ok := fileItem["deletions"].(float64); ok {
+			file.Deletions = uint32(deletions)
+		}
+		pullRequestDiff.Files = append(pullRequestDiff.Files, file)
+	}
+
+	if pullRequestDiff.HeadSHA != "" {
+		ghm.withState(func(state *monitorState) {
+			state.queueStoreWrite(func() {
+				ghm.store.StorePullRequestDiff(pullRequestDiff)
+			})
+		})
+	}
+
+	return pullRequestDiff, nil
+}
+
+// LoadStoredPullRequests loads the pull requests kept from the last refresh without going to GitHub, scored and
+// sorted as they were then
+func (ghm *GHMon) LoadStoredPullRequests() ([]*PullRequestWrapper, error) {
+
+	storedPullRequestWrappers, err := ghm.store.LoadPullRequestWrappers()
+	if err != nil {
+		return nil, err
+	}
+
+	var sortedPullRequestWrappers []*PullRequestWrapper
+	ghm.withState(func(state *monitorState) {
+		for _, pullRequestWrapper := range storedPullRequestWrappers {
+			state.pullRequestWrappers[pullRequestWrapper.Id] = pullRequestWrapper
+		}
+		sortedPullRequestWrappers = ghm.filterPullRequestWrappers(ghm.sortPullRequestWrappers(state.pullRequestWrappers))
+	})
+	return sortedPullRequestWrappers, nil
+}
+
+// QueryStoredPullRequests loads the stored pull requests of a repository and/or in a state (see getPullRequestState)
+// through the indexes of the store, sorted by score
+func (ghm *GHMon) QueryStoredPullRequests(repositoryFullName string, state string) ([]*PullRequestWrapper, error) {
+
+	var matchingPullRequestWrappers map[uint32]*PullRequestWrapper
+	if repositoryFullName != "" {
+		pullRequestWrappers, err := ghm.store.LoadPullRequestWrappersByRepository(repositoryFullName)
+		if err != nil {
+			return nil, err
+		}
+		matchingPullRequestWrappers = make(map[uint32]*PullRequestWrapper)
+		for _, pullRequestWrapper := range pullRequestWrappers {
+			matchingPullRequestWrappers[pullRequestWrapper.Id] = pullRequestWrapper
+		}
+	}
+
+	if state != "" {
+		pullRequestWrappers, err := ghm.store.LoadPullRequestWrappersByState(state)
+		if err != nil {
+			return nil, err
+		}
+		pullRequestWrappersInState := make(map[uint32]*PullRequestWrapper)
+		for _, pullRequestWrapper := range pullRequestWrappers {
+			if _, ok := matchingPullRequestWrappers[pullRequestWrapper.Id]; ok || matchingPullRequestWrappers == nil {
+				pullRequestWrappersInState[pullRequestWrapper.Id] = pullRequestWrapper
+			}
+		}
+		matchingPullRequestWrappers = pullRequestWrappersInState
+	}
+
+	return ghm.sortPullRequestWrappers(matchingPullRequestWrappers), nil
+}
+
+// FindPullRequestWrapper looks up a known pull request by its identifier, 'owner/repo#number' or its URL
+func (ghm *GHMon) FindPullRequestWrapper(reference string) *PullRequestWrapper {
+
+	reference = strings.TrimSuffix(strings.TrimSpace(reference), "/")
+	for _, pullRequestWrapper := range ghm.GetPullRequestWrappers() {
+		pullRequest := pullRequestWrapper.PullRequest
+		if fmt.Sprint(pullRequestWrapper.Id) == reference {
+			return pullRequestWrapper
+		}
+		if pullRequest.Repo != nil && strings.EqualFold(fmt.Sprintf("%s#%d", pullRequest.Repo.FullName, pullRequest.Number), reference) {
+			return pullRequestWrapper
+		}
+		if pullRequest.HtmlURL != nil && pullRequest.HtmlURL.String() == reference {
+			return pullRequestWrapper
+		}
+	}
+	return nil
+}
+
+// OpenInBrowser opens the pull request on GitHub in the default browser
+func OpenInBrowser(pullRequestWrapper *PullRequestWrapper) error {
+
+	url := pullRequestWrapper.PullRequest.HtmlURL.String()
+
+	switch runtime.GOOS {
+	case "linux":
+		return exec.Command("xdg-open", url).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	case "darwin":
+		return exec.Command("open", url).Start()
+	default:
+		return fmt.Errorf("unsupported platform")
+	}
+}
+
+// StatusTemplate is the configured template of 'ghmon status', empty for the default
+func (ghm *GHMon) StatusTemplate() string {
+	return ghm.configuration.StatusTemplate
+}
+
+func (ghm *GHMon) LoadPreferences() *Preferences {
+	return ghm.store.LoadPreferences()
+}
+
+// StorePreferences returns once the preferences are written, by the store writer as everything else
+func (ghm *GHMon) StorePreferences(preferences *Preferences) {
+	ghm.writeStore(func() {
+		ghm.store.StorePreferences(preferences)
+	})
 }
 
 func (ghm *GHMon) PurgeDeletedPullRequests() int {
 
-	var pullRequestDeleted = 0
-	for _,pullRequestWrapper := range ghm.pullRequestWrappers {
-		if pullRequestWrapper.Deleted {
-			ghm.internalEvents <- Event{eventType: PullRequestDeleted, payload: pullRequestWrapper}
-			go ghm.store.DeletePullRequestWrapper(pullRequestWrapper.Id)
-			delete(ghm.pullRequestWrappers,pullRequestWrapper.Id)
-			pullRequestDeleted++
+	if ghm.daemonClient != nil {
+		purged, err := ghm.daemonClient.PurgeDeletedPullRequests()
+		if err != nil {
+			ghm.reportStatus("Could not ask the daemon to purge: %s", err)
+		}
+		return purged
+	}
+
+	deletedPullRequestIds := make([]uint32, 0)
+	ghm.withState(func(state *monitorState) {
+		for _,pullRequestWrapper := range state.pullRequestWrappers {
+			if pullRequestWrapper.Deleted {
+				deletedPullRequestIds = append(deletedPullRequestIds, pullRequestWrapper.Id)
+			}
 		}
+	})
+	if len(deletedPullRequestIds) == 0 {
+		return 0
 	}
 
-	if pullRequestDeleted > 0 {
-		sortedPullRequestWrappers := ghm.sortPullRequestWrappers(ghm.pullRequestWrappers)
-		ghm.internalEvents <- Event{eventType: PullRequestsUpdates, payload:PullRequestsUpdatesEvent{pullRequestType: Reviewer, pullRequestWrappers: sortedPullRequestWrappers} }
+	// Deleted by the store writer, after the writes of these pull requests queued so far
+	var purgedPullRequestIds []uint32
+	var err error
+	ghm.writeStore(func() {
+		purgedPullRequestIds, err = ghm.store.DeletePullRequestWrappers(deletedPullRequestIds)
+	})
+	if err != nil {
+		ghm.reportStatus("Could not purge %d of %d deleted pull requests: %s", len(deletedPullRequestIds)-len(purgedPullRequestIds), len(deletedPullRequestIds), err)
+	}
+	if len(purgedPullRequestIds) == 0 {
+		return 0
 	}
 
-	return pullRequestDeleted
+	// Only what the store deleted leaves the list, so the list never misses what is still stored
+	purged := 0
+	ghm.withState(func(state *monitorState) {
+		for _, pullRequestId := range purgedPullRequestIds {
+			pullRequestWrapper, ok := state.pullRequestWrappers[pullRequestId]
+			if !ok {
+				continue
+			}
+			if !pullRequestWrapper.Deleted {
+				// Retrieved again while it was purged, so it is stored again
+				state.queueStoreWrite(func() {
+					ghm.store.StorePullRequestWrapper(pullRequestWrapper)
+				})
+				continue
+			}
+			state.publish(Event{eventType: PullRequestDeleted, payload: pullRequestWrapper})
+			delete(state.pullRequestWrappers, pullRequestId)
+			if state.refreshWrites != nil {
+				// Marked deleted by the refresh running, it is not stored again when the refresh finishes
+				delete(state.refreshWrites.pullRequestWrappers, pullRequestId)
+			}
+			purged++
+		}
+		ghm.publishPullRequests(state)
+	})
+
+	return purged
 }
\ No newline at end of file
@@ -0,0 +1,706 @@
+package ghmon
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+/* Buckets of the database */
+var (
+	pullRequestsBucket = []byte("pull-requests")
+	diffsBucket        = []byte("diffs")
+	preferencesBucket  = []byte("preferences")
+	byRepositoryBucket = []byte("by-repository")
+	byStateBucket      = []byte("by-state")
+	metaBucket         = []byte("meta")
+	historyBucket      = []byte("history")
+	/* Records that could not be parsed, under the name of their bucket and their key */
+	quarantineBucket = []byte("quarantine")
+)
+
+var (
+	preferencesKey = []byte("preferences")
+	migratedKey    = []byte("migrated-from-files")
+)
+
+// How long to wait for the commands reading the database to let go of it
+const boltLockTimeout = 10 * time.Second
+
+// How long to wait to read the database, the ghmon writing to it holds it for as long as it runs
+const boltReadLockTimeout = time.Second
+
+// BoltStore keeps everything in a single bbolt database.  Pull requests are indexed by repository and by state, the
+// indexes are buckets of pull request keys kept up to date in the same transaction as the pull request itself.
+//
+// The database is opened once, read-only until makeWritable and for writing after, and stays open until Close.  bbolt
+// locks the file for as long as it is open, so the other ghmon processes cannot read it while one writes to it.
+type BoltStore struct {
+	logger *log.Logger
+	path   string
+	/* What previous versions kept, copied into the database the first time it is written */
+	legacyFileStore *FileStore
+	/* Guards opening and closing the database, the transactions do not need it */
+	lock     sync.Mutex
+	db       *bolt.DB
+	readOnly bool
+	closed   bool
+}
+
+// makeWritable creates the database, fills it from the legacy files the first time and migrates the pull requests
+// stored with an older schema, after a backup in the backups folder
+func (boltStore *BoltStore) makeWritable(backupFolder string) (string, error) {
+	boltStore.lock.Lock()
+	if boltStore.readOnly && boltStore.db != nil {
+		// Opened to read, which keeps it from being opened for writing
+		boltStore.db.Close()
+		boltStore.db = nil
+	}
+	boltStore.readOnly = false
+	boltStore.lock.Unlock()
+	err := boltStore.update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{pullRequestsBucket, diffsBucket, preferencesBucket, byRepositoryBucket, byStateBucket, metaBucket, historyBucket, quarantineBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not open %s: %s", boltStore.path, err)
+	}
+	notice, err := boltStore.MigrateFileStore(boltStore.legacyFileStore)
+	if err != nil {
+		return "", fmt.Errorf("could not migrate %s: %s", filepath.Dir(boltStore.path), err)
+	}
+	if err = boltStore.migrateSchema(backupFolder); err != nil {
+		return "", fmt.Errorf("could not migrate %s: %s", boltStore.path, err)
+	}
+	return notice, nil
+}
+
+// database opens the database the first time it is used, returning nil when the store only reads and nothing was
+// stored yet
+func (boltStore *BoltStore) database(writing bool) (*bolt.DB, error) {
+	boltStore.lock.Lock()
+	defer boltStore.lock.Unlock()
+	if writing && boltStore.readOnly {
+		return nil, errReadOnlyStore
+	}
+	if boltStore.closed {
+		return nil, bolt.ErrDatabaseNotOpen
+	}
+	if boltStore.db != nil {
+		return boltStore.db, nil
+	}
+
+	if !boltStore.readOnly {
+		db, err := bolt.Open(boltStore.path, 0644, &bolt.Options{Timeout: boltLockTimeout})
+		if err != nil {
+			return nil, err
+		}
+		boltStore.db = db
+		return db, nil
+	}
+
+	if _, err := os.Stat(boltStore.path); os.IsNotExist(err) {
+		// Nothing stored yet
+		return nil, nil
+	}
+	db, err := bolt.Open(boltStore.path, 0644, &bolt.Options{Timeout: boltReadLockTimeout, ReadOnly: true})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("%s is held by the ghmon writing to it", boltStore.path)
+	} else if err != nil {
+		return nil, err
+	}
+	boltStore.db = db
+	return db, nil
+}
+
+// Close closes the database, the store is not used afterwards
+func (boltStore *BoltStore) Close() error {
+	boltStore.lock.Lock()
+	defer boltStore.lock.Unlock()
+	boltStore.closed = true
+	if boltStore.db == nil {
+		return nil
+	}
+	return boltStore.db.Close()
+}
+
+func (boltStore *BoltStore) view(function func(tx *bolt.Tx) error) error {
+	db, err := boltStore.database(false)
+	if db == nil {
+		return err
+	}
+	return db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(pullRequestsBucket) == nil {
+			// Still being created
+			return nil
+		}
+		return function(tx)
+	})
+}
+
+func (boltStore *BoltStore) update(function func(tx *bolt.Tx) error) error {
+	db, err := boltStore.database(true)
+	if err != nil {
+		return err
+	}
+	return db.Update(function)
+}
+
+// Batch runs the writes in a single transaction, all of them are stored or none
+func (boltStore *BoltStore) Batch(write func(batch StoreBatch) error) error {
+	return boltStore.update(func(tx *bolt.Tx) error {
+		return write(&boltStoreBatch{tx: tx})
+	})
+}
+
+// boltStoreBatch reads and writes in the transaction of a batch
+type boltStoreBatch struct {
+	tx *bolt.Tx
+}
+
+func (batch *boltStoreBatch) StorePullRequestWrappers(pullRequestWrappers []*PullRequestWrapper) error {
+	return putPullRequestWrappers(batch.tx, pullRequestWrappers)
+}
+
+func (batch *boltStoreBatch) LoadPullRequestHistory(id uint32) (*PullRequestHistory, error) {
+	bytes := batch.tx.Bucket(historyBucket).Get(createKey(id))
+	if bytes == nil {
+		return nil, nil
+	}
+	var history PullRequestHistory
+	if err := json.Unmarshal(bytes, &history); err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
+
+func (batch *boltStoreBatch) StorePullRequestHistory(history *PullRequestHistory) error {
+	return putPullRequestHistory(batch.tx, history)
+}
+
+// createKey keeps the keys in the order of the identifiers
+func createKey(id uint32) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, id)
+	return key
+}
+
+func getRepositoryIndexKey(pullRequestWrapper *PullRequestWrapper) []byte {
+	if pullRequestWrapper.PullRequest.Repo == nil {
+		return nil
+	}
+	return []byte(strings.ToLower(pullRequestWrapper.PullRequest.Repo.FullName))
+}
+
+func getStateIndexKey(pullRequestWrapper *PullRequestWrapper) []byte {
+	return []byte(getPullRequestState(pullRequestWrapper))
+}
+
+func addToIndex(index *bolt.Bucket, indexKey []byte, key []byte) error {
+	if len(indexKey) == 0 {
+		return nil
+	}
+	bucket, err := index.CreateBucketIfNotExists(indexKey)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, []byte{})
+}
+
+func removeFromIndex(index *bolt.Bucket, indexKey []byte, key []byte) error {
+	if len(indexKey) == 0 {
+		return nil
+	}
+	if bucket := index.Bucket(indexKey); bucket != nil {
+		return bucket.Delete(key)
+	}
+	return nil
+}
+
+func getPullRequestWrapper(tx *bolt.Tx, key []byte) (*PullRequestWrapper, error) {
+	bytes := tx.Bucket(pullRequestsBucket).Get(key)
+	if bytes == nil {
+		return nil, nil
+	}
+	return decodePullRequestWrapper(bytes)
+}
+
+// removePullRequestWrapper removes the pull request from the indexes it was stored under
+func removePullRequestWrapper(tx *bolt.Tx, key []byte) error {
+	storedPullRequestWrapper, err := getPullRequestWrapper(tx, key)
+	if err != nil || storedPullRequestWrapper == nil {
+		// A pull request that cannot be parsed cannot be found in the indexes either
+		return tx.Bucket(pullRequestsBucket).Delete(key)
+	}
+	if err = removeFromIndex(tx.Bucket(byRepositoryBucket), getRepositoryIndexKey(storedPullRequestWrapper), key); err != nil {
+		return err
+	}
+	if err = removeFromIndex(tx.Bucket(byStateBucket), getStateIndexKey(storedPullRequestWrapper), key); err != nil {
+		return err
+	}
+	return tx.Bucket(pullRequestsBucket).Delete(key)
+}
+
+func putPullRequestWrapper(tx *bolt.Tx, pullRequestWrapper *PullRequestWrapper) error {
+	bytes, err := encodePullRequestWrapper(pullRequestWrapper)
+	if err != nil {
+		return err
+	}
+	key := createKey(pullRequestWrapper.Id)
+	if err = removePullRequestWrapper(tx, key); err != nil {
+		return err
+	}
+	if err = tx.Bucket(pullRequestsBucket).Put(key, bytes); err != nil {
+		return err
+	}
+	if err = addToIndex(tx.Bucket(byRepositoryBucket), getRepositoryIndexKey(pullRequestWrapper), key); err != nil {
+		return err
+	}
+	return addToIndex(tx.Bucket(byStateBucket), getStateIndexKey(pullRequestWrapper), key)
+}
+
+func (boltStore *BoltStore) LoadPullRequestWrapper(id uint32) (*PullRequestWrapper, error) {
+	pullRequestWrappers, err := boltStore.loadPullRequestWrappers(func(tx *bolt.Tx, load func(key []byte) error) error {
+		return load(createKey(id))
+	})
+	if err != nil || len(pullRequestWrappers) == 0 {
+		return nil, err
+	}
+	return pullRequestWrappers[0], nil
+}
+
+func (boltStore *BoltStore) LoadPullRequestWrappers() ([]*PullRequestWrapper, error) {
+	return boltStore.loadPullRequestWrappers(func(tx *bolt.Tx, load func(key []byte) error) error {
+		return tx.Bucket(pullRequestsBucket).ForEach(func(key []byte, _ []byte) error {
+			return load(key)
+		})
+	})
+}
+
+func (boltStore *BoltStore) LoadPullRequestWrappersByRepository(repositoryFullName string) ([]*PullRequestWrapper, error) {
+	return boltStore.loadIndexedPullRequestWrappers(byRepositoryBucket, []byte(strings.ToLower(repositoryFullName)))
+}
+
+func (boltStore *BoltStore) LoadPullRequestWrappersByState(state string) ([]*PullRequestWrapper, error) {
+	return boltStore.loadIndexedPullRequestWrappers(byStateBucket, []byte(state))
+}
+
+func (boltStore *BoltStore) loadIndexedPullRequestWrappers(index []byte, indexKey []byte) ([]*PullRequestWrapper, error) {
+	return boltStore.loadPullRequestWrappers(func(tx *bolt.Tx, load func(key []byte) error) error {
+		bucket := tx.Bucket(index).Bucket(indexKey)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key []byte, _ []byte) error {
+			return load(key)
+		})
+	})
+}
+
+// loadPullRequestWrappers loads the pull requests of the keys listed by listKeys.  Those that cannot be parsed are
+// skipped, and moved to quarantine once the transaction is over.
+func (boltStore *BoltStore) loadPullRequestWrappers(listKeys func(tx *bolt.Tx, load func(key []byte) error) error) ([]*PullRequestWrapper, error) {
+
+	pullRequestWrappers := make([]*PullRequestWrapper, 0)
+	corruptKeys := make([][]byte, 0)
+	err := boltStore.view(func(tx *bolt.Tx) error {
+		return listKeys(tx, func(key []byte) error {
+			pullRequestWrapper, err := getPullRequestWrapper(tx, key)
+			if err != nil {
+				// One broken record should not hide all the other pull requests
+				boltStore.logger.Printf("Skipping stored pull request %d: %s", binary.BigEndian.Uint32(key), err)
+				if isCorrupt(err) {
+					corruptKeys = append(corruptKeys, append([]byte{}, key...))
+				}
+			} else if pullRequestWrapper != nil {
+				pullRequestWrappers = append(pullRequestWrappers, pullRequestWrapper)
+			}
+			return nil
+		})
+	})
+	if len(corruptKeys) > 0 {
+		boltStore.quarantine(pullRequestsBucket, corruptKeys)
+	}
+	return pullRequestWrappers, err
+}
+
+// quarantine moves records that could not be parsed out of their bucket, so they are neither loaded again nor
+// overwritten
+func (boltStore *BoltStore) quarantine(bucketName []byte, keys [][]byte) {
+	err := boltStore.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		for _, key := range keys {
+			bytes := bucket.Get(key)
+			if bytes == nil {
+				continue
+			}
+			quarantineKey := append(append(append([]byte{}, bucketName...), '/'), key...)
+			if err := tx.Bucket(quarantineBucket).Put(quarantineKey, bytes); err != nil {
+				return err
+			}
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		boltStore.logger.Printf("Moved %d records of %s to the %s bucket", len(keys), bucketName, quarantineBucket)
+	} else if err != errReadOnlyStore {
+		boltStore.logger.Printf("Could not move records of %s to the %s bucket: %s", bucketName, quarantineBucket, err)
+	}
+}
+
+func (boltStore *BoltStore) StorePullRequestWrapper(pullRequestWrapper *PullRequestWrapper) {
+	err := boltStore.update(func(tx *bolt.Tx) error {
+		return putPullRequestWrapper(tx, pullRequestWrapper)
+	})
+	if err != nil && err != errReadOnlyStore {
+		boltStore.logger.Printf("Could not store pull request %d: %s", pullRequestWrapper.Id, err)
+	}
+}
+
+func (boltStore *BoltStore) StorePullRequestWrappers(pullRequestWrappers []*PullRequestWrapper) error {
+	return boltStore.update(func(tx *bolt.Tx) error {
+		return putPullRequestWrappers(tx, pullRequestWrappers)
+	})
+}
+
+func putPullRequestWrappers(tx *bolt.Tx, pullRequestWrappers []*PullRequestWrapper) error {
+	for _, pullRequestWrapper := range pullRequestWrappers {
+		if err := putPullRequestWrapper(tx, pullRequestWrapper); err != nil {
+			return fmt.Errorf("could not store pull request %d: %s", pullRequestWrapper.Id, err)
+		}
+	}
+	return nil
+}
+
+func (boltStore *BoltStore) DeletePullRequestWrappers(ids []uint32) ([]uint32, error) {
+	// A single transaction, either all of them are deleted or none
+	err := boltStore.update(func(tx *bolt.Tx) error {
+		for _, id := range ids {
+			key := createKey(id)
+			if err := removePullRequestWrapper(tx, key); err != nil {
+				return err
+			}
+			if err := tx.Bucket(diffsBucket).Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (boltStore *BoltStore) LoadPullRequestDiff(id uint32, headSHA string) *PullRequestDiff {
+
+	var pullRequestDiff *PullRequestDiff
+	corrupt := false
+	err := boltStore.view(func(tx *bolt.Tx) error {
+		bytes := tx.Bucket(diffsBucket).Get(createKey(id))
+		if bytes == nil {
+			return nil
+		}
+		var storedPullRequestDiff PullRequestDiff
+		if err := json.Unmarshal(bytes, &storedPullRequestDiff); err != nil {
+			corrupt = true
+			return err
+		}
+		// Only the diff of the latest head commit is kept, it may not be that one anymore
+		if storedPullRequestDiff.HeadSHA == headSHA {
+			pullRequestDiff = &storedPullRequestDiff
+		}
+		return nil
+	})
+	if err != nil {
+		boltStore.logger.Printf("Could not load cached diff for %d: %s", id, err)
+		if corrupt {
+			boltStore.quarantine(diffsBucket, [][]byte{createKey(id)})
+		}
+		return nil
+	}
+	return pullRequestDiff
+}
+
+func (boltStore *BoltStore) StorePullRequestDiff(pullRequestDiff *PullRequestDiff) {
+
+	bytes, err := json.Marshal(pullRequestDiff)
+	if err != nil {
+		boltStore.logger.Printf("Could not serialize diff for %d: %s", pullRequestDiff.Id, err)
+		return
+	}
+	err = boltStore.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(diffsBucket).Put(createKey(pullRequestDiff.Id), bytes)
+	})
+	if err != nil && err != errReadOnlyStore {
+		boltStore.logger.Printf("Could not store diff for %d: %s", pullRequestDiff.Id, err)
+	}
+}
+
+func (boltStore *BoltStore) LoadPreferences() *Preferences {
+
+	preferences := createDefaultPreferences()
+	corrupt := false
+	err := boltStore.view(func(tx *bolt.Tx) error {
+		if bytes := tx.Bucket(preferencesBucket).Get(preferencesKey); bytes != nil {
+			if err := json.Unmarshal(bytes, preferences); err != nil {
+				corrupt = true
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		boltStore.logger.Printf("Could not load preferences: %s", err)
+		if corrupt {
+			boltStore.quarantine(preferencesBucket, [][]byte{preferencesKey})
+		}
+		return createDefaultPreferences()
+	}
+	return preferences
+}
+
+func (boltStore *BoltStore) StorePreferences(preferences *Preferences) {
+
+	bytes, err := json.Marshal(preferences)
+	if err != nil {
+		boltStore.logger.Printf("Could not serialize preferences: %s", err)
+		return
+	}
+	err = boltStore.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(preferencesBucket).Put(preferencesKey, bytes)
+	})
+	if err != nil && err != errReadOnlyStore {
+		boltStore.logger.Printf("Could not store preferences: %s", err)
+	}
+}
+
+func (boltStore *BoltStore) LoadPullRequestHistory(id uint32) (*PullRequestHistory, error) {
+	histories, err := boltStore.loadPullRequestHistories(func(bucket *bolt.Bucket, load func(key []byte, bytes []byte) error) error {
+		key := createKey(id)
+		if bytes := bucket.Get(key); bytes != nil {
+			return load(key, bytes)
+		}
+		return nil
+	})
+	if err != nil || len(histories) == 0 {
+		return nil, err
+	}
+	return histories[0], nil
+}
+
+func (boltStore *BoltStore) LoadPullRequestHistories() ([]*PullRequestHistory, error) {
+	return boltStore.loadPullRequestHistories(func(bucket *bolt.Bucket, load func(key []byte, bytes []byte) error) error {
+		return bucket.ForEach(load)
+	})
+}
+
+// loadPullRequestHistories loads the histories listed by listHistories, those that cannot be parsed are moved to
+// quarantine
+func (boltStore *BoltStore) loadPullRequestHistories(listHistories func(bucket *bolt.Bucket, load func(key []byte, bytes []byte) error) error) ([]*PullRequestHistory, error) {
+
+	histories := make([]*PullRequestHistory, 0)
+	corruptKeys := make([][]byte, 0)
+	err := boltStore.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket)
+		if bucket == nil {
+			// Created by a version that did not record histories, and not written to since
+			return nil
+		}
+		return listHistories(bucket, func(key []byte, bytes []byte) error {
+			var history PullRequestHistory
+			if err := json.Unmarshal(bytes, &history); err != nil {
+				boltStore.logger.Printf("Skipping stored history %d: %s", binary.BigEndian.Uint32(key), err)
+				corruptKeys = append(corruptKeys, append([]byte{}, key...))
+				return nil
+			}
+			histories = append(histories, &history)
+			return nil
+		})
+	})
+	if len(corruptKeys) > 0 {
+		boltStore.quarantine(historyBucket, corruptKeys)
+	}
+	return histories, err
+}
+
+func (boltStore *BoltStore) StorePullRequestHistory(history *PullRequestHistory) error {
+	return boltStore.update(func(tx *bolt.Tx) error {
+		return putPullRequestHistory(tx, history)
+	})
+}
+
+func putPullRequestHistory(tx *bolt.Tx, history *PullRequestHistory) error {
+	bytes, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(historyBucket).Put(createKey(history.Id), bytes)
+}
+
+func (boltStore *BoltStore) DeletePullRequestHistories(ids []uint32) error {
+	return boltStore.update(func(tx *bolt.Tx) error {
+		for _, id := range ids {
+			if err := tx.Bucket(historyBucket).Delete(createKey(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// migrateSchema rewrites the pull requests stored with an older schema, copying the database to the backup folder first
+func (boltStore *BoltStore) migrateSchema(backupFolder string) error {
+
+	outdatedKeys := make([][]byte, 0)
+	err := boltStore.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(pullRequestsBucket).ForEach(func(key []byte, bytes []byte) error {
+			if schemaVersion, err := getSchemaVersion(bytes); err == nil && schemaVersion < pullRequestSchemaVersion {
+				outdatedKeys = append(outdatedKeys, append([]byte{}, key...))
+			}
+			return nil
+		})
+	})
+	if err != nil || len(outdatedKeys) == 0 {
+		return err
+	}
+
+	if err = os.MkdirAll(backupFolder, 0755); err != nil {
+		return err
+	}
+	backupPath := filepath.Join(backupFolder, fmt.Sprintf("ghmon-%s.db", time.Now().Format("20060102-150405")))
+	err = boltStore.view(func(tx *bolt.Tx) error {
+		return tx.CopyFile(backupPath, 0644)
+	})
+	if err != nil {
+		return fmt.Errorf("could not back up to %s: %s", backupPath, err)
+	}
+
+	migrated := 0
+	err = boltStore.update(func(tx *bolt.Tx) error {
+		for _, key := range outdatedKeys {
+			pullRequestWrapper, err := getPullRequestWrapper(tx, key)
+			if err != nil {
+				// Left as it is, loading it will skip it
+				boltStore.logger.Printf("Could not migrate pull request %d: %s", binary.BigEndian.Uint32(key), err)
+				continue
+			}
+			if pullRequestWrapper == nil {
+				continue
+			}
+			if err = putPullRequestWrapper(tx, pullRequestWrapper); err != nil {
+				return err
+			}
+			migrated++
+		}
+		return nil
+	})
+	if err == nil {
+		boltStore.logger.Printf("Migrated %d pull requests to schema version %d, the previous database is %s", migrated, pullRequestSchemaVersion, backupPath)
+	}
+	return err
+}
+
+// MigrateFileStore copies what the file backend kept into the database, in a single transaction and only once.  The
+// files are left in place so that going back to GHMON_STORAGE=files loses nothing older than the migration.  Returns
+// what the user has to be told when something was copied, so they know the files are not written anymore.
+func (boltStore *BoltStore) MigrateFileStore(fileStore *FileStore) (string, error) {
+
+	migrated := false
+	err := boltStore.view(func(tx *bolt.Tx) error {
+		migrated = tx.Bucket(metaBucket).Get(migratedKey) != nil
+		return nil
+	})
+	if err != nil || migrated {
+		return "", err
+	}
+
+	pullRequestWrappers := make([]*PullRequestWrapper, 0)
+	if _, err = os.Stat(fileStore.cachedPullRequestFolder); err == nil {
+		if pullRequestWrappers, err = fileStore.LoadPullRequestWrappers(); err != nil {
+			return "", err
+		}
+	}
+
+	histories, err := fileStore.LoadPullRequestHistories()
+	if err != nil {
+		return "", err
+	}
+
+	pullRequestDiffs := make([]*PullRequestDiff, 0)
+	diffFiles, _ := filepath.Glob(filepath.Join(fileStore.cachedDiffFolder, "*.json"))
+	for _, diffFile := range diffFiles {
+		bytes, err := ioutil.ReadFile(diffFile)
+		if err != nil {
+			continue
+		}
+		var pullRequestDiff PullRequestDiff
+		if json.Unmarshal(bytes, &pullRequestDiff) == nil {
+			pullRequestDiffs = append(pullRequestDiffs, &pullRequestDiff)
+		}
+	}
+
+	preferencesBytes, err := ioutil.ReadFile(fileStore.preferencesFile)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	err = boltStore.update(func(tx *bolt.Tx) error {
+		for _, pullRequestWrapper := range pullRequestWrappers {
+			if err := putPullRequestWrapper(tx, pullRequestWrapper); err != nil {
+				return err
+			}
+		}
+		for _, pullRequestDiff := range pullRequestDiffs {
+			bytes, err := json.Marshal(pullRequestDiff)
+			if err != nil {
+				return err
+			}
+			if err = tx.Bucket(diffsBucket).Put(createKey(pullRequestDiff.Id), bytes); err != nil {
+				return err
+			}
+		}
+		for _, history := range histories {
+			bytes, err := json.Marshal(history)
+			if err != nil {
+				return err
+			}
+			if err = tx.Bucket(historyBucket).Put(createKey(history.Id), bytes); err != nil {
+				return err
+			}
+		}
+		if preferencesBytes != nil && json.Valid(preferencesBytes) {
+			if err := tx.Bucket(preferencesBucket).Put(preferencesKey, preferencesBytes); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(metaBucket).Put(migratedKey, []byte(time.Now().Format(time.RFC3339)))
+	})
+	if err != nil {
+		return "", err
+	}
+	folder := filepath.Dir(fileStore.cachedPullRequestFolder)
+	boltStore.logger.Printf("Migrated %d pull requests, %d diffs and %d histories from %s", len(pullRequestWrappers), len(pullRequestDiffs), len(histories), folder)
+	if len(pullRequestWrappers) == 0 && len(pullRequestDiffs) == 0 && len(histories) == 0 && preferencesBytes == nil {
+		// Nothing was stored before, there is nothing to tell
+		return "", nil
+	}
+	return fmt.Sprintf("ghmon now stores everything in %s: %d pull requests, %d diffs and %d histories were copied from %s, which is left as it was (GHMON_STORAGE=files goes back to it)",
+		boltStore.path, len(pullRequestWrappers), len(pullRequestDiffs), len(histories), folder), nil
+}
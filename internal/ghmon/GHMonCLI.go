@@ -0,0 +1,697 @@
+package ghmon
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const commandUsage = `Usage: ghmon [command] [options]
+
+Without a command the terminal UI is started.
+
+Commands:
+  list [--json] [--refresh] [--all] [--filter EXPRESSION] [--sort MODE] [--repo OWNER/REPO] [--state STATE]
+                     Lists the pull requests, hottest first
+  show [--json] REF  Shows the details and the timeline of a pull request
+  refresh            Retrieves the pull requests from GitHub
+  purge              Removes the pull requests that are no longer open
+  open REF           Opens a pull request in the browser
+  status [--format plain|tmux|waybar|i3blocks] [--template TEMPLATE]
+                     Prints a one line summary for status bars, from the stored pull requests
+  unhide REF         Shows a hidden or snoozed pull request again
+  export [FILE]      Writes the pull requests, their state, histories and the preferences to an archive (JSON lines)
+  import [FILE]      Merges an archive written by 'export' into the stored pull requests
+  report [--since DATE] [--until DATE] [--format table|markdown|csv] [--user LOGIN]
+                     Measures review times and counts reviews from the recorded histories
+  daemon [--address ADDRESS]
+                     Monitors GitHub in the background and serves the pull requests over HTTP
+  attach [--address ADDRESS]
+                     Starts the terminal UI on the pull requests of a running daemon
+  help               Shows this help
+
+REF is the identifier shown by 'list', owner/repo#number or the URL of the pull request.
+`
+
+// CommandLine runs ghmon without the terminal UI, using the same monitor and storage so the scored and sorted list
+// can be used from scripts
+type CommandLine struct {
+	ghMon     *GHMon
+	stdout    io.Writer
+	stderr    io.Writer
+	refreshed chan PullRequestsUpdatesEvent
+}
+
+type pullRequestReviewerJSON struct {
+	User        string     `json:"user"`
+	State       string     `json:"state"`
+	SubmittedAt *time.Time `json:"submitted_at,omitempty"`
+}
+
+type pullRequestHistoryEventJSON struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Actor   string    `json:"actor,omitempty"`
+	Details string    `json:"details,omitempty"`
+}
+
+type pullRequestJSON struct {
+	Id               uint32                         `json:"id"`
+	Repository       string                         `json:"repository"`
+	Number           uint32                         `json:"number"`
+	Title            string                         `json:"title"`
+	Author           string                         `json:"author"`
+	URL              string                         `json:"url"`
+	Own              bool                           `json:"own"`
+	Draft            bool                           `json:"draft"`
+	Seen             bool                           `json:"seen"`
+	Deleted          bool                           `json:"deleted"`
+	Score            float32                        `json:"score"`
+	Size             string                         `json:"size"`
+	Approvals        uint                           `json:"approvals"`
+	ChangesRequested uint                           `json:"changes_requested"`
+	Comments         uint                           `json:"comments"`
+	NumReviewers     uint                           `json:"reviewers_count"`
+	Labels           []string                       `json:"labels"`
+	Milestone        string                         `json:"milestone,omitempty"`
+	Note             string                         `json:"note,omitempty"`
+	Tags             []string                       `json:"tags,omitempty"`
+	HeadRef          string                         `json:"head_ref,omitempty"`
+	BaseRef          string                         `json:"base_ref,omitempty"`
+	CreatedAt        time.Time                      `json:"created_at"`
+	UpdatedAt        time.Time                      `json:"updated_at"`
+	Reviewers        []*pullRequestReviewerJSON     `json:"reviewers,omitempty"`
+	Timeline         []*pullRequestHistoryEventJSON `json:"timeline,omitempty"`
+	Body             string                         `json:"body,omitempty"`
+}
+
+func NewCommandLine(ghMon *GHMon) *CommandLine {
+	return &CommandLine{ghMon: ghMon, stdout: os.Stdout, stderr: os.Stderr, refreshed: make(chan PullRequestsUpdatesEvent, 1)}
+}
+
+// Run runs the given command and returns the exit code
+func (cli *CommandLine) Run(arguments []string) int {
+
+	if len(arguments) == 0 {
+		fmt.Fprint(cli.stderr, commandUsage)
+		return 2
+	}
+
+	var err error
+	command := arguments[0]
+
+	// Nothing shows the events without the UI, they still have to be consumed for the monitor to make progress.  The
+	// daemon and the UI consume them themselves.
+	if command != "daemon" && command != "attach" {
+		go cli.pollEvents()
+	}
+
+	switch command {
+	case "list", "ls":
+		err = cli.list(arguments[1:])
+	case "show":
+		err = cli.show(arguments[1:])
+	case "refresh":
+		err = cli.refresh(arguments[1:])
+	case "purge":
+		err = cli.purge(arguments[1:])
+	case "open":
+		err = cli.open(arguments[1:])
+	case "status":
+		err = cli.status(arguments[1:])
+	case "unhide":
+		err = cli.unhide(arguments[1:])
+	case "report":
+		err = cli.report(arguments[1:])
+	case "export":
+		err = cli.exportArchive(arguments[1:])
+	case "import":
+		err = cli.importArchive(arguments[1:])
+	case "daemon":
+		err = cli.daemon(arguments[1:])
+	case "attach":
+		err = cli.attach(arguments[1:])
+	case "help", "-h", "--help":
+		fmt.Fprint(cli.stdout, commandUsage)
+		return 0
+	default:
+		fmt.Fprintf(cli.stderr, "ghmon: unknown command %s\n\n%s", command, commandUsage)
+		return 2
+	}
+
+	// Whatever the monitor is still retrieving is not waited for
+	cli.ghMon.Stop()
+	if notice := cli.ghMon.StoreNotice(); notice != "" {
+		fmt.Fprintln(cli.stderr, notice)
+	}
+
+	if err == flag.ErrHelp {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(cli.stderr, "ghmon %s: %s\n", command, err)
+		return 1
+	}
+	return 0
+}
+
+func (cli *CommandLine) pollEvents() {
+	for event := range cli.ghMon.Events() {
+		switch event.eventType {
+		case Status:
+			cli.ghMon.Logger().Printf("Status: %s", event.payload.(string))
+		case PullRequestsUpdates:
+			select {
+			case cli.refreshed <- event.payload.(PullRequestsUpdatesEvent):
+			default:
+			}
+		}
+	}
+}
+
+func (cli *CommandLine) newFlagSet(command string) *flag.FlagSet {
+	flagSet := flag.NewFlagSet(command, flag.ContinueOnError)
+	flagSet.SetOutput(cli.stderr)
+	return flagSet
+}
+
+// loadPullRequests gives the pull requests from the last refresh, or retrieves them from GitHub first
+func (cli *CommandLine) loadPullRequests(refresh bool) ([]*PullRequestWrapper, error) {
+	if refresh {
+		if err := cli.ghMon.CheckSetup(); err != nil {
+			return nil, err
+		}
+		if err := cli.ghMon.LockStore(); err != nil {
+			return nil, err
+		}
+		return cli.retrievePullRequests()
+	}
+	return cli.ghMon.LoadStoredPullRequests()
+}
+
+// retrievePullRequests refreshes the pull requests from GitHub and waits for the scored and sorted result
+func (cli *CommandLine) retrievePullRequests() ([]*PullRequestWrapper, error) {
+	ghMon := cli.ghMon
+	if err := ghMon.CheckLoggedIn(); err != nil {
+		return nil, err
+	}
+	if ghMon.RetrieveUser() == nil {
+		return nil, fmt.Errorf("could not retrieve the logged in user from GitHub")
+	}
+	ghMon.RetrievePullRequests()
+	refreshed := <-cli.refreshed
+	if refreshed.refreshError != nil {
+		return nil, fmt.Errorf("could not retrieve all pull requests: %s", refreshed.refreshError)
+	}
+	return refreshed.pullRequestWrappers, nil
+}
+
+func (cli *CommandLine) findPullRequest(flagSet *flag.FlagSet) (*PullRequestWrapper, error) {
+
+	if flagSet.NArg() != 1 {
+		return nil, fmt.Errorf("expected a single pull request, see 'ghmon help'")
+	}
+	if _, err := cli.ghMon.LoadStoredPullRequests(); err != nil {
+		return nil, err
+	}
+
+	reference := flagSet.Arg(0)
+	pullRequestWrapper := cli.ghMon.FindPullRequestWrapper(reference)
+	if pullRequestWrapper == nil {
+		return nil, fmt.Errorf("no pull request %s, see 'ghmon list'", reference)
+	}
+	return pullRequestWrapper, nil
+}
+
+func (cli *CommandLine) list(arguments []string) error {
+
+	flagSet := cli.newFlagSet("list")
+	asJSON := flagSet.Bool("json", false, "print the pull requests as JSON")
+	refresh := flagSet.Bool("refresh", false, "retrieve the pull requests from GitHub first")
+	all := flagSet.Bool("all", false, "include hidden and snoozed pull requests")
+	filterExpression := flagSet.String("filter", "", "only list the pull requests matching the filter expression")
+	sortModeString := flagSet.String("sort", "", "sort by score, last-activity, created, repository, author, review-requested or size")
+	repositoryFullName := flagSet.String("repo", "", "only list the pull requests of the repository")
+	state := flagSet.String("state", "", "only list the pull requests in the state: pending, commented, approved, changes_requested or deleted")
+	if err := flagSet.Parse(arguments); err != nil {
+		return err
+	}
+
+	pullRequestWrappers, err := cli.loadPullRequests(*refresh)
+	if err != nil {
+		return err
+	}
+	if *repositoryFullName != "" || *state != "" {
+		// Straight from the indexes of the store
+		if pullRequestWrappers, err = cli.ghMon.QueryStoredPullRequests(*repositoryFullName, *state); err != nil {
+			return err
+		}
+		if !*all {
+			pullRequestWrappers = cli.ghMon.filterPullRequestWrappers(pullRequestWrappers)
+		}
+	} else if *all {
+		pullRequestWrappers = cli.ghMon.GetPullRequestWrappers()
+	}
+
+	pullRequestWrappers = ParsePullRequestFilter(*filterExpression).Filter(pullRequestWrappers)
+	if *sortModeString != "" {
+		sortMode, ok := ParseSortMode(*sortModeString)
+		if !ok {
+			return fmt.Errorf("unknown sort mode %s", *sortModeString)
+		}
+		pullRequestWrappers = SortPullRequestWrappers(pullRequestWrappers, sortMode, DefaultSortDescending(sortMode))
+	}
+
+	if *asJSON {
+		pullRequests := make([]*pullRequestJSON, 0)
+		for _, pullRequestWrapper := range pullRequestWrappers {
+			pullRequests = append(pullRequests, cli.convertPullRequestToJSON(pullRequestWrapper, false))
+		}
+		return cli.printJSON(pullRequests)
+	}
+
+	writer := tabwriter.NewWriter(cli.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tHEAT\tPULL REQUEST\tAUTHOR\tSIZE\tREVIEWS\tFLAGS\tTITLE")
+	for _, pullRequestWrapper := range pullRequestWrappers {
+		pullRequest := pullRequestWrapper.PullRequest
+		score := pullRequestWrapper.Score
+		fmt.Fprintf(writer, "%d\t%.0f\t%s#%d\t%s\t%s\t%d/%d\t%s\t%s\n",
+			pullRequestWrapper.Id, score.Total, pullRequest.Repo.FullName, pullRequest.Number, pullRequest.Creator.Username,
+			cli.ghMon.ConvertPullRequestSizeToString(score.Size), score.Approvals, score.NumReviewers,
+			cli.getFlagsString(pullRequestWrapper), pullRequest.Title)
+	}
+	return writer.Flush()
+}
+
+func (cli *CommandLine) show(arguments []string) error {
+
+	flagSet := cli.newFlagSet("show")
+	asJSON := flagSet.Bool("json", false, "print the pull request as JSON")
+	if err := flagSet.Parse(arguments); err != nil {
+		return err
+	}
+
+	pullRequestWrapper, err := cli.findPullRequest(flagSet)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return cli.printJSON(cli.convertPullRequestToJSON(pullRequestWrapper, true))
+	}
+
+	pullRequest := pullRequestWrapper.PullRequest
+	score := pullRequestWrapper.Score
+
+	fmt.Fprintf(cli.stdout, "%s#%d %s\n%s\n\n", pullRequest.Repo.FullName, pullRequest.Number, pullRequest.Title, pullRequest.HtmlURL)
+
+	writer := tabwriter.NewWriter(cli.stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(writer, "Id:\t%d\n", pullRequestWrapper.Id)
+	fmt.Fprintf(writer, "Author:\t%s\n", pullRequest.Creator.Username)
+	fmt.Fprintf(writer, "Created:\t%s\n", pullRequest.CreatedAt.Local().Format("2006-01-02 15:04"))
+	fmt.Fprintf(writer, "Updated:\t%s\n", pullRequest.UpdatedAt.Local().Format("2006-01-02 15:04"))
+	fmt.Fprintf(writer, "Heat:\t%.0f\n", score.Total)
+	fmt.Fprintf(writer, "Size:\t%s (+%d -%d in %d files, %d commits)\n", cli.ghMon.ConvertPullRequestSizeToString(score.Size), pullRequest.Additions, pullRequest.Deletions, pullRequest.ChangedFiles, pullRequest.Commits)
+	fmt.Fprintf(writer, "Reviews:\t%d/%d approvals, %d changes requested, %d comments\n", score.Approvals, score.NumReviewers, score.ChangesRequested, score.Comments)
+	if pullRequest.HeadRef != "" {
+		fmt.Fprintf(writer, "Branch:\t%s -> %s\n", pullRequest.HeadRef, pullRequest.BaseRef)
+	}
+	if labels := cli.getLabelNames(pullRequest); len(labels) > 0 {
+		fmt.Fprintf(writer, "Labels:\t%s\n", strings.Join(labels, ", "))
+	}
+	if pullRequest.Milestone != nil {
+		fmt.Fprintf(writer, "Milestone:\t%s\n", pullRequest.Milestone.Title)
+	}
+	if pullRequestWrapper.Note != "" {
+		fmt.Fprintf(writer, "Note:\t%s\n", pullRequestWrapper.Note)
+	}
+	if len(pullRequestWrapper.Tags) > 0 {
+		fmt.Fprintf(writer, "Tags:\t%s\n", strings.Join(pullRequestWrapper.Tags, ", "))
+	}
+	if flags := cli.getFlagsString(pullRequestWrapper); flags != "" {
+		fmt.Fprintf(writer, "Flags:\t%s\n", flags)
+	}
+	for i, pullRequestReviews := range pullRequest.PullRequestReviewsByPriority {
+		label := ""
+		if i == 0 {
+			label = "Reviewers:"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", label, pullRequestReviews[0].User.Username, cli.ghMon.ConvertPullRequestReviewStateToString(pullRequestReviews[0].Status))
+	}
+	for i, event := range cli.loadTimeline(pullRequestWrapper) {
+		label := ""
+		if i == 0 {
+			label = "Timeline:"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", label, event.Time.Local().Format("2006-01-02 15:04"), event.Kind, strings.TrimSpace(event.Actor+" "+event.Details))
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if body := strings.TrimSpace(pullRequest.Body); body != "" {
+		fmt.Fprintf(cli.stdout, "\n%s\n", body)
+	}
+	return nil
+}
+
+func (cli *CommandLine) refresh(arguments []string) error {
+
+	flagSet := cli.newFlagSet("refresh")
+	if err := flagSet.Parse(arguments); err != nil {
+		return err
+	}
+
+	pullRequestWrappers, err := cli.loadPullRequests(true)
+	if err != nil {
+		return err
+	}
+
+	deleted := 0
+	for _, pullRequestWrapper := range pullRequestWrappers {
+		if pullRequestWrapper.Deleted {
+			deleted++
+		}
+	}
+	fmt.Fprintf(cli.stdout, "Retrieved %d pull requests, %d no longer open\n", len(pullRequestWrappers)-deleted, deleted)
+	return nil
+}
+
+func (cli *CommandLine) purge(arguments []string) error {
+
+	flagSet := cli.newFlagSet("purge")
+	if err := flagSet.Parse(arguments); err != nil {
+		return err
+	}
+	if err := cli.ghMon.LockStore(); err != nil {
+		return err
+	}
+
+	if _, err := cli.ghMon.LoadStoredPullRequests(); err != nil {
+		return err
+	}
+	fmt.Fprintf(cli.stdout, "Purged %d pull requests\n", cli.ghMon.PurgeDeletedPullRequests())
+	return nil
+}
+
+func (cli *CommandLine) open(arguments []string) error {
+
+	flagSet := cli.newFlagSet("open")
+	if err := flagSet.Parse(arguments); err != nil {
+		return err
+	}
+	if err := cli.ghMon.CheckSetup(); err != nil {
+		return err
+	}
+
+	pullRequestWrapper, err := cli.findPullRequest(flagSet)
+	if err != nil {
+		return err
+	}
+	return OpenInBrowser(pullRequestWrapper)
+}
+
+// status never goes to GitHub so that status bars can run it as often as they like
+func (cli *CommandLine) status(arguments []string) error {
+
+	flagSet := cli.newFlagSet("status")
+	statusFormatString := flagSet.String("format", "plain", "plain, tmux, waybar or i3blocks")
+	statusTemplate := flagSet.String("template", cli.ghMon.StatusTemplate(), "Go template executed with the summary")
+	if err := flagSet.Parse(arguments); err != nil {
+		return err
+	}
+
+	statusFormat, ok := ParseStatusFormat(*statusFormatString)
+	if !ok {
+		return fmt.Errorf("unknown format %s", *statusFormatString)
+	}
+
+	pullRequestWrappers, err := cli.ghMon.LoadStoredPullRequests()
+	if err != nil {
+		return err
+	}
+	status, err := RenderStatus(CreateStatusSummary(pullRequestWrappers), *statusTemplate, statusFormat)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cli.stdout, status)
+	return nil
+}
+
+// report only reads the histories recorded by the refreshes, GitHub is asked for the user at most
+func (cli *CommandLine) report(arguments []string) error {
+
+	flagSet := cli.newFlagSet("report")
+	sinceString := flagSet.String("since", "30d", "start of the range, YYYY-MM-DD or a number of days ago such as 30d")
+	untilString := flagSet.String("until", "0d", "end of the range (included), YYYY-MM-DD or a number of days ago")
+	format := flagSet.String("format", reportFormatTable, "table, markdown or csv")
+	username := flagSet.String("user", "", "GitHub login whose review response time is measured, the current user by default")
+	if err := flagSet.Parse(arguments); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	since, err := ParseReportTime(*sinceString, false, now)
+	if err != nil {
+		return err
+	}
+	until, err := ParseReportTime(*untilString, true, now)
+	if err != nil {
+		return err
+	}
+	if !since.Before(until) {
+		return fmt.Errorf("--since %s is not before --until %s", *sinceString, *untilString)
+	}
+	if *format != reportFormatTable && *format != reportFormatMarkdown && *format != reportFormatCSV {
+		return fmt.Errorf("unknown format %s", *format)
+	}
+
+	if *username == "" {
+		if *username, err = cli.ghMon.FindUsername(); err != nil {
+			return err
+		}
+	}
+	report, err := cli.ghMon.CreateReport(*username, since, until)
+	if err != nil {
+		return err
+	}
+	return report.Write(cli.stdout, *format)
+}
+
+// exportArchive writes to the given file, or to the standard output
+func (cli *CommandLine) exportArchive(arguments []string) error {
+
+	flagSet := cli.newFlagSet("export")
+	if err := flagSet.Parse(arguments); err != nil {
+		return err
+	}
+	if flagSet.NArg() > 1 {
+		return fmt.Errorf("expected at most one file, see 'ghmon help'")
+	}
+
+	writer := cli.stdout
+	if flagSet.NArg() == 1 && flagSet.Arg(0) != "-" {
+		file, err := os.Create(flagSet.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+
+	summary, err := cli.ghMon.ExportArchive(writer)
+	if err != nil {
+		return err
+	}
+	if writer != cli.stdout {
+		fmt.Fprintf(cli.stdout, "Exported %d pull requests and %d histories\n", summary.PullRequests, summary.Histories)
+	}
+	return nil
+}
+
+// importArchive reads the given file, or the standard input
+func (cli *CommandLine) importArchive(arguments []string) error {
+
+	flagSet := cli.newFlagSet("import")
+	if err := flagSet.Parse(arguments); err != nil {
+		return err
+	}
+	if flagSet.NArg() > 1 {
+		return fmt.Errorf("expected at most one file, see 'ghmon help'")
+	}
+	if err := cli.ghMon.LockStore(); err != nil {
+		return err
+	}
+
+	var reader io.Reader = os.Stdin
+	if flagSet.NArg() == 1 && flagSet.Arg(0) != "-" {
+		file, err := os.Open(flagSet.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	summary, err := cli.ghMon.ImportArchive(reader)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cli.stdout, "Imported %d pull requests (%d merged with stored ones) and %d histories (%d merged)\n",
+		summary.PullRequests, summary.MergedPullRequests, summary.Histories, summary.MergedHistories)
+	return nil
+}
+
+func (cli *CommandLine) unhide(arguments []string) error {
+
+	flagSet := cli.newFlagSet("unhide")
+	if err := flagSet.Parse(arguments); err != nil {
+		return err
+	}
+	if err := cli.ghMon.LockStore(); err != nil {
+		return err
+	}
+
+	pullRequestWrapper, err := cli.findPullRequest(flagSet)
+	if err != nil {
+		return err
+	}
+	if err = cli.ghMon.HidePullRequest(pullRequestWrapper, false); err != nil {
+		return err
+	}
+	return cli.ghMon.SnoozePullRequest(pullRequestWrapper, time.Time{})
+}
+
+func (cli *CommandLine) daemon(arguments []string) error {
+
+	flagSet := cli.newFlagSet("daemon")
+	address := flagSet.String("address", cli.ghMon.DaemonAddress(), "unix socket path or localhost:port to listen on")
+	if err := flagSet.Parse(arguments); err != nil {
+		return err
+	}
+	if err := checkDaemonListenAddress(parseDaemonAddress(*address)); err != nil {
+		return err
+	}
+	if err := cli.ghMon.CheckSetup(); err != nil {
+		return err
+	}
+	if err := cli.ghMon.LockStore(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cli.stderr, "ghmon daemon listening on %s\n", *address)
+	return NewDaemon(cli.ghMon).Serve(*address)
+}
+
+func (cli *CommandLine) attach(arguments []string) error {
+
+	flagSet := cli.newFlagSet("attach")
+	address := flagSet.String("address", cli.ghMon.DaemonAddress(), "address of the daemon")
+	if err := flagSet.Parse(arguments); err != nil {
+		return err
+	}
+	// The UI still runs 'gh' itself, for the diffs and the actions on the pull requests
+	if err := cli.ghMon.CheckSetup(); err != nil {
+		return err
+	}
+
+	cli.ghMon.UseDaemon(*address)
+	ghmui := NewGHMonUI(cli.ghMon)
+	go cli.ghMon.Initialize()
+	ghmui.EventLoop()
+	return nil
+}
+
+func (cli *CommandLine) printJSON(value interface{}) error {
+	encoder := json.NewEncoder(cli.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func (cli *CommandLine) getLabelNames(pullRequest *PullRequest) []string {
+	labels := make([]string, 0)
+	for _, label := range pullRequest.Labels {
+		labels = append(labels, label.Name)
+	}
+	return labels
+}
+
+func (cli *CommandLine) getFlagsString(pullRequestWrapper *PullRequestWrapper) string {
+	flags := make([]string, 0)
+	if pullRequestWrapper.Score.IsMyPullRequest {
+		flags = append(flags, "own")
+	}
+	if pullRequestWrapper.PullRequest.Draft {
+		flags = append(flags, "draft")
+	}
+	if !pullRequestWrapper.Seen {
+		flags = append(flags, "new")
+	}
+	if pullRequestWrapper.Deleted {
+		flags = append(flags, "deleted")
+	}
+	if pullRequestWrapper.Hidden {
+		flags = append(flags, "hidden")
+	}
+	if pullRequestWrapper.SnoozedUntil.After(time.Now()) {
+		flags = append(flags, "snoozed")
+	}
+	return strings.Join(flags, ",")
+}
+
+func (cli *CommandLine) convertPullRequestToJSON(pullRequestWrapper *PullRequestWrapper, withDetails bool) *pullRequestJSON {
+
+	pullRequest := pullRequestWrapper.PullRequest
+	score := pullRequestWrapper.Score
+
+	pullRequestJSON := &pullRequestJSON{
+		Id: pullRequestWrapper.Id, Repository: pullRequest.Repo.FullName, Number: pullRequest.Number, Title: pullRequest.Title,
+		Author: pullRequest.Creator.Username, Own: score.IsMyPullRequest, Draft: pullRequest.Draft,
+		Seen: pullRequestWrapper.Seen, Deleted: pullRequestWrapper.Deleted, Score: score.Total,
+		Size: cli.ghMon.ConvertPullRequestSizeToString(score.Size), Approvals: score.Approvals,
+		ChangesRequested: score.ChangesRequested, Comments: score.Comments, NumReviewers: score.NumReviewers,
+		Labels: cli.getLabelNames(pullRequest), HeadRef: pullRequest.HeadRef, BaseRef: pullRequest.BaseRef,
+		CreatedAt: pullRequest.CreatedAt, UpdatedAt: pullRequest.UpdatedAt,
+		Note: pullRequestWrapper.Note, Tags: pullRequestWrapper.Tags,
+	}
+	if pullRequest.HtmlURL != nil {
+		pullRequestJSON.URL = pullRequest.HtmlURL.String()
+	}
+	if pullRequest.Milestone != nil {
+		pullRequestJSON.Milestone = pullRequest.Milestone.Title
+	}
+
+	if withDetails {
+		pullRequestJSON.Body = pullRequest.Body
+		for _, pullRequestReviews := range pullRequest.PullRequestReviewsByPriority {
+			pullRequestReview := pullRequestReviews[0]
+			reviewer := &pullRequestReviewerJSON{User: pullRequestReview.User.Username, State: cli.ghMon.ConvertPullRequestReviewStateToString(pullRequestReview.Status)}
+			if !pullRequestReview.SubmittedAt.IsZero() {
+				submittedAt := pullRequestReview.SubmittedAt
+				reviewer.SubmittedAt = &submittedAt
+			}
+			pullRequestJSON.Reviewers = append(pullRequestJSON.Reviewers, reviewer)
+		}
+		for _, event := range cli.loadTimeline(pullRequestWrapper) {
+			pullRequestJSON.Timeline = append(pullRequestJSON.Timeline, &pullRequestHistoryEventJSON{Time: event.Time, Kind: string(event.Kind), Actor: event.Actor, Details: event.Details})
+		}
+	}
+	return pullRequestJSON
+}
+
+// loadTimeline returns the recorded history of the pull request, a history that cannot be loaded is only reported
+func (cli *CommandLine) loadTimeline(pullRequestWrapper *PullRequestWrapper) []*PullRequestHistoryEvent {
+	history, err := cli.ghMon.LoadPullRequestHistory(pullRequestWrapper.Id)
+	if err != nil {
+		fmt.Fprintf(cli.stderr, "ghmon: could not load the history of %d: %s\n", pullRequestWrapper.Id, err)
+	}
+	if history == nil {
+		return nil
+	}
+	return history.Events
+}
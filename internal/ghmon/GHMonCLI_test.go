@@ -0,0 +1,50 @@
+package ghmon
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// withoutGH empties the PATH for the test, so that 'gh' cannot be found
+func withoutGH(t *testing.T) {
+	t.Helper()
+	path := os.Getenv("PATH")
+	if err := os.Setenv("PATH", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Setenv("PATH", path)
+	})
+}
+
+func TestCommandLineOnlyRequiresGHToGoToGitHub(t *testing.T) {
+	withoutGH(t)
+
+	tests := []struct {
+		arguments []string
+		exitCode  int
+	}{
+		{[]string{"status"}, 0},
+		{[]string{"list"}, 0},
+		{[]string{"export"}, 0},
+		{[]string{"list", "--refresh"}, 1},
+		{[]string{"refresh"}, 1},
+		{[]string{"open", "1"}, 1},
+	}
+	for _, test := range tests {
+		t.Run(strings.Join(test.arguments, " "), func(t *testing.T) {
+			cli := NewCommandLine(newTestMonitor(t))
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			cli.stdout, cli.stderr = stdout, stderr
+
+			if exitCode := cli.Run(test.arguments); exitCode != test.exitCode {
+				t.Fatalf("exit code %d, expected %d: %s", exitCode, test.exitCode, stderr)
+			}
+			if test.exitCode != 0 && !strings.Contains(stderr.String(), "installing 'gh'") {
+				t.Errorf("expected the missing 'gh' to be reported, got %q", stderr)
+			}
+		})
+	}
+}
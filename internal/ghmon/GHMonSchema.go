@@ -0,0 +1,507 @@
+package ghmon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// pullRequestSchemaVersion is the version of the stored pull requests written by this version of ghmon
+//
+//	0: PullRequestWrapper serialized as is, without a version
+//	1: storedPullRequestWrapper
+//	2: note and tags of the user, tags in the score
+const pullRequestSchemaVersion = 2
+
+// pullRequestMigrations[n] turns a stored pull request of version n into version n+1.  They work on the decoded JSON
+// rather than on the types so that they keep working whatever becomes of the types.
+var pullRequestMigrations = []func(record map[string]interface{}) error{
+	migratePullRequestFromVersion0,
+	migratePullRequestFromVersion1,
+}
+
+// storedPullRequestWrapper is how a pull request is persisted, apart from PullRequestWrapper so that the types the
+// monitor works with can change without breaking what is stored.  Changing any of the stored types, or the order of
+// the enums they use, needs a new schema version and a migration.
+type storedPullRequestWrapper struct {
+	SchemaVersion     int
+	Id                uint32
+	PullRequestType   PullRequestType
+	FirstSeen         time.Time
+	Seen              bool
+	Score             storedPullRequestScore
+	PullRequest       *storedPullRequest
+	Deleted           bool
+	ReviewRequestedAt time.Time
+	LastViewed        time.Time
+	Hidden            bool
+	SnoozedUntil      time.Time
+	Note              string
+	Tags              []string
+	NoteUpdatedAt     time.Time
+}
+
+type storedPullRequestScore struct {
+	Total            float32
+	Seen             bool
+	AgeSec           uint32
+	Approvals        uint
+	ApprovedByMe     bool
+	Comments         uint
+	Dismissed        uint
+	ChangesRequested uint
+	NumReviewers     uint
+	IsMyPullRequest  bool
+	Size             PullRequestSize
+	BoostedLabels    uint
+	PenalizedLabels  uint
+	BoostedTags      uint
+	PenalizedTags    uint
+}
+
+type storedPullRequest struct {
+	Id             uint32
+	Number         uint32
+	Repo           *storedRepo
+	Creator        *storedUser
+	Title          string
+	Body           string
+	HtmlURL        string
+	PullRequestURL string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	/* The reviews of each reviewer, most important reviewer first */
+	Reviews          [][]*storedPullRequestReview
+	PullRequestType  PullRequestType
+	Additions        uint32
+	Deletions        uint32
+	ChangedFiles     uint32
+	Commits          uint32
+	Labels           []*storedLabel
+	Milestone        *storedMilestone
+	HeadSHA          string
+	HeadRef          string
+	HeadRepoFullName string
+	BaseRef          string
+	NodeId           string
+	RequestedTeams   []string
+	Draft            bool
+	MergeableState   string
+}
+
+type storedUser struct {
+	Id       uint32
+	Username string
+}
+
+type storedRepo struct {
+	Id                  uint32
+	Name                string
+	FullName            string
+	Description         string
+	Url                 string
+	AllowMergeCommit    bool
+	AllowSquashMerge    bool
+	AllowRebaseMerge    bool
+	AllowAutoMerge      bool
+	DeleteBranchOnMerge bool
+}
+
+type storedPullRequestReview struct {
+	User        *storedUser
+	Status      PullRequestReviewStatus
+	SubmittedAt time.Time
+	Score       float32
+}
+
+type storedLabel struct {
+	Id          uint64
+	Name        string
+	Color       string
+	Description string
+}
+
+type storedMilestone struct {
+	Id     uint64
+	Number uint32
+	Title  string
+	State  string
+	DueOn  time.Time
+}
+
+// newerSchemaError is returned for pull requests stored by a newer ghmon, they are not corrupt and have to be kept
+type newerSchemaError struct {
+	schemaVersion int
+}
+
+func (newerSchemaError *newerSchemaError) Error() string {
+	return fmt.Sprintf("schema version %d was written by a newer ghmon, this one knows up to %d", newerSchemaError.schemaVersion, pullRequestSchemaVersion)
+}
+
+// isCorrupt tells whether a stored pull request that could not be decoded is beyond repair
+func isCorrupt(err error) bool {
+	_, isNewerSchema := err.(*newerSchemaError)
+	return !isNewerSchema
+}
+
+// getSchemaVersion returns the version a stored pull request was written with
+func getSchemaVersion(bytes []byte) (int, error) {
+	var versioned struct {
+		SchemaVersion int
+	}
+	if err := json.Unmarshal(bytes, &versioned); err != nil {
+		return 0, err
+	}
+	return versioned.SchemaVersion, nil
+}
+
+// migratePullRequest brings a stored pull request up to the current schema version
+func migratePullRequest(bytes []byte) ([]byte, error) {
+
+	schemaVersion, err := getSchemaVersion(bytes)
+	if err != nil {
+		return nil, err
+	}
+	if schemaVersion > pullRequestSchemaVersion {
+		return nil, &newerSchemaError{schemaVersion: schemaVersion}
+	}
+	if schemaVersion == pullRequestSchemaVersion {
+		return bytes, nil
+	}
+
+	record := make(map[string]interface{})
+	if err = json.Unmarshal(bytes, &record); err != nil {
+		return nil, err
+	}
+	for ; schemaVersion < pullRequestSchemaVersion; schemaVersion++ {
+		if err = pullRequestMigrations[schemaVersion](record); err != nil {
+			return nil, fmt.Errorf("could not migrate from schema version %d: %s", schemaVersion, err)
+		}
+		record["SchemaVersion"] = schemaVersion + 1
+	}
+	return json.Marshal(record)
+}
+
+func decodePullRequestWrapper(bytes []byte) (*PullRequestWrapper, error) {
+
+	bytes, err := migratePullRequest(bytes)
+	if err != nil {
+		return nil, err
+	}
+	var storedPullRequestWrapper storedPullRequestWrapper
+	if err = json.Unmarshal(bytes, &storedPullRequestWrapper); err != nil {
+		return nil, err
+	}
+	return convertStoredPullRequestWrapper(&storedPullRequestWrapper)
+}
+
+func encodePullRequestWrapper(pullRequestWrapper *PullRequestWrapper) ([]byte, error) {
+	return json.Marshal(convertPullRequestWrapperToStored(pullRequestWrapper))
+}
+
+func convertPullRequestWrapperToStored(pullRequestWrapper *PullRequestWrapper) *storedPullRequestWrapper {
+	return &storedPullRequestWrapper{
+		SchemaVersion:     pullRequestSchemaVersion,
+		Id:                pullRequestWrapper.Id,
+		PullRequestType:   pullRequestWrapper.PullRequestType,
+		FirstSeen:         pullRequestWrapper.FirstSeen,
+		Seen:              pullRequestWrapper.Seen,
+		Score:             convertPullRequestScoreToStored(pullRequestWrapper.Score),
+		PullRequest:       convertPullRequestToStored(pullRequestWrapper.PullRequest),
+		Deleted:           pullRequestWrapper.Deleted,
+		ReviewRequestedAt: pullRequestWrapper.ReviewRequestedAt,
+		LastViewed:        pullRequestWrapper.LastViewed,
+		Hidden:            pullRequestWrapper.Hidden,
+		SnoozedUntil:      pullRequestWrapper.SnoozedUntil,
+		Note:              pullRequestWrapper.Note,
+		Tags:              pullRequestWrapper.Tags,
+		NoteUpdatedAt:     pullRequestWrapper.NoteUpdatedAt,
+	}
+}
+
+func convertStoredPullRequestWrapper(storedPullRequestWrapper *storedPullRequestWrapper) (*PullRequestWrapper, error) {
+	if storedPullRequestWrapper.PullRequest == nil {
+		return nil, fmt.Errorf("pull request %d has no pull request", storedPullRequestWrapper.Id)
+	}
+	pullRequest, err := convertStoredPullRequest(storedPullRequestWrapper.PullRequest)
+	if err != nil {
+		return nil, err
+	}
+	return &PullRequestWrapper{
+		Id:                storedPullRequestWrapper.Id,
+		PullRequestType:   storedPullRequestWrapper.PullRequestType,
+		FirstSeen:         storedPullRequestWrapper.FirstSeen,
+		Seen:              storedPullRequestWrapper.Seen,
+		Score:             convertStoredPullRequestScore(storedPullRequestWrapper.Score),
+		PullRequest:       pullRequest,
+		Deleted:           storedPullRequestWrapper.Deleted,
+		ReviewRequestedAt: storedPullRequestWrapper.ReviewRequestedAt,
+		LastViewed:        storedPullRequestWrapper.LastViewed,
+		Hidden:            storedPullRequestWrapper.Hidden,
+		SnoozedUntil:      storedPullRequestWrapper.SnoozedUntil,
+		Note:              storedPullRequestWrapper.Note,
+		Tags:              storedPullRequestWrapper.Tags,
+		NoteUpdatedAt:     storedPullRequestWrapper.NoteUpdatedAt,
+	}, nil
+}
+
+// convertPullRequestScoreToStored copies the score field by field, so that PullRequestScore can change without
+// changing what is stored
+func convertPullRequestScoreToStored(score PullRequestScore) storedPullRequestScore {
+	return storedPullRequestScore{
+		Total: score.Total, Seen: score.Seen, AgeSec: score.AgeSec,
+		Approvals: score.Approvals, ApprovedByMe: score.ApprovedByMe, Comments: score.Comments, Dismissed: score.Dismissed,
+		ChangesRequested: score.ChangesRequested, NumReviewers: score.NumReviewers, IsMyPullRequest: score.IsMyPullRequest,
+		Size: score.Size, BoostedLabels: score.BoostedLabels, PenalizedLabels: score.PenalizedLabels,
+		BoostedTags: score.BoostedTags, PenalizedTags: score.PenalizedTags,
+	}
+}
+
+func convertStoredPullRequestScore(storedScore storedPullRequestScore) PullRequestScore {
+	return PullRequestScore{
+		Total: storedScore.Total, Seen: storedScore.Seen, AgeSec: storedScore.AgeSec,
+		Approvals: storedScore.Approvals, ApprovedByMe: storedScore.ApprovedByMe, Comments: storedScore.Comments, Dismissed: storedScore.Dismissed,
+		ChangesRequested: storedScore.ChangesRequested, NumReviewers: storedScore.NumReviewers, IsMyPullRequest: storedScore.IsMyPullRequest,
+		Size: storedScore.Size, BoostedLabels: storedScore.BoostedLabels, PenalizedLabels: storedScore.PenalizedLabels,
+		BoostedTags: storedScore.BoostedTags, PenalizedTags: storedScore.PenalizedTags,
+	}
+}
+
+func convertUserToStored(user *User) *storedUser {
+	if user == nil {
+		return nil
+	}
+	return &storedUser{Id: user.Id, Username: user.Username}
+}
+
+func convertStoredUser(storedUser *storedUser) *User {
+	if storedUser == nil {
+		return nil
+	}
+	return &User{Id: storedUser.Id, Username: storedUser.Username}
+}
+
+func convertURLToString(value *url.URL) string {
+	if value == nil {
+		return ""
+	}
+	return value.String()
+}
+
+func parseStoredURL(value string) (*url.URL, error) {
+	if value == "" {
+		return nil, nil
+	}
+	return url.Parse(value)
+}
+
+func convertPullRequestToStored(pullRequest *PullRequest) *storedPullRequest {
+
+	if pullRequest == nil {
+		return nil
+	}
+
+	storedPullRequest := &storedPullRequest{
+		Id: pullRequest.Id, Number: pullRequest.Number, Creator: convertUserToStored(pullRequest.Creator),
+		Title: pullRequest.Title, Body: pullRequest.Body,
+		HtmlURL: convertURLToString(pullRequest.HtmlURL), PullRequestURL: convertURLToString(pullRequest.PullRequestURL),
+		CreatedAt: pullRequest.CreatedAt, UpdatedAt: pullRequest.UpdatedAt,
+		Reviews: make([][]*storedPullRequestReview, 0), PullRequestType: pullRequest.PullRequestType,
+		Additions: pullRequest.Additions, Deletions: pullRequest.Deletions, ChangedFiles: pullRequest.ChangedFiles, Commits: pullRequest.Commits,
+		Labels:  make([]*storedLabel, 0),
+		HeadSHA: pullRequest.HeadSHA, HeadRef: pullRequest.HeadRef, HeadRepoFullName: pullRequest.HeadRepoFullName, BaseRef: pullRequest.BaseRef,
+		NodeId: pullRequest.NodeId, RequestedTeams: pullRequest.RequestedTeams, Draft: pullRequest.Draft, MergeableState: pullRequest.MergeableState,
+	}
+
+	if repo := pullRequest.Repo; repo != nil {
+		storedPullRequest.Repo = &storedRepo{
+			Id: repo.Id, Name: repo.Name, FullName: repo.FullName, Description: repo.Description, Url: convertURLToString(repo.Url),
+			AllowMergeCommit: repo.AllowMergeCommit, AllowSquashMerge: repo.AllowSquashMerge, AllowRebaseMerge: repo.AllowRebaseMerge,
+			AllowAutoMerge: repo.AllowAutoMerge, DeleteBranchOnMerge: repo.DeleteBranchOnMerge,
+		}
+	}
+	for _, label := range pullRequest.Labels {
+		storedPullRequest.Labels = append(storedPullRequest.Labels, &storedLabel{Id: label.Id, Name: label.Name, Color: label.Color, Description: label.Description})
+	}
+	if milestone := pullRequest.Milestone; milestone != nil {
+		storedPullRequest.Milestone = &storedMilestone{Id: milestone.Id, Number: milestone.Number, Title: milestone.Title, State: milestone.State, DueOn: milestone.DueOn}
+	}
+
+	// Reviewers in order of priority, then whoever has not been sorted yet
+	userIds := make([]uint32, 0)
+	sortedUserIds := make(map[uint32]bool)
+	for _, pullRequestReviews := range pullRequest.PullRequestReviewsByPriority {
+		if len(pullRequestReviews) > 0 && pullRequestReviews[0].User != nil && !sortedUserIds[pullRequestReviews[0].User.Id] {
+			userIds = append(userIds, pullRequestReviews[0].User.Id)
+			sortedUserIds[pullRequestReviews[0].User.Id] = true
+		}
+	}
+	unsortedUserIds := make([]uint32, 0)
+	for userId := range pullRequest.PullRequestReviewsByUser {
+		if !sortedUserIds[userId] {
+			unsortedUserIds = append(unsortedUserIds, userId)
+		}
+	}
+	sort.Slice(unsortedUserIds, func(i, j int) bool {
+		return unsortedUserIds[i] < unsortedUserIds[j]
+	})
+	for _, userId := range append(userIds, unsortedUserIds...) {
+		storedPullRequestReviews := make([]*storedPullRequestReview, 0)
+		for _, pullRequestReview := range pullRequest.PullRequestReviewsByUser[userId] {
+			storedPullRequestReviews = append(storedPullRequestReviews, &storedPullRequestReview{
+				User: convertUserToStored(pullRequestReview.User), Status: pullRequestReview.Status, SubmittedAt: pullRequestReview.SubmittedAt, Score: pullRequestReview.Score,
+			})
+		}
+		if len(storedPullRequestReviews) > 0 {
+			storedPullRequest.Reviews = append(storedPullRequest.Reviews, storedPullRequestReviews)
+		}
+	}
+
+	return storedPullRequest
+}
+
+func convertStoredPullRequest(storedPullRequest *storedPullRequest) (*PullRequest, error) {
+
+	htmlURL, err := parseStoredURL(storedPullRequest.HtmlURL)
+	if err != nil {
+		return nil, err
+	}
+	pullRequestURL, err := parseStoredURL(storedPullRequest.PullRequestURL)
+	if err != nil {
+		return nil, err
+	}
+
+	pullRequest := &PullRequest{
+		Id: storedPullRequest.Id, Number: storedPullRequest.Number, Creator: convertStoredUser(storedPullRequest.Creator),
+		Title: storedPullRequest.Title, Body: storedPullRequest.Body, HtmlURL: htmlURL, PullRequestURL: pullRequestURL,
+		CreatedAt: storedPullRequest.CreatedAt, UpdatedAt: storedPullRequest.UpdatedAt,
+		PullRequestReviewsByUser: make(map[uint32][]*PullRequestReview), PullRequestReviewsByPriority: make([][]*PullRequestReview, 0),
+		PullRequestType: storedPullRequest.PullRequestType,
+		Additions:       storedPullRequest.Additions, Deletions: storedPullRequest.Deletions, ChangedFiles: storedPullRequest.ChangedFiles, Commits: storedPullRequest.Commits,
+		Labels:  make([]*Label, 0),
+		HeadSHA: storedPullRequest.HeadSHA, HeadRef: storedPullRequest.HeadRef, HeadRepoFullName: storedPullRequest.HeadRepoFullName, BaseRef: storedPullRequest.BaseRef,
+		NodeId: storedPullRequest.NodeId, RequestedTeams: storedPullRequest.RequestedTeams, Draft: storedPullRequest.Draft, MergeableState: storedPullRequest.MergeableState,
+	}
+
+	if storedRepo := storedPullRequest.Repo; storedRepo != nil {
+		repoURL, err := parseStoredURL(storedRepo.Url)
+		if err != nil {
+			return nil, err
+		}
+		pullRequest.Repo = &Repo{
+			Id: storedRepo.Id, Name: storedRepo.Name, FullName: storedRepo.FullName, Description: storedRepo.Description, Url: repoURL,
+			AllowMergeCommit: storedRepo.AllowMergeCommit, AllowSquashMerge: storedRepo.AllowSquashMerge, AllowRebaseMerge: storedRepo.AllowRebaseMerge,
+			AllowAutoMerge: storedRepo.AllowAutoMerge, DeleteBranchOnMerge: storedRepo.DeleteBranchOnMerge,
+		}
+	}
+	for _, storedLabel := range storedPullRequest.Labels {
+		pullRequest.Labels = append(pullRequest.Labels, &Label{Id: storedLabel.Id, Name: storedLabel.Name, Color: storedLabel.Color, Description: storedLabel.Description})
+	}
+	if storedMilestone := storedPullRequest.Milestone; storedMilestone != nil {
+		pullRequest.Milestone = &Milestone{Id: storedMilestone.Id, Number: storedMilestone.Number, Title: storedMilestone.Title, State: storedMilestone.State, DueOn: storedMilestone.DueOn}
+	}
+	for _, storedPullRequestReviews := range storedPullRequest.Reviews {
+		pullRequestReviews := make([]*PullRequestReview, 0)
+		for _, storedPullRequestReview := range storedPullRequestReviews {
+			if storedPullRequestReview.User == nil {
+				continue
+			}
+			pullRequestReviews = append(pullRequestReviews, &PullRequestReview{
+				User: convertStoredUser(storedPullRequestReview.User), Status: storedPullRequestReview.Status, SubmittedAt: storedPullRequestReview.SubmittedAt, Score: storedPullRequestReview.Score,
+			})
+		}
+		if len(pullRequestReviews) == 0 {
+			continue
+		}
+		pullRequest.PullRequestReviewsByUser[pullRequestReviews[0].User.Id] = pullRequestReviews
+		pullRequest.PullRequestReviewsByPriority = append(pullRequest.PullRequestReviewsByPriority, pullRequestReviews)
+	}
+
+	return pullRequest, nil
+}
+
+// migratePullRequestFromVersion0 turns a serialized PullRequestWrapper into a storedPullRequestWrapper: URLs were
+// serialized field by field, the reviews were kept both by user and by priority and the lock came along too
+func migratePullRequestFromVersion0(record map[string]interface{}) error {
+
+	pullRequest, ok := record["PullRequest"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("no pull request")
+	}
+
+	var err error
+	for _, key := range []string{"HtmlURL", "PullRequestURL"} {
+		if pullRequest[key], err = convertVersion0URL(pullRequest[key]); err != nil {
+			return err
+		}
+	}
+	if repo, ok := pullRequest["Repo"].(map[string]interface{}); ok {
+		if repo["Url"], err = convertVersion0URL(repo["Url"]); err != nil {
+			return err
+		}
+	}
+
+	reviews := make([]interface{}, 0)
+	sortedUserIds := make(map[string]bool)
+	byPriority, _ := pullRequest["PullRequestReviewsByPriority"].([]interface{})
+	for _, pullRequestReviews := range byPriority {
+		if userId := getVersion0ReviewerId(pullRequestReviews); userId != "" && !sortedUserIds[userId] {
+			sortedUserIds[userId] = true
+			reviews = append(reviews, pullRequestReviews)
+		}
+	}
+	byUser, _ := pullRequest["PullRequestReviewsByUser"].(map[string]interface{})
+	unsortedUserIds := make([]string, 0)
+	for userId := range byUser {
+		if !sortedUserIds[userId] {
+			unsortedUserIds = append(unsortedUserIds, userId)
+		}
+	}
+	sort.Strings(unsortedUserIds)
+	for _, userId := range unsortedUserIds {
+		reviews = append(reviews, byUser[userId])
+	}
+	pullRequest["Reviews"] = reviews
+
+	delete(pullRequest, "PullRequestReviewsByUser")
+	delete(pullRequest, "PullRequestReviewsByPriority")
+	delete(pullRequest, "Lock")
+	return nil
+}
+
+// convertVersion0URL turns a url.URL serialized field by field back into a string
+func convertVersion0URL(value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	var parsedURL url.URL
+	if err = json.Unmarshal(bytes, &parsedURL); err != nil {
+		return "", fmt.Errorf("could not parse URL %s: %s", bytes, err)
+	}
+	return parsedURL.String(), nil
+}
+
+func getVersion0ReviewerId(pullRequestReviews interface{}) string {
+	reviews, _ := pullRequestReviews.([]interface{})
+	if len(reviews) == 0 {
+		return ""
+	}
+	review, _ := reviews[0].(map[string]interface{})
+	user, _ := review["User"].(map[string]interface{})
+	if id, ok := user["Id"].(float64); ok {
+		return fmt.Sprint(uint32(id))
+	}
+	return ""
+}
+
+// migratePullRequestFromVersion1 has nothing to convert, pull requests without a note or tags read as such.  The new
+// version keeps an older ghmon from storing them again without the note.
+func migratePullRequestFromVersion1(record map[string]interface{}) error {
+	return nil
+}
@@ -0,0 +1,186 @@
+package ghmon
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The fixtures are what each version of ghmon stored for the same pull request: pull-request-v0-baseline.json before
+// sizes, labels and the like were kept, pull-request-v0.json just before the schema was versioned, then one file per
+// schema version
+func loadFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	bytes, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes
+}
+
+func TestDecodePullRequestWrapperFromEverySchemaVersion(t *testing.T) {
+
+	fixtures := []struct {
+		name string
+		/* Written once the details of the pull request were kept */
+		detailed bool
+		/* Written once notes and tags were kept */
+		noted bool
+	}{
+		{"pull-request-v0-baseline.json", false, false},
+		{"pull-request-v0.json", true, false},
+		{"pull-request-v1.json", true, false},
+		{"pull-request-v2.json", true, true},
+	}
+
+	for _, fixture := range fixtures {
+
+		pullRequestWrapper, err := decodePullRequestWrapper(loadFixture(t, fixture.name))
+		if err != nil {
+			t.Errorf("%s: %s", fixture.name, err)
+			continue
+		}
+
+		if pullRequestWrapper.Id != 1002 || pullRequestWrapper.PullRequestType != Reviewer || !pullRequestWrapper.Seen {
+			t.Errorf("%s: unexpected wrapper %+v", fixture.name, pullRequestWrapper)
+		}
+		if !pullRequestWrapper.FirstSeen.Equal(time.Date(2021, 3, 1, 11, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s: first seen %s", fixture.name, pullRequestWrapper.FirstSeen)
+		}
+		if pullRequestWrapper.Score.Total != 42.5 || pullRequestWrapper.Score.NumReviewers != 3 || pullRequestWrapper.Score.Comments != 1 {
+			t.Errorf("%s: unexpected score %+v", fixture.name, pullRequestWrapper.Score)
+		}
+
+		pullRequest := pullRequestWrapper.PullRequest
+		if pullRequest.Title != "Add feature toggles" || pullRequest.Creator == nil || pullRequest.Creator.Username != "alice" {
+			t.Errorf("%s: unexpected pull request %+v", fixture.name, pullRequest)
+		}
+		if pullRequest.Repo == nil || pullRequest.Repo.FullName != "acme/widgets" || pullRequest.Repo.Url.String() != "https://api.github.com/repos/acme/widgets" {
+			t.Errorf("%s: unexpected repository %+v", fixture.name, pullRequest.Repo)
+		}
+		if pullRequest.HtmlURL.String() != "https://github.com/acme/widgets/pull/2" || pullRequest.PullRequestURL.String() != "https://api.github.com/repos/acme/widgets/pulls/2" {
+			t.Errorf("%s: unexpected URLs %s and %s", fixture.name, pullRequest.HtmlURL, pullRequest.PullRequestURL)
+		}
+
+		// The order of priority is kept, and so is the order of the reviews of each reviewer
+		reviewers := make([]string, 0)
+		for _, pullRequestReviews := range pullRequest.PullRequestReviewsByPriority {
+			reviewers = append(reviewers, pullRequestReviews[0].User.Username)
+		}
+		if !reflect.DeepEqual(reviewers, []string{"me", "dave", "carol"}) {
+			t.Errorf("%s: reviewers in the order %v", fixture.name, reviewers)
+		}
+		carolReviews := pullRequest.PullRequestReviewsByUser[60]
+		if len(carolReviews) != 2 || carolReviews[0].Status != PullRequestReviewStatusChangesRequested || carolReviews[1].Status != PullRequestReviewStatusApproved {
+			t.Errorf("%s: unexpected reviews of carol %+v", fixture.name, carolReviews)
+		} else if !carolReviews[1].SubmittedAt.Equal(time.Date(2021, 3, 3, 9, 0, 0, 0, time.UTC)) || carolReviews[1].Score != 12 {
+			t.Errorf("%s: unexpected approval of carol %+v", fixture.name, carolReviews[1])
+		}
+
+		if fixture.detailed {
+			if pullRequest.Number != 2 || pullRequest.Additions != 120 || pullRequest.HeadRef != "feature/toggles" || pullRequest.MergeableState != "clean" {
+				t.Errorf("%s: details missing from %+v", fixture.name, pullRequest)
+			}
+			if len(pullRequest.Labels) != 1 || pullRequest.Labels[0].Name != "wip" || pullRequest.Milestone == nil || pullRequest.Milestone.Title != "v1.0" {
+				t.Errorf("%s: labels %v, milestone %v", fixture.name, pullRequest.Labels, pullRequest.Milestone)
+			}
+			if !pullRequest.Repo.AllowSquashMerge || !pullRequest.Repo.DeleteBranchOnMerge {
+				t.Errorf("%s: merge settings missing from %+v", fixture.name, pullRequest.Repo)
+			}
+			if pullRequestWrapper.Score.Size != PullRequestSizeM || pullRequestWrapper.Score.PenalizedLabels != 1 {
+				t.Errorf("%s: unexpected score %+v", fixture.name, pullRequestWrapper.Score)
+			}
+			if !pullRequestWrapper.SnoozedUntil.Equal(time.Date(2021, 3, 10, 9, 0, 0, 0, time.UTC)) {
+				t.Errorf("%s: snoozed until %s", fixture.name, pullRequestWrapper.SnoozedUntil)
+			}
+		}
+
+		if fixture.noted {
+			if pullRequestWrapper.Note != "waiting on infra" || !reflect.DeepEqual(pullRequestWrapper.Tags, []string{"later", "infra"}) || pullRequestWrapper.Score.BoostedTags != 1 {
+				t.Errorf("%s: note %q, tags %v, score %+v", fixture.name, pullRequestWrapper.Note, pullRequestWrapper.Tags, pullRequestWrapper.Score)
+			}
+		} else if pullRequestWrapper.Note != "" || len(pullRequestWrapper.Tags) != 0 {
+			t.Errorf("%s: note %q and tags %v out of nowhere", fixture.name, pullRequestWrapper.Note, pullRequestWrapper.Tags)
+		}
+	}
+}
+
+func TestMigratePullRequestBringsEveryVersionToTheCurrentOne(t *testing.T) {
+
+	for _, name := range []string{"pull-request-v0-baseline.json", "pull-request-v0.json", "pull-request-v1.json", "pull-request-v2.json"} {
+
+		bytes, err := migratePullRequest(loadFixture(t, name))
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if schemaVersion, err := getSchemaVersion(bytes); err != nil || schemaVersion != pullRequestSchemaVersion {
+			t.Errorf("%s: migrated to schema version %d (%v)", name, schemaVersion, err)
+		}
+
+		var record struct {
+			PullRequest map[string]interface{}
+		}
+		if err = json.Unmarshal(bytes, &record); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"PullRequestReviewsByUser", "PullRequestReviewsByPriority", "Lock"} {
+			if _, ok := record.PullRequest[key]; ok {
+				t.Errorf("%s: %s left after migrating", name, key)
+			}
+		}
+	}
+}
+
+func TestEncodePullRequestWrapperWritesTheCurrentSchema(t *testing.T) {
+
+	fixture := loadFixture(t, "pull-request-v2.json")
+	pullRequestWrapper, err := decodePullRequestWrapper(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes, err := encodePullRequestWrapper(pullRequestWrapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Anything the in-memory types add or move must not change what is stored
+	var expected, encoded interface{}
+	if err = json.Unmarshal(fixture, &expected); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(bytes, &encoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, encoded) {
+		t.Errorf("encoded as\n%s\nexpected\n%s", bytes, fixture)
+	}
+}
+
+func TestDecodePullRequestWrapperRefusesNewerSchemas(t *testing.T) {
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(loadFixture(t, "pull-request-v2.json"), &record); err != nil {
+		t.Fatal(err)
+	}
+	record["SchemaVersion"] = pullRequestSchemaVersion + 1
+	bytes, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = decodePullRequestWrapper(bytes)
+	if _, isNewerSchema := err.(*newerSchemaError); !isNewerSchema {
+		t.Fatalf("expected a newer schema error, got %v", err)
+	}
+	if isCorrupt(err) {
+		t.Errorf("a pull request stored by a newer ghmon is taken for corrupt")
+	}
+
+	if _, err = decodePullRequestWrapper([]byte(`{"SchemaVersion": 1, "PullRequest": `)); err == nil || !isCorrupt(err) {
+		t.Errorf("a truncated pull request is not taken for corrupt (%v)", err)
+	}
+}
@@ -2,6 +2,7 @@ package ghmon
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -9,96 +10,522 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
-type Storage struct {
+// Store keeps the pull requests, their diffs, their histories and the preferences between runs
+type Store interface {
+	// LoadPullRequestWrapper returns nil without an error when the pull request is not stored
+	LoadPullRequestWrapper(id uint32) (*PullRequestWrapper, error)
+	LoadPullRequestWrappers() ([]*PullRequestWrapper, error)
+	LoadPullRequestWrappersByRepository(repositoryFullName string) ([]*PullRequestWrapper, error)
+	LoadPullRequestWrappersByState(state string) ([]*PullRequestWrapper, error)
+	StorePullRequestWrapper(pullRequestWrapper *PullRequestWrapper)
+	// StorePullRequestWrappers stores them in one go where the store can: all or none for the bolt store, one file
+	// at a time for the file store, which keeps the ones written before a failure
+	StorePullRequestWrappers(pullRequestWrappers []*PullRequestWrapper) error
+	// DeletePullRequestWrappers deletes the pull requests along with their diffs and returns the ones deleted.  Those
+	// can be fewer than asked for when it fails, a store that cannot delete them all at once stops halfway.
+	DeletePullRequestWrappers(ids []uint32) ([]uint32, error)
+	LoadPullRequestDiff(id uint32, headSHA string) *PullRequestDiff
+	StorePullRequestDiff(pullRequestDiff *PullRequestDiff)
+	LoadPreferences() *Preferences
+	StorePreferences(preferences *Preferences)
+	// LoadPullRequestHistory returns nil without an error when nothing was recorded for the pull request
+	LoadPullRequestHistory(id uint32) (*PullRequestHistory, error)
+	LoadPullRequestHistories() ([]*PullRequestHistory, error)
+	StorePullRequestHistory(history *PullRequestHistory) error
+	// DeletePullRequestHistories is separate from DeletePullRequestWrappers, histories outlive the pull requests
+	DeletePullRequestHistories(ids []uint32) error
+	// Batch runs the writes in one go where the store can, like StorePullRequestWrappers.  The writes go through the
+	// batch only, the store itself is not used until they return.
+	Batch(write func(batch StoreBatch) error) error
+	// Close lets go of what the store keeps open, the store is not used afterwards
+	Close() error
+	// makeWritable is called once the store is locked, the store only reads until then.  Returns what the user has to
+	// be told about it, e.g. that what was stored was moved to another backend.
+	makeWritable(backupFolder string) (string, error)
+}
+
+// StoreBatch is what the writes of a batch can do
+type StoreBatch interface {
+	StorePullRequestWrappers(pullRequestWrappers []*PullRequestWrapper) error
+	LoadPullRequestHistory(id uint32) (*PullRequestHistory, error)
+	StorePullRequestHistory(history *PullRequestHistory) error
+}
+
+// errReadOnlyStore is returned when writing to a store locked by another process
+var errReadOnlyStore = errors.New("the store is read-only")
+
+/* Storage backends */
+const (
+	storageBolt  = "bolt"
+	storageFiles = "files"
+)
+
+// FileStore keeps every pull request and diff in its own JSON file
+type FileStore struct {
 	logger *log.Logger
 	cachedPullRequestFolder string
+	preferencesFile string
+	cachedDiffFolder string
+	historyFolder string
+	/* Files that could not be parsed are moved here */
+	quarantineFolder string
+	readOnly bool
 }
 
-func (ghmStorage *Storage) createCachedPullRequestWrapperFilename(id uint32) string {
-	return filepath.Join(ghmStorage.cachedPullRequestFolder,fmt.Sprintf("%d.json",id))
+// Preferences holds the UI state that survives restarts
+type Preferences struct {
+	Filter                string
+	SortMode              SortMode
+	SortDescending        bool
+	GroupByRepository     bool
+	CollapsedRepositories []string
+	ListPaneWeight        int
 }
 
-func (ghmStorage *Storage) loadPullRequest(id uint32, channel chan *PullRequestWrapper) {
+// newStore opens the configured backend for reading, see makeWritable
+func newStore(configuration *Configuration, configPath string, logger *log.Logger) (Store, error) {
 
-	pullRequestWrapperFilePath := ghmStorage.createCachedPullRequestWrapperFilename(id)
+	fileStore := &FileStore{
+		cachedPullRequestFolder: filepath.Join(configPath, "pull-requests"),
+		preferencesFile: filepath.Join(configPath, "preferences.json"),
+		cachedDiffFolder: filepath.Join(configPath, "diffs"),
+		historyFolder: filepath.Join(configPath, "history"),
+		quarantineFolder: filepath.Join(configPath, "quarantine"),
+		logger: logger,
+		readOnly: true,
+	}
 
-	if _, err := os.Stat(pullRequestWrapperFilePath); err == nil {
-		// If it exist, read it & parse the JSON
-		if bytes, err := ioutil.ReadFile(pullRequestWrapperFilePath); err == nil {
+	switch configuration.Storage {
+	case storageFiles:
+		return fileStore, nil
+	case storageBolt:
+		return &BoltStore{path: filepath.Join(configPath, "ghmon.db"), legacyFileStore: fileStore, logger: logger, readOnly: true}, nil
+	}
+	return nil, fmt.Errorf("unknown storage '%s', expected %s or %s", configuration.Storage, storageBolt, storageFiles)
+}
 
-			var pullRequestWrapper PullRequestWrapper
-			if err = json.Unmarshal(bytes, &pullRequestWrapper); err == nil {
-				channel <- &pullRequestWrapper
-			}
+func createDefaultPreferences() *Preferences {
+	return &Preferences{SortMode: SortByScore, SortDescending: DefaultSortDescending(SortByScore), ListPaneWeight: defaultListPaneWeight}
+}
 
+// makeWritable creates the folders and migrates the pull requests stored with an older schema, after a backup in the
+// backups folder
+func (ghmStorage *FileStore) makeWritable(backupFolder string) (string, error) {
+	ghmStorage.readOnly = false
+	for _, folder := range []string{ghmStorage.cachedPullRequestFolder, ghmStorage.cachedDiffFolder, ghmStorage.historyFolder} {
+		if err := os.MkdirAll(folder, 0755); err != nil {
+			return "", err
 		}
+	}
+	if err := ghmStorage.migrateSchema(backupFolder); err != nil {
+		return "", fmt.Errorf("could not migrate %s: %s", ghmStorage.cachedPullRequestFolder, err)
+	}
+	return "", nil
+}
+
+// Batch has nothing to group the writes in, each file is written on its own
+func (ghmStorage *FileStore) Batch(write func(batch StoreBatch) error) error {
+	return write(ghmStorage)
+}
+
+// Close has nothing to do, the files are only open while read or written
+func (ghmStorage *FileStore) Close() error {
+	return nil
+}
 
+// writeFile writes to a temporary file next to the file and renames it over the file, so that a crash leaves either
+// the previous or the new content but never a part of it
+func (ghmStorage *FileStore) writeFile(path string, bytes []byte) error {
 
-	} else if os.IsNotExist(err) {
-		// path/to/whatever does *not* exist
-	} else {
-		// Could be a path issue, or read-permission
+	if ghmStorage.readOnly {
+		return errReadOnlyStore
 	}
 
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(bytes)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
 
-	channel <- nil
+func (ghmStorage *FileStore) removeFile(path string) error {
+	if ghmStorage.readOnly {
+		return errReadOnlyStore
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// quarantine moves a file that could not be parsed out of the way, so it is neither loaded again nor overwritten
+func (ghmStorage *FileStore) quarantine(path string, cause error) error {
 
+	if ghmStorage.readOnly {
+		return cause
+	}
+	if err := os.MkdirAll(ghmStorage.quarantineFolder, 0755); err != nil {
+		return cause
+	}
+	quarantinePath := filepath.Join(ghmStorage.quarantineFolder, fmt.Sprintf("%s.%s", filepath.Base(path), time.Now().Format("20060102-150405")))
+	if err := os.Rename(path, quarantinePath); err != nil {
+		return cause
+	}
+	ghmStorage.logger.Printf("Moved %s to %s: %s", path, quarantinePath, cause)
+	return fmt.Errorf("%s, moved to %s", cause, quarantinePath)
 }
 
-func (ghmStorage *Storage) DeletePullRequestWrapper(id uint32) {
-	pullRequestWrapperFilePath := ghmStorage.createCachedPullRequestWrapperFilename(id)
-	err := os.Remove(pullRequestWrapperFilePath)
-	if err != nil {
+func (ghmStorage *FileStore) createCachedPullRequestWrapperFilename(id uint32) string {
+	return filepath.Join(ghmStorage.cachedPullRequestFolder,fmt.Sprintf("%d.json",id))
+}
 
+func (ghmStorage *FileStore) LoadPullRequestWrapper(id uint32) (*PullRequestWrapper, error) {
+
+	bytes, err := ioutil.ReadFile(ghmStorage.createCachedPullRequestWrapperFilename(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	pullRequestWrapper, err := decodePullRequestWrapper(bytes)
+	if err != nil {
+		if isCorrupt(err) {
+			err = ghmStorage.quarantine(ghmStorage.createCachedPullRequestWrapperFilename(id), err)
+		}
+		return nil, fmt.Errorf("could not parse pull request %d: %s", id, err)
 	}
+	return pullRequestWrapper, nil
 }
 
-func (ghmStorage *Storage) LoadPullRequestWrapper(id uint32) chan *PullRequestWrapper {
-	channel := make(chan *PullRequestWrapper,1)
-	go ghmStorage.loadPullRequest(id, channel)
-	return channel
+func (ghmStorage *FileStore) LoadPullRequestWrappers() ([]*PullRequestWrapper, error) {
+
+	pullRequestIdentifiers, err := ghmStorage.loadStoredPullRequestIdentifiers()
+	if err != nil {
+		return nil, err
+	}
+
+	pullRequestWrappers := make([]*PullRequestWrapper, 0, len(pullRequestIdentifiers))
+	for _, pullRequestIdentifier := range pullRequestIdentifiers {
+		pullRequestWrapper, err := ghmStorage.LoadPullRequestWrapper(pullRequestIdentifier)
+		if err != nil {
+			// One broken file should not hide all the other pull requests
+			ghmStorage.logger.Printf("Skipping stored pull request: %s", err)
+			continue
+		}
+		if pullRequestWrapper != nil {
+			pullRequestWrappers = append(pullRequestWrappers, pullRequestWrapper)
+		}
+	}
+	return pullRequestWrappers, nil
 }
 
-func (ghmStorage *Storage) StorePullRequestWrapper(pullRequestWrapper *PullRequestWrapper) {
+// LoadPullRequestWrappersByRepository has no index to use, it reads every file
+func (ghmStorage *FileStore) LoadPullRequestWrappersByRepository(repositoryFullName string) ([]*PullRequestWrapper, error) {
+	return ghmStorage.loadMatchingPullRequestWrappers(func(pullRequestWrapper *PullRequestWrapper) bool {
+		return pullRequestWrapper.PullRequest.Repo != nil && strings.EqualFold(pullRequestWrapper.PullRequest.Repo.FullName, repositoryFullName)
+	})
+}
 
-	pullRequestWrapperFilePath := ghmStorage.createCachedPullRequestWrapperFilename(pullRequestWrapper.Id)
+// LoadPullRequestWrappersByState has no index to use, it reads every file
+func (ghmStorage *FileStore) LoadPullRequestWrappersByState(state string) ([]*PullRequestWrapper, error) {
+	return ghmStorage.loadMatchingPullRequestWrappers(func(pullRequestWrapper *PullRequestWrapper) bool {
+		return getPullRequestState(pullRequestWrapper) == state
+	})
+}
 
-	if bytes, err := json.Marshal(pullRequestWrapper); err == nil {
+func (ghmStorage *FileStore) loadMatchingPullRequestWrappers(matches func(pullRequestWrapper *PullRequestWrapper) bool) ([]*PullRequestWrapper, error) {
 
-		if _, err := os.Stat(pullRequestWrapperFilePath); err == nil || os.IsNotExist(err) {
-			// If it exist, write out the JSON
-			if err = ioutil.WriteFile(pullRequestWrapperFilePath, bytes, 0644); err == nil {
-				// All good :)
-			}
-		} else if os.IsNotExist(err) {
-			//
-		} else {
-			// Could be a path issue, or read-permission
+	pullRequestWrappers, err := ghmStorage.LoadPullRequestWrappers()
+	if err != nil {
+		return nil, err
+	}
+	matchingPullRequestWrappers := make([]*PullRequestWrapper, 0)
+	for _, pullRequestWrapper := range pullRequestWrappers {
+		if matches(pullRequestWrapper) {
+			matchingPullRequestWrappers = append(matchingPullRequestWrappers, pullRequestWrapper)
 		}
+	}
+	return matchingPullRequestWrappers, nil
+}
+
+func (ghmStorage *FileStore) StorePullRequestWrapper(pullRequestWrapper *PullRequestWrapper) {
+	if err := ghmStorage.writePullRequestWrapper(pullRequestWrapper); err != nil && err != errReadOnlyStore {
+		ghmStorage.logger.Printf("Could not store pull request %d: %s", pullRequestWrapper.Id, err)
+	}
+}
 
+func (ghmStorage *FileStore) writePullRequestWrapper(pullRequestWrapper *PullRequestWrapper) error {
+	bytes, err := encodePullRequestWrapper(pullRequestWrapper)
+	if err != nil {
+		return err
 	}
+	return ghmStorage.writeFile(ghmStorage.createCachedPullRequestWrapperFilename(pullRequestWrapper.Id), bytes)
+}
 
+// StorePullRequestWrappers writes one file per pull request, files cannot do better than stopping at the first error
+func (ghmStorage *FileStore) StorePullRequestWrappers(pullRequestWrappers []*PullRequestWrapper) error {
+	for _, pullRequestWrapper := range pullRequestWrappers {
+		if err := ghmStorage.writePullRequestWrapper(pullRequestWrapper); err != nil {
+			return fmt.Errorf("could not store pull request %d: %s", pullRequestWrapper.Id, err)
+		}
+	}
+	return nil
 }
 
-func (ghmStorage *Storage) loadStoredPullRequestIdentifiers() ([]uint32, error) {
+func (ghmStorage *FileStore) DeletePullRequestWrappers(ids []uint32) ([]uint32, error) {
+	// One file at a time, the ones removed before a failure stay removed
+	deletedIds := make([]uint32, 0, len(ids))
+	for _, id := range ids {
+		if err := ghmStorage.removeFile(ghmStorage.createCachedPullRequestWrapperFilename(id)); err != nil {
+			return deletedIds, err
+		}
+		ghmStorage.deletePullRequestDiffs(id, "")
+		deletedIds = append(deletedIds, id)
+	}
+	return deletedIds, nil
+}
 
-	// List all the files in the pull request folder
+// migrateSchema rewrites the pull requests stored with an older schema, copying the files to the backup folder first
+func (ghmStorage *FileStore) migrateSchema(backupFolder string) error {
 
-	f, err := os.Open(ghmStorage.cachedPullRequestFolder)
+	pullRequestIdentifiers, err := ghmStorage.loadStoredPullRequestIdentifiers()
 	if err != nil {
+		return err
+	}
+
+	outdatedFiles := make(map[uint32][]byte)
+	for _, pullRequestIdentifier := range pullRequestIdentifiers {
+		bytes, err := ioutil.ReadFile(ghmStorage.createCachedPullRequestWrapperFilename(pullRequestIdentifier))
+		if err != nil {
+			return err
+		}
+		if schemaVersion, err := getSchemaVersion(bytes); err == nil && schemaVersion < pullRequestSchemaVersion {
+			outdatedFiles[pullRequestIdentifier] = bytes
+		}
+	}
+	if len(outdatedFiles) == 0 {
+		return nil
+	}
+
+	backupPath := filepath.Join(backupFolder, fmt.Sprintf("pull-requests-%s", time.Now().Format("20060102-150405")))
+	if err = os.MkdirAll(backupPath, 0755); err != nil {
+		return err
+	}
+	for pullRequestIdentifier, bytes := range outdatedFiles {
+		if err = ghmStorage.writeFile(filepath.Join(backupPath, fmt.Sprintf("%d.json", pullRequestIdentifier)), bytes); err != nil {
+			return err
+		}
+	}
+
+	for pullRequestIdentifier, bytes := range outdatedFiles {
+		pullRequestWrapper, err := decodePullRequestWrapper(bytes)
+		if err != nil {
+			// Left as it is, loading it will skip it
+			ghmStorage.logger.Printf("Could not migrate pull request %d: %s", pullRequestIdentifier, err)
+			continue
+		}
+		if err = ghmStorage.writePullRequestWrapper(pullRequestWrapper); err != nil {
+			return err
+		}
+	}
+	ghmStorage.logger.Printf("Migrated %d pull requests to schema version %d, the previous files are in %s", len(outdatedFiles), pullRequestSchemaVersion, backupPath)
+	return nil
+}
+
+func (ghmStorage *FileStore) loadStoredPullRequestIdentifiers() ([]uint32, error) {
+	return ghmStorage.loadStoredIdentifiers(ghmStorage.cachedPullRequestFolder)
+}
+
+func (ghmStorage *FileStore) loadStoredIdentifiers(folder string) ([]uint32, error) {
+
+	// List all the files in the folder
+
+	f, err := os.Open(folder)
+	if os.IsNotExist(err) {
+		// Nothing stored yet
+		return []uint32{}, nil
+	} else if err != nil {
 		return nil,err
 	}
+	defer f.Close()
 	names, err := f.Readdirnames(0)
 	if err != nil {
 		return nil,err
 	}
 	identifiers := make([]uint32, 0)
 	for _,name := range names {
-		parseUint, _ := strconv.ParseUint(strings.Split(name, ".json")[0], 10, 32)
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		parseUint, err := strconv.ParseUint(strings.TrimSuffix(name, ".json"), 10, 32)
+		if err != nil {
+			ghmStorage.logger.Printf("Ignoring %s in %s", name, folder)
+			continue
+		}
 		identifiers = append(identifiers, uint32(parseUint))
 	}
 	return identifiers, nil
 }
 
+func (ghmStorage *FileStore) LoadPreferences() *Preferences {
+
+	preferences := createDefaultPreferences()
+
+	bytes, err := ioutil.ReadFile(ghmStorage.preferencesFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			ghmStorage.logger.Printf("Could not read preferences: %s", err)
+		}
+		return preferences
+	}
+
+	if err = json.Unmarshal(bytes, preferences); err != nil {
+		ghmStorage.logger.Printf("Could not parse preferences: %s", ghmStorage.quarantine(ghmStorage.preferencesFile, err))
+		return createDefaultPreferences()
+	}
+	return preferences
+}
+
+func (ghmStorage *FileStore) StorePreferences(preferences *Preferences) {
+
+	bytes, err := json.Marshal(preferences)
+	if err != nil {
+		ghmStorage.logger.Printf("Could not serialize preferences: %s", err)
+		return
+	}
+
+	if err = ghmStorage.writeFile(ghmStorage.preferencesFile, bytes); err != nil && err != errReadOnlyStore {
+		ghmStorage.logger.Printf("Could not write preferences: %s", err)
+	}
+}
+
+func (ghmStorage *FileStore) createCachedPullRequestDiffFilename(id uint32, headSHA string) string {
+	return filepath.Join(ghmStorage.cachedDiffFolder, fmt.Sprintf("%d-%s.json", id, headSHA))
+}
+
+func (ghmStorage *FileStore) LoadPullRequestDiff(id uint32, headSHA string) *PullRequestDiff {
+
+	pullRequestDiffFilename := ghmStorage.createCachedPullRequestDiffFilename(id, headSHA)
+	bytes, err := ioutil.ReadFile(pullRequestDiffFilename)
+	if err != nil {
+		return nil
+	}
+
+	var pullRequestDiff PullRequestDiff
+	if err = json.Unmarshal(bytes, &pullRequestDiff); err != nil {
+		ghmStorage.logger.Printf("Could not parse cached diff for %d: %s", id, ghmStorage.quarantine(pullRequestDiffFilename, err))
+		return nil
+	}
+	return &pullRequestDiff
+}
+
+func (ghmStorage *FileStore) StorePullRequestDiff(pullRequestDiff *PullRequestDiff) {
+
+	bytes, err := json.Marshal(pullRequestDiff)
+	if err != nil {
+		ghmStorage.logger.Printf("Could not serialize diff for %d: %s", pullRequestDiff.Id, err)
+		return
+	}
+
+	pullRequestDiffFilename := ghmStorage.createCachedPullRequestDiffFilename(pullRequestDiff.Id, pullRequestDiff.HeadSHA)
+	if err = ghmStorage.writeFile(pullRequestDiffFilename, bytes); err != nil {
+		if err != errReadOnlyStore {
+			ghmStorage.logger.Printf("Could not write diff for %d: %s", pullRequestDiff.Id, err)
+		}
+		return
+	}
+
+	// Only the diff of the latest head commit is worth keeping
+	ghmStorage.deletePullRequestDiffs(pullRequestDiff.Id, pullRequestDiffFilename)
+}
+
+func (ghmStorage *FileStore) deletePullRequestDiffs(id uint32, keptFilename string) {
+	matches, _ := filepath.Glob(filepath.Join(ghmStorage.cachedDiffFolder, fmt.Sprintf("%d-*.json", id)))
+	for _, match := range matches {
+		if match == keptFilename {
+			continue
+		}
+		if err := ghmStorage.removeFile(match); err != nil {
+			ghmStorage.logger.Printf("Could not remove cached diff %s: %s", match, err)
+		}
+	}
+}
+
+func (ghmStorage *FileStore) createHistoryFilename(id uint32) string {
+	return filepath.Join(ghmStorage.historyFolder, fmt.Sprintf("%d.json", id))
+}
+
+func (ghmStorage *FileStore) LoadPullRequestHistory(id uint32) (*PullRequestHistory, error) {
+
+	historyFilename := ghmStorage.createHistoryFilename(id)
+	bytes, err := ioutil.ReadFile(historyFilename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var history PullRequestHistory
+	if err = json.Unmarshal(bytes, &history); err != nil {
+		return nil, fmt.Errorf("could not parse the history of %d: %s", id, ghmStorage.quarantine(historyFilename, err))
+	}
+	return &history, nil
+}
+
+func (ghmStorage *FileStore) LoadPullRequestHistories() ([]*PullRequestHistory, error) {
+
+	identifiers, err := ghmStorage.loadStoredIdentifiers(ghmStorage.historyFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	histories := make([]*PullRequestHistory, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		history, err := ghmStorage.LoadPullRequestHistory(identifier)
+		if err != nil {
+			ghmStorage.logger.Printf("Skipping stored history: %s", err)
+			continue
+		}
+		if history != nil {
+			histories = append(histories, history)
+		}
+	}
+	return histories, nil
+}
+
+func (ghmStorage *FileStore) StorePullRequestHistory(history *PullRequestHistory) error {
+	bytes, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return ghmStorage.writeFile(ghmStorage.createHistoryFilename(history.Id), bytes)
+}
+
+func (ghmStorage *FileStore) DeletePullRequestHistories(ids []uint32) error {
+	for _, id := range ids {
+		if err := ghmStorage.removeFile(ghmStorage.createHistoryFilename(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
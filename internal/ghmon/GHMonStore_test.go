@@ -0,0 +1,315 @@
+package ghmon
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kelseyhightower/envconfig"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestStore(t *testing.T, storage string) (Store, string) {
+	t.Helper()
+	configPath, err := ioutil.TempDir("", "ghmon-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(configPath)
+	})
+	store, err := newStore(&Configuration{Storage: storage}, configPath, log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+	})
+	return store, configPath
+}
+
+func TestFileStoreBacksUpBeforeMigrating(t *testing.T) {
+
+	store, configPath := newTestStore(t, storageFiles)
+	fixture := loadFixture(t, "pull-request-v0.json")
+	pullRequestFile := filepath.Join(configPath, "pull-requests", "1002.json")
+	if err := os.MkdirAll(filepath.Dir(pullRequestFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(pullRequestFile, fixture, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	backupFolder := filepath.Join(configPath, "backups")
+	if _, err := store.makeWritable(backupFolder); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(backupFolder, "pull-requests-*", "1002.json"))
+	if len(backups) != 1 {
+		t.Fatalf("expected a single backup, found %v", backups)
+	}
+	if backup, err := ioutil.ReadFile(backups[0]); err != nil || !bytes.Equal(backup, fixture) {
+		t.Errorf("the backup is not what was stored (%v)", err)
+	}
+
+	migrated, err := ioutil.ReadFile(pullRequestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schemaVersion, _ := getSchemaVersion(migrated); schemaVersion != pullRequestSchemaVersion {
+		t.Errorf("stored with schema version %d after migrating", schemaVersion)
+	}
+	if pullRequestWrapper, err := store.LoadPullRequestWrapper(1002); err != nil || pullRequestWrapper == nil || pullRequestWrapper.PullRequest.Number != 2 {
+		t.Errorf("could not load the migrated pull request: %v %v", pullRequestWrapper, err)
+	}
+
+	// Nothing is left to migrate, so nothing is backed up again
+	if _, err = store.makeWritable(backupFolder); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ = filepath.Glob(filepath.Join(backupFolder, "*")); len(backups) != 1 {
+		t.Errorf("expected a single backup, found %v", backups)
+	}
+}
+
+func TestBoltStoreBacksUpBeforeMigrating(t *testing.T) {
+
+	store, configPath := newTestStore(t, storageBolt)
+	backupFolder := filepath.Join(configPath, "backups")
+	if _, err := store.makeWritable(backupFolder); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(backupFolder); !os.IsNotExist(err) {
+		t.Errorf("backed up with nothing to migrate")
+	}
+
+	// Stored by the previous version of ghmon, which is opened again by this one
+	store.Close()
+	fixture := loadFixture(t, "pull-request-v1.json")
+	databasePath := filepath.Join(configPath, "ghmon.db")
+	db, err := bolt.Open(databasePath, 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(pullRequestsBucket).Put(createKey(1002), fixture)
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = newStore(&Configuration{Storage: storageBolt}, configPath, log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.makeWritable(backupFolder); err != nil {
+		t.Fatal(err)
+	}
+	if pullRequestWrappers, err := store.LoadPullRequestWrappersByRepository("acme/widgets"); err != nil || len(pullRequestWrappers) != 1 {
+		t.Errorf("the migrated pull request is not indexed: %v %v", pullRequestWrappers, err)
+	}
+	store.Close()
+
+	readPullRequest := func(path string) []byte {
+		db, err := bolt.Open(path, 0644, &bolt.Options{ReadOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		var stored []byte
+		db.View(func(tx *bolt.Tx) error {
+			stored = append([]byte{}, tx.Bucket(pullRequestsBucket).Get(createKey(1002))...)
+			return nil
+		})
+		return stored
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(backupFolder, "ghmon-*.db"))
+	if len(backups) != 1 {
+		t.Fatalf("expected a single backup, found %v", backups)
+	}
+	if !bytes.Equal(readPullRequest(backups[0]), fixture) {
+		t.Errorf("the backup is not what was stored")
+	}
+	if schemaVersion, _ := getSchemaVersion(readPullRequest(databasePath)); schemaVersion != pullRequestSchemaVersion {
+		t.Errorf("stored with schema version %d after migrating", schemaVersion)
+	}
+}
+
+func TestFileStoreKeepsPullRequestsOfNewerSchemas(t *testing.T) {
+
+	store, configPath := newTestStore(t, storageFiles)
+	if _, err := store.makeWritable(filepath.Join(configPath, "backups")); err != nil {
+		t.Fatal(err)
+	}
+	newer := bytes.Replace(loadFixture(t, "pull-request-v2.json"), []byte(`"SchemaVersion": 2`), []byte(`"SchemaVersion": 99`), 1)
+	pullRequestFile := filepath.Join(configPath, "pull-requests", "1002.json")
+	if err := ioutil.WriteFile(pullRequestFile, newer, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.LoadPullRequestWrapper(1002); err == nil {
+		t.Errorf("loaded a pull request stored by a newer ghmon")
+	}
+	if stored, err := ioutil.ReadFile(pullRequestFile); err != nil || !bytes.Equal(stored, newer) {
+		t.Errorf("the pull request stored by a newer ghmon was moved or changed (%v)", err)
+	}
+}
+
+func TestBoltStoreCopiesTheFileStoreOnceAndSaysSo(t *testing.T) {
+
+	store, configPath := newTestStore(t, storageBolt)
+	fileStore := &FileStore{
+		cachedPullRequestFolder: filepath.Join(configPath, "pull-requests"), historyFolder: filepath.Join(configPath, "history"),
+		cachedDiffFolder: filepath.Join(configPath, "diffs"), preferencesFile: filepath.Join(configPath, "preferences.json"),
+		quarantineFolder: filepath.Join(configPath, "quarantine"), logger: log.New(ioutil.Discard, "", 0),
+	}
+	if _, err := fileStore.makeWritable(filepath.Join(configPath, "backups")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fileStore.createCachedPullRequestWrapperFilename(1002), loadFixture(t, "pull-request-v2.json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileStore.StorePullRequestHistory(&PullRequestHistory{Id: 1002, Repository: "acme/widgets", Number: 2, Title: "Add feature toggles"}); err != nil {
+		t.Fatal(err)
+	}
+
+	notice, err := store.makeWritable(filepath.Join(configPath, "backups"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notice == "" {
+		t.Errorf("moved what was stored to the database without a word")
+	}
+	if history, err := store.LoadPullRequestHistory(1002); err != nil || history == nil || history.Title != "Add feature toggles" {
+		t.Errorf("the history was not copied: %v %v", history, err)
+	}
+	if pullRequestWrapper, err := store.LoadPullRequestWrapper(1002); err != nil || pullRequestWrapper == nil {
+		t.Errorf("the pull request was not copied: %v %v", pullRequestWrapper, err)
+	}
+
+	// Copied only once, so there is nothing to say the next time
+	if notice, err = store.makeWritable(filepath.Join(configPath, "backups")); err != nil || notice != "" {
+		t.Errorf("told %q again (%v)", notice, err)
+	}
+}
+
+func TestBoltStoreSaysNothingWhenNothingWasStored(t *testing.T) {
+	store, configPath := newTestStore(t, storageBolt)
+	if notice, err := store.makeWritable(filepath.Join(configPath, "backups")); err != nil || notice != "" {
+		t.Errorf("told %q with nothing stored (%v)", notice, err)
+	}
+}
+
+func TestStorageDefaultsToFiles(t *testing.T) {
+
+	if storage, ok := os.LookupEnv("GHMON_STORAGE"); ok {
+		os.Unsetenv("GHMON_STORAGE")
+		t.Cleanup(func() {
+			os.Setenv("GHMON_STORAGE", storage)
+		})
+	}
+	configuration := &Configuration{}
+	if err := envconfig.Process("ghmon", configuration); err != nil {
+		t.Fatal(err)
+	}
+
+	_, configPath := newTestStore(t, storageFiles)
+	store, err := newStore(configuration, configPath, log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.(*FileStore); !ok {
+		t.Fatalf("storing in %T by default", store)
+	}
+	if _, err = store.makeWritable(filepath.Join(configPath, "backups")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(configPath, "ghmon.db")); !os.IsNotExist(err) {
+		t.Errorf("created the database without being asked to (%v)", err)
+	}
+}
+
+func TestBoltStoreKeepsTheDatabaseOpenUntilClosed(t *testing.T) {
+
+	store, configPath := newTestStore(t, storageBolt)
+	reader, err := newStore(&Configuration{Storage: storageBolt}, configPath, log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		reader.Close()
+	})
+
+	// Opened to read first, as the commands do before locking the store
+	if pullRequestWrappers, err := store.LoadPullRequestWrappers(); err != nil || len(pullRequestWrappers) != 0 {
+		t.Fatalf("read %v from an empty store (%v)", pullRequestWrappers, err)
+	}
+	if _, err = store.makeWritable(filepath.Join(configPath, "backups")); err != nil {
+		t.Fatal(err)
+	}
+	pullRequestWrapper, err := decodePullRequestWrapper(loadFixture(t, "pull-request-v2.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.StorePullRequestWrapper(pullRequestWrapper)
+
+	if _, err = reader.LoadPullRequestWrappers(); err == nil {
+		t.Errorf("read the database while another store writes to it")
+	}
+
+	if err = store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.LoadPullRequestWrappers(); err == nil {
+		t.Errorf("read from a closed store")
+	}
+	if pullRequestWrappers, err := reader.LoadPullRequestWrappers(); err != nil || len(pullRequestWrappers) != 1 {
+		t.Errorf("read %v once the writing store was closed (%v)", pullRequestWrappers, err)
+	}
+}
+
+func TestBoltStoreBatchStoresAllOrNothing(t *testing.T) {
+
+	store, configPath := newTestStore(t, storageBolt)
+	if _, err := store.makeWritable(filepath.Join(configPath, "backups")); err != nil {
+		t.Fatal(err)
+	}
+	pullRequestWrapper, err := decodePullRequestWrapper(loadFixture(t, "pull-request-v2.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Batch(func(batch StoreBatch) error {
+		if err := batch.StorePullRequestWrappers([]*PullRequestWrapper{pullRequestWrapper}); err != nil {
+			return err
+		}
+		return batch.StorePullRequestHistory(&PullRequestHistory{Id: pullRequestWrapper.Id, Title: "stored in the batch"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history, err := store.LoadPullRequestHistory(pullRequestWrapper.Id); err != nil || history == nil || history.Title != "stored in the batch" {
+		t.Errorf("the history of the batch was not stored: %v (%v)", history, err)
+	}
+
+	failure := errors.New("failed halfway")
+	err = store.Batch(func(batch StoreBatch) error {
+		if err := batch.StorePullRequestHistory(&PullRequestHistory{Id: pullRequestWrapper.Id, Title: "rolled back"}); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		t.Errorf("the batch returned %v", err)
+	}
+	if history, err := store.LoadPullRequestHistory(pullRequestWrapper.Id); err != nil || history == nil || history.Title != "stored in the batch" {
+		t.Errorf("a failed batch changed the history: %v (%v)", history, err)
+	}
+}
@@ -6,8 +6,6 @@
 		tview "gitlab.com/tslocum/cview"
 		"log"
 		"math"
-		"os/exec"
-		"runtime"
 		"sort"
 		"strings"
 		"sync"
@@ -15,10 +13,26 @@
 		"github.com/andanhm/go-prettytime"
 	)
 
+/* Panels shown on top of the main grid */
+const (
+	mainPanel    = "main"
+	confirmPanel = "confirm"
+)
 
 type PullRequestEntry struct {
 	tableIndex int
 	pullRequestWrapper *PullRequestWrapper
+	/* Set instead of the pull request wrapper for repository group headers */
+	repository *Repo
+	groupSize  int
+	collapsed  bool
+}
+
+func (pullRequestEntry *PullRequestEntry) isSameAs(otherPullRequestEntry *PullRequestEntry) bool {
+	if pullRequestEntry.repository != nil || otherPullRequestEntry.repository != nil {
+		return pullRequestEntry.repository != nil && otherPullRequestEntry.repository != nil && pullRequestEntry.repository.FullName == otherPullRequestEntry.repository.FullName
+	}
+	return pullRequestEntry.pullRequestWrapper.Id == otherPullRequestEntry.pullRequestWrapper.Id
 }
 
 type PullRequestGroup struct {
@@ -45,12 +59,17 @@ type UI struct {
 	app *tview.Application
 
 	status *tview.TextView
+	filterInput *tview.InputField
+	pullRequestListLabel *tview.TextView
 
 	pullRequestDetails *tview.Table
+	/* The details pane shows the timeline of the pull request instead of its details */
+	showTimeline       bool
 	pullRequestBody    *tview.TextView
 	reviewerTable      *tview.Table
 
 	grid                   *tview.Grid
+	panels                 *tview.Panels
 	reviewPullRequestGroup *PullRequestGroup
 
 	timerCanceled chan bool
@@ -58,6 +77,32 @@ type UI struct {
 	userConfigurations       map[uint32]*UserConfiguration
 	repositoryConfigurations map[uint32]*RepositoryConfiguration
 	numRowsForHeader         int
+
+	preferences         *Preferences
+	/* Copies of the preferences waiting to be stored, in the order they changed */
+	preferencesToStore  chan Preferences
+	/* Closed once the preferences left to store are stored */
+	preferencesStored   chan struct{}
+	filter              *PullRequestFilter
+	pullRequestWrappers []*PullRequestWrapper
+
+	panes          []tview.Primitive
+	paneLabels     []*tview.TextView
+	focusedPane    pane
+	zoomed         bool
+	filtering      bool
+	screenWidth    int
+	visibleColumns []int
+	titleWidth     int
+
+	/* Full screen view shown on top of the grid, empty when the grid is showing */
+	activeView       string
+	diffView         *DiffView
+	conversationView *ConversationView
+	reviewDialog     *ReviewDialog
+	reviewersDialog  *ReviewersDialog
+	statsView        *StatsView
+	noteDialog       *NoteDialog
 }
 
 func NewGHMonUI(ghm *GHMon) *UI {
@@ -75,14 +120,26 @@ func NewGHMonUI(ghm *GHMon) *UI {
 	reviewerTable := tview.NewTable()
 	pullRequestDetails := tview.NewTable()
 	pullRequestBody := tview.NewTextView()
+	pullRequestBody.SetDynamicColors(true)
+	pullRequestBody.SetWrap(true)
+	pullRequestBody.SetWordWrap(true)
+	pullRequestBody.SetScrollable(true)
 
 	status := tview.NewTextView()
 	status.SetTextAlign(tview.AlignLeft)
+	status.SetDynamicColors(true)
 	status.SetText("")
 
 	reviewPullRequestLabel := tview.NewTextView()
 	reviewPullRequestLabel.SetTextAlign(tview.AlignLeft)
 	reviewPullRequestLabel.SetText(" Pending Pull Request(s)")
+	reviewPullRequestLabel.SetDynamicColors(true)
+
+	filterInput := tview.NewInputField()
+	filterInput.SetLabel(" / ")
+	filterInput.SetPlaceholder("fuzzy text or repo:, author:, label:, tag:, state:, heat:>50, size:<M, is:own")
+	filterInput.SetFieldBackgroundColor(tcell.Color16)
+	filterInput.SetFieldBackgroundColorFocused(tcell.Color16)
 
 	pullRequestDetailsLabel := tview.NewTextView()
 	pullRequestDetailsLabel.SetTextAlign(tview.AlignLeft)
@@ -97,41 +154,81 @@ func NewGHMonUI(ghm *GHMon) *UI {
 	reviewersLabel.SetText(" Reviewers")
 
 	grid := tview.NewGrid()
-	grid.SetRows(1, -2, 1, 8, 1, -3, 1)
-	grid.SetColumns(-2,-3)
 	grid.SetBorders(true)
 	grid.SetBackgroundColor(tcell.Color16)
 	grid.SetBackgroundTransparent(false)
 
-	// FIXME: Layout for screens narrower than 100 cells
-
-	// Layout for screens wider than 100 cells.
-	grid.AddItem(reviewPullRequestLabel, 0, 0, 1, 2, 0, 0, false)
-	grid.AddItem(reviewPullRequestTable, 1, 0, 1, 2, 0, 0, false)
-
-	grid.AddItem(pullRequestDetailsLabel, 2, 0, 1, 1, 0, 0, false)
-	grid.AddItem(pullRequestDetails, 3, 0, 1, 1, 0, 0, false)
-	grid.AddItem(reviewersLabel, 4, 0, 1, 1, 0, 0, false)
-	grid.AddItem(reviewerTable, 5, 0, 1, 1, 0, 0, false)
+	panels := tview.NewPanels()
+	panels.AddPanel(mainPanel, grid, true, true)
 
-	grid.AddItem(descriptionLabel, 2, 1, 1, 1, 0, 0, false)
-	grid.AddItem(pullRequestBody, 3, 1, 3, 1, 0, 0, false)
-
-	grid.AddItem(status, 6, 0, 1, 2, 0, 0, false)
 	app := tview.NewApplication()
 
+	preferences := ghm.LoadPreferences()
+
 	ghui := UI {
-		ghMon: ghm,app: app, grid: grid, reviewerTable: reviewerTable,
+		ghMon: ghm,app: app, grid: grid, panels: panels, reviewerTable: reviewerTable,
 		status: status, pullRequestDetails: pullRequestDetails,
+		filterInput: filterInput, pullRequestListLabel: reviewPullRequestLabel,
+		preferences: preferences, filter: ParsePullRequestFilter(preferences.Filter),
+		preferencesToStore: make(chan Preferences, 16), preferencesStored: make(chan struct{}),
 		pullRequestBody:  pullRequestBody,
 		timerCanceled: make(chan bool,1),
 		reviewPullRequestGroup: &PullRequestGroup{pullRequestTable: reviewPullRequestTable},
 		numRowsForHeader: 1,
 		userConfigurations: make(map[uint32]*UserConfiguration),
 		repositoryConfigurations: make(map[uint32]*RepositoryConfiguration),
+		panes: []tview.Primitive{reviewPullRequestTable, pullRequestDetails, reviewerTable, pullRequestBody},
+		paneLabels: []*tview.TextView{reviewPullRequestLabel, pullRequestDetailsLabel, reviewersLabel, descriptionLabel},
+		focusedPane: paneList,
 	}
 
+	ghui.layoutGrid()
+	app.SetAfterResizeFunc(ghui.handleResize)
+
+	ghui.diffView = NewDiffView(&ghui)
+	panels.AddPanel(diffPanel, ghui.diffView.layout, true, false)
+	ghui.conversationView = NewConversationView(&ghui)
+	panels.AddPanel(conversationPanel, ghui.conversationView.layout, true, false)
+	ghui.reviewDialog = NewReviewDialog(&ghui)
+	panels.AddPanel(reviewPanel, ghui.reviewDialog.layout, true, false)
+	ghui.reviewersDialog = NewReviewersDialog(&ghui)
+	panels.AddPanel(reviewersPanel, ghui.reviewersDialog.layout, true, false)
+	ghui.statsView = NewStatsView(&ghui)
+	panels.AddPanel(statsPanel, ghui.statsView.layout, true, false)
+	ghui.noteDialog = NewNoteDialog(&ghui)
+	panels.AddPanel(notePanel, ghui.noteDialog.layout, true, false)
+
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Text entry gets all the keys
+		if ghui.app.GetFocus() == ghui.filterInput {
+			return event
+		}
+		switch ghui.activeView {
+		case diffPanel:
+			return ghui.diffView.handleInput(event)
+		case conversationPanel:
+			return ghui.conversationView.handleInput(event)
+		case reviewPanel:
+			return ghui.reviewDialog.handleInput(event)
+		case reviewersPanel:
+			return ghui.reviewersDialog.handleInput(event)
+		case statsPanel:
+			return ghui.statsView.handleInput(event)
+		case notePanel:
+			return ghui.noteDialog.handleInput(event)
+		case menuPanel:
+			return ghui.handleMenuInput(event)
+		case confirmPanel:
+			return event
+		}
+		switch event.Key() {
+		case tcell.KeyTab:
+			ghui.cycleFocus(true)
+			return nil
+		case tcell.KeyBacktab:
+			ghui.cycleFocus(false)
+			return nil
+		}
 		// We navigate in between focuses here
 		if event.Key() == tcell.KeyRune {
 			switch event.Rune() {
@@ -142,13 +239,67 @@ func NewGHMonUI(ghm *GHMon) *UI {
 				go ghui.refreshPullRequests()
 				return nil
 			case 'X', 'x' :
-				go ghui.hidePullRequest()
+				ghui.hidePullRequest()
 				return nil
 			case 'p' :
 				go ghui.purgePullRequests()
 				return nil
 			case 'z' :
-				go ghui.snoozePullRequest()
+				ghui.snoozePullRequest()
+				return nil
+			case '/' :
+				ghui.showFilterInput()
+				return nil
+			case 's' :
+				ghui.cycleSortMode()
+				return nil
+			case 'S' :
+				ghui.toggleSortDirection()
+				return nil
+			case 'g' :
+				ghui.toggleGroupByRepository()
+				return nil
+			case 'm' :
+				ghui.toggleZoom()
+				return nil
+			case 'd' :
+				ghui.showPullRequestDiff()
+				return nil
+			case 'v' :
+				ghui.showPullRequestConversation()
+				return nil
+			case 'a' :
+				ghui.showReviewDialog(PullRequestReviewStatusApproved)
+				return nil
+			case 'b' :
+				ghui.showReviewDialog(PullRequestReviewStatusChangesRequested)
+				return nil
+			case 'c' :
+				ghui.showReviewDialog(PullRequestReviewStatusCommented)
+				return nil
+			case 'M' :
+				ghui.showPullRequestActions()
+				return nil
+			case 'e' :
+				ghui.showReviewersDialog()
+				return nil
+			case 'w' :
+				ghui.checkoutPullRequest()
+				return nil
+			case 't' :
+				ghui.toggleTimeline()
+				return nil
+			case 'i' :
+				ghui.showStats()
+				return nil
+			case 'n' :
+				ghui.showNoteDialog()
+				return nil
+			case '+' :
+				ghui.resizeListPane(1)
+				return nil
+			case '-' :
+				ghui.resizeListPane(-1)
 				return nil
 			default:
 			}
@@ -163,7 +314,15 @@ func NewGHMonUI(ghm *GHMon) *UI {
 		// What here?
 	})
 	reviewPullRequestTable.SetSelectedFunc(func(row int, column int) {
-		ghui.openBrowser(ghui.reviewPullRequestGroup.pullRequestEntries[row-ghui.numRowsForHeader].pullRequestWrapper)
+		if row-ghui.numRowsForHeader < 0 || row-ghui.numRowsForHeader >= len(ghui.reviewPullRequestGroup.pullRequestEntries) {
+			return
+		}
+		pullRequestEntry := ghui.reviewPullRequestGroup.pullRequestEntries[row-ghui.numRowsForHeader]
+		if pullRequestEntry.repository != nil {
+			ghui.toggleRepositoryCollapsed(pullRequestEntry.repository)
+			return
+		}
+		ghui.openBrowser(pullRequestEntry.pullRequestWrapper)
 	})
 	reviewPullRequestTable.SetSelectable(true,false)
 
@@ -173,6 +332,15 @@ func NewGHMonUI(ghm *GHMon) *UI {
 
 	reviewPullRequestTable.SetInputCapture(app.GetInputCapture())
 
+	filterInput.SetChangedFunc(func(text string) {
+		ghui.applyFilter(text)
+	})
+	filterInput.SetDoneFunc(func(key tcell.Key) {
+		ghui.hideFilterInput(key)
+	})
+
+	ghui.updatePullRequestListLabel(0)
+
 	app.SetFocus(ghui.reviewPullRequestGroup.pullRequestTable)
 
 	go ghui.app.QueueUpdateDraw(func() {
@@ -190,11 +358,16 @@ func (ghui *UI) getCurrentlySelectedPullRequest() *PullRequestEntry {
 func (ghui *UI) handlePullRequestSelectionChanged(pullRequestGroup *PullRequestGroup, row int) {
 
 	currentlySelectedPullRequestEntryIndex := row - ghui.numRowsForHeader
+	if currentlySelectedPullRequestEntryIndex < 0 || currentlySelectedPullRequestEntryIndex >= len(pullRequestGroup.pullRequestEntries) {
+		pullRequestGroup.currentlySelectedPullRequestEntry = nil
+		return
+	}
 	pullRequestGroup.currentlySelectedPullRequestEntryIndex = currentlySelectedPullRequestEntryIndex
-	pullRequestGroup.currentlySelectedPullRequestEntry = pullRequestGroup.pullRequestEntries[currentlySelectedPullRequestEntryIndex]
+	pullRequestEntry := pullRequestGroup.pullRequestEntries[currentlySelectedPullRequestEntryIndex]
+	pullRequestGroup.currentlySelectedPullRequestEntry = pullRequestEntry
 
 	go ghui.app.QueueUpdateDraw(func() {
-		ghui.handlePullRequestSelected(pullRequestGroup.pullRequestEntries[currentlySelectedPullRequestEntryIndex])
+		ghui.handlePullRequestSelected(pullRequestEntry)
 	})
 }
 
@@ -205,15 +378,15 @@ func (ghui *UI) startSeenTimer(pullRequestWrapper *PullRequestWrapper) {
 			// do something for timeout, like change state
 			ghui.ghMon.Logger().Printf("Seen timer timeout for %d", pullRequestWrapper.Id)
 			// if current pull request is still the same one as we started 'seeing'
-			currentlySelectedPullRequest := ghui.getCurrentlySelectedPullRequest()
-
-			if currentlySelectedPullRequest != nil && currentlySelectedPullRequest.pullRequestWrapper.Id == pullRequestWrapper.Id {
-				ghui.ghMon.Logger().Printf("Marking %d as seen", pullRequestWrapper.Id)
-				ghui.ghMon.UpdateSeen(pullRequestWrapper, true)
-				ghui.app.QueueUpdateDraw(func() {
-					ghui.handlePullRequestUpdated(pullRequestWrapper)
-				})
-			}
+			ghui.app.QueueUpdate(func() {
+				currentlySelectedPullRequest := ghui.getCurrentlySelectedPullRequest()
+
+				if currentlySelectedPullRequest != nil && currentlySelectedPullRequest.pullRequestWrapper != nil && currentlySelectedPullRequest.pullRequestWrapper.Id == pullRequestWrapper.Id {
+					ghui.ghMon.Logger().Printf("Marking %d as seen", pullRequestWrapper.Id)
+					// The list is updated from the event of the monitor
+					go ghui.ghMon.UpdateSeen(pullRequestWrapper, true)
+				}
+			})
 		case <-ghui.timerCanceled:
 			ghui.ghMon.Logger().Printf("Timer cancelled for %d", pullRequestWrapper.Id)
 	}
@@ -222,11 +395,19 @@ func (ghui *UI) startSeenTimer(pullRequestWrapper *PullRequestWrapper) {
 
 func (ghui *UI) handlePullRequestSelected(pullRequestEntry *PullRequestEntry) {
 
+	if pullRequestEntry.repository != nil {
+		ghui.timerCanceled <- true
+		ghui.timerCanceled = make(chan bool, 1)
+		ghui.clearPullRequestDetails()
+		return
+	}
+
 	pullRequestWrapper := pullRequestEntry.pullRequestWrapper
 	ghui.ghMon.Logger().Printf("Selected pull request %d", pullRequestWrapper.Id)
 	ghui.ghMon.Logger().Printf("Pull Request Seen? %t", pullRequestWrapper.Seen)
 
 	ghui.updatePullRequestDetails(pullRequestWrapper)
+	ghui.pullRequestBody.ScrollToBeginning()
 
 	// FIXME: Slightly weird since we essentially throw away the channel each time
 	ghui.timerCanceled <- true
@@ -245,16 +426,207 @@ func (ghui *UI) refreshPullRequests() {
 	go ghui.ghMon.RetrievePullRequests()
 }
 
+// hidePullRequest leaves the selected pull request out of the list until it is shown again with 'ghmon unhide'
 func (ghui *UI) hidePullRequest() {
+	pullRequestEntry := ghui.getCurrentlySelectedPullRequest()
+	if pullRequestEntry == nil || pullRequestEntry.pullRequestWrapper == nil {
+		return
+	}
+	pullRequestWrapper := pullRequestEntry.pullRequestWrapper
+	ghui.runPullRequestAction(pullRequestWrapper, "Hiding", func() error {
+		return ghui.ghMon.HidePullRequest(pullRequestWrapper, true)
+	})
 }
 
+// snoozePullRequest leaves the selected pull request out of the list for a while
 func (ghui *UI) snoozePullRequest() {
+	pullRequestEntry := ghui.getCurrentlySelectedPullRequest()
+	if pullRequestEntry == nil || pullRequestEntry.pullRequestWrapper == nil {
+		return
+	}
+	pullRequestWrapper := pullRequestEntry.pullRequestWrapper
+	snoozedUntil := time.Now().Add(ghui.ghMon.SnoozeDuration())
+	ghui.runPullRequestAction(pullRequestWrapper, "Snoozing", func() error {
+		return ghui.ghMon.SnoozePullRequest(pullRequestWrapper, snoozedUntil)
+	})
 }
 
 func (ghui *UI) purgePullRequests() {
 	ghui.ghMon.PurgeDeletedPullRequests()
 }
 
+// showStats opens the review statistics of the recorded histories
+func (ghui *UI) showStats() {
+	ghui.statsView.Show()
+	ghui.openView(statsPanel, ghui.statsView.text)
+}
+
+// showPullRequestDiff retrieves the changed files of the selected pull request in the background and opens the
+// diff view once they are available
+func (ghui *UI) showPullRequestDiff() {
+
+	pullRequestEntry := ghui.getCurrentlySelectedPullRequest()
+	if pullRequestEntry == nil || pullRequestEntry.pullRequestWrapper == nil {
+		return
+	}
+	pullRequestWrapper := pullRequestEntry.pullRequestWrapper
+
+	ghui.status.SetText(fmt.Sprintf(" Fetching diff for %s#%d", pullRequestWrapper.PullRequest.Repo.FullName, pullRequestWrapper.PullRequest.Number))
+
+	go func() {
+		pullRequestDiff, err := ghui.ghMon.RetrievePullRequestDiff(pullRequestWrapper)
+		ghui.app.QueueUpdateDraw(func() {
+			if err != nil {
+				ghui.status.SetText(fmt.Sprintf(" [red]Could not fetch diff: %s[-]", tview.Escape(err.Error())))
+				return
+			}
+			ghui.status.SetText("")
+			ghui.diffView.Show(pullRequestWrapper, pullRequestDiff)
+			ghui.openView(diffPanel, ghui.diffView.diffText)
+		})
+	}()
+}
+
+// showPullRequestConversation retrieves the comments and review threads of the selected pull request in the
+// background, highlighting what is new since it was last viewed
+func (ghui *UI) showPullRequestConversation() {
+
+	pullRequestEntry := ghui.getCurrentlySelectedPullRequest()
+	if pullRequestEntry == nil || pullRequestEntry.pullRequestWrapper == nil {
+		return
+	}
+	pullRequestWrapper := pullRequestEntry.pullRequestWrapper
+
+	ghui.status.SetText(fmt.Sprintf(" Fetching conversation for %s#%d", pullRequestWrapper.PullRequest.Repo.FullName, pullRequestWrapper.PullRequest.Number))
+
+	go func() {
+		conversation, err := ghui.ghMon.RetrievePullRequestConversation(pullRequestWrapper)
+		ghui.app.QueueUpdateDraw(func() {
+			if err != nil {
+				ghui.status.SetText(fmt.Sprintf(" [red]Could not fetch conversation: %s[-]", tview.Escape(err.Error())))
+				return
+			}
+			ghui.status.SetText("")
+			ghui.conversationView.Show(pullRequestWrapper, conversation, ViewedSince(pullRequestWrapper))
+			ghui.openView(conversationPanel, ghui.conversationView.text)
+			go ghui.ghMon.UpdateLastViewed(pullRequestWrapper, conversation.RetrievedAt)
+		})
+	}()
+}
+
+func (ghui *UI) showReviewDialog(pullRequestReviewStatus PullRequestReviewStatus) {
+
+	pullRequestEntry := ghui.getCurrentlySelectedPullRequest()
+	if pullRequestEntry == nil || pullRequestEntry.pullRequestWrapper == nil {
+		return
+	}
+	pullRequestWrapper := pullRequestEntry.pullRequestWrapper
+
+	if ghui.ghMon.IsOwnPullRequest(pullRequestWrapper) && pullRequestReviewStatus != PullRequestReviewStatusCommented {
+		ghui.status.SetText(" [red]You cannot approve or request changes on your own pull request[-]")
+		return
+	}
+
+	ghui.reviewDialog.Show(pullRequestWrapper, pullRequestReviewStatus)
+	ghui.openView(reviewPanel, ghui.reviewDialog.input)
+}
+
+func (ghui *UI) showReviewersDialog() {
+
+	pullRequestEntry := ghui.getCurrentlySelectedPullRequest()
+	if pullRequestEntry == nil || pullRequestEntry.pullRequestWrapper == nil {
+		return
+	}
+	pullRequestWrapper := pullRequestEntry.pullRequestWrapper
+
+	if !ghui.ghMon.IsOwnPullRequest(pullRequestWrapper) {
+		ghui.status.SetText(" [red]Reviewers can only be managed on your own pull requests[-]")
+		return
+	}
+
+	ghui.reviewersDialog.Show(pullRequestWrapper)
+	ghui.openView(reviewersPanel, ghui.reviewersDialog.list)
+}
+
+func (ghui *UI) showNoteDialog() {
+
+	pullRequestEntry := ghui.getCurrentlySelectedPullRequest()
+	if pullRequestEntry == nil || pullRequestEntry.pullRequestWrapper == nil {
+		return
+	}
+
+	ghui.noteDialog.Show(pullRequestEntry.pullRequestWrapper)
+	ghui.openView(notePanel, ghui.noteDialog.noteInput)
+}
+
+// checkoutPullRequest checks the selected pull request out locally in the background, progress is reported by the
+// monitor through status events
+func (ghui *UI) checkoutPullRequest() {
+
+	pullRequestEntry := ghui.getCurrentlySelectedPullRequest()
+	if pullRequestEntry == nil || pullRequestEntry.pullRequestWrapper == nil {
+		return
+	}
+	pullRequestWrapper := pullRequestEntry.pullRequestWrapper
+	pullRequest := pullRequestWrapper.PullRequest
+	target := fmt.Sprintf("%s#%d", tview.Escape(pullRequest.Repo.FullName), pullRequest.Number)
+	ghui.status.SetText(fmt.Sprintf(" Checking out %s ...", target))
+
+	go func() {
+		checkoutPath, err := ghui.ghMon.CheckoutPullRequest(pullRequestWrapper)
+		ghui.app.QueueUpdateDraw(func() {
+			if err != nil {
+				ghui.ghMon.Logger().Printf("Checking out %s failed: %s", target, err)
+				ghui.status.SetText(fmt.Sprintf(" [red]Checking out %s failed: %s[-]", target, tview.Escape(err.Error())))
+				return
+			}
+			ghui.status.SetText(fmt.Sprintf(" [green]Checked out %s in %s[-]", target, tview.Escape(checkoutPath)))
+		})
+	}()
+}
+
+func (ghui *UI) submitPullRequestReview(pullRequestWrapper *PullRequestWrapper, pullRequestReviewStatus PullRequestReviewStatus, body string) {
+	ghui.runPullRequestAction(pullRequestWrapper, "Submitting review on", func() error {
+		return ghui.ghMon.SubmitPullRequestReview(pullRequestWrapper, pullRequestReviewStatus, body)
+	})
+}
+
+// confirm shows a modal dialog on top of whatever is showing, calling onConfirm if the user accepts
+func (ghui *UI) confirm(message string, confirmLabel string, onConfirm func()) {
+
+	previousView := ghui.activeView
+	previousFocus := ghui.app.GetFocus()
+
+	modal := tview.NewModal()
+	modal.SetText(message)
+	modal.AddButtons([]string{confirmLabel, "Cancel"})
+	modal.SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+		ghui.panels.RemovePanel(confirmPanel)
+		ghui.activeView = previousView
+		ghui.app.SetFocus(previousFocus)
+		if buttonIndex == 0 {
+			onConfirm()
+		}
+	})
+
+	ghui.panels.AddPanel(confirmPanel, modal, false, true)
+	ghui.activeView = confirmPanel
+	ghui.app.SetFocus(modal)
+}
+
+func (ghui *UI) openView(panel string, focus tview.Primitive) {
+	ghui.activeView = panel
+	ghui.panels.ShowPanel(panel)
+	ghui.panels.SendToFront(panel)
+	ghui.app.SetFocus(focus)
+}
+
+func (ghui *UI) closeView(panel string) {
+	ghui.activeView = ""
+	ghui.panels.HidePanel(panel)
+	ghui.app.SetFocus(ghui.panes[ghui.focusedPane])
+}
+
 func (ghui *UI) getPullRequestReviewColorString(pullRequestReview *PullRequestReview) (color string) {
 	switch pullRequestReview.Status {
 	case PullRequestReviewStatusApproved:
@@ -363,49 +735,12 @@ func (ghui *UI)escapeSquareBracketsInString(str string) string {
 
 func (ghui *UI) openBrowser(pullRequestWrapper *PullRequestWrapper) {
 
-	url := pullRequestWrapper.PullRequest.HtmlURL.String()
-
-	var err error
-
-	switch runtime.GOOS {
-	case "linux":
-		err = exec.Command("xdg-open", url).Start()
-	case "windows":
-		err = exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
-	case "darwin":
-		err = exec.Command("open", url).Start()
-	default:
-		err = fmt.Errorf("unsupported platform")
-	}
-
-	if err != nil {
+	if err := OpenInBrowser(pullRequestWrapper); err != nil {
 		log.Fatal(err)
 	}
 
 }
 
-func pruneTo(str string, requiredLen int) string {
-	if len(str) >= requiredLen {
-
-		if len(str) > 3 {
-			trimmedString := string(str[0 : requiredLen-3])
-			trimmedString += "..."
-			return trimmedString
-		}
-	}
-	return str
-}
-
-func padToLen(str string, requiredLen int) string {
-	paddedString := " "
-	paddedString += str
-	for len(paddedString) < (requiredLen-2) {
-		paddedString += " "
-	}
-	paddedString += " "
-	return paddedString
-}
-
 func (ghui *UI) hasPullReviewStatus(pullRequstReviewStatus PullRequestReviewStatus, pullRequestWrapper *PullRequestWrapper) bool {
 	for _, pullRequestReviews := range pullRequestWrapper.PullRequest.PullRequestReviewsByUser {
 		for _, pullRequestReview := range pullRequestReviews {
@@ -433,6 +768,84 @@ func (ghui *UI) getHeatPattern(wrapper *PullRequestWrapper) (int, string) {
 	return 8, "[green]▒▒▒▒▒▒"
 }
 
+func (ghui *UI) getPullRequestSizeColorString(pullRequestSize PullRequestSize) (color string) {
+	switch pullRequestSize {
+	case PullRequestSizeXS, PullRequestSizeS:
+		color = "green"
+	case PullRequestSizeM:
+		color = "white"
+	case PullRequestSizeL:
+		color = "orange"
+	case PullRequestSizeXL:
+		color = "red"
+	default:
+		color = "gray"
+	}
+	return
+}
+
+func (ghui *UI) getPullRequestSizeString(pullRequestWrapper *PullRequestWrapper) (string, int) {
+	color := ghui.getPullRequestSizeColorString(pullRequestWrapper.Score.Size)
+	return fmt.Sprintf("[%s]%s[-]", color, ghui.ghMon.ConvertPullRequestSizeToString(pullRequestWrapper.Score.Size)), len(color) + 5
+}
+
+func (ghui *UI) getPullRequestSizeDetailsString(pullRequestWrapper *PullRequestWrapper) string {
+	pullRequest := pullRequestWrapper.PullRequest
+	if pullRequestWrapper.Score.Size == PullRequestSizeUnknown {
+		return "[gray]Unknown"
+	}
+	return fmt.Sprintf("[%s]%s[-] ([green]+%d[-]/[red]-%d[-], %d files, %d commits)",
+		ghui.getPullRequestSizeColorString(pullRequestWrapper.Score.Size), ghui.ghMon.ConvertPullRequestSizeToString(pullRequestWrapper.Score.Size),
+		pullRequest.Additions, pullRequest.Deletions, pullRequest.ChangedFiles, pullRequest.Commits)
+}
+
+// formatLabelChips renders the labels as chips in their GitHub color, picking a readable text color for each
+func (ghui *UI) formatLabelChips(labels []*Label) string {
+
+	chips := make([]string, 0)
+	for _, label := range labels {
+		labelColor := tcell.GetColor("#" + label.Color)
+		if label.Color == "" || labelColor == tcell.ColorDefault {
+			labelColor = tcell.ColorGray
+		}
+		r, g, b := labelColor.RGB()
+		textColor := "#000000"
+		if (299*r+587*g+114*b)/1000 < 128 {
+			textColor = "#ffffff"
+		}
+		chips = append(chips, fmt.Sprintf("[%s:#%06x] %s [-:-]", textColor, labelColor.Hex(), tview.Escape(label.Name)))
+	}
+	return strings.Join(chips, " ")
+}
+
+func (ghui *UI) getNoteString(note string) string {
+	if note == "" {
+		return "[gray]None"
+	}
+	return "[yellow]" + tview.Escape(note)
+}
+
+func (ghui *UI) formatTagChips(tags []string) string {
+	if len(tags) == 0 {
+		return "[gray]None"
+	}
+	chips := make([]string, 0)
+	for _, tag := range tags {
+		chips = append(chips, fmt.Sprintf("[black:yellow] %s [-:-]", tview.Escape(tag)))
+	}
+	return strings.Join(chips, " ")
+}
+
+func (ghui *UI) getMilestoneString(milestone *Milestone) string {
+	if milestone == nil {
+		return "[gray]None"
+	}
+	if milestone.DueOn.IsZero() {
+		return fmt.Sprintf("%s (%s)", tview.Escape(milestone.Title), milestone.State)
+	}
+	return fmt.Sprintf("%s (%s, due %s)", tview.Escape(milestone.Title), milestone.State, milestone.DueOn.Format("Jan 2 2006"))
+}
+
 func (ghui *UI) formatDate(dateToFormat time.Time, usePrettyTime bool) string {
 
 	// 2021-02-03 11:41:25.843652832 -0500 EST
@@ -463,6 +876,29 @@ func (ghui *UI) formatDate(dateToFormat time.Time, usePrettyTime bool) string {
 
 func (ghui *UI) updatePullRequestDetails(pullRequestWrapper *PullRequestWrapper) {
 
+	if ghui.showTimeline {
+		ghui.updatePullRequestTimeline(pullRequestWrapper)
+	} else {
+		ghui.updatePullRequestDetailsTable(pullRequestWrapper)
+	}
+	ghui.pullRequestBody.SetText(RenderMarkdown(pullRequestWrapper.PullRequest.Body))
+
+	ghui.reviewerTable.Clear()
+	for i, pullRequestReviews := range pullRequestWrapper.PullRequest.PullRequestReviewsByPriority {
+		status := fmt.Sprintf("[%s][%s[]", ghui.getPullRequestReviewColorString(pullRequestReviews[0]),ghui.ghMon.ConvertPullRequestReviewStateToString(pullRequestReviews[0].Status))
+		ghui.reviewerTable.SetCell(i, 1, tview.NewTableCell(status))
+		ghui.reviewerTable.SetCell(i, 2, tview.NewTableCell(pullRequestReviews[0].User.Username))
+		ghui.reviewerTable.SetCell(i, 3, tview.NewTableCell(fmt.Sprintf("[%f[]", pullRequestReviews[0].Score)))
+
+	}
+
+	// Add score details
+
+}
+
+func (ghui *UI) updatePullRequestDetailsTable(pullRequestWrapper *PullRequestWrapper) {
+
+	ghui.pullRequestDetails.Clear()
 	ghui.pullRequestDetails.SetCell(0,0,tview.NewTableCell(" [::b]ID:"))
 	ghui.pullRequestDetails.SetCell(0,1,tview.NewTableCell(fmt.Sprintf("[::b]%d",pullRequestWrapper.PullRequest.Id)))
 	ghui.pullRequestDetails.SetCell(1,0,tview.NewTableCell(" [::b]Title:"))
@@ -479,19 +915,88 @@ func (ghui *UI) updatePullRequestDetails(pullRequestWrapper *PullRequestWrapper)
 	ghui.pullRequestDetails.SetCell(6,1,tview.NewTableCell(fmt.Sprintf("[::b]%f",pullRequestWrapper.Score.Total)))
 	ghui.pullRequestDetails.SetCell(7,0,tview.NewTableCell(" [::b]Deleted: "))
 	ghui.pullRequestDetails.SetCell(7,1,tview.NewTableCell(fmt.Sprintf("[::b]%t",pullRequestWrapper.Deleted)))
-	ghui.pullRequestBody.SetText(fmt.Sprintf("%s", pullRequestWrapper.PullRequest.Body))
-
-	ghui.reviewerTable.Clear()
-	for i, pullRequestReviews := range pullRequestWrapper.PullRequest.PullRequestReviewsByPriority {
-		status := fmt.Sprintf("[%s][%s[]", ghui.getPullRequestReviewColorString(pullRequestReviews[0]),ghui.ghMon.ConvertPullRequestReviewStateToString(pullRequestReviews[0].Status))
-		ghui.reviewerTable.SetCell(i, 1, tview.NewTableCell(status))
-		ghui.reviewerTable.SetCell(i, 2, tview.NewTableCell(pullRequestReviews[0].User.Username))
-		ghui.reviewerTable.SetCell(i, 3, tview.NewTableCell(fmt.Sprintf("[%f[]", pullRequestReviews[0].Score)))
+	ghui.pullRequestDetails.SetCell(8,0,tview.NewTableCell(" [::b]Size: "))
+	ghui.pullRequestDetails.SetCell(8,1,tview.NewTableCell(ghui.getPullRequestSizeDetailsString(pullRequestWrapper)))
+	ghui.pullRequestDetails.SetCell(9,0,tview.NewTableCell(" [::b]Labels: "))
+	ghui.pullRequestDetails.SetCell(9,1,tview.NewTableCell(ghui.formatLabelChips(pullRequestWrapper.PullRequest.Labels)))
+	ghui.pullRequestDetails.SetCell(10,0,tview.NewTableCell(" [::b]Milestone: "))
+	ghui.pullRequestDetails.SetCell(10,1,tview.NewTableCell(ghui.getMilestoneString(pullRequestWrapper.PullRequest.Milestone)))
+	// The note of the user goes right below the title, where it is seen without scrolling
+	if pullRequestWrapper.HasNote() {
+		ghui.pullRequestDetails.InsertRow(2)
+		ghui.pullRequestDetails.InsertRow(2)
+		ghui.pullRequestDetails.SetCell(2,0,tview.NewTableCell(" [::b]✎ Note: "))
+		ghui.pullRequestDetails.SetCell(2,1,tview.NewTableCell(ghui.getNoteString(pullRequestWrapper.Note)))
+		ghui.pullRequestDetails.SetCell(3,0,tview.NewTableCell(" [::b]Tags: "))
+		ghui.pullRequestDetails.SetCell(3,1,tview.NewTableCell(ghui.formatTagChips(pullRequestWrapper.Tags)))
+	}
+	ghui.pullRequestDetails.ScrollToBeginning()
+}
 
+// toggleTimeline switches the details pane between the details and the timeline of the selected pull request
+func (ghui *UI) toggleTimeline() {
+	ghui.showTimeline = !ghui.showTimeline
+	if ghui.showTimeline {
+		ghui.paneLabels[paneDetails].SetText(" Pull Request Timeline")
+	} else {
+		ghui.paneLabels[paneDetails].SetText(" Pull Request Details")
 	}
+	pullRequestEntry := ghui.getCurrentlySelectedPullRequest()
+	if pullRequestEntry == nil || pullRequestEntry.pullRequestWrapper == nil {
+		return
+	}
+	ghui.updatePullRequestDetails(pullRequestEntry.pullRequestWrapper)
+}
 
-	// Add score details
+// updatePullRequestTimeline loads the history of the pull request in the background and lists it oldest first,
+// scrolled to the latest events
+func (ghui *UI) updatePullRequestTimeline(pullRequestWrapper *PullRequestWrapper) {
 
+	go func() {
+		history, err := ghui.ghMon.LoadPullRequestHistory(pullRequestWrapper.Id)
+		ghui.app.QueueUpdateDraw(func() {
+			pullRequestEntry := ghui.getCurrentlySelectedPullRequest()
+			if !ghui.showTimeline || pullRequestEntry == nil || pullRequestEntry.pullRequestWrapper == nil || pullRequestEntry.pullRequestWrapper.Id != pullRequestWrapper.Id {
+				return
+			}
+			ghui.pullRequestDetails.Clear()
+			if err != nil {
+				ghui.pullRequestDetails.SetCell(0, 0, tview.NewTableCell(fmt.Sprintf(" [red]Could not load the timeline: %s[-]", tview.Escape(err.Error()))))
+				return
+			}
+			if history == nil || len(history.Events) == 0 {
+				ghui.pullRequestDetails.SetCell(0, 0, tview.NewTableCell(" [gray]Nothing recorded yet, the timeline starts with the next refresh[-]"))
+				return
+			}
+			for i, event := range history.Events {
+				ghui.pullRequestDetails.SetCell(i, 0, tview.NewTableCell(" " + event.Time.Local().Format("Jan 2 2006 15:04")))
+				ghui.pullRequestDetails.SetCell(i, 1, tview.NewTableCell(fmt.Sprintf("[%s]%s[-]", getHistoryEventColorString(event.Kind), event.Kind)))
+				ghui.pullRequestDetails.SetCell(i, 2, tview.NewTableCell(tview.Escape(strings.TrimSpace(event.Actor + " " + event.Details))))
+			}
+			ghui.pullRequestDetails.ScrollToEnd()
+		})
+	}()
+}
+
+func getHistoryEventColorString(historyEventKind HistoryEventKind) string {
+	switch historyEventKind {
+	case HistoryEventApproved, HistoryEventMerged:
+		return "green"
+	case HistoryEventChangesRequested:
+		return "red"
+	case HistoryEventCommented, HistoryEventReviewRequested:
+		return "yellow"
+	case HistoryEventClosed, HistoryEventLeftList, HistoryEventDismissed, HistoryEventReviewRequestRemoved:
+		return "gray"
+	default:
+		return "white"
+	}
+}
+
+func (ghui *UI) clearPullRequestDetails() {
+	ghui.pullRequestDetails.Clear()
+	ghui.pullRequestBody.SetText("")
+	ghui.reviewerTable.Clear()
 }
 
 func (ghui *UI) updatePullRequestEntry(pullRequestEntry *PullRequestEntry) {
@@ -502,60 +1007,63 @@ func (ghui *UI) updatePullRequestEntry(pullRequestEntry *PullRequestEntry) {
 	pullRequestWrapper := pullRequestEntry.pullRequestWrapper
 	pullRequestItem := pullRequestWrapper.PullRequest
 
+	contents := make([]string, numColumns)
+
 	seen := " "
 	if !pullRequestWrapper.Seen {
 		seen = "*"
 	}
+	contents[columnSeen] = padToWidth(seen, pullRequestColumns[columnSeen].width)
+
+	_, heatPattern := ghui.getHeatPattern(pullRequestWrapper)
+	contents[columnHeat] = padToWidth(heatPattern, pullRequestColumns[columnHeat].width)
 
-	_,_, width, _ := pullRequestTable.GetRect()
+	contents[columnAttributes] = padToWidth(ghui.getPullRequestReviewStatusString(pullRequestWrapper), pullRequestColumns[columnAttributes].width)
 
-	// We can expand the title and repo fields to ensure consistent display
-	// AvailableSpace := width - border (2) + dividers (3 * 6) + Seen (1) + heat pattern (5) + brief status (9) + Date (30) + Repo Name (35) + User (20)
-	availableSpace := width - (2 + 3*6 + 1 + 5 + 9 + 30 + 35 + 20)
+	colorizedSize, _ := ghui.getPullRequestSizeString(pullRequestWrapper)
+	contents[columnSize] = padToWidth(colorizedSize, pullRequestColumns[columnSize].width)
 
-	title := ghui.escapeSquareBracketsInString(pullRequestItem.Title)
-	var stylingLength = 0
+	// The title takes whatever is left, label chips are only shown if they leave room for a reasonable title
+	availableTitleWidth := ghui.titleWidth - 2
+	labelChips := ghui.formatLabelChips(pullRequestItem.Labels)
+	if labelChips != "" && availableTitleWidth-tview.TaggedStringWidth(labelChips)-1 < 20 {
+		labelChips = ""
+	}
+	if labelChips != "" {
+		availableTitleWidth -= tview.TaggedStringWidth(labelChips) + 1
+	}
+	title := tview.Escape(truncateToWidth(pullRequestItem.Title, availableTitleWidth))
 	if pullRequestWrapper.Deleted {
 		title = "[::s]" + title + "[::-]"
-		stylingLength = 10
 	}
-	expandedTitle := padToLen(title, availableSpace-stylingLength)
-
-	colorizedRepo, stylingLength := formatWithColor(pruneTo(pullRequestItem.Repo.Name,33), ghui.getColorForRepo(pullRequestItem.Repo))
-	expandedRepoName := padToLen(colorizedRepo, 35-stylingLength)
-
-	updatedAt := ghui.formatDate(pullRequestItem.UpdatedAt, true)
-	expandedDate := padToLen(updatedAt, 30)
-	expandedAttributes := padToLen(ghui.getPullRequestReviewStatusString(pullRequestWrapper), 9)
-	expandedSeen := padToLen(seen, 3)
-
-	colorizedUser, stylingLength := formatWithColor(pullRequestItem.Creator.Username, ghui.getColorForUser(pullRequestItem.Creator))
-	expandedUser := padToLen(colorizedUser, 20-stylingLength)
-
-	coloringLength, heatPattern := ghui.getHeatPattern(pullRequestWrapper)
-	expandedHeatPattern := padToLen(heatPattern,9-coloringLength)
-
-	cell := tview.NewTableCell(expandedSeen)
-	pullRequestTable.SetCell(pullRequestEntry.tableIndex,0, cell)
-
-	cell = tview.NewTableCell(expandedHeatPattern)
-	pullRequestTable.SetCell(pullRequestEntry.tableIndex,1, cell)
+	if labelChips != "" {
+		title += " " + labelChips
+	}
+	contents[columnTitle] = padToWidth(title, ghui.titleWidth)
 
-	cell = tview.NewTableCell(expandedAttributes)
-	pullRequestTable.SetCell(pullRequestEntry.tableIndex,2, cell)
+	colorizedRepo, _ := formatWithColor(tview.Escape(truncateToWidth(pullRequestItem.Repo.Name, pullRequestColumns[columnRepository].width-2)), ghui.getColorForRepo(pullRequestItem.Repo))
+	contents[columnRepository] = padToWidth(colorizedRepo, pullRequestColumns[columnRepository].width)
 
-	cell = tview.NewTableCell(expandedTitle)
-	pullRequestTable.SetCell(pullRequestEntry.tableIndex,3, cell)
+	colorizedUser, _ := formatWithColor(truncateToWidth(pullRequestItem.Creator.Username, pullRequestColumns[columnUser].width-2), ghui.getColorForUser(pullRequestItem.Creator))
+	contents[columnUser] = padToWidth(colorizedUser, pullRequestColumns[columnUser].width)
 
-	cell = tview.NewTableCell(expandedRepoName)
-	pullRequestTable.SetCell(pullRequestEntry.tableIndex,4, cell)
+	updatedAt := ghui.formatDate(pullRequestItem.UpdatedAt, true)
+	contents[columnLastActive] = padToWidth(truncateToWidth(updatedAt, pullRequestColumns[columnLastActive].width-2), pullRequestColumns[columnLastActive].width)
 
-	cell = tview.NewTableCell(expandedUser)
-	pullRequestTable.SetCell(pullRequestEntry.tableIndex,5, cell)
+	for index, column := range ghui.visibleColumns {
+		pullRequestTable.SetCell(pullRequestEntry.tableIndex, index, tview.NewTableCell(contents[column]))
+	}
 
-	cell = tview.NewTableCell(expandedDate)
-	pullRequestTable.SetCell(pullRequestEntry.tableIndex,6, cell)
+}
 
+// getVisibleColumnIndex gives the table column a column is rendered in, or -1 if it has been dropped
+func (ghui *UI) getVisibleColumnIndex(column int) int {
+	for index, visibleColumn := range ghui.visibleColumns {
+		if visibleColumn == column {
+			return index
+		}
+	}
+	return -1
 }
 
 func stringToColor(str string) tcell.Color {
@@ -609,41 +1117,84 @@ func (ghui *UI) addPullRequestTableHeader() {
 	pullRequestGroup := ghui.reviewPullRequestGroup
 	pullRequestTable := pullRequestGroup.pullRequestTable
 
-	cell := tview.NewTableCell(" ")
-	cell.SetSelectable(false)
-	pullRequestTable.SetCell(0,0, cell)
+	for index, column := range ghui.visibleColumns {
+		cell := tview.NewTableCell(" [::b]" + pullRequestColumns[column].header)
+		if column == columnSeen {
+			cell = tview.NewTableCell(" ")
+			cell.SetSelectable(false)
+		}
+		pullRequestTable.SetCell(0, index, cell)
+	}
+}
 
-	cell = tview.NewTableCell(" [::b]Heat")
-	pullRequestTable.SetCell(0,1, cell)
+func (ghui *UI)handlePullRequestsUpdates(loadedPullRequestWrappers []*PullRequestWrapper) {
 
-	cell = tview.NewTableCell(" [::b]Attributes")
-	pullRequestTable.SetCell(0,2, cell)
+	if len(loadedPullRequestWrappers) <= 0 {
+		return
+	}
 
-	cell = tview.NewTableCell(" [::b]Title")
-	pullRequestTable.SetCell(0,3, cell)
+	ghui.pullRequestWrappers = loadedPullRequestWrappers
+	ghui.updatePullRequestTable()
+}
 
-	cell = tview.NewTableCell(" [::b]Repository")
-	pullRequestTable.SetCell(0,4, cell)
+func (ghui *UI) showFilterInput() {
+	ghui.filterInput.SetText(ghui.filter.Expression)
+	ghui.filtering = true
+	ghui.layoutGrid()
+	ghui.app.SetFocus(ghui.filterInput)
+}
 
-	cell = tview.NewTableCell(" [::b]User")
-	pullRequestTable.SetCell(0,5, cell)
+func (ghui *UI) hideFilterInput(key tcell.Key) {
 
-	cell = tview.NewTableCell(" [::b]Last Active")
-	pullRequestTable.SetCell(0,6, cell)
+	if key == tcell.KeyEscape {
+		// Escape abandons the edit and goes back to the last committed filter
+		ghui.applyFilter(ghui.preferences.Filter)
+	} else {
+		ghui.preferences.Filter = ghui.filter.Expression
+		ghui.storePreferences()
+	}
+
+	ghui.filtering = false
+	ghui.layoutGrid()
+	ghui.app.SetFocus(ghui.panes[ghui.focusedPane])
 }
 
-func (ghui *UI)handlePullRequestsUpdates(loadedPullRequestWrappers []*PullRequestWrapper) {
+func (ghui *UI) applyFilter(expression string) {
+	ghui.filter = ParsePullRequestFilter(expression)
+	ghui.updatePullRequestTable()
+}
 
-	if len(loadedPullRequestWrappers) <= 0 {
-		return
+func (ghui *UI) updatePullRequestListLabel(numPullRequests int) {
+	label := fmt.Sprintf(" Pending Pull Request(s) [%d]", numPullRequests)
+	if !ghui.filter.IsEmpty() {
+		label = fmt.Sprintf(" Pending Pull Request(s) [%d of %d] - filter: [yellow]%s[-]", numPullRequests, len(ghui.pullRequestWrappers), tview.Escape(ghui.filter.Expression))
 	}
 
+	direction := "▲"
+	if ghui.preferences.SortDescending {
+		direction = "▼"
+	}
+	label += fmt.Sprintf(" - sorted by %s %s", ConvertSortModeToString(ghui.preferences.SortMode), direction)
+	if ghui.preferences.GroupByRepository {
+		label += ", grouped by repository"
+	}
+	ghui.pullRequestListLabel.SetText(label)
+}
+
+func (ghui *UI) updatePullRequestTable() {
+
+	loadedPullRequestWrappers := SortPullRequestWrappers(ghui.filter.Filter(ghui.pullRequestWrappers), ghui.preferences.SortMode, ghui.preferences.SortDescending)
+	ghui.visibleColumns, ghui.titleWidth = calculateVisibleColumns(ghui.getPullRequestTableWidth())
+	ghui.updatePullRequestListLabel(len(loadedPullRequestWrappers))
+
 	selectedIndex := ghui.numRowsForHeader
 	var currentlySelectedEntry *PullRequestEntry = nil
 
 	if len(ghui.reviewPullRequestGroup.pullRequestEntries) > 0 {
 		selectedIndex,_ = ghui.reviewPullRequestGroup.pullRequestTable.GetSelection()
-		currentlySelectedEntry = ghui.reviewPullRequestGroup.pullRequestEntries[selectedIndex - ghui.numRowsForHeader]
+		if selectedIndex - ghui.numRowsForHeader >= 0 && selectedIndex - ghui.numRowsForHeader < len(ghui.reviewPullRequestGroup.pullRequestEntries) {
+			currentlySelectedEntry = ghui.reviewPullRequestGroup.pullRequestEntries[selectedIndex - ghui.numRowsForHeader]
+		}
 	}
 
 	pullRequestGroup := ghui.reviewPullRequestGroup
@@ -652,13 +1203,21 @@ func (ghui *UI)handlePullRequestsUpdates(loadedPullRequestWrappers []*PullReques
 
 	ghui.addPullRequestTableHeader()
 
-	for counter, pullRequestWrapper := range loadedPullRequestWrappers {
+	for _, pullRequestEntry := range ghui.createPullRequestEntries(loadedPullRequestWrappers) {
 
-		if currentlySelectedEntry != nil && pullRequestWrapper.Id == currentlySelectedEntry.pullRequestWrapper.Id {
-			selectedIndex = counter + ghui.numRowsForHeader
+		pullRequestEntry.tableIndex = len(pullRequestGroup.pullRequestEntries) + ghui.numRowsForHeader
+
+		if currentlySelectedEntry != nil && currentlySelectedEntry.isSameAs(pullRequestEntry) {
+			selectedIndex = pullRequestEntry.tableIndex
+		}
+
+		if pullRequestEntry.repository != nil {
+			ghui.updateRepositoryGroupEntry(pullRequestEntry)
+			pullRequestGroup.pullRequestEntries = append(pullRequestGroup.pullRequestEntries, pullRequestEntry)
+			continue
 		}
 
-		pullRequestEntry := &PullRequestEntry{pullRequestWrapper: pullRequestWrapper,tableIndex: counter + ghui.numRowsForHeader}
+		pullRequestWrapper := pullRequestEntry.pullRequestWrapper
 
 		creator := pullRequestWrapper.PullRequest.Creator
 		if _, ok := ghui.userConfigurations[creator.Id]; !ok {
@@ -678,17 +1237,121 @@ func (ghui *UI)handlePullRequestsUpdates(loadedPullRequestWrappers []*PullReques
 		pullRequestGroup.pullRequestEntries = append(pullRequestGroup.pullRequestEntries, pullRequestEntry)
 	}
 
-	for selectedIndex >= pullRequestGroup.pullRequestTable.GetRowCount() + ghui.numRowsForHeader {
+	for selectedIndex >= pullRequestGroup.pullRequestTable.GetRowCount() && selectedIndex > ghui.numRowsForHeader {
 		selectedIndex--
 	}
 
+	if len(pullRequestGroup.pullRequestEntries) == 0 {
+		pullRequestGroup.currentlySelectedPullRequestEntry = nil
+		ghui.clearPullRequestDetails()
+		return
+	}
+
 	pullRequestGroup.pullRequestTable.Select(selectedIndex,0)
 
 }
 
+// createPullRequestEntries lays out the (already sorted) pull requests, optionally grouped by repository.  Groups are
+// ordered by their first pull request so the sort order still decides what comes first.
+func (ghui *UI) createPullRequestEntries(pullRequestWrappers []*PullRequestWrapper) []*PullRequestEntry {
+
+	pullRequestEntries := make([]*PullRequestEntry, 0)
+
+	if !ghui.preferences.GroupByRepository {
+		for _, pullRequestWrapper := range pullRequestWrappers {
+			pullRequestEntries = append(pullRequestEntries, &PullRequestEntry{pullRequestWrapper: pullRequestWrapper})
+		}
+		return pullRequestEntries
+	}
+
+	repositories := make([]*Repo, 0)
+	pullRequestWrappersByRepository := make(map[string][]*PullRequestWrapper)
+	for _, pullRequestWrapper := range pullRequestWrappers {
+		repo := pullRequestWrapper.PullRequest.Repo
+		if _, ok := pullRequestWrappersByRepository[repo.FullName]; !ok {
+			repositories = append(repositories, repo)
+		}
+		pullRequestWrappersByRepository[repo.FullName] = append(pullRequestWrappersByRepository[repo.FullName], pullRequestWrapper)
+	}
+
+	for _, repo := range repositories {
+		repositoryPullRequestWrappers := pullRequestWrappersByRepository[repo.FullName]
+		collapsed := ghui.isRepositoryCollapsed(repo)
+		pullRequestEntries = append(pullRequestEntries, &PullRequestEntry{repository: repo, groupSize: len(repositoryPullRequestWrappers), collapsed: collapsed})
+		if collapsed {
+			continue
+		}
+		for _, pullRequestWrapper := range repositoryPullRequestWrappers {
+			pullRequestEntries = append(pullRequestEntries, &PullRequestEntry{pullRequestWrapper: pullRequestWrapper})
+		}
+	}
+
+	return pullRequestEntries
+}
+
+func (ghui *UI) updateRepositoryGroupEntry(pullRequestEntry *PullRequestEntry) {
+
+	pullRequestTable := ghui.reviewPullRequestGroup.pullRequestTable
+
+	indicator := " ▼ "
+	if pullRequestEntry.collapsed {
+		indicator = " ▶ "
+	}
+
+	colorizedRepo, _ := formatWithColor(tview.Escape(pullRequestEntry.repository.FullName), ghui.getColorForRepo(pullRequestEntry.repository))
+
+	pullRequestTable.SetCell(pullRequestEntry.tableIndex, ghui.getVisibleColumnIndex(columnSeen), tview.NewTableCell(indicator))
+	pullRequestTable.SetCell(pullRequestEntry.tableIndex, ghui.getVisibleColumnIndex(columnTitle), tview.NewTableCell(fmt.Sprintf(" [::b]%s[::-] (%d)", colorizedRepo, pullRequestEntry.groupSize)))
+}
+
+func (ghui *UI) isRepositoryCollapsed(repo *Repo) bool {
+	for _, collapsedRepository := range ghui.preferences.CollapsedRepositories {
+		if collapsedRepository == repo.FullName {
+			return true
+		}
+	}
+	return false
+}
+
+func (ghui *UI) toggleRepositoryCollapsed(repo *Repo) {
+
+	collapsedRepositories := make([]string, 0)
+	for _, collapsedRepository := range ghui.preferences.CollapsedRepositories {
+		if collapsedRepository != repo.FullName {
+			collapsedRepositories = append(collapsedRepositories, collapsedRepository)
+		}
+	}
+	if !ghui.isRepositoryCollapsed(repo) {
+		collapsedRepositories = append(collapsedRepositories, repo.FullName)
+	}
+	ghui.preferences.CollapsedRepositories = collapsedRepositories
+
+	ghui.updatePullRequestTable()
+	ghui.storePreferences()
+}
+
+func (ghui *UI) cycleSortMode() {
+	ghui.preferences.SortMode = NextSortMode(ghui.preferences.SortMode)
+	ghui.preferences.SortDescending = DefaultSortDescending(ghui.preferences.SortMode)
+	ghui.updatePullRequestTable()
+	ghui.storePreferences()
+}
+
+func (ghui *UI) toggleSortDirection() {
+	ghui.preferences.SortDescending = !ghui.preferences.SortDescending
+	ghui.updatePullRequestTable()
+	ghui.storePreferences()
+}
+
+func (ghui *UI) toggleGroupByRepository() {
+	ghui.preferences.GroupByRepository = !ghui.preferences.GroupByRepository
+	ghui.updatePullRequestTable()
+	ghui.storePreferences()
+}
+
 func (ghui *UI)getPullRequestReviewStatusString(pullRequestWrapper *PullRequestWrapper) string {
 
-	statusString := []byte{'-','-','-','-','-','-','-', '-'}
+	statusString := []rune{'-','-','-','-','-','-','-', '-', ' '}
 
 	if ghui.hasPullReviewStatus(PullRequestReviewStatusPending, pullRequestWrapper) {
 		statusString[0] = 'P'
@@ -719,6 +1382,10 @@ func (ghui *UI)getPullRequestReviewStatusString(pullRequestWrapper *PullRequestW
 		statusString[7] = 'X'
 	}
 
+	if pullRequestWrapper.HasNote() {
+		statusString[8] = '✎'
+	}
+
 	return string(statusString)
 
 
@@ -730,11 +1397,11 @@ func (ghui *UI) handlePullRequestDeleted(pullRequestWrapper *PullRequestWrapper)
 
 	var pullRequestEntry *PullRequestEntry = nil
 	var pullRequestEntryIndex int = -1
-	for index, existingPullRequestEntry := range ghui.reviewPullRequestGroup.pullRequestEntries {
-		if existingPullRequestEntry.pullRequestWrapper.Id == pullRequestWrapper.Id {
+	for _, existingPullRequestEntry := range ghui.reviewPullRequestGroup.pullRequestEntries {
+		if existingPullRequestEntry.pullRequestWrapper != nil && existingPullRequestEntry.pullRequestWrapper.Id == pullRequestWrapper.Id {
 			pullRequestEntry = existingPullRequestEntry
 			pullRequestEntry.pullRequestWrapper = pullRequestWrapper
-			pullRequestEntryIndex = index-ghui.numRowsForHeader
+			pullRequestEntryIndex = existingPullRequestEntry.tableIndex
 		}
 	}
 
@@ -756,14 +1423,30 @@ func (ghui *UI) handlePullRequestUpdated(pullRequestWrapper *PullRequestWrapper)
 
 	var pullRequestEntry *PullRequestEntry = nil
 	var pullRequestEntryIndex int = -1
-	for index, existingPullRequestEntry := range ghui.reviewPullRequestGroup.pullRequestEntries {
-		if existingPullRequestEntry.pullRequestWrapper.Id == pullRequestWrapper.Id {
+	for _, existingPullRequestEntry := range ghui.reviewPullRequestGroup.pullRequestEntries {
+		if existingPullRequestEntry.pullRequestWrapper != nil && existingPullRequestEntry.pullRequestWrapper.Id == pullRequestWrapper.Id {
 			pullRequestEntry = existingPullRequestEntry
 			pullRequestEntry.pullRequestWrapper = pullRequestWrapper
-			pullRequestEntryIndex = index
+			pullRequestEntryIndex = existingPullRequestEntry.tableIndex
 		}
 	}
 
+	// The list is shared with whoever else got it from the monitor, so it is replaced rather than changed
+	pullRequestWrappers := make([]*PullRequestWrapper, len(ghui.pullRequestWrappers))
+	for index, existingPullRequestWrapper := range ghui.pullRequestWrappers {
+		if existingPullRequestWrapper.Id == pullRequestWrapper.Id {
+			existingPullRequestWrapper = pullRequestWrapper
+		}
+		pullRequestWrappers[index] = existingPullRequestWrapper
+	}
+	ghui.pullRequestWrappers = pullRequestWrappers
+
+	// The reviewers dialog shows the pull request as it is now, e.g. once a review request went through
+	if ghui.activeView == reviewersPanel && ghui.reviewersDialog.pullRequestWrapper.Id == pullRequestWrapper.Id {
+		ghui.reviewersDialog.pullRequestWrapper = pullRequestWrapper
+		ghui.reviewersDialog.update()
+	}
+
 	// If not in the list, safe to ignore
 	// If in the list, update the list entry
 	// If in the list && the index == currently selected index, update the details view too
@@ -780,33 +1463,35 @@ func (ghui *UI) handlePullRequestUpdated(pullRequestWrapper *PullRequestWrapper)
 }
 
 func (ghui *UI) handleStatusUpdate(status string) {
-	go ghui.app.QueueUpdateDraw(func() {
-		ghui.status.SetText(" " + status)
-	})
+	ghui.status.SetText(" " + tview.Escape(status))
 }
 
+// pollEvents queues the events for the UI in the order the monitor sent them, waiting while the queue of the UI is
+// full.  The monitor queues its own events, so it is never held up by this.
 func (ghui *UI) pollEvents() {
 	events := ghui.ghMon.events
 	for {
 		event := <-events
 		switch event.eventType {
 		case PullRequestDeleted:
-			go ghui.app.QueueUpdateDraw(func(){
+			ghui.app.QueueUpdateDraw(func(){
 				ghui.handlePullRequestDeleted(event.payload.(*PullRequestWrapper))
 			})
 		case PullRequestUpdated:
-			go ghui.app.QueueUpdateDraw(func() {
+			ghui.app.QueueUpdateDraw(func() {
 				ghui.handlePullRequestUpdated(event.payload.(*PullRequestWrapper))
 			})
 		case PullRequestRefreshFinished,PullRequestsUpdates:
 
-			go ghui.app.QueueUpdateDraw(func() {
+			ghui.app.QueueUpdateDraw(func() {
 				pullRequestsUpdatesEvent := event.payload.(PullRequestsUpdatesEvent)
 				ghui.handlePullRequestsUpdates(pullRequestsUpdatesEvent.pullRequestWrappers)
 			})
 
 		case Status:
-			go ghui.handleStatusUpdate(event.payload.(string))
+			ghui.app.QueueUpdateDraw(func() {
+				ghui.handleStatusUpdate(event.payload.(string))
+			})
 		}
 	}
 }
@@ -814,8 +1499,9 @@ func (ghui *UI) pollEvents() {
 func (ghui *UI) EventLoop() {
 
 	go ghui.pollEvents()
+	go ghui.storePreferencesInOrder()
 
-	ghui.app.SetRoot(ghui.grid, true)
+	ghui.app.SetRoot(ghui.panels, true)
 	ghui.app.SetFocus(ghui.reviewerTable)
 	ghui.app.EnableMouse(false)
 
@@ -823,4 +1509,23 @@ func (ghui *UI) EventLoop() {
 		panic(err)
 	}
 
+	// The last change to the preferences is not lost on quitting
+	close(ghui.preferencesToStore)
+	<-ghui.preferencesStored
+}
+
+// storePreferences hands a copy of the preferences to storePreferencesInOrder, the UI keeps changing its own
+func (ghui *UI) storePreferences() {
+	preferences := *ghui.preferences
+	preferences.CollapsedRepositories = append([]string(nil), ghui.preferences.CollapsedRepositories...)
+	ghui.preferencesToStore <- preferences
+}
+
+// storePreferencesInOrder stores the preferences one copy at a time, so the last change is the one left on disk
+func (ghui *UI) storePreferencesInOrder() {
+	for preferences := range ghui.preferencesToStore {
+		storedPreferences := preferences
+		ghui.ghMon.StorePreferences(&storedPreferences)
+	}
+	close(ghui.preferencesStored)
 }
\ No newline at end of file
@@ -0,0 +1,172 @@
+package ghmon
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	tview "gitlab.com/tslocum/cview"
+)
+
+const menuPanel = "menu"
+
+type menuItem struct {
+	label    string
+	shortcut rune
+	action   func()
+}
+
+// showMenu shows a list of actions on top of the current view, choosing one (ENTER or its shortcut) closes the menu
+// and runs the action
+func (ghui *UI) showMenu(title string, menuItems []*menuItem) {
+
+	previousView := ghui.activeView
+	previousFocus := ghui.app.GetFocus()
+
+	closeMenu := func() {
+		ghui.panels.RemovePanel(menuPanel)
+		ghui.activeView = previousView
+		ghui.app.SetFocus(previousFocus)
+	}
+
+	list := tview.NewList()
+	list.SetBorder(true)
+	list.SetTitle(" " + title + " ")
+	list.ShowSecondaryText(false)
+	list.SetHighlightFullLine(true)
+	list.SetWrapAround(true)
+
+	for _, item := range menuItems {
+		action := item.action
+		listItem := tview.NewListItem(item.label)
+		listItem.SetShortcut(item.shortcut)
+		listItem.SetSelectedFunc(func() {
+			closeMenu()
+			action()
+		})
+		list.AddItem(listItem)
+	}
+	list.SetDoneFunc(closeMenu)
+
+	ghui.panels.RemovePanel(menuPanel)
+	ghui.panels.AddPanel(menuPanel, centerPrimitive(list, 3, len(menuItems)+2), true, true)
+	ghui.activeView = menuPanel
+	ghui.app.SetFocus(list)
+}
+
+// runPullRequestAction runs an action against GitHub in the background, reporting progress and the result in the
+// status bar
+func (ghui *UI) runPullRequestAction(pullRequestWrapper *PullRequestWrapper, description string, action func() error) {
+
+	pullRequest := pullRequestWrapper.PullRequest
+	target := fmt.Sprintf("%s#%d", tview.Escape(pullRequest.Repo.FullName), pullRequest.Number)
+	ghui.status.SetText(fmt.Sprintf(" %s %s ...", description, target))
+
+	go func() {
+		err := action()
+		ghui.app.QueueUpdateDraw(func() {
+			if err != nil {
+				ghui.ghMon.Logger().Printf("%s %s failed: %s", description, target, err)
+				ghui.status.SetText(fmt.Sprintf(" [red]%s %s failed: %s[-]", description, target, tview.Escape(err.Error())))
+				return
+			}
+			ghui.status.SetText(fmt.Sprintf(" [green]%s %s done[-]", description, target))
+		})
+	}()
+}
+
+// confirmPullRequestAction asks for confirmation before running an action against GitHub
+func (ghui *UI) confirmPullRequestAction(pullRequestWrapper *PullRequestWrapper, description string, action func() error) {
+	pullRequest := pullRequestWrapper.PullRequest
+	message := fmt.Sprintf("%s?\n\n%s#%d %s", description, pullRequest.Repo.FullName, pullRequest.Number, pullRequest.Title)
+	ghui.confirm(message, description, func() {
+		ghui.runPullRequestAction(pullRequestWrapper, description, action)
+	})
+}
+
+// showPullRequestActions offers the actions available on one of the user's own pull requests
+func (ghui *UI) showPullRequestActions() {
+
+	pullRequestEntry := ghui.getCurrentlySelectedPullRequest()
+	if pullRequestEntry == nil || pullRequestEntry.pullRequestWrapper == nil {
+		return
+	}
+	pullRequestWrapper := pullRequestEntry.pullRequestWrapper
+	pullRequest := pullRequestWrapper.PullRequest
+	ghMon := ghui.ghMon
+
+	if !ghMon.IsOwnPullRequest(pullRequestWrapper) {
+		ghui.status.SetText(" [red]Merging, closing and marking ready are only available on your own pull requests[-]")
+		return
+	}
+	if pullRequestWrapper.Deleted {
+		ghui.status.SetText(" [red]The pull request is no longer open[-]")
+		return
+	}
+
+	menuItems := make([]*menuItem, 0)
+	shortcut := '1'
+	addMenuItem := func(label string, action func()) {
+		menuItems = append(menuItems, &menuItem{label: label, shortcut: shortcut, action: action})
+		shortcut++
+	}
+
+	if pullRequest.Draft {
+		addMenuItem("Mark ready for review", func() {
+			ghui.confirmPullRequestAction(pullRequestWrapper, "Mark ready", func() error {
+				return ghMon.MarkPullRequestReady(pullRequestWrapper)
+			})
+		})
+	}
+
+	mergeLabels := map[MergeMethod]string{MergeMethodMerge: "Merge", MergeMethodSquash: "Squash and merge", MergeMethodRebase: "Rebase and merge"}
+	for _, mergeMethod := range pullRequest.Repo.AllowedMergeMethods() {
+		mergeMethod := mergeMethod
+		label := mergeLabels[mergeMethod]
+		addMenuItem(label, func() {
+			ghui.confirmPullRequestAction(pullRequestWrapper, label, func() error {
+				return ghMon.MergePullRequest(pullRequestWrapper, mergeMethod)
+			})
+		})
+	}
+
+	if pullRequest.Repo.AllowAutoMerge {
+		for _, mergeMethod := range pullRequest.Repo.AllowedMergeMethods() {
+			mergeMethod := mergeMethod
+			label := fmt.Sprintf("Enable auto-merge (%s)", ConvertMergeMethodToString(mergeMethod))
+			addMenuItem(label, func() {
+				ghui.confirmPullRequestAction(pullRequestWrapper, "Enable auto-merge", func() error {
+					return ghMon.EnableAutoMerge(pullRequestWrapper, mergeMethod)
+				})
+			})
+		}
+	}
+
+	addMenuItem("Close", func() {
+		ghui.confirmPullRequestAction(pullRequestWrapper, "Close", func() error {
+			return ghMon.ClosePullRequest(pullRequestWrapper)
+		})
+	})
+
+	if pullRequest.HeadRef != "" {
+		addMenuItem(fmt.Sprintf("Delete branch %s", tview.Escape(pullRequest.HeadRef)), func() {
+			ghui.confirmPullRequestAction(pullRequestWrapper, "Delete branch", func() error {
+				return ghMon.DeletePullRequestBranch(pullRequestWrapper)
+			})
+		})
+	}
+
+	score := pullRequestWrapper.Score
+	title := fmt.Sprintf("%s#%d - %d/%d approvals", pullRequest.Repo.FullName, pullRequest.Number, score.Approvals, score.NumReviewers)
+	if pullRequest.MergeableState != "" {
+		title += ", " + pullRequest.MergeableState
+	}
+	ghui.showMenu(tview.Escape(title), menuItems)
+}
+
+func (ghui *UI) handleMenuInput(event *tcell.EventKey) *tcell.EventKey {
+	// The list handles ESC (done) and ENTER itself, 'q' closes the menu as well
+	if event.Key() == tcell.KeyRune && event.Rune() == 'q' {
+		return tcell.NewEventKey(tcell.KeyEscape, 0, tcell.ModNone)
+	}
+	return event
+}
@@ -0,0 +1,242 @@
+package ghmon
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	tview "gitlab.com/tslocum/cview"
+)
+
+const conversationPanel = "conversation"
+
+// Number of lines of the diff hunk shown above a review thread
+const reviewThreadContextLines = 4
+
+const (
+	conversationNewColor      = "yellow"
+	conversationAuthorColor   = "#5fafff"
+	conversationResolvedColor = "gray"
+	conversationOutdatedColor = "#d78700"
+)
+
+type ConversationView struct {
+	ghui *UI
+
+	layout *tview.Flex
+	label  *tview.TextView
+	text   *tview.TextView
+
+	pullRequestWrapper *PullRequestWrapper
+	conversation       *PullRequestConversation
+	viewedSince        time.Time
+	showResolved       bool
+
+	/* Region of each new item, lines wrap so regions are used rather than line numbers */
+	newItemRegions []string
+	currentNewItem int
+}
+
+func NewConversationView(ghui *UI) *ConversationView {
+
+	label := tview.NewTextView()
+	label.SetDynamicColors(true)
+
+	text := tview.NewTextView()
+	text.SetDynamicColors(true)
+	text.SetWrap(true)
+	text.SetWordWrap(true)
+	text.SetScrollable(true)
+	text.SetRegions(true)
+
+	layout := tview.NewFlex()
+	layout.SetDirection(tview.FlexRow)
+	layout.AddItem(label, 1, 0, false)
+	layout.AddItem(text, 0, 1, true)
+
+	return &ConversationView{ghui: ghui, layout: layout, label: label, text: text, showResolved: false}
+}
+
+func (conversationView *ConversationView) Show(pullRequestWrapper *PullRequestWrapper, conversation *PullRequestConversation, viewedSince time.Time) {
+	conversationView.pullRequestWrapper = pullRequestWrapper
+	conversationView.conversation = conversation
+	conversationView.viewedSince = viewedSince
+	conversationView.refresh()
+	conversationView.text.ScrollToBeginning()
+}
+
+func (conversationView *ConversationView) refresh() {
+
+	conversation := conversationView.conversation
+
+	newItems := 0
+	for _, comment := range conversation.Comments {
+		if comment.IsNewSince(conversationView.viewedSince) {
+			newItems++
+		}
+	}
+	resolvedThreads := 0
+	for _, thread := range conversation.Threads {
+		if thread.Resolved {
+			resolvedThreads++
+		}
+		for _, comment := range thread.Comments {
+			if comment.IsNewSince(conversationView.viewedSince) {
+				newItems++
+			}
+		}
+	}
+
+	resolvedHint := "r show resolved"
+	if conversationView.showResolved {
+		resolvedHint = "r hide resolved"
+	}
+	conversationView.label.SetText(fmt.Sprintf(" [::b]%s[::-] - %d comments, %d threads (%d resolved), [%s]%d new[-]   [gray](n/N next/previous new, %s, ESC close)[-]",
+		tview.Escape(conversationView.pullRequestWrapper.PullRequest.Title), len(conversation.Comments), len(conversation.Threads), resolvedThreads,
+		conversationNewColor, newItems, resolvedHint))
+
+	conversationView.text.SetText(conversationView.render())
+	conversationView.text.Highlight()
+	conversationView.currentNewItem = -1
+}
+
+func (conversationView *ConversationView) render() string {
+
+	var rendered strings.Builder
+	conversationView.newItemRegions = make([]string, 0)
+
+	writeLine := func(text string) {
+		rendered.WriteString(text)
+		rendered.WriteString("\n")
+	}
+
+	writeComment := func(comment *PullRequestComment, indent string) {
+
+		isNew := comment.IsNewSince(conversationView.viewedSince)
+		region := ""
+		if isNew {
+			region = fmt.Sprintf("new-%d", len(conversationView.newItemRegions))
+			conversationView.newItemRegions = append(conversationView.newItemRegions, region)
+		}
+
+		header := fmt.Sprintf("%s[\"%s\"][%s::b]%s[-::-][\"\"] [gray]%s[-]", indent, region, conversationAuthorColor, tview.Escape(comment.User.Username),
+			conversationView.ghui.formatDate(comment.CreatedAt, true))
+		if comment.Kind == PullRequestCommentKindReview {
+			pullRequestReview := &PullRequestReview{Status: comment.ReviewStatus}
+			header += fmt.Sprintf(" [%s]%s[-]", conversationView.ghui.getPullRequestReviewColorString(pullRequestReview),
+				conversationView.ghui.ghMon.ConvertPullRequestReviewStateToString(comment.ReviewStatus))
+		}
+		if comment.UpdatedAt.After(comment.CreatedAt.Add(time.Minute)) {
+			header += " [gray](edited)[-]"
+		}
+		if isNew {
+			header += fmt.Sprintf(" [%s::b]● new[-::-]", conversationNewColor)
+		}
+		writeLine(header)
+
+		if strings.TrimSpace(comment.Body) != "" {
+			for _, bodyLine := range strings.Split(RenderMarkdown(comment.Body), "\n") {
+				writeLine(indent + "  " + bodyLine)
+			}
+		}
+		writeLine("")
+	}
+
+	writeLine("[::bu]Conversation[::-]")
+	writeLine("")
+	if len(conversationView.conversation.Comments) == 0 {
+		writeLine("[gray]No comments[-]")
+		writeLine("")
+	}
+	for _, comment := range conversationView.conversation.Comments {
+		writeComment(comment, "")
+	}
+
+	writeLine("[::bu]Review Threads[::-]")
+	writeLine("")
+	if len(conversationView.conversation.Threads) == 0 {
+		writeLine("[gray]No review comments[-]")
+	}
+
+	hiddenThreads := 0
+	for _, thread := range conversationView.conversation.Threads {
+
+		if thread.Resolved && !conversationView.showResolved {
+			hiddenThreads++
+			continue
+		}
+
+		header := fmt.Sprintf("[::b]%s:%d[::-]", tview.Escape(thread.Path), thread.Line)
+		if thread.Resolved {
+			header += fmt.Sprintf(" [%s](resolved)[-]", conversationResolvedColor)
+		}
+		if thread.Outdated {
+			header += fmt.Sprintf(" [%s](outdated)[-]", conversationOutdatedColor)
+		}
+		writeLine(header)
+
+		// The end of the hunk is where the comment was made
+		hunkLines := strings.Split(thread.DiffHunk, "\n")
+		if len(hunkLines) > reviewThreadContextLines {
+			hunkLines = hunkLines[len(hunkLines)-reviewThreadContextLines:]
+		}
+		for _, hunkLine := range hunkLines {
+			color := "gray"
+			if strings.HasPrefix(hunkLine, "+") {
+				color = "green"
+			} else if strings.HasPrefix(hunkLine, "-") {
+				color = "red"
+			}
+			writeLine(fmt.Sprintf("  [%s]│ %s[-]", color, tview.Escape(hunkLine)))
+		}
+		writeLine("")
+
+		for _, comment := range thread.Comments {
+			writeComment(comment, "    ")
+		}
+	}
+
+	if hiddenThreads > 0 {
+		writeLine(fmt.Sprintf("[%s]%d resolved thread(s) hidden, press r to show them[-]", conversationResolvedColor, hiddenThreads))
+	}
+
+	return rendered.String()
+}
+
+func (conversationView *ConversationView) moveNewItem(delta int) {
+
+	newItem := conversationView.currentNewItem + delta
+	if newItem < 0 || newItem >= len(conversationView.newItemRegions) {
+		return
+	}
+	conversationView.currentNewItem = newItem
+	conversationView.text.Highlight(conversationView.newItemRegions[newItem])
+	conversationView.text.ScrollToHighlight()
+}
+
+func (conversationView *ConversationView) handleInput(event *tcell.EventKey) *tcell.EventKey {
+
+	switch event.Key() {
+	case tcell.KeyEscape:
+		conversationView.ghui.closeView(conversationPanel)
+		return nil
+	case tcell.KeyRune:
+		switch event.Rune() {
+		case 'q', 'v':
+			conversationView.ghui.closeView(conversationPanel)
+			return nil
+		case 'n':
+			conversationView.moveNewItem(1)
+			return nil
+		case 'N', 'p':
+			conversationView.moveNewItem(-1)
+			return nil
+		case 'r':
+			conversationView.showResolved = !conversationView.showResolved
+			conversationView.refresh()
+			return nil
+		}
+	}
+	return event
+}
@@ -0,0 +1,347 @@
+package ghmon
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	tview "gitlab.com/tslocum/cview"
+)
+
+const diffPanel = "diff"
+
+var (
+	diffHunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+(\d+)(?:,\d+)? @@(.*)$`)
+	// One pattern per comment syntax, a language without a known syntax gets no comments at all.  Strings come first so
+	// that a comment marker inside one is not taken for a comment.
+	diffTokenPatterns = map[string]*regexp.Regexp{
+		"":   newDiffTokenPattern(""),
+		"//": newDiffTokenPattern(`//.*$|`),
+		"#":  newDiffTokenPattern(`#.*$|`),
+		"--": newDiffTokenPattern(`--.*$|`),
+	}
+)
+
+func newDiffTokenPattern(commentPattern string) *regexp.Regexp {
+	return regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|` + "`[^`]*`" + `|` + commentPattern + `\b\d+(?:\.\d+)?\b|\b[A-Za-z_][A-Za-z0-9_]*\b`)
+}
+
+var diffCommentMarkers = map[string]string{
+	"go": "//", "java": "//", "js": "//", "rust": "//", "c": "//",
+	"python": "#", "ruby": "#", "shell": "#",
+	"sql": "--", "lua": "--", "haskell": "--",
+}
+
+var diffKeywords = map[string][]string{
+	"go":     {"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map", "package", "range", "return", "select", "struct", "switch", "type", "var", "nil", "true", "false"},
+	"java":   {"abstract", "boolean", "break", "case", "catch", "class", "continue", "default", "do", "else", "enum", "extends", "final", "finally", "for", "if", "implements", "import", "instanceof", "interface", "new", "null", "package", "private", "protected", "public", "return", "static", "super", "switch", "this", "throw", "throws", "try", "void", "while", "true", "false", "val", "var", "fun", "when", "override"},
+	"js":     {"async", "await", "break", "case", "catch", "class", "const", "continue", "default", "delete", "do", "else", "export", "extends", "finally", "for", "from", "function", "if", "import", "in", "instanceof", "interface", "let", "new", "null", "of", "return", "switch", "this", "throw", "try", "type", "typeof", "undefined", "var", "while", "yield", "true", "false"},
+	"python": {"and", "as", "assert", "async", "await", "break", "class", "continue", "def", "del", "elif", "else", "except", "finally", "for", "from", "global", "if", "import", "in", "is", "lambda", "None", "not", "or", "pass", "raise", "return", "try", "while", "with", "yield", "True", "False", "self"},
+	"ruby":   {"begin", "class", "def", "do", "else", "elsif", "end", "ensure", "if", "module", "nil", "require", "rescue", "return", "self", "unless", "until", "when", "while", "yield", "true", "false"},
+	"rust":   {"as", "break", "const", "continue", "crate", "else", "enum", "fn", "for", "if", "impl", "in", "let", "loop", "match", "mod", "move", "mut", "pub", "ref", "return", "self", "Self", "static", "struct", "trait", "type", "unsafe", "use", "where", "while", "true", "false"},
+	"c":      {"auto", "break", "case", "char", "class", "const", "continue", "default", "do", "double", "else", "enum", "extern", "float", "for", "if", "include", "int", "long", "namespace", "new", "nullptr", "private", "public", "return", "short", "sizeof", "static", "struct", "switch", "template", "typedef", "union", "unsigned", "void", "while", "true", "false"},
+	"shell":  {"case", "do", "done", "elif", "else", "esac", "export", "fi", "for", "function", "if", "in", "local", "return", "then", "while"},
+}
+
+var diffLanguagesByExtension = map[string]string{
+	".go": "go", ".java": "java", ".kt": "java", ".scala": "java", ".js": "js", ".jsx": "js", ".ts": "js", ".tsx": "js",
+	".py": "python", ".rb": "ruby", ".rs": "rust", ".c": "c", ".h": "c", ".cc": "c", ".cpp": "c", ".hpp": "c", ".cs": "c",
+	".sh": "shell", ".bash": "shell", ".zsh": "shell", ".sql": "sql", ".lua": "lua", ".hs": "haskell",
+}
+
+const (
+	diffAddedBackground   = "#003000"
+	diffRemovedBackground = "#3a0000"
+	diffKeywordColor      = "#d787ff"
+	diffStringColor       = "#d7d787"
+	diffCommentColor      = "gray"
+	diffNumberColor       = "#87d7ff"
+	diffHunkColor         = "#5fafff"
+)
+
+type DiffView struct {
+	ghui *UI
+
+	layout   *tview.Flex
+	label    *tview.TextView
+	fileList *tview.List
+	diffText *tview.TextView
+
+	pullRequestWrapper *PullRequestWrapper
+	pullRequestDiff    *PullRequestDiff
+
+	/* Rendered line of each file header and each hunk header */
+	fileLines    []int
+	hunkLines    []int
+	currentHunk  int
+	updatingList bool
+}
+
+func NewDiffView(ghui *UI) *DiffView {
+
+	label := tview.NewTextView()
+	label.SetDynamicColors(true)
+
+	fileList := tview.NewList()
+	fileList.ShowSecondaryText(false)
+	fileList.SetHighlightFullLine(true)
+	fileList.SetScrollBarVisibility(tview.ScrollBarAuto)
+
+	diffText := tview.NewTextView()
+	diffText.SetDynamicColors(true)
+	diffText.SetWrap(false)
+	diffText.SetScrollable(true)
+
+	body := tview.NewFlex()
+	body.AddItem(fileList, 0, 1, true)
+	body.AddItem(diffText, 0, 3, false)
+
+	layout := tview.NewFlex()
+	layout.SetDirection(tview.FlexRow)
+	layout.AddItem(label, 1, 0, false)
+	layout.AddItem(body, 0, 1, true)
+
+	diffView := &DiffView{ghui: ghui, layout: layout, label: label, fileList: fileList, diffText: diffText}
+
+	fileList.SetChangedFunc(func(index int, item *tview.ListItem) {
+		if !diffView.updatingList {
+			diffView.scrollToFile(index)
+		}
+	})
+	fileList.SetSelectedFunc(func(index int, item *tview.ListItem) {
+		diffView.scrollToFile(index)
+		ghui.app.SetFocus(diffView.diffText)
+	})
+
+	return diffView
+}
+
+func (diffView *DiffView) Show(pullRequestWrapper *PullRequestWrapper, pullRequestDiff *PullRequestDiff) {
+
+	diffView.pullRequestWrapper = pullRequestWrapper
+	diffView.pullRequestDiff = pullRequestDiff
+	diffView.currentHunk = -1
+
+	var additions, deletions uint32
+	diffView.updatingList = true
+	diffView.fileList.Clear()
+	for _, file := range pullRequestDiff.Files {
+		additions += file.Additions
+		deletions += file.Deletions
+		item := tview.NewListItem(fmt.Sprintf("%s [green]+%d[-] [red]-%d[-]", tview.Escape(file.Filename), file.Additions, file.Deletions))
+		diffView.fileList.AddItem(item)
+	}
+	diffView.updatingList = false
+
+	diffView.label.SetText(fmt.Sprintf(" [::b]%s[::-] - %d files, [green]+%d[-] [red]-%d[-]   [gray](TAB switch pane, n/N next/previous hunk, ]/[ next/previous file, ESC close)[-]",
+		tview.Escape(pullRequestWrapper.PullRequest.Title), len(pullRequestDiff.Files), additions, deletions))
+
+	diffView.diffText.SetText(diffView.render())
+	diffView.diffText.ScrollToBeginning()
+}
+
+func (diffView *DiffView) render() string {
+
+	var rendered strings.Builder
+	line := 0
+
+	diffView.fileLines = make([]int, 0)
+	diffView.hunkLines = make([]int, 0)
+
+	writeLine := func(text string) {
+		rendered.WriteString(text)
+		rendered.WriteString("\n")
+		line++
+	}
+
+	for _, file := range diffView.pullRequestDiff.Files {
+
+		diffView.fileLines = append(diffView.fileLines, line)
+
+		header := file.Filename
+		if file.PreviousFilename != "" {
+			header = file.PreviousFilename + " → " + file.Filename
+		}
+		writeLine(fmt.Sprintf("[::b]%s %s[::-] [gray](%s)[-]", strings.Repeat("━", 3), tview.Escape(header), file.Status))
+
+		if file.Patch == "" {
+			writeLine("[gray]  (binary file or diff too large to show)[-]")
+			writeLine("")
+			continue
+		}
+
+		language := diffLanguagesByExtension[strings.ToLower(filepath.Ext(file.Filename))]
+		oldLine, newLine := 0, 0
+
+		for _, patchLine := range strings.Split(file.Patch, "\n") {
+
+			if matches := diffHunkHeaderPattern.FindStringSubmatch(patchLine); matches != nil {
+				diffView.hunkLines = append(diffView.hunkLines, line)
+				fmt.Sscanf(matches[1], "%d", &oldLine)
+				fmt.Sscanf(matches[2], "%d", &newLine)
+				writeLine(fmt.Sprintf("[%s]%s[-]", diffHunkColor, tview.Escape(patchLine)))
+				continue
+			}
+
+			if patchLine == "" {
+				continue
+			}
+
+			prefix := patchLine[0]
+			code := highlightCode(patchLine[1:], language)
+
+			switch prefix {
+			case '+':
+				writeLine(fmt.Sprintf("[:%s]     %5d [green]+[-]%s[-:-:-]", diffAddedBackground, newLine, code))
+				newLine++
+			case '-':
+				writeLine(fmt.Sprintf("[:%s]%5d      [red]-[-]%s[-:-:-]", diffRemovedBackground, oldLine, code))
+				oldLine++
+			case '\\':
+				writeLine(fmt.Sprintf("[gray]%s[-]", tview.Escape(patchLine)))
+			default:
+				writeLine(fmt.Sprintf("%5d %5d  %s", oldLine, newLine, code))
+				oldLine++
+				newLine++
+			}
+		}
+		writeLine("")
+	}
+
+	if len(diffView.pullRequestDiff.Files) == 0 {
+		writeLine("[gray]No changed files[-]")
+	}
+
+	return rendered.String()
+}
+
+// highlightCode applies a light, language aware highlighting of keywords, strings, numbers and comments
+func highlightCode(code string, language string) string {
+
+	keywords := make(map[string]bool)
+	for _, keyword := range diffKeywords[language] {
+		keywords[keyword] = true
+	}
+
+	commentMarker := diffCommentMarkers[language]
+
+	var highlighted strings.Builder
+	position := 0
+
+	for _, match := range diffTokenPatterns[commentMarker].FindAllStringIndex(code, -1) {
+
+		token := code[match[0]:match[1]]
+		color := ""
+
+		switch {
+		case commentMarker != "" && strings.HasPrefix(token, commentMarker):
+			color = diffCommentColor
+		case token[0] == '"' || token[0] == '\'' || token[0] == '`':
+			color = diffStringColor
+		case token[0] >= '0' && token[0] <= '9':
+			color = diffNumberColor
+		case keywords[token]:
+			color = diffKeywordColor
+		}
+
+		if color == "" {
+			continue
+		}
+
+		highlighted.WriteString(tview.Escape(code[position:match[0]]))
+		highlighted.WriteString(fmt.Sprintf("[%s]%s[-]", color, tview.Escape(token)))
+		position = match[1]
+	}
+
+	highlighted.WriteString(tview.Escape(code[position:]))
+	return highlighted.String()
+}
+
+func (diffView *DiffView) scrollToFile(index int) {
+	if index < 0 || index >= len(diffView.fileLines) {
+		return
+	}
+	diffView.diffText.ScrollTo(diffView.fileLines[index], 0)
+
+	// Continue hunk navigation from the selected file
+	diffView.currentHunk = -1
+	for hunk, hunkLine := range diffView.hunkLines {
+		if hunkLine < diffView.fileLines[index] {
+			diffView.currentHunk = hunk
+		}
+	}
+}
+
+func (diffView *DiffView) selectFileForLine(line int) {
+	for index, fileLine := range diffView.fileLines {
+		if fileLine <= line {
+			diffView.updatingList = true
+			diffView.fileList.SetCurrentItem(index)
+			diffView.updatingList = false
+		}
+	}
+}
+
+func (diffView *DiffView) moveHunk(delta int) {
+
+	if len(diffView.hunkLines) == 0 {
+		return
+	}
+
+	hunk := diffView.currentHunk + delta
+	if hunk < 0 || hunk >= len(diffView.hunkLines) {
+		return
+	}
+	diffView.currentHunk = hunk
+
+	diffView.diffText.ScrollTo(diffView.hunkLines[hunk], 0)
+	diffView.selectFileForLine(diffView.hunkLines[hunk])
+}
+
+func (diffView *DiffView) moveFile(delta int) {
+	index := diffView.fileList.GetCurrentItemIndex() + delta
+	if index < 0 || index >= diffView.fileList.GetItemCount() {
+		return
+	}
+	diffView.updatingList = true
+	diffView.fileList.SetCurrentItem(index)
+	diffView.updatingList = false
+	diffView.scrollToFile(index)
+}
+
+func (diffView *DiffView) handleInput(event *tcell.EventKey) *tcell.EventKey {
+
+	switch event.Key() {
+	case tcell.KeyEscape:
+		diffView.ghui.closeView(diffPanel)
+		return nil
+	case tcell.KeyTab, tcell.KeyBacktab:
+		if diffView.ghui.app.GetFocus() == diffView.fileList {
+			diffView.ghui.app.SetFocus(diffView.diffText)
+		} else {
+			diffView.ghui.app.SetFocus(diffView.fileList)
+		}
+		return nil
+	case tcell.KeyRune:
+		switch event.Rune() {
+		case 'q', 'd':
+			diffView.ghui.closeView(diffPanel)
+			return nil
+		case 'n':
+			diffView.moveHunk(1)
+			return nil
+		case 'N', 'p':
+			diffView.moveHunk(-1)
+			return nil
+		case ']':
+			diffView.moveFile(1)
+			return nil
+		case '[':
+			diffView.moveFile(-1)
+			return nil
+		}
+	}
+	return event
+}
@@ -0,0 +1,26 @@
+package ghmon
+
+import "testing"
+
+func TestHighlightCodeOnlyColoursCommentsOfTheLanguage(t *testing.T) {
+
+	tests := []struct {
+		code        string
+		language    string
+		highlighted string
+	}{
+		{`x := 1 // one`, "go", `x := [#87d7ff]1[-] [gray]// one[-]`},
+		{`s := "a // b"`, "go", `s := [#d7d787]"a // b"[-]`},
+		{`#include "x.h"`, "c", `#[#d787ff]include[-] [#d7d787]"x.h"[-]`},
+		{`x-- // done`, "c", `x-- [gray]// done[-]`},
+		{`color: #fff; --gap: 2`, "", `color: #fff; --gap: [#87d7ff]2[-]`},
+		{`name = "#1" # why`, "python", `name = [#d7d787]"#1"[-] [gray]# why[-]`},
+		{`select 1 -- one`, "sql", `select [#87d7ff]1[-] [gray]-- one[-]`},
+	}
+
+	for _, test := range tests {
+		if highlighted := highlightCode(test.code, test.language); highlighted != test.highlighted {
+			t.Errorf("%s (%q): got %q, expected %q", test.code, test.language, highlighted, test.highlighted)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package ghmon
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	tview "gitlab.com/tslocum/cview"
+)
+
+// Below this many cells the panes are stacked in a single column
+const stackedLayoutThreshold = 100
+
+const (
+	minListPaneWeight     = 1
+	maxListPaneWeight     = 8
+	defaultListPaneWeight = 2
+	detailsPaneWeight     = 3
+)
+
+const (
+	columnSeen = iota
+	columnHeat
+	columnAttributes
+	columnSize
+	columnTitle
+	columnRepository
+	columnUser
+	columnLastActive
+	numColumns
+)
+
+type pullRequestColumn struct {
+	header string
+	/* Width including the padding on either side, the minimum width for the expanding column */
+	width int
+	/* When space runs out, columns with the highest value are dropped first (0 is never dropped) */
+	dropPriority int
+}
+
+var pullRequestColumns = [numColumns]pullRequestColumn{
+	columnSeen:       {header: "", width: 3, dropPriority: 0},
+	columnHeat:       {header: "Heat", width: 9, dropPriority: 4},
+	columnAttributes: {header: "Attributes", width: 11, dropPriority: 6},
+	columnSize:       {header: "Size", width: 6, dropPriority: 3},
+	columnTitle:      {header: "Title", width: 20, dropPriority: 0},
+	columnRepository: {header: "Repository", width: 30, dropPriority: 2},
+	columnUser:       {header: "User", width: 18, dropPriority: 1},
+	columnLastActive: {header: "Last Active", width: 26, dropPriority: 5},
+}
+
+type pane int
+
+const (
+	paneList pane = iota
+	paneDetails
+	paneReviewers
+	paneDescription
+	numPanes
+)
+
+// calculateVisibleColumns works out which columns fit in the given table width, dropping the least important ones
+// first, and how wide the title column can be made with the space that is left
+func calculateVisibleColumns(tableWidth int) ([]int, int) {
+
+	visible := make([]bool, numColumns)
+	for column := range visible {
+		visible[column] = true
+	}
+
+	requiredWidth := func() int {
+		required := 0
+		for column, isVisible := range visible {
+			if isVisible {
+				required += pullRequestColumns[column].width + 1
+			}
+		}
+		return required
+	}
+
+	for requiredWidth() > tableWidth {
+		columnToDrop := -1
+		for column, isVisible := range visible {
+			if isVisible && pullRequestColumns[column].dropPriority > 0 && (columnToDrop < 0 || pullRequestColumns[column].dropPriority > pullRequestColumns[columnToDrop].dropPriority) {
+				columnToDrop = column
+			}
+		}
+		if columnToDrop < 0 {
+			break
+		}
+		visible[columnToDrop] = false
+	}
+
+	visibleColumns := make([]int, 0)
+	for column, isVisible := range visible {
+		if isVisible {
+			visibleColumns = append(visibleColumns, column)
+		}
+	}
+
+	titleWidth := pullRequestColumns[columnTitle].width + tableWidth - requiredWidth()
+	if titleWidth < pullRequestColumns[columnTitle].width {
+		titleWidth = pullRequestColumns[columnTitle].width
+	}
+
+	return visibleColumns, titleWidth
+}
+
+// padToWidth pads a string, which may contain color tags, with a space on the left and spaces on the right so that
+// it occupies the requested number of cells on screen
+func padToWidth(str string, width int) string {
+	padding := width - 2 - tview.TaggedStringWidth(str)
+	if padding < 0 {
+		padding = 0
+	}
+	return " " + str + strings.Repeat(" ", padding) + " "
+}
+
+// truncateToWidth shortens a plain string to the given number of cells, ending it with '...' when cut
+func truncateToWidth(str string, width int) string {
+	runes := []rune(str)
+	if len(runes) <= width {
+		return str
+	}
+	if width <= 3 {
+		return string(runes[:width])
+	}
+	return string(runes[:width-3]) + "..."
+}
+
+func isStackedLayout(screenWidth int) bool {
+	return screenWidth > 0 && screenWidth < stackedLayoutThreshold
+}
+
+func (ghui *UI) getStatusItem() tview.Primitive {
+	if ghui.filtering {
+		return ghui.filterInput
+	}
+	return ghui.status
+}
+
+// layoutGrid (re)builds the grid for the current screen width, zoom state and split
+func (ghui *UI) layoutGrid() {
+
+	grid := ghui.grid
+	grid.Clear()
+
+	for p, paneLabel := range ghui.paneLabels {
+		if pane(p) == ghui.focusedPane {
+			paneLabel.SetTextColor(tcell.ColorYellow)
+		} else {
+			paneLabel.SetTextColor(tview.Styles.PrimaryTextColor)
+		}
+	}
+
+	if ghui.zoomed {
+		grid.SetRows(1, -1, 1)
+		grid.SetColumns(-1)
+		grid.AddItem(ghui.paneLabels[ghui.focusedPane], 0, 0, 1, 1, 0, 0, false)
+		grid.AddItem(ghui.panes[ghui.focusedPane], 1, 0, 1, 1, 0, 0, false)
+		grid.AddItem(ghui.getStatusItem(), 2, 0, 1, 1, 0, 0, false)
+		return
+	}
+
+	listPaneWeight := ghui.preferences.ListPaneWeight
+	if listPaneWeight < minListPaneWeight || listPaneWeight > maxListPaneWeight {
+		listPaneWeight = defaultListPaneWeight
+	}
+
+	if isStackedLayout(ghui.screenWidth) {
+		// Layout for screens narrower than 100 cells, everything in a single column
+		grid.SetRows(1, -listPaneWeight, 1, 11, 1, -1, 1, -detailsPaneWeight, 1)
+		grid.SetColumns(-1)
+
+		grid.AddItem(ghui.paneLabels[paneList], 0, 0, 1, 1, 0, 0, false)
+		grid.AddItem(ghui.panes[paneList], 1, 0, 1, 1, 0, 0, false)
+		grid.AddItem(ghui.paneLabels[paneDetails], 2, 0, 1, 1, 0, 0, false)
+		grid.AddItem(ghui.panes[paneDetails], 3, 0, 1, 1, 0, 0, false)
+		grid.AddItem(ghui.paneLabels[paneReviewers], 4, 0, 1, 1, 0, 0, false)
+		grid.AddItem(ghui.panes[paneReviewers], 5, 0, 1, 1, 0, 0, false)
+		grid.AddItem(ghui.paneLabels[paneDescription], 6, 0, 1, 1, 0, 0, false)
+		grid.AddItem(ghui.panes[paneDescription], 7, 0, 1, 1, 0, 0, false)
+		grid.AddItem(ghui.getStatusItem(), 8, 0, 1, 1, 0, 0, false)
+		return
+	}
+
+	// Layout for screens wider than 100 cells.
+	grid.SetRows(1, -listPaneWeight, 1, 11, 1, -detailsPaneWeight, 1)
+	grid.SetColumns(-2, -3)
+
+	grid.AddItem(ghui.paneLabels[paneList], 0, 0, 1, 2, 0, 0, false)
+	grid.AddItem(ghui.panes[paneList], 1, 0, 1, 2, 0, 0, false)
+
+	grid.AddItem(ghui.paneLabels[paneDetails], 2, 0, 1, 1, 0, 0, false)
+	grid.AddItem(ghui.panes[paneDetails], 3, 0, 1, 1, 0, 0, false)
+	grid.AddItem(ghui.paneLabels[paneReviewers], 4, 0, 1, 1, 0, 0, false)
+	grid.AddItem(ghui.panes[paneReviewers], 5, 0, 1, 1, 0, 0, false)
+
+	grid.AddItem(ghui.paneLabels[paneDescription], 2, 1, 1, 1, 0, 0, false)
+	grid.AddItem(ghui.panes[paneDescription], 3, 1, 3, 1, 0, 0, false)
+
+	grid.AddItem(ghui.getStatusItem(), 6, 0, 1, 2, 0, 0, false)
+}
+
+// getPullRequestTableWidth is the width the pull request table will get in the current layout, the table spans
+// the whole screen (less the grid borders) in all of them
+func (ghui *UI) getPullRequestTableWidth() int {
+	if ghui.screenWidth <= 0 {
+		_, _, width, _ := ghui.reviewPullRequestGroup.pullRequestTable.GetRect()
+		return width
+	}
+	return ghui.screenWidth - 2
+}
+
+func (ghui *UI) handleResize(width int, height int) {
+
+	stackedBefore := isStackedLayout(ghui.screenWidth)
+	widthChanged := ghui.screenWidth != width
+	ghui.screenWidth = width
+
+	if stackedBefore != isStackedLayout(width) {
+		ghui.layoutGrid()
+	}
+	if widthChanged {
+		ghui.updatePullRequestTable()
+	}
+}
+
+func (ghui *UI) cycleFocus(forward bool) {
+	if forward {
+		ghui.focusedPane = (ghui.focusedPane + 1) % numPanes
+	} else {
+		ghui.focusedPane = (ghui.focusedPane + numPanes - 1) % numPanes
+	}
+	ghui.layoutGrid()
+	ghui.app.SetFocus(ghui.panes[ghui.focusedPane])
+}
+
+func (ghui *UI) toggleZoom() {
+	ghui.zoomed = !ghui.zoomed
+	ghui.layoutGrid()
+	ghui.app.SetFocus(ghui.panes[ghui.focusedPane])
+}
+
+func (ghui *UI) resizeListPane(delta int) {
+
+	listPaneWeight := ghui.preferences.ListPaneWeight
+	if listPaneWeight == 0 {
+		listPaneWeight = defaultListPaneWeight
+	}
+	listPaneWeight += delta
+	if listPaneWeight < minListPaneWeight || listPaneWeight > maxListPaneWeight {
+		return
+	}
+	ghui.preferences.ListPaneWeight = listPaneWeight
+
+	ghui.layoutGrid()
+	ghui.storePreferences()
+}
+
+// centerPrimitive places a primitive in the middle of the screen, taking the given share (out of 5) of the width and
+// number of rows, while leaving whatever is underneath visible around it
+func centerPrimitive(primitive tview.Primitive, widthProportion int, height int) *tview.Flex {
+
+	newSpacer := func() *tview.Box {
+		spacer := tview.NewBox()
+		spacer.SetBackgroundTransparent(true)
+		return spacer
+	}
+
+	row := tview.NewFlex()
+	row.SetBackgroundTransparent(true)
+	row.AddItem(newSpacer(), 0, (5-widthProportion+1)/2, false)
+	row.AddItem(primitive, 0, widthProportion, true)
+	row.AddItem(newSpacer(), 0, (5-widthProportion+1)/2, false)
+
+	layout := tview.NewFlex()
+	layout.SetDirection(tview.FlexRow)
+	layout.SetBackgroundTransparent(true)
+	layout.AddItem(newSpacer(), 0, 1, false)
+	layout.AddItem(row, height, 0, true)
+	layout.AddItem(newSpacer(), 0, 1, false)
+	return layout
+}
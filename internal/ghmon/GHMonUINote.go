@@ -0,0 +1,102 @@
+package ghmon
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	tview "gitlab.com/tslocum/cview"
+)
+
+const notePanel = "note"
+
+// NoteDialog edits the private note and the local tags of a pull request, neither of them leaves this machine
+type NoteDialog struct {
+	ghui *UI
+
+	layout    *tview.Flex
+	frame     *tview.Flex
+	noteInput *tview.InputField
+	tagsInput *tview.InputField
+	hint      *tview.TextView
+
+	pullRequestWrapper *PullRequestWrapper
+}
+
+const noteDialogHint = "[gray]TAB switch field, ENTER save, Ctrl-D clear both, ESC cancel[-]"
+
+func NewNoteDialog(ghui *UI) *NoteDialog {
+
+	newInput := func(label string, placeholder string) *tview.InputField {
+		input := tview.NewInputField()
+		input.SetLabel(label)
+		input.SetPlaceholder(placeholder)
+		input.SetFieldBackgroundColor(tcell.Color16)
+		input.SetFieldBackgroundColorFocused(tcell.Color16)
+		return input
+	}
+	noteInput := newInput("Note: ", "e.g. waiting on infra")
+	tagsInput := newInput("Tags: ", "comma separated, e.g. later, infra")
+
+	hint := tview.NewTextView()
+	hint.SetDynamicColors(true)
+
+	frame := tview.NewFlex()
+	frame.SetDirection(tview.FlexRow)
+	frame.SetBorder(true)
+	frame.AddItem(noteInput, 1, 0, true)
+	frame.AddItem(tagsInput, 1, 0, false)
+	frame.AddItem(hint, 1, 0, false)
+
+	layout := centerPrimitive(frame, 3, 5)
+
+	return &NoteDialog{ghui: ghui, layout: layout, frame: frame, noteInput: noteInput, tagsInput: tagsInput, hint: hint}
+}
+
+func (noteDialog *NoteDialog) Show(pullRequestWrapper *PullRequestWrapper) {
+
+	noteDialog.pullRequestWrapper = pullRequestWrapper
+
+	pullRequest := pullRequestWrapper.PullRequest
+	noteDialog.frame.SetTitle(fmt.Sprintf(" Note on %s#%d ", pullRequest.Repo.FullName, pullRequest.Number))
+	noteDialog.noteInput.SetText(pullRequestWrapper.Note)
+	noteDialog.tagsInput.SetText(strings.Join(pullRequestWrapper.Tags, ", "))
+	noteDialog.hint.SetText(noteDialogHint)
+}
+
+func (noteDialog *NoteDialog) save() {
+
+	ghui := noteDialog.ghui
+	pullRequestWrapper := noteDialog.pullRequestWrapper
+	note := noteDialog.noteInput.GetText()
+	tags := ParseTags(noteDialog.tagsInput.GetText())
+
+	ghui.closeView(notePanel)
+	ghui.runPullRequestAction(pullRequestWrapper, "Saving the note on", func() error {
+		return ghui.ghMon.UpdatePullRequestNote(pullRequestWrapper, note, tags)
+	})
+}
+
+func (noteDialog *NoteDialog) handleInput(event *tcell.EventKey) *tcell.EventKey {
+
+	switch event.Key() {
+	case tcell.KeyEscape:
+		noteDialog.ghui.closeView(notePanel)
+		return nil
+	case tcell.KeyEnter:
+		noteDialog.save()
+		return nil
+	case tcell.KeyCtrlD:
+		noteDialog.noteInput.SetText("")
+		noteDialog.tagsInput.SetText("")
+		return nil
+	case tcell.KeyTab, tcell.KeyBacktab:
+		if noteDialog.ghui.app.GetFocus() == noteDialog.noteInput {
+			noteDialog.ghui.app.SetFocus(noteDialog.tagsInput)
+		} else {
+			noteDialog.ghui.app.SetFocus(noteDialog.noteInput)
+		}
+		return nil
+	}
+	return event
+}
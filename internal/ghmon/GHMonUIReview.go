@@ -0,0 +1,196 @@
+package ghmon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	tview "gitlab.com/tslocum/cview"
+)
+
+const reviewPanel = "review"
+
+// ReviewDialog is a small multi-line editor for the body of a review.  Lines are entered one at a time, the body can
+// also be written in $VISUAL/$EDITOR.
+type ReviewDialog struct {
+	ghui *UI
+
+	layout *tview.Flex
+	frame  *tview.Flex
+	text   *tview.TextView
+	input  *tview.InputField
+	hint   *tview.TextView
+
+	pullRequestWrapper      *PullRequestWrapper
+	pullRequestReviewStatus PullRequestReviewStatus
+	lines                   []string
+}
+
+const reviewDialogHint = "[gray]ENTER new line, Ctrl-S submit, Ctrl-E open $EDITOR, ESC cancel[-]"
+
+func NewReviewDialog(ghui *UI) *ReviewDialog {
+
+	text := tview.NewTextView()
+	text.SetDynamicColors(true)
+	text.SetWrap(true)
+	text.SetScrollable(true)
+
+	input := tview.NewInputField()
+	input.SetLabel("> ")
+	input.SetFieldBackgroundColor(tcell.Color16)
+	input.SetFieldBackgroundColorFocused(tcell.Color16)
+
+	hint := tview.NewTextView()
+	hint.SetDynamicColors(true)
+
+	frame := tview.NewFlex()
+	frame.SetDirection(tview.FlexRow)
+	frame.SetBorder(true)
+	frame.AddItem(text, 0, 1, false)
+	frame.AddItem(input, 1, 0, true)
+	frame.AddItem(hint, 1, 0, false)
+
+	// Centre the frame, leaving the pull request list visible around it
+	layout := centerPrimitive(frame, 3, 16)
+
+	return &ReviewDialog{ghui: ghui, layout: layout, frame: frame, text: text, input: input, hint: hint}
+}
+
+func (reviewDialog *ReviewDialog) Show(pullRequestWrapper *PullRequestWrapper, pullRequestReviewStatus PullRequestReviewStatus) {
+
+	reviewDialog.pullRequestWrapper = pullRequestWrapper
+	reviewDialog.pullRequestReviewStatus = pullRequestReviewStatus
+	reviewDialog.lines = make([]string, 0)
+
+	pullRequest := pullRequestWrapper.PullRequest
+	action := "Comment on"
+	switch pullRequestReviewStatus {
+	case PullRequestReviewStatusApproved:
+		action = "Approve"
+	case PullRequestReviewStatusChangesRequested:
+		action = "Request changes on"
+	}
+	reviewDialog.frame.SetTitle(fmt.Sprintf(" %s %s#%d ", action, pullRequest.Repo.FullName, pullRequest.Number))
+
+	if pullRequestReviewStatus == PullRequestReviewStatusApproved {
+		reviewDialog.input.SetPlaceholder("optional comment")
+	} else {
+		reviewDialog.input.SetPlaceholder("comment (required)")
+	}
+	reviewDialog.input.SetText("")
+	reviewDialog.update()
+	reviewDialog.hint.SetText(reviewDialogHint)
+}
+
+func (reviewDialog *ReviewDialog) update() {
+	reviewDialog.text.SetText(tview.Escape(strings.Join(reviewDialog.lines, "\n")))
+	reviewDialog.text.ScrollToEnd()
+}
+
+func (reviewDialog *ReviewDialog) getBody() string {
+	return strings.TrimSpace(strings.Join(append(reviewDialog.lines, reviewDialog.input.GetText()), "\n"))
+}
+
+func (reviewDialog *ReviewDialog) setBody(body string) {
+	reviewDialog.lines = strings.Split(strings.TrimRight(body, "\n"), "\n")
+	reviewDialog.input.SetText("")
+	reviewDialog.update()
+}
+
+func (reviewDialog *ReviewDialog) submit() {
+
+	body := reviewDialog.getBody()
+	if body == "" && reviewDialog.pullRequestReviewStatus != PullRequestReviewStatusApproved {
+		reviewDialog.hint.SetText("[red]A comment is required[-]  " + reviewDialogHint)
+		return
+	}
+
+	ghui := reviewDialog.ghui
+	pullRequestWrapper := reviewDialog.pullRequestWrapper
+	pullRequestReviewStatus := reviewDialog.pullRequestReviewStatus
+	pullRequest := pullRequestWrapper.PullRequest
+
+	message := fmt.Sprintf("Submit '%s' review on %s#%d?", ghui.ghMon.ConvertPullRequestReviewStateToString(pullRequestReviewStatus), pullRequest.Repo.FullName, pullRequest.Number)
+	ghui.confirm(message, "Submit", func() {
+		ghui.closeView(reviewPanel)
+		ghui.submitPullRequestReview(pullRequestWrapper, pullRequestReviewStatus, body)
+	})
+}
+
+// editInExternalEditor suspends the UI and lets the body be written in the user's editor of choice
+func (reviewDialog *ReviewDialog) editInExternalEditor() {
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		reviewDialog.hint.SetText("[red]Neither $VISUAL nor $EDITOR is set[-]  " + reviewDialogHint)
+		return
+	}
+
+	file, err := ioutil.TempFile("", "ghmon-review-*.md")
+	if err != nil {
+		reviewDialog.hint.SetText(fmt.Sprintf("[red]%s[-]", tview.Escape(err.Error())))
+		return
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(reviewDialog.getBody() + "\n")
+	file.Close()
+	if err != nil {
+		reviewDialog.hint.SetText(fmt.Sprintf("[red]%s[-]", tview.Escape(err.Error())))
+		return
+	}
+
+	arguments := append(strings.Fields(editor), file.Name())
+	reviewDialog.ghui.app.Suspend(func() {
+		cmd := exec.Command(arguments[0], arguments[1:]...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err = cmd.Run()
+	})
+	if err != nil {
+		reviewDialog.hint.SetText(fmt.Sprintf("[red]Editor failed: %s[-]", tview.Escape(err.Error())))
+		return
+	}
+
+	body, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		reviewDialog.hint.SetText(fmt.Sprintf("[red]%s[-]", tview.Escape(err.Error())))
+		return
+	}
+	reviewDialog.setBody(string(body))
+}
+
+func (reviewDialog *ReviewDialog) handleInput(event *tcell.EventKey) *tcell.EventKey {
+
+	switch event.Key() {
+	case tcell.KeyEscape:
+		reviewDialog.ghui.closeView(reviewPanel)
+		return nil
+	case tcell.KeyCtrlS:
+		reviewDialog.submit()
+		return nil
+	case tcell.KeyCtrlE:
+		reviewDialog.editInExternalEditor()
+		return nil
+	case tcell.KeyEnter:
+		reviewDialog.lines = append(reviewDialog.lines, reviewDialog.input.GetText())
+		reviewDialog.input.SetText("")
+		reviewDialog.update()
+		return nil
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		// Backspace at the start of an empty line goes back to the previous one
+		if reviewDialog.input.GetText() == "" && len(reviewDialog.lines) > 0 {
+			reviewDialog.input.SetText(reviewDialog.lines[len(reviewDialog.lines)-1])
+			reviewDialog.lines = reviewDialog.lines[:len(reviewDialog.lines)-1]
+			reviewDialog.update()
+			return nil
+		}
+	}
+	return event
+}
@@ -0,0 +1,341 @@
+package ghmon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	tview "gitlab.com/tslocum/cview"
+)
+
+const reviewersPanel = "reviewers"
+
+// Maximum number of suggestions shown while typing a reviewer
+const maxReviewerSuggestions = 8
+
+const reviewersDialogHint = "[gray]TAB switch, ENTER add, d remove, r/R re-request selected/all, ESC close[-]"
+
+type reviewerReference struct {
+	user   *User
+	team   string
+	status PullRequestReviewStatus
+}
+
+// ReviewersDialog manages the requested reviewers of one of the user's own pull requests
+type ReviewersDialog struct {
+	ghui *UI
+
+	layout *tview.Flex
+	frame  *tview.Flex
+	list   *tview.List
+	input  *tview.InputField
+	hint   *tview.TextView
+
+	pullRequestWrapper *PullRequestWrapper
+	reviewerCandidates *ReviewerCandidates
+}
+
+func NewReviewersDialog(ghui *UI) *ReviewersDialog {
+
+	list := tview.NewList()
+	list.ShowSecondaryText(false)
+	list.SetHighlightFullLine(true)
+
+	input := tview.NewInputField()
+	input.SetLabel("Add reviewer: ")
+	input.SetPlaceholder("user or @org/team")
+	input.SetFieldBackgroundColor(tcell.Color16)
+	input.SetFieldBackgroundColorFocused(tcell.Color16)
+
+	hint := tview.NewTextView()
+	hint.SetDynamicColors(true)
+
+	frame := tview.NewFlex()
+	frame.SetDirection(tview.FlexRow)
+	frame.SetBorder(true)
+	frame.AddItem(list, 0, 1, true)
+	frame.AddItem(input, 1, 0, false)
+	frame.AddItem(hint, 1, 0, false)
+
+	reviewersDialog := &ReviewersDialog{ghui: ghui, layout: centerPrimitive(frame, 3, 16), frame: frame, list: list, input: input, hint: hint}
+
+	input.SetAutocompleteFunc(reviewersDialog.suggestReviewers)
+	input.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyEnter:
+			reviewersDialog.addReviewer(input.GetText())
+		case tcell.KeyTab, tcell.KeyBacktab:
+			ghui.app.SetFocus(list)
+		case tcell.KeyEscape:
+			ghui.closeView(reviewersPanel)
+		}
+	})
+
+	return reviewersDialog
+}
+
+func (reviewersDialog *ReviewersDialog) Show(pullRequestWrapper *PullRequestWrapper) {
+
+	reviewersDialog.pullRequestWrapper = pullRequestWrapper
+	reviewersDialog.reviewerCandidates = nil
+
+	pullRequest := pullRequestWrapper.PullRequest
+	reviewersDialog.frame.SetTitle(fmt.Sprintf(" Reviewers of %s#%d ", pullRequest.Repo.FullName, pullRequest.Number))
+	reviewersDialog.input.SetText("")
+	reviewersDialog.hint.SetText(reviewersDialogHint)
+	reviewersDialog.update()
+
+	// Suggestions are loaded in the background, typing works without them
+	go func() {
+		reviewerCandidates, err := reviewersDialog.ghui.ghMon.RetrieveReviewerCandidates(pullRequest.Repo)
+		reviewersDialog.ghui.app.QueueUpdateDraw(func() {
+			if err != nil {
+				reviewersDialog.hint.SetText(fmt.Sprintf("[red]No suggestions: %s[-]", tview.Escape(err.Error())))
+				return
+			}
+			if reviewersDialog.pullRequestWrapper.Id == pullRequestWrapper.Id {
+				reviewersDialog.reviewerCandidates = reviewerCandidates
+			}
+		})
+	}()
+}
+
+// update lists the reviewers with their current state, followed by the requested teams
+func (reviewersDialog *ReviewersDialog) update() {
+
+	ghui := reviewersDialog.ghui
+	pullRequest := reviewersDialog.pullRequestWrapper.PullRequest
+
+	currentItem := reviewersDialog.list.GetCurrentItemIndex()
+	reviewersDialog.list.Clear()
+
+	for _, pullRequestReviews := range pullRequest.PullRequestReviewsByPriority {
+		latestPullRequestReview := LatestPullRequestReview(pullRequestReviews)
+		if latestPullRequestReview == nil {
+			continue
+		}
+		item := tview.NewListItem(fmt.Sprintf("[%s]%-20s[-] %s", ghui.getPullRequestReviewColorString(latestPullRequestReview),
+			"["+ghui.ghMon.ConvertPullRequestReviewStateToString(latestPullRequestReview.Status)+"[]", tview.Escape(latestPullRequestReview.User.Username)))
+		item.SetReference(&reviewerReference{user: latestPullRequestReview.User, status: latestPullRequestReview.Status})
+		reviewersDialog.list.AddItem(item)
+	}
+
+	for _, team := range pullRequest.RequestedTeams {
+		item := tview.NewListItem(fmt.Sprintf("%-20s @%s/%s", "[Requested[]", tview.Escape(reviewersDialog.getOwner()), tview.Escape(team)))
+		item.SetReference(&reviewerReference{team: team, status: PullRequestReviewStatusRequested})
+		reviewersDialog.list.AddItem(item)
+	}
+
+	if reviewersDialog.list.GetItemCount() == 0 {
+		reviewersDialog.list.AddItem(tview.NewListItem("[gray]No reviewers yet[-]"))
+	}
+	if currentItem < reviewersDialog.list.GetItemCount() {
+		reviewersDialog.list.SetCurrentItem(currentItem)
+	}
+}
+
+func (reviewersDialog *ReviewersDialog) getOwner() string {
+	return strings.SplitN(reviewersDialog.pullRequestWrapper.PullRequest.Repo.FullName, "/", 2)[0]
+}
+
+func (reviewersDialog *ReviewersDialog) suggestReviewers(currentText string) []*tview.ListItem {
+
+	currentText = strings.TrimSpace(currentText)
+	if currentText == "" || reviewersDialog.reviewerCandidates == nil {
+		return nil
+	}
+
+	candidates := make([]string, 0)
+	candidates = append(candidates, reviewersDialog.reviewerCandidates.Users...)
+	for _, team := range reviewersDialog.reviewerCandidates.Teams {
+		candidates = append(candidates, "@"+reviewersDialog.getOwner()+"/"+team)
+	}
+
+	matches := make([]string, 0)
+	for _, candidate := range candidates {
+		if FuzzyMatch(currentText, candidate) {
+			matches = append(matches, candidate)
+		}
+	}
+	// Prefix matches first, then alphabetically
+	sort.SliceStable(matches, func(i, j int) bool {
+		leftPrefix := strings.HasPrefix(strings.ToLower(matches[i]), strings.ToLower(currentText))
+		rightPrefix := strings.HasPrefix(strings.ToLower(matches[j]), strings.ToLower(currentText))
+		if leftPrefix != rightPrefix {
+			return leftPrefix
+		}
+		return strings.ToLower(matches[i]) < strings.ToLower(matches[j])
+	})
+	if len(matches) > maxReviewerSuggestions {
+		matches = matches[:maxReviewerSuggestions]
+	}
+
+	listItems := make([]*tview.ListItem, 0)
+	for _, match := range matches {
+		listItems = append(listItems, tview.NewListItem(match))
+	}
+	return listItems
+}
+
+// runReviewersAction runs a change in the background and shows the new state of the reviewers once done
+func (reviewersDialog *ReviewersDialog) runReviewersAction(description string, action func() error) {
+
+	ghui := reviewersDialog.ghui
+	pullRequestId := reviewersDialog.pullRequestWrapper.Id
+	reviewersDialog.hint.SetText(" " + tview.Escape(description) + " ...")
+
+	go func() {
+		err := action()
+		// The pull request is refreshed by the action, the dialog still shows the version it was opened with
+		currentPullRequestWrapper := ghui.ghMon.GetPullRequestWrapper(pullRequestId)
+		ghui.app.QueueUpdateDraw(func() {
+			if reviewersDialog.pullRequestWrapper.Id != pullRequestId {
+				return
+			}
+			if currentPullRequestWrapper != nil {
+				reviewersDialog.pullRequestWrapper = currentPullRequestWrapper
+			}
+			if err != nil {
+				reviewersDialog.hint.SetText(fmt.Sprintf("[red]%s failed: %s[-]", tview.Escape(description), tview.Escape(err.Error())))
+			} else {
+				reviewersDialog.hint.SetText(fmt.Sprintf("[green]%s done[-]", tview.Escape(description)))
+			}
+			reviewersDialog.update()
+		})
+	}()
+}
+
+func (reviewersDialog *ReviewersDialog) addReviewer(reviewer string) {
+
+	reviewer = strings.TrimPrefix(strings.TrimSpace(reviewer), "@")
+	if reviewer == "" {
+		return
+	}
+	reviewersDialog.input.SetText("")
+
+	ghMon := reviewersDialog.ghui.ghMon
+	pullRequestWrapper := reviewersDialog.pullRequestWrapper
+
+	if index := strings.Index(reviewer, "/"); index >= 0 {
+		team := reviewer[index+1:]
+		reviewersDialog.runReviewersAction("Requesting review from team "+team, func() error {
+			return ghMon.RequestReviewers(pullRequestWrapper, nil, []string{team})
+		})
+		return
+	}
+
+	reviewersDialog.runReviewersAction("Requesting review from "+reviewer, func() error {
+		return ghMon.RequestReviewers(pullRequestWrapper, []string{reviewer}, nil)
+	})
+}
+
+func (reviewersDialog *ReviewersDialog) getSelectedReviewer() *reviewerReference {
+	item := reviewersDialog.list.GetCurrentItem()
+	if item == nil {
+		return nil
+	}
+	reference, _ := item.GetReference().(*reviewerReference)
+	return reference
+}
+
+func (reviewersDialog *ReviewersDialog) removeSelectedReviewer() {
+
+	reviewer := reviewersDialog.getSelectedReviewer()
+	if reviewer == nil {
+		return
+	}
+	if reviewer.status != PullRequestReviewStatusRequested {
+		reviewersDialog.hint.SetText("[red]Only outstanding review requests can be removed[-]  " + reviewersDialogHint)
+		return
+	}
+
+	ghMon := reviewersDialog.ghui.ghMon
+	pullRequestWrapper := reviewersDialog.pullRequestWrapper
+
+	if reviewer.team != "" {
+		reviewersDialog.runReviewersAction("Removing review request from team "+reviewer.team, func() error {
+			return ghMon.RemoveRequestedReviewers(pullRequestWrapper, nil, []string{reviewer.team})
+		})
+		return
+	}
+	reviewersDialog.runReviewersAction("Removing review request from "+reviewer.user.Username, func() error {
+		return ghMon.RemoveRequestedReviewers(pullRequestWrapper, []string{reviewer.user.Username}, nil)
+	})
+}
+
+func (reviewersDialog *ReviewersDialog) reRequestSelectedReviewer() {
+
+	reviewer := reviewersDialog.getSelectedReviewer()
+	if reviewer == nil || reviewer.user == nil {
+		return
+	}
+	if reviewer.status == PullRequestReviewStatusRequested {
+		reviewersDialog.hint.SetText("[red]A review has already been requested[-]  " + reviewersDialogHint)
+		return
+	}
+
+	ghMon := reviewersDialog.ghui.ghMon
+	pullRequestWrapper := reviewersDialog.pullRequestWrapper
+	reviewersDialog.runReviewersAction("Re-requesting review from "+reviewer.user.Username, func() error {
+		return ghMon.RequestReviewers(pullRequestWrapper, []string{reviewer.user.Username}, nil)
+	})
+}
+
+// reRequestAllReviewers asks everyone that commented or requested changes to have another look
+func (reviewersDialog *ReviewersDialog) reRequestAllReviewers() {
+
+	users := make([]string, 0)
+	for _, user := range ReviewersToReRequest(reviewersDialog.pullRequestWrapper) {
+		users = append(users, user.Username)
+	}
+	if len(users) == 0 {
+		reviewersDialog.hint.SetText("[gray]Nobody commented or requested changes[-]  " + reviewersDialogHint)
+		return
+	}
+
+	ghMon := reviewersDialog.ghui.ghMon
+	pullRequestWrapper := reviewersDialog.pullRequestWrapper
+	reviewersDialog.runReviewersAction("Re-requesting review from "+strings.Join(users, ", "), func() error {
+		return ghMon.RequestReviewers(pullRequestWrapper, users, nil)
+	})
+}
+
+func (reviewersDialog *ReviewersDialog) handleInput(event *tcell.EventKey) *tcell.EventKey {
+
+	// The input field deals with its own keys (see the done function)
+	if reviewersDialog.ghui.app.GetFocus() == reviewersDialog.input {
+		return event
+	}
+
+	switch event.Key() {
+	case tcell.KeyEscape:
+		reviewersDialog.ghui.closeView(reviewersPanel)
+		return nil
+	case tcell.KeyTab, tcell.KeyBacktab:
+		reviewersDialog.ghui.app.SetFocus(reviewersDialog.input)
+		return nil
+	case tcell.KeyDelete:
+		reviewersDialog.removeSelectedReviewer()
+		return nil
+	case tcell.KeyRune:
+		switch event.Rune() {
+		case 'q':
+			reviewersDialog.ghui.closeView(reviewersPanel)
+			return nil
+		case 'd':
+			reviewersDialog.removeSelectedReviewer()
+			return nil
+		case 'r':
+			reviewersDialog.reRequestSelectedReviewer()
+			return nil
+		case 'R':
+			reviewersDialog.reRequestAllReviewers()
+			return nil
+		case 'a', '/':
+			reviewersDialog.ghui.app.SetFocus(reviewersDialog.input)
+			return nil
+		}
+	}
+	return event
+}
@@ -0,0 +1,92 @@
+package ghmon
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	tview "gitlab.com/tslocum/cview"
+)
+
+const statsPanel = "stats"
+
+/* Ranges the stats screen cycles through, in days before now */
+var statsRanges = []int{7, 30, 90, 365}
+
+// StatsView shows the report of the recorded histories over the last days
+type StatsView struct {
+	ghui *UI
+
+	layout *tview.Flex
+	label  *tview.TextView
+	text   *tview.TextView
+
+	currentRange int
+}
+
+func NewStatsView(ghui *UI) *StatsView {
+
+	label := tview.NewTextView()
+	label.SetDynamicColors(true)
+
+	text := tview.NewTextView()
+	text.SetDynamicColors(true)
+	text.SetScrollable(true)
+
+	layout := tview.NewFlex()
+	layout.SetDirection(tview.FlexRow)
+	layout.AddItem(label, 1, 0, false)
+	layout.AddItem(text, 0, 1, true)
+
+	// 30 days, as 'ghmon report'
+	return &StatsView{ghui: ghui, layout: layout, label: label, text: text, currentRange: 1}
+}
+
+// Show creates the report in the background, the histories of a year can take a moment to load
+func (statsView *StatsView) Show() {
+
+	days := statsRanges[statsView.currentRange]
+	statsView.label.SetText(fmt.Sprintf(" [::b]Review statistics[::-] - last %d days   [gray](r change range, ESC close)[-]", days))
+	statsView.text.SetText(" Loading histories...")
+
+	go func() {
+		now := time.Now()
+		var output bytes.Buffer
+		username, err := statsView.ghui.ghMon.FindUsername()
+		if err == nil {
+			var report *Report
+			if report, err = statsView.ghui.ghMon.CreateReport(username, now.AddDate(0, 0, -days), now); err == nil {
+				err = report.Write(&output, reportFormatTable)
+			}
+		}
+		statsView.ghui.app.QueueUpdateDraw(func() {
+			if err != nil {
+				statsView.text.SetText(fmt.Sprintf(" [red]Could not create the report: %s[-]", tview.Escape(err.Error())))
+				return
+			}
+			statsView.text.SetText(tview.Escape(output.String()))
+			statsView.text.ScrollToBeginning()
+		})
+	}()
+}
+
+func (statsView *StatsView) handleInput(event *tcell.EventKey) *tcell.EventKey {
+
+	switch event.Key() {
+	case tcell.KeyEscape:
+		statsView.ghui.closeView(statsPanel)
+		return nil
+	case tcell.KeyRune:
+		switch event.Rune() {
+		case 'q', 'i':
+			statsView.ghui.closeView(statsPanel)
+			return nil
+		case 'r':
+			statsView.currentRange = (statsView.currentRange + 1) % len(statsRanges)
+			statsView.Show()
+			return nil
+		}
+	}
+	return event
+}
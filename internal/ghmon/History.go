@@ -0,0 +1,410 @@
+package ghmon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// HistoryEventKind is what changed on a pull request between two refreshes
+type HistoryEventKind string
+
+const (
+	HistoryEventOpened               HistoryEventKind = "opened"
+	HistoryEventApproved             HistoryEventKind = "approved"
+	HistoryEventChangesRequested     HistoryEventKind = "changes-requested"
+	HistoryEventCommented            HistoryEventKind = "commented"
+	HistoryEventDismissed            HistoryEventKind = "dismissed"
+	HistoryEventReviewRequested      HistoryEventKind = "review-requested"
+	HistoryEventReviewRequestRemoved HistoryEventKind = "review-request-removed"
+	HistoryEventPushed               HistoryEventKind = "pushed"
+	HistoryEventReadyForReview       HistoryEventKind = "ready-for-review"
+	HistoryEventConvertedToDraft     HistoryEventKind = "converted-to-draft"
+	HistoryEventLabeled              HistoryEventKind = "labeled"
+	HistoryEventUnlabeled            HistoryEventKind = "unlabeled"
+	HistoryEventRenamed              HistoryEventKind = "renamed"
+	HistoryEventMerged               HistoryEventKind = "merged"
+	HistoryEventClosed               HistoryEventKind = "closed"
+	/* Still open on GitHub but not returned by the queries anymore */
+	HistoryEventLeftList    HistoryEventKind = "left-list"
+	HistoryEventReopened    HistoryEventKind = "reopened"
+	HistoryEventListedAgain HistoryEventKind = "listed-again"
+)
+
+// PullRequestHistoryEvent is a change noticed by a refresh.  Its time comes from GitHub when GitHub has one (reviews,
+// merging, closing), it is when the refresh noticed the change otherwise.
+type PullRequestHistoryEvent struct {
+	Time time.Time
+	Kind HistoryEventKind
+	/* Who made the change, empty when GitHub does not say */
+	Actor   string
+	Details string
+}
+
+// PullRequestHistoryState is what the last refresh saw of a pull request, the next refresh is compared to it
+type PullRequestHistoryState struct {
+	/* userId:status:submittedAt of every submitted review */
+	Reviews            []string
+	RequestedReviewers []string
+	HeadSHA            string
+	Draft              bool
+	Labels             []string
+	Title              string
+}
+
+// PullRequestHistory is the log of what happened to a pull request.  It is kept apart from the pull request so that
+// it outlives purging, until HistoryRetention after the pull request was closed.
+type PullRequestHistory struct {
+	Id         uint32
+	Repository string
+	Number     uint32
+	Title      string
+	Author     string
+	CreatedAt  time.Time
+	/* When the pull request was merged, closed or left the list, zero while it is listed */
+	ClosedAt  time.Time
+	Events    []*PullRequestHistoryEvent
+	LastState PullRequestHistoryState
+}
+
+func createPullRequestHistoryState(pullRequestWrapper *PullRequestWrapper) PullRequestHistoryState {
+
+	pullRequest := pullRequestWrapper.PullRequest
+	state := PullRequestHistoryState{Reviews: make([]string, 0), RequestedReviewers: make([]string, 0), HeadSHA: pullRequest.HeadSHA, Draft: pullRequest.Draft, Labels: make([]string, 0), Title: pullRequest.Title}
+	for _, pullRequestReviews := range pullRequest.PullRequestReviewsByUser {
+		for _, pullRequestReview := range pullRequestReviews {
+			switch pullRequestReview.Status {
+			case PullRequestReviewStatusRequested:
+				state.RequestedReviewers = append(state.RequestedReviewers, pullRequestReview.User.Username)
+			case PullRequestReviewStatusPending, PullRequestReviewStatusUnknown:
+				// Not submitted, nobody else can see it
+			default:
+				state.Reviews = append(state.Reviews, createReviewKey(pullRequestReview))
+			}
+		}
+	}
+	for _, requestedTeam := range pullRequest.RequestedTeams {
+		state.RequestedReviewers = append(state.RequestedReviewers, "team "+requestedTeam)
+	}
+	for _, label := range pullRequest.Labels {
+		state.Labels = append(state.Labels, label.Name)
+	}
+	sort.Strings(state.Reviews)
+	sort.Strings(state.RequestedReviewers)
+	sort.Strings(state.Labels)
+	return state
+}
+
+func createReviewKey(pullRequestReview *PullRequestReview) string {
+	return fmt.Sprintf("%d:%d:%d", pullRequestReview.User.Id, pullRequestReview.Status, pullRequestReview.SubmittedAt.Unix())
+}
+
+func findPullRequestReview(pullRequest *PullRequest, reviewKey string) *PullRequestReview {
+	for _, pullRequestReviews := range pullRequest.PullRequestReviewsByUser {
+		for _, pullRequestReview := range pullRequestReviews {
+			if createReviewKey(pullRequestReview) == reviewKey {
+				return pullRequestReview
+			}
+		}
+	}
+	return nil
+}
+
+// difference returns what is in values but not in others
+func difference(values []string, others []string) []string {
+	otherValues := make(map[string]bool)
+	for _, other := range others {
+		otherValues[other] = true
+	}
+	result := make([]string, 0)
+	for _, value := range values {
+		if !otherValues[value] {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func getReviewHistoryEventKind(pullRequestReviewStatus PullRequestReviewStatus) HistoryEventKind {
+	switch pullRequestReviewStatus {
+	case PullRequestReviewStatusApproved:
+		return HistoryEventApproved
+	case PullRequestReviewStatusChangesRequested:
+		return HistoryEventChangesRequested
+	case PullRequestReviewStatusDismissed:
+		return HistoryEventDismissed
+	default:
+		return HistoryEventCommented
+	}
+}
+
+// createPullRequestHistory starts the history of a pull request seen for the first time with what is already known:
+// when it was opened, the reviews submitted so far and the reviews requested
+func createPullRequestHistory(user *User, pullRequestWrapper *PullRequestWrapper, now time.Time) *PullRequestHistory {
+
+	pullRequest := pullRequestWrapper.PullRequest
+	history := &PullRequestHistory{Id: pullRequestWrapper.Id, Number: pullRequest.Number, Title: pullRequest.Title, CreatedAt: pullRequest.CreatedAt, Events: make([]*PullRequestHistoryEvent, 0)}
+	if pullRequest.Repo != nil {
+		history.Repository = pullRequest.Repo.FullName
+	}
+	if pullRequest.Creator != nil {
+		history.Author = pullRequest.Creator.Username
+	}
+	history.LastState = createPullRequestHistoryState(pullRequestWrapper)
+
+	history.appendEvent(&PullRequestHistoryEvent{Time: pullRequest.CreatedAt, Kind: HistoryEventOpened, Actor: history.Author})
+	for _, reviewKey := range history.LastState.Reviews {
+		pullRequestReview := findPullRequestReview(pullRequest, reviewKey)
+		history.appendEvent(&PullRequestHistoryEvent{Time: pullRequestReview.SubmittedAt, Kind: getReviewHistoryEventKind(pullRequestReview.Status), Actor: pullRequestReview.User.Username})
+	}
+	for _, requestedReviewer := range history.LastState.RequestedReviewers {
+		event := &PullRequestHistoryEvent{Time: now, Kind: HistoryEventReviewRequested, Details: requestedReviewer}
+		// Only the request of the user was noticed before
+		if user != nil && requestedReviewer == user.Username && !pullRequestWrapper.ReviewRequestedAt.IsZero() {
+			event.Time = pullRequestWrapper.ReviewRequestedAt
+		}
+		history.appendEvent(event)
+	}
+	return history
+}
+
+// update appends the changes since the last state and makes the pull request the last state.  A closed pull request
+// that is listed again is reopened.
+func (history *PullRequestHistory) update(pullRequestWrapper *PullRequestWrapper, now time.Time) bool {
+
+	pullRequest := pullRequestWrapper.PullRequest
+	lastState := history.LastState
+	state := createPullRequestHistoryState(pullRequestWrapper)
+	numEvents := len(history.Events)
+
+	if !history.ClosedAt.IsZero() && !pullRequestWrapper.Deleted {
+		kind := HistoryEventListedAgain
+		if closedEvent := history.findLastEvent(HistoryEventMerged, HistoryEventClosed, HistoryEventLeftList); closedEvent != nil && closedEvent.Kind != HistoryEventLeftList {
+			kind = HistoryEventReopened
+		}
+		history.ClosedAt = time.Time{}
+		history.appendEvent(&PullRequestHistoryEvent{Time: now, Kind: kind})
+	}
+
+	reviewers := make(map[string]bool)
+	for _, reviewKey := range difference(state.Reviews, lastState.Reviews) {
+		pullRequestReview := findPullRequestReview(pullRequest, reviewKey)
+		reviewers[pullRequestReview.User.Username] = true
+		event := &PullRequestHistoryEvent{Time: pullRequestReview.SubmittedAt, Kind: getReviewHistoryEventKind(pullRequestReview.Status), Actor: pullRequestReview.User.Username}
+		// A dismissed review keeps the time it was submitted at, GitHub does not say when it was dismissed
+		if event.Time.IsZero() || pullRequestReview.Status == PullRequestReviewStatusDismissed {
+			event.Time = now
+		}
+		history.appendEvent(event)
+	}
+
+	for _, requestedReviewer := range difference(state.RequestedReviewers, lastState.RequestedReviewers) {
+		history.appendEvent(&PullRequestHistoryEvent{Time: now, Kind: HistoryEventReviewRequested, Details: requestedReviewer})
+	}
+	for _, requestedReviewer := range difference(lastState.RequestedReviewers, state.RequestedReviewers) {
+		// Reviewing removes the request, that is already in the history as the review
+		if !reviewers[requestedReviewer] {
+			history.appendEvent(&PullRequestHistoryEvent{Time: now, Kind: HistoryEventReviewRequestRemoved, Details: requestedReviewer})
+		}
+	}
+
+	if lastState.HeadSHA != "" && state.HeadSHA != "" && lastState.HeadSHA != state.HeadSHA {
+		history.appendEvent(&PullRequestHistoryEvent{Time: now, Kind: HistoryEventPushed, Actor: history.Author, Details: fmt.Sprintf("%.7s to %.7s", lastState.HeadSHA, state.HeadSHA)})
+	}
+	if lastState.Draft && !state.Draft {
+		history.appendEvent(&PullRequestHistoryEvent{Time: now, Kind: HistoryEventReadyForReview, Actor: history.Author})
+	} else if !lastState.Draft && state.Draft {
+		history.appendEvent(&PullRequestHistoryEvent{Time: now, Kind: HistoryEventConvertedToDraft, Actor: history.Author})
+	}
+	for _, label := range difference(state.Labels, lastState.Labels) {
+		history.appendEvent(&PullRequestHistoryEvent{Time: now, Kind: HistoryEventLabeled, Details: label})
+	}
+	for _, label := range difference(lastState.Labels, state.Labels) {
+		history.appendEvent(&PullRequestHistoryEvent{Time: now, Kind: HistoryEventUnlabeled, Details: label})
+	}
+	if lastState.Title != "" && lastState.Title != state.Title {
+		history.appendEvent(&PullRequestHistoryEvent{Time: now, Kind: HistoryEventRenamed, Details: fmt.Sprintf("from \"%s\"", lastState.Title)})
+	}
+
+	changed := len(history.Events) != numEvents || history.Number != pullRequest.Number || history.Title != pullRequest.Title
+	history.LastState = state
+	history.Number = pullRequest.Number
+	history.Title = pullRequest.Title
+	return changed
+}
+
+// close appends how the pull request left the list, ClosedAt starts the retention of the history
+func (history *PullRequestHistory) close(event *PullRequestHistoryEvent) {
+	history.ClosedAt = event.Time
+	history.appendEvent(event)
+}
+
+func (history *PullRequestHistory) findLastEvent(kinds ...HistoryEventKind) *PullRequestHistoryEvent {
+	for i := len(history.Events) - 1; i >= 0; i-- {
+		for _, kind := range kinds {
+			if history.Events[i].Kind == kind {
+				return history.Events[i]
+			}
+		}
+	}
+	return nil
+}
+
+// appendEvent keeps the events in chronological order, events at the same time stay in the order they were appended
+func (history *PullRequestHistory) appendEvent(event *PullRequestHistoryEvent) {
+	index := sort.Search(len(history.Events), func(i int) bool {
+		return history.Events[i].Time.After(event.Time)
+	})
+	history.Events = append(history.Events, nil)
+	copy(history.Events[index+1:], history.Events[index:])
+	history.Events[index] = event
+}
+
+// recordPullRequestHistory appends what changed since the last refresh to the history of the pull request, through the
+// store or the batch of a refresh.  Nothing is recorded while another process writes to the store, that process
+// records it.  Run by the store writer, the same pull request can be retrieved by several queries at once.
+func (ghm *GHMon) recordPullRequestHistory(store StoreBatch, user *User, pullRequestWrapper *PullRequestWrapper) {
+
+	if ghm.storeLock == nil {
+		return
+	}
+
+	history, err := store.LoadPullRequestHistory(pullRequestWrapper.Id)
+	if err != nil {
+		ghm.logger.Printf("Could not load the history of %d: %s", pullRequestWrapper.Id, err)
+		return
+	}
+	if history == nil {
+		history = createPullRequestHistory(user, pullRequestWrapper, time.Now())
+	} else if !history.update(pullRequestWrapper, time.Now()) {
+		return
+	}
+	if err = store.StorePullRequestHistory(history); err != nil {
+		ghm.logger.Printf("Could not store the history of %d: %s", pullRequestWrapper.Id, err)
+	}
+}
+
+// recordPullRequestClosed finds out from GitHub why a pull request left the list and appends it to its history
+func (ghm *GHMon) recordPullRequestClosed(ctx context.Context, user *User, pullRequestWrapper *PullRequestWrapper) {
+
+	if ghm.storeLock == nil {
+		return
+	}
+
+	// Already known to be closed, GitHub is not asked again
+	history, err := ghm.store.LoadPullRequestHistory(pullRequestWrapper.Id)
+	if err != nil {
+		ghm.logger.Printf("Could not load the history of %d: %s", pullRequestWrapper.Id, err)
+		return
+	}
+	if history != nil && !history.ClosedAt.IsZero() {
+		return
+	}
+
+	// Asked before handing it to the store writer, the other histories are not kept waiting on GitHub
+	event := ghm.retrievePullRequestClosedEvent(ctx, pullRequestWrapper)
+	if ctx.Err() != nil {
+		// Why it left is not known, the next refresh finds out
+		return
+	}
+
+	ghm.writeStore(func() {
+		// Loaded again, it may have been updated or closed while GitHub was asked
+		history, err := ghm.store.LoadPullRequestHistory(pullRequestWrapper.Id)
+		if err != nil {
+			ghm.logger.Printf("Could not load the history of %d: %s", pullRequestWrapper.Id, err)
+			return
+		}
+		if history == nil {
+			history = createPullRequestHistory(user, pullRequestWrapper, time.Now())
+		}
+		if !history.ClosedAt.IsZero() {
+			return
+		}
+		history.close(event)
+		if err = ghm.store.StorePullRequestHistory(history); err != nil {
+			ghm.logger.Printf("Could not store the history of %d: %s", pullRequestWrapper.Id, err)
+		}
+	})
+}
+
+// retrievePullRequestClosedEvent tells a merged or closed pull request apart from one the queries do not return anymore
+func (ghm *GHMon) retrievePullRequestClosedEvent(ctx context.Context, pullRequestWrapper *PullRequestWrapper) *PullRequestHistoryEvent {
+
+	event := &PullRequestHistoryEvent{Time: time.Now(), Kind: HistoryEventLeftList}
+	if pullRequestWrapper.PullRequest.PullRequestURL == nil {
+		return event
+	}
+	var pullRequestResult struct {
+		State    string
+		MergedAt time.Time `json:"merged_at"`
+		MergedBy *struct {
+			Login string
+		} `json:"merged_by"`
+		ClosedAt time.Time `json:"closed_at"`
+	}
+	output, err := runAPIRequest(ctx, pullRequestWrapper.PullRequest.PullRequestURL.Path)
+	if err == nil {
+		err = json.Unmarshal(output, &pullRequestResult)
+	}
+	if err != nil {
+		ghm.logger.Printf("Could not find out why %d left the list: %s", pullRequestWrapper.Id, err)
+		return event
+	}
+
+	switch {
+	case !pullRequestResult.MergedAt.IsZero():
+		event.Kind = HistoryEventMerged
+		event.Time = pullRequestResult.MergedAt
+		if pullRequestResult.MergedBy != nil {
+			event.Actor = pullRequestResult.MergedBy.Login
+		}
+	case pullRequestResult.State == "closed":
+		event.Kind = HistoryEventClosed
+		if !pullRequestResult.ClosedAt.IsZero() {
+			event.Time = pullRequestResult.ClosedAt
+		}
+	}
+	return event
+}
+
+// expirePullRequestHistories forgets the history of the pull requests closed longer than HistoryRetention ago, a
+// zero retention keeps it forever.  Run by the store writer.
+func (ghm *GHMon) expirePullRequestHistories() {
+
+	if ghm.storeLock == nil || ghm.configuration.HistoryRetention <= 0 {
+		return
+	}
+
+	histories, err := ghm.store.LoadPullRequestHistories()
+	if err != nil {
+		ghm.logger.Printf("Could not load the histories: %s", err)
+		return
+	}
+	expiredIds := make([]uint32, 0)
+	expiry := time.Now().Add(-ghm.configuration.HistoryRetention)
+	for _, history := range histories {
+		if !history.ClosedAt.IsZero() && history.ClosedAt.Before(expiry) {
+			expiredIds = append(expiredIds, history.Id)
+		}
+	}
+	if len(expiredIds) == 0 {
+		return
+	}
+	if err = ghm.store.DeletePullRequestHistories(expiredIds); err != nil {
+		ghm.logger.Printf("Could not remove expired histories: %s", err)
+		return
+	}
+	ghm.logger.Printf("Removed the history of %d pull requests closed before %s", len(expiredIds), expiry.Format(time.RFC3339))
+}
+
+// LoadPullRequestHistory returns the history of a pull request, nil when nothing was recorded yet.  It is read from
+// the store, or from the daemon when following one.
+func (ghm *GHMon) LoadPullRequestHistory(pullRequestId uint32) (*PullRequestHistory, error) {
+	if ghm.daemonClient != nil {
+		return ghm.daemonClient.RetrievePullRequestHistory(pullRequestId)
+	}
+	return ghm.store.LoadPullRequestHistory(pullRequestId)
+}
@@ -0,0 +1,235 @@
+package ghmon
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func newHistoryPullRequestWrapper() *PullRequestWrapper {
+	return &PullRequestWrapper{
+		Id: 1,
+		PullRequest: &PullRequest{
+			Id: 1, Number: 7, Title: "Add the history",
+			Repo:                     &Repo{Name: "repo", FullName: "owner/repo"},
+			Creator:                  &User{Id: 2, Username: "author"},
+			CreatedAt:                time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC),
+			HeadSHA:                  "1111111aaaa",
+			PullRequestReviewsByUser: make(map[uint32][]*PullRequestReview),
+		},
+	}
+}
+
+func eventKinds(history *PullRequestHistory) []HistoryEventKind {
+	kinds := make([]HistoryEventKind, 0)
+	for _, event := range history.Events {
+		kinds = append(kinds, event.Kind)
+	}
+	return kinds
+}
+
+func checkEvents(t *testing.T, history *PullRequestHistory, expected ...*PullRequestHistoryEvent) {
+	t.Helper()
+	if len(history.Events) != len(expected) {
+		t.Fatalf("events %v, expected %d", eventKinds(history), len(expected))
+	}
+	for index, event := range history.Events {
+		if *event != *expected[index] {
+			t.Errorf("event %d is %+v, expected %+v", index, *event, *expected[index])
+		}
+	}
+}
+
+func TestCreatePullRequestHistory(t *testing.T) {
+
+	me := &User{Id: 1, Username: "me"}
+	reviewer := &User{Id: 3, Username: "reviewer"}
+	other := &User{Id: 4, Username: "other"}
+	reviewedAt := time.Date(2021, 3, 1, 11, 0, 0, 0, time.UTC)
+	requestedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	now := time.Date(2021, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	pullRequestWrapper := newHistoryPullRequestWrapper()
+	pullRequestWrapper.ReviewRequestedAt = requestedAt
+	pullRequest := pullRequestWrapper.PullRequest
+	pullRequest.PullRequestReviewsByUser[me.Id] = []*PullRequestReview{{User: me, Status: PullRequestReviewStatusRequested}}
+	pullRequest.PullRequestReviewsByUser[reviewer.Id] = []*PullRequestReview{{User: reviewer, Status: PullRequestReviewStatusChangesRequested, SubmittedAt: reviewedAt}}
+	// Nobody but the reviewer sees a pending review
+	pullRequest.PullRequestReviewsByUser[other.Id] = []*PullRequestReview{{User: other, Status: PullRequestReviewStatusPending}, {User: other, Status: PullRequestReviewStatusRequested}}
+	pullRequest.RequestedTeams = []string{"core"}
+
+	history := createPullRequestHistory(me, pullRequestWrapper, now)
+
+	if history.Id != 1 || history.Repository != "owner/repo" || history.Number != 7 || history.Author != "author" || !history.ClosedAt.IsZero() {
+		t.Errorf("unexpected history %+v", history)
+	}
+	checkEvents(t, history,
+		&PullRequestHistoryEvent{Time: pullRequest.CreatedAt, Kind: HistoryEventOpened, Actor: "author"},
+		&PullRequestHistoryEvent{Time: requestedAt, Kind: HistoryEventReviewRequested, Details: "me"},
+		&PullRequestHistoryEvent{Time: reviewedAt, Kind: HistoryEventChangesRequested, Actor: "reviewer"},
+		&PullRequestHistoryEvent{Time: now, Kind: HistoryEventReviewRequested, Details: "other"},
+		&PullRequestHistoryEvent{Time: now, Kind: HistoryEventReviewRequested, Details: "team core"},
+	)
+}
+
+func TestPullRequestHistoryUpdate(t *testing.T) {
+
+	reviewer := &User{Id: 3, Username: "reviewer"}
+	other := &User{Id: 4, Username: "other"}
+	reviewedAt := time.Date(2021, 3, 1, 11, 0, 0, 0, time.UTC)
+	now := time.Date(2021, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	pullRequestWrapper := newHistoryPullRequestWrapper()
+	pullRequest := pullRequestWrapper.PullRequest
+	pullRequest.Draft = true
+	pullRequest.Labels = []*Label{{Name: "wip"}}
+	pullRequest.PullRequestReviewsByUser[reviewer.Id] = []*PullRequestReview{{User: reviewer, Status: PullRequestReviewStatusRequested}}
+	pullRequest.PullRequestReviewsByUser[other.Id] = []*PullRequestReview{{User: other, Status: PullRequestReviewStatusRequested}}
+	history := createPullRequestHistory(nil, pullRequestWrapper, now.Add(-time.Hour))
+
+	if history.update(pullRequestWrapper, now) {
+		t.Errorf("nothing changed, yet the history changed to %v", eventKinds(history))
+	}
+
+	// The review takes the place of the request, the other request is withdrawn
+	pullRequest.PullRequestReviewsByUser[reviewer.Id] = []*PullRequestReview{{User: reviewer, Status: PullRequestReviewStatusApproved, SubmittedAt: reviewedAt}}
+	delete(pullRequest.PullRequestReviewsByUser, other.Id)
+	pullRequest.HeadSHA = "2222222bbbb"
+	pullRequest.Draft = false
+	pullRequest.Labels = []*Label{{Name: "ready"}}
+	pullRequest.Title = "Record the history"
+
+	if !history.update(pullRequestWrapper, now) {
+		t.Fatal("expected the history to change")
+	}
+	checkEvents(t, history,
+		&PullRequestHistoryEvent{Time: pullRequest.CreatedAt, Kind: HistoryEventOpened, Actor: "author"},
+		&PullRequestHistoryEvent{Time: reviewedAt, Kind: HistoryEventApproved, Actor: "reviewer"},
+		&PullRequestHistoryEvent{Time: now.Add(-time.Hour), Kind: HistoryEventReviewRequested, Details: "other"},
+		&PullRequestHistoryEvent{Time: now.Add(-time.Hour), Kind: HistoryEventReviewRequested, Details: "reviewer"},
+		&PullRequestHistoryEvent{Time: now, Kind: HistoryEventReviewRequestRemoved, Details: "other"},
+		&PullRequestHistoryEvent{Time: now, Kind: HistoryEventPushed, Actor: "author", Details: "1111111 to 2222222"},
+		&PullRequestHistoryEvent{Time: now, Kind: HistoryEventReadyForReview, Actor: "author"},
+		&PullRequestHistoryEvent{Time: now, Kind: HistoryEventLabeled, Details: "ready"},
+		&PullRequestHistoryEvent{Time: now, Kind: HistoryEventUnlabeled, Details: "wip"},
+		&PullRequestHistoryEvent{Time: now, Kind: HistoryEventRenamed, Details: `from "Add the history"`},
+	)
+	if history.Title != "Record the history" || history.LastState.HeadSHA != "2222222bbbb" {
+		t.Errorf("the last state was not kept: %+v", history.LastState)
+	}
+
+	// GitHub does not say when a review was dismissed, it is when the refresh noticed
+	pullRequest.PullRequestReviewsByUser[reviewer.Id] = []*PullRequestReview{{User: reviewer, Status: PullRequestReviewStatusDismissed, SubmittedAt: reviewedAt}}
+	pullRequest.Draft = true
+	later := now.Add(time.Hour)
+	if !history.update(pullRequestWrapper, later) {
+		t.Fatal("expected the history to change")
+	}
+	lastEvents := history.Events[len(history.Events)-2:]
+	if *lastEvents[0] != (PullRequestHistoryEvent{Time: later, Kind: HistoryEventDismissed, Actor: "reviewer"}) || *lastEvents[1] != (PullRequestHistoryEvent{Time: later, Kind: HistoryEventConvertedToDraft, Actor: "author"}) {
+		t.Errorf("unexpected events %+v and %+v", *lastEvents[0], *lastEvents[1])
+	}
+}
+
+func TestPullRequestHistoryReopens(t *testing.T) {
+
+	closedAt := time.Date(2021, 3, 2, 9, 0, 0, 0, time.UTC)
+	now := closedAt.Add(time.Hour)
+
+	tests := []struct {
+		closedKind HistoryEventKind
+		kind       HistoryEventKind
+	}{
+		{HistoryEventMerged, HistoryEventReopened},
+		{HistoryEventClosed, HistoryEventReopened},
+		{HistoryEventLeftList, HistoryEventListedAgain},
+	}
+	for _, test := range tests {
+		pullRequestWrapper := newHistoryPullRequestWrapper()
+		history := createPullRequestHistory(nil, pullRequestWrapper, closedAt)
+		history.close(&PullRequestHistoryEvent{Time: closedAt, Kind: test.closedKind})
+		if !history.ClosedAt.Equal(closedAt) {
+			t.Errorf("%s: closed at %s, expected %s", test.closedKind, history.ClosedAt, closedAt)
+		}
+
+		// Still closed, nothing happens
+		pullRequestWrapper.Deleted = true
+		if history.update(pullRequestWrapper, now) {
+			t.Errorf("%s: changed while closed", test.closedKind)
+		}
+
+		pullRequestWrapper.Deleted = false
+		if !history.update(pullRequestWrapper, now) || !history.ClosedAt.IsZero() {
+			t.Errorf("%s: not opened again", test.closedKind)
+		}
+		if lastEvent := history.Events[len(history.Events)-1]; lastEvent.Kind != test.kind || !lastEvent.Time.Equal(now) {
+			t.Errorf("%s: opened again with %+v, expected %s", test.closedKind, *lastEvent, test.kind)
+		}
+	}
+}
+
+func TestRetrievePullRequestClosedEvent(t *testing.T) {
+	withFakeGH(t,
+		fakeGHResponse{"repos/owner/repo/pulls/1", `{"state": "closed", "merged_at": "2021-03-02T09:00:00Z", "merged_by": {"login": "maintainer"}, "closed_at": "2021-03-02T09:00:00Z"}`},
+		fakeGHResponse{"repos/owner/repo/pulls/2", `{"state": "closed", "merged_at": null, "closed_at": "2021-03-03T09:00:00Z"}`},
+		fakeGHResponse{"repos/owner/repo/pulls/3", `{"state": "open", "merged_at": null, "closed_at": null}`},
+	)
+	ghm := newTestMonitor(t)
+
+	tests := []struct {
+		path  string
+		event PullRequestHistoryEvent
+	}{
+		{"/repos/owner/repo/pulls/1", PullRequestHistoryEvent{Time: time.Date(2021, 3, 2, 9, 0, 0, 0, time.UTC), Kind: HistoryEventMerged, Actor: "maintainer"}},
+		{"/repos/owner/repo/pulls/2", PullRequestHistoryEvent{Time: time.Date(2021, 3, 3, 9, 0, 0, 0, time.UTC), Kind: HistoryEventClosed}},
+		// Still open, or GitHub could not tell
+		{"/repos/owner/repo/pulls/3", PullRequestHistoryEvent{Kind: HistoryEventLeftList}},
+		{"/repos/owner/repo/pulls/4", PullRequestHistoryEvent{Kind: HistoryEventLeftList}},
+	}
+	for _, test := range tests {
+		pullRequestWrapper := newHistoryPullRequestWrapper()
+		pullRequestWrapper.PullRequest.PullRequestURL = &url.URL{Scheme: "https", Host: "api.github.com", Path: test.path}
+
+		before := time.Now()
+		event := ghm.retrievePullRequestClosedEvent(context.Background(), pullRequestWrapper)
+		if test.event.Time.IsZero() {
+			if event.Time.Before(before) {
+				t.Errorf("%s: left the list at %s, expected now", test.path, event.Time)
+			}
+			event.Time = time.Time{}
+		}
+		if *event != test.event {
+			t.Errorf("%s: %+v, expected %+v", test.path, *event, test.event)
+		}
+	}
+}
+
+func TestExpirePullRequestHistories(t *testing.T) {
+
+	ghm := newTestMonitor(t)
+	ghm.configuration.HistoryRetention = 24 * time.Hour
+
+	histories := []*PullRequestHistory{
+		{Id: 1, Title: "open"},
+		{Id: 2, Title: "closed recently", ClosedAt: time.Now().Add(-time.Hour)},
+		{Id: 3, Title: "closed long ago", ClosedAt: time.Now().Add(-48 * time.Hour)},
+	}
+	for _, history := range histories {
+		if err := ghm.store.StorePullRequestHistory(history); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ghm.writeStore(ghm.expirePullRequestHistories)
+
+	for _, history := range histories {
+		storedHistory, err := ghm.store.LoadPullRequestHistory(history.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expired := storedHistory == nil; expired != (history.Id == 3) {
+			t.Errorf("%s: expired %v", history.Title, expired)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package ghmon
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	tview "gitlab.com/tslocum/cview"
+)
+
+var (
+	markdownHTMLCommentPattern = regexp.MustCompile(`(?s)<!--.*?-->`)
+	markdownHTMLTagPattern     = regexp.MustCompile(`(?i)</?(details|summary|p|div|span|sub|sup|b|i|em|strong|kbd|img)\b[^>]*>|<br\s*/?>`)
+	markdownHeadingPattern     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	markdownTaskPattern        = regexp.MustCompile(`^(\s*)[-*+]\s+\[([ xX])\]\s+(.*)$`)
+	markdownBulletPattern      = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	markdownNumberedPattern    = regexp.MustCompile(`^(\s*)(\d+)[.)]\s+(.*)$`)
+	markdownRulePattern        = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	markdownFencePattern       = regexp.MustCompile("^\\s*(```|~~~)\\s*([\\w+-]*)")
+)
+
+const (
+	markdownHeadingColor = "yellow"
+	markdownCodeColor    = "#ffaf5f"
+	markdownLinkColor    = "#5fafff"
+	markdownQuoteColor   = "gray"
+)
+
+// RenderMarkdown converts the GitHub flavoured markdown of a pull request description into text with tview color
+// tags.  It covers what typically shows up in pull request templates - headings, emphasis, lists, task lists, code,
+// links and quotes - and drops HTML comments.  Anything else is shown as is (escaped).
+func RenderMarkdown(markdown string) string {
+
+	markdown = strings.ReplaceAll(markdown, "\r\n", "\n")
+	markdown = markdownHTMLCommentPattern.ReplaceAllString(markdown, "")
+	markdown = markdownHTMLTagPattern.ReplaceAllString(markdown, "")
+
+	var rendered strings.Builder
+
+	inCodeBlock := false
+	codeFence := ""
+	previousLineBlank := true
+
+	for _, line := range strings.Split(markdown, "\n") {
+
+		if matches := markdownFencePattern.FindStringSubmatch(line); matches != nil && (!inCodeBlock || matches[1] == codeFence) {
+			if !inCodeBlock {
+				inCodeBlock = true
+				codeFence = matches[1]
+				if matches[2] != "" {
+					rendered.WriteString(fmt.Sprintf("[%s::d]  ┌ %s[-::-]\n", markdownQuoteColor, tview.Escape(matches[2])))
+				}
+			} else {
+				inCodeBlock = false
+			}
+			continue
+		}
+
+		if inCodeBlock {
+			rendered.WriteString(fmt.Sprintf("[%s]  │ %s[-]\n", markdownCodeColor, tview.Escape(line)))
+			continue
+		}
+
+		// Collapse runs of blank lines (often left behind by stripped comments)
+		if strings.TrimSpace(line) == "" {
+			if !previousLineBlank {
+				rendered.WriteString("\n")
+			}
+			previousLineBlank = true
+			continue
+		}
+		previousLineBlank = false
+
+		rendered.WriteString(renderMarkdownLine(line))
+		rendered.WriteString("\n")
+	}
+
+	return strings.TrimRight(rendered.String(), "\n")
+}
+
+func renderMarkdownLine(line string) string {
+
+	if matches := markdownHeadingPattern.FindStringSubmatch(line); matches != nil {
+		if len(matches[1]) == 1 {
+			return fmt.Sprintf("[%s::bu]%s[-::-]", markdownHeadingColor, renderMarkdownInline(matches[2]))
+		}
+		return fmt.Sprintf("[%s::b]%s[-::-]", markdownHeadingColor, renderMarkdownInline(matches[2]))
+	}
+
+	if markdownRulePattern.MatchString(line) {
+		return fmt.Sprintf("[%s]%s[-]", markdownQuoteColor, strings.Repeat("─", 40))
+	}
+
+	if matches := markdownTaskPattern.FindStringSubmatch(line); matches != nil {
+		if matches[2] == " " {
+			return fmt.Sprintf("%s ☐ %s", matches[1], renderMarkdownInline(matches[3]))
+		}
+		return fmt.Sprintf("%s [green]☑[-] [::d]%s[::-]", matches[1], renderMarkdownInline(matches[3]))
+	}
+
+	if matches := markdownBulletPattern.FindStringSubmatch(line); matches != nil {
+		return fmt.Sprintf("%s • %s", matches[1], renderMarkdownInline(matches[2]))
+	}
+
+	if matches := markdownNumberedPattern.FindStringSubmatch(line); matches != nil {
+		return fmt.Sprintf("%s %s. %s", matches[1], matches[2], renderMarkdownInline(matches[3]))
+	}
+
+	if trimmed := strings.TrimLeft(line, " "); strings.HasPrefix(trimmed, ">") {
+		return fmt.Sprintf("[%s]│ %s[-]", markdownQuoteColor, renderMarkdownInline(strings.TrimLeft(trimmed[1:], " ")))
+	}
+
+	return renderMarkdownInline(line)
+}
+
+// renderMarkdownInline handles code spans, emphasis, strike-through, links and images within a single line
+func renderMarkdownInline(text string) string {
+
+	var rendered strings.Builder
+	var literal strings.Builder
+
+	flushLiteral := func() {
+		if literal.Len() > 0 {
+			rendered.WriteString(tview.Escape(literal.String()))
+			literal.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); i++ {
+
+		c := text[i]
+
+		switch {
+		case c == '\\' && i+1 < len(text) && strings.IndexByte("\\`*_[]()#+-.!~<>", text[i+1]) >= 0:
+			literal.WriteByte(text[i+1])
+			i++
+			continue
+
+		case c == '`':
+			if end := strings.IndexByte(text[i+1:], '`'); end >= 0 {
+				flushLiteral()
+				rendered.WriteString(fmt.Sprintf("[%s]%s[-]", markdownCodeColor, tview.Escape(text[i+1:i+1+end])))
+				i += end + 1
+				continue
+			}
+
+		case c == '!' && i+1 < len(text) && text[i+1] == '[':
+			if label, _, length := parseMarkdownLink(text[i+1:]); length > 0 {
+				flushLiteral()
+				rendered.WriteString(fmt.Sprintf("[%s]%s[-]", markdownQuoteColor, tview.Escape("[image: "+label+"]")))
+				i += length
+				continue
+			}
+
+		case c == '[':
+			if label, target, length := parseMarkdownLink(text[i:]); length > 0 {
+				flushLiteral()
+				rendered.WriteString(fmt.Sprintf("[%s::u]%s[-::-]", markdownLinkColor, renderMarkdownInline(label)))
+				if target != label {
+					rendered.WriteString(fmt.Sprintf(" [%s](%s)[-]", markdownQuoteColor, tview.Escape(target)))
+				}
+				i += length - 1
+				continue
+			}
+
+		case (c == '*' || c == '_' || c == '~') && i+1 < len(text) && text[i+1] == c:
+			delimiter := text[i : i+2]
+			if end := strings.Index(text[i+2:], delimiter); end > 0 {
+				flushLiteral()
+				attribute := "b"
+				if c == '~' {
+					attribute = "s"
+				}
+				rendered.WriteString(fmt.Sprintf("[::%s]%s[::-]", attribute, renderMarkdownInline(text[i+2:i+2+end])))
+				i += end + 3
+				continue
+			}
+
+		case c == '*' || c == '_':
+			// Underscores within words (snake_case) are not emphasis
+			if c == '_' && i > 0 && isMarkdownWordCharacter(text[i-1]) {
+				break
+			}
+			if end := strings.IndexByte(text[i+1:], c); end > 0 && text[i+1] != ' ' {
+				closing := i + 1 + end
+				if c == '_' && closing+1 < len(text) && isMarkdownWordCharacter(text[closing+1]) {
+					break
+				}
+				flushLiteral()
+				rendered.WriteString(fmt.Sprintf("[::i]%s[::-]", renderMarkdownInline(text[i+1:closing])))
+				i = closing
+				continue
+			}
+		}
+
+		literal.WriteByte(c)
+	}
+
+	flushLiteral()
+	return rendered.String()
+}
+
+// parseMarkdownLink parses '[label](target)' at the start of text, returning the number of bytes consumed (0 if
+// text does not start with a link)
+func parseMarkdownLink(text string) (string, string, int) {
+
+	labelEnd := strings.Index(text, "](")
+	if !strings.HasPrefix(text, "[") || labelEnd < 0 {
+		return "", "", 0
+	}
+	targetEnd := strings.IndexByte(text[labelEnd+2:], ')')
+	if targetEnd < 0 {
+		return "", "", 0
+	}
+
+	label := text[1:labelEnd]
+	target := text[labelEnd+2 : labelEnd+2+targetEnd]
+	if strings.ContainsAny(label, "[]") {
+		return "", "", 0
+	}
+	return label, target, labelEnd + 2 + targetEnd + 1
+}
+
+func isMarkdownWordCharacter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
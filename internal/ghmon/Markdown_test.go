@@ -0,0 +1,42 @@
+package ghmon
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		markdown string
+		rendered string
+	}{
+		{"top heading", "# Title", "[yellow::bu]Title[-::-]"},
+		{"heading", "## Changes ##", "[yellow::b]Changes[-::-]"},
+		{"open task", "- [ ] write tests", " ☐ write tests"},
+		{"done task", "- [x] fix the bug", " [green]☑[-] [::d]fix the bug[::-]"},
+		{"bullet", "* item", " • item"},
+		{"numbered", "  1) first", "   1. first"},
+		{"quote", "> quoted", "[gray]│ quoted[-]"},
+		{"rule", "- - -", "[gray]" + strings.Repeat("─", 40) + "[-]"},
+		{"emphasis", "**bold**, *italic* and ~~gone~~", "[::b]bold[::-], [::i]italic[::-] and [::s]gone[::-]"},
+		{"snake case", "rename snake_case_name", "rename snake_case_name"},
+		{"escaped", `\*not emphasis\*`, "*not emphasis*"},
+		{"code span", "run `go test`", "run [#ffaf5f]go test[-]"},
+		{"link", "see [the docs](https://example.com/docs)", "see [#5fafff::u]the docs[-::-] [gray](https://example.com/docs)[-]"},
+		{"bare link", "[https://example.com](https://example.com)", "[#5fafff::u]https://example.com[-::-]"},
+		{"image", "![logo](logo.png)", "[gray][image: logo[][-]"},
+		{"color tags", "[red] stays text", "[red[] stays text"},
+		{"comments and blank lines", "first\r\n<!-- describe the change -->\r\n\r\n\r\nsecond", "first\n\nsecond"},
+		{"html", "<details><summary>More</summary>hidden<br/>text</details>", "Morehiddentext"},
+		{"code block", "```go\nx := a[i]\n**not bold**\n```\nafter", "[gray::d]  ┌ go[-::-]\n[#ffaf5f]  │ x := a[i[][-]\n[#ffaf5f]  │ **not bold**[-]\nafter"},
+		{"other fence in a code block", "~~~\n```\n~~~", "[#ffaf5f]  │ ```[-]"},
+	}
+
+	for _, test := range tests {
+		if rendered := RenderMarkdown(test.markdown); rendered != test.rendered {
+			t.Errorf("%s: rendered %q, expected %q", test.name, rendered, test.rendered)
+		}
+	}
+}
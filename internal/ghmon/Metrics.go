@@ -0,0 +1,179 @@
+package ghmon
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics collects what the monitor does for a Prometheus scrape.  API calls are counted where gh is run, which has no
+// monitor at hand, so there is a single instance for the process.
+type Metrics struct {
+	lock                  sync.Mutex
+	apiRequests           map[string]uint64
+	apiErrors             map[string]uint64
+	refreshes             uint64
+	refreshStartedAt      time.Time
+	lastRefreshDuration   time.Duration
+	lastRefreshFinishedAt time.Time
+	pullRequestWrappers   []*PullRequestWrapper
+}
+
+var metrics = &Metrics{apiRequests: make(map[string]uint64), apiErrors: make(map[string]uint64), pullRequestWrappers: make([]*PullRequestWrapper, 0)}
+
+/* Kinds of API calls */
+const (
+	apiKindREST    = "rest"
+	apiKindGraphQL = "graphql"
+)
+
+func (metrics *Metrics) countAPIRequest(kind string, err error) {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	metrics.apiRequests[kind]++
+	if err != nil {
+		metrics.apiErrors[kind]++
+	}
+}
+
+func (metrics *Metrics) refreshStarted() {
+	metrics.lock.Lock()
+	metrics.refreshStartedAt = time.Now()
+	metrics.lock.Unlock()
+}
+
+func (metrics *Metrics) refreshFinished(pullRequestWrappers []*PullRequestWrapper) {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	metrics.refreshes++
+	metrics.lastRefreshFinishedAt = time.Now()
+	if !metrics.refreshStartedAt.IsZero() {
+		metrics.lastRefreshDuration = metrics.lastRefreshFinishedAt.Sub(metrics.refreshStartedAt)
+	}
+	metrics.pullRequestWrappers = pullRequestWrappers
+}
+
+func (metrics *Metrics) updatePullRequests(pullRequestWrappers []*PullRequestWrapper) {
+	metrics.lock.Lock()
+	metrics.pullRequestWrappers = pullRequestWrappers
+	metrics.lock.Unlock()
+}
+
+// getHeat follows the thresholds of the heat column of the UI
+func getHeat(pullRequestWrapper *PullRequestWrapper) string {
+	switch {
+	case pullRequestWrapper.Score.Total > 75:
+		return "hot"
+	case pullRequestWrapper.Score.Total > 50:
+		return "warm"
+	default:
+		return "cool"
+	}
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+type metricSample struct {
+	labels string
+	value  float64
+}
+
+func writeMetric(writer io.Writer, name string, metricType string, help string, samples []*metricSample) {
+	fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].labels < samples[j].labels
+	})
+	for _, sample := range samples {
+		if sample.labels == "" {
+			fmt.Fprintf(writer, "%s %g\n", name, sample.value)
+		} else {
+			fmt.Fprintf(writer, "%s{%s} %g\n", name, sample.labels, sample.value)
+		}
+	}
+}
+
+func createCountSamples(counts map[string]float64) []*metricSample {
+	samples := make([]*metricSample, 0)
+	for labels, count := range counts {
+		samples = append(samples, &metricSample{labels: labels, value: count})
+	}
+	return samples
+}
+
+// writeExposition writes the metrics in the Prometheus text exposition format
+func (metrics *Metrics) writeExposition(writer io.Writer) {
+
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+
+	pullRequestCounts := make(map[string]float64)
+	heatCounts := map[string]float64{`heat="hot"`: 0, `heat="warm"`: 0, `heat="cool"`: 0}
+	oldestPendingReviewAge := time.Duration(0)
+	unseen := 0.0
+	for _, pullRequestWrapper := range metrics.pullRequestWrappers {
+		pullRequest := pullRequestWrapper.PullRequest
+		pullRequestType := "review"
+		if pullRequestWrapper.Score.IsMyPullRequest {
+			pullRequestType = "own"
+		}
+		labels := fmt.Sprintf(`type="%s",state="%s",repository="%s"`, pullRequestType, getPullRequestState(pullRequestWrapper), escapeLabelValue(pullRequest.Repo.FullName))
+		pullRequestCounts[labels]++
+
+		if pullRequestWrapper.Deleted {
+			continue
+		}
+		heatCounts[fmt.Sprintf(`heat="%s"`, getHeat(pullRequestWrapper))]++
+		if pullRequestType == "review" && !pullRequestWrapper.Score.ApprovedByMe {
+			if age := ReviewRequestAge(pullRequestWrapper); age > oldestPendingReviewAge {
+				oldestPendingReviewAge = age
+			}
+			if !pullRequestWrapper.Seen {
+				unseen++
+			}
+		}
+	}
+
+	writeMetric(writer, "ghmon_pull_requests", "gauge", "Listed pull requests by type, state and repository.", createCountSamples(pullRequestCounts))
+	writeMetric(writer, "ghmon_pull_requests_by_heat", "gauge", "Open listed pull requests by heat (score above 75 is hot, above 50 warm).", createCountSamples(heatCounts))
+	writeMetric(writer, "ghmon_unseen_pending_reviews", "gauge", "Pull requests waiting on a review that have not been looked at.", []*metricSample{{value: unseen}})
+	writeMetric(writer, "ghmon_oldest_pending_review_age_seconds", "gauge", "How long the longest waiting pull request has been waiting on a review.", []*metricSample{{value: oldestPendingReviewAge.Seconds()}})
+
+	apiRequests := make(map[string]float64)
+	apiErrors := make(map[string]float64)
+	for _, kind := range []string{apiKindREST, apiKindGraphQL} {
+		apiRequests[fmt.Sprintf(`kind="%s"`, kind)] = float64(metrics.apiRequests[kind])
+		apiErrors[fmt.Sprintf(`kind="%s"`, kind)] = float64(metrics.apiErrors[kind])
+	}
+	writeMetric(writer, "ghmon_api_requests_total", "counter", "GitHub API requests made through gh.", createCountSamples(apiRequests))
+	writeMetric(writer, "ghmon_api_errors_total", "counter", "GitHub API requests that failed.", createCountSamples(apiErrors))
+
+	writeMetric(writer, "ghmon_refreshes_total", "counter", "Completed refreshes of the pull requests.", []*metricSample{{value: float64(metrics.refreshes)}})
+	writeMetric(writer, "ghmon_refresh_duration_seconds", "gauge", "Duration of the last refresh.", []*metricSample{{value: metrics.lastRefreshDuration.Seconds()}})
+	lastRefresh := 0.0
+	if !metrics.lastRefreshFinishedAt.IsZero() {
+		lastRefresh = float64(metrics.lastRefreshFinishedAt.Unix())
+	}
+	writeMetric(writer, "ghmon_last_refresh_timestamp_seconds", "gauge", "When the last refresh finished.", []*metricSample{{value: lastRefresh}})
+}
+
+func (metrics *Metrics) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.writeExposition(writer)
+}
+
+// serveMetrics serves /metrics on the configured address for as long as the process runs
+func (ghm *GHMon) serveMetrics() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	ghm.logger.Printf("Serving metrics on %s", ghm.configuration.MetricsAddress)
+	if err := http.ListenAndServe(ghm.configuration.MetricsAddress, mux); err != nil {
+		ghm.logger.Printf("Could not serve metrics on %s: %s", ghm.configuration.MetricsAddress, err)
+		ghm.publish(Event{eventType: Status, payload: fmt.Sprintf("Could not serve metrics: %s", err)})
+	}
+}
@@ -0,0 +1,126 @@
+package ghmon
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestMetrics() *Metrics {
+	return &Metrics{apiRequests: make(map[string]uint64), apiErrors: make(map[string]uint64), pullRequestWrappers: make([]*PullRequestWrapper, 0)}
+}
+
+func newMetricsPullRequestWrapper(id uint32, fullName string, score PullRequestScore) *PullRequestWrapper {
+	return &PullRequestWrapper{Id: id, Score: score, FirstSeen: time.Now(), PullRequest: &PullRequest{Id: id, Repo: &Repo{FullName: fullName}}}
+}
+
+func TestMetricsExposition(t *testing.T) {
+
+	testMetrics := newTestMetrics()
+	testMetrics.countAPIRequest(apiKindREST, nil)
+	testMetrics.countAPIRequest(apiKindREST, errors.New("rate limited"))
+	testMetrics.countAPIRequest(apiKindGraphQL, nil)
+
+	waitingLongest := newMetricsPullRequestWrapper(1, "owner/repo", PullRequestScore{Total: 80})
+	waitingLongest.ReviewRequestedAt = time.Now().Add(-time.Hour)
+	seen := newMetricsPullRequestWrapper(2, "owner/repo", PullRequestScore{Total: 60, Comments: 1})
+	seen.Seen = true
+	// Approved by the user, it is not waiting on them any longer
+	approvedByMe := newMetricsPullRequestWrapper(3, `owner/"quoted"`, PullRequestScore{Total: 10, Approvals: 1, ApprovedByMe: true})
+	approvedByMe.FirstSeen = time.Now().Add(-48 * time.Hour)
+	deleted := newMetricsPullRequestWrapper(4, "owner/repo", PullRequestScore{Total: 90})
+	deleted.Deleted = true
+	own := newMetricsPullRequestWrapper(5, "owner/repo", PullRequestScore{Total: 20, IsMyPullRequest: true, ChangesRequested: 1})
+
+	testMetrics.refreshStarted()
+	testMetrics.refreshFinished([]*PullRequestWrapper{waitingLongest, seen, approvedByMe, deleted, own})
+
+	var exposition bytes.Buffer
+	testMetrics.writeExposition(&exposition)
+	lines := strings.Split(exposition.String(), "\n")
+
+	for _, expectedLine := range []string{
+		"# HELP ghmon_pull_requests Listed pull requests by type, state and repository.",
+		"# TYPE ghmon_pull_requests gauge",
+		`ghmon_pull_requests{type="own",state="changes_requested",repository="owner/repo"} 1`,
+		`ghmon_pull_requests{type="review",state="approved",repository="owner/\"quoted\""} 1`,
+		`ghmon_pull_requests{type="review",state="commented",repository="owner/repo"} 1`,
+		`ghmon_pull_requests{type="review",state="deleted",repository="owner/repo"} 1`,
+		`ghmon_pull_requests{type="review",state="pending",repository="owner/repo"} 1`,
+		`ghmon_pull_requests_by_heat{heat="cool"} 2`,
+		`ghmon_pull_requests_by_heat{heat="hot"} 1`,
+		`ghmon_pull_requests_by_heat{heat="warm"} 1`,
+		"ghmon_unseen_pending_reviews 1",
+		`ghmon_api_requests_total{kind="graphql"} 1`,
+		`ghmon_api_requests_total{kind="rest"} 2`,
+		`ghmon_api_errors_total{kind="graphql"} 0`,
+		`ghmon_api_errors_total{kind="rest"} 1`,
+		"# TYPE ghmon_refreshes_total counter",
+		"ghmon_refreshes_total 1",
+	} {
+		if !containsLine(lines, expectedLine) {
+			t.Errorf("missing %q in\n%s", expectedLine, exposition.String())
+		}
+	}
+
+	// Only the pull requests still waiting on the user count, whichever was seen first
+	age := metricValue(t, lines, "ghmon_oldest_pending_review_age_seconds")
+	if age < time.Hour.Seconds() || age > time.Hour.Seconds()+60 {
+		t.Errorf("oldest pending review is %.0f seconds old, expected an hour", age)
+	}
+	if lastRefresh := metricValue(t, lines, "ghmon_last_refresh_timestamp_seconds"); time.Since(time.Unix(int64(lastRefresh), 0)) > time.Minute {
+		t.Errorf("last refresh at %.0f, expected now", lastRefresh)
+	}
+}
+
+func TestMetricsBeforeTheFirstRefresh(t *testing.T) {
+
+	recorder := httptest.NewRecorder()
+	newTestMetrics().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("content type %s, expected the text exposition format", contentType)
+	}
+	lines := strings.Split(recorder.Body.String(), "\n")
+	for _, expectedLine := range []string{
+		`ghmon_pull_requests_by_heat{heat="hot"} 0`,
+		"ghmon_unseen_pending_reviews 0",
+		"ghmon_oldest_pending_review_age_seconds 0",
+		`ghmon_api_requests_total{kind="rest"} 0`,
+		"ghmon_refreshes_total 0",
+		"ghmon_last_refresh_timestamp_seconds 0",
+	} {
+		if !containsLine(lines, expectedLine) {
+			t.Errorf("missing %q in\n%s", expectedLine, recorder.Body.String())
+		}
+	}
+}
+
+func containsLine(lines []string, expectedLine string) bool {
+	for _, line := range lines {
+		if line == expectedLine {
+			return true
+		}
+	}
+	return false
+}
+
+// metricValue gives the value of a metric without labels
+func metricValue(t *testing.T, lines []string, name string) float64 {
+	t.Helper()
+	for _, line := range lines {
+		if strings.HasPrefix(line, name+" ") {
+			value, err := strconv.ParseFloat(strings.TrimPrefix(line, name+" "), 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return value
+		}
+	}
+	t.Fatalf("no %s", name)
+	return 0
+}
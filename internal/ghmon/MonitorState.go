@@ -0,0 +1,341 @@
+package ghmon
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// monitorState is what the monitor knows.  It belongs to the goroutine running runMonitorState, everything else
+// reaches it through withState.  Pull request wrappers are never changed once handed out: a change is made to a copy
+// that takes the place of the wrapper, so the UI and the daemon read what they were given without locking.
+type monitorState struct {
+	user                *User
+	pullRequestWrappers map[uint32]*PullRequestWrapper
+	/* Keyed by the API URL of the repository */
+	repos map[string]*Repo
+	/* Cancels the refresh running, nil while none is */
+	cancelRefresh context.CancelFunc
+	/* Closed once the last refresh started has finished */
+	refreshFinished chan struct{}
+	/* Events waiting for whoever reads the events of the monitor, in the order they happened */
+	pendingEvents []Event
+	/* Writes waiting for the store writer, in the order they were queued */
+	pendingStoreWrites []func()
+	/* Pull requests returned by GitHub during the current refresh */
+	retrievedPullRequestIds map[uint32]bool
+	/* What the current refresh changed, stored in one batch when it finishes; nil while no refresh runs */
+	refreshWrites *refreshWrites
+	/* Keyed by the full name of the repository */
+	reviewerCandidates map[string]*ReviewerCandidates
+}
+
+// refreshWrites collects what a refresh changed, so that the store writes it at once rather than one pull request at a
+// time
+type refreshWrites struct {
+	/* The last version of each pull request replaced */
+	pullRequestWrappers map[uint32]*PullRequestWrapper
+	/* The versions retrieved from GitHub, in order, each one compared to the history before it */
+	retrievedPullRequests []retrievedPullRequest
+}
+
+type retrievedPullRequest struct {
+	user               *User
+	pullRequestWrapper *PullRequestWrapper
+}
+
+type stateCommand struct {
+	run  func(state *monitorState)
+	done chan struct{}
+}
+
+// runMonitorState runs the commands sent to the state one at a time and hands out the events and store writes they
+// queue.  Queueing them keeps a slow reader of the events, or a slow store, from holding up the commands.
+func (ghm *GHMon) runMonitorState() {
+
+	state := &monitorState{
+		pullRequestWrappers:     make(map[uint32]*PullRequestWrapper),
+		repos:                   make(map[string]*Repo),
+		pendingEvents:           make([]Event, 0),
+		pendingStoreWrites:      make([]func(), 0),
+		retrievedPullRequestIds: make(map[uint32]bool),
+		reviewerCandidates:      make(map[string]*ReviewerCandidates),
+	}
+
+	for {
+		// A nil channel is never ready, so nothing is sent until there is an event
+		var events chan Event
+		var event Event
+		if len(state.pendingEvents) > 0 {
+			events = ghm.events
+			event = state.pendingEvents[0]
+		}
+		var storeWrites chan func()
+		var storeWrite func()
+		if len(state.pendingStoreWrites) > 0 {
+			storeWrites = ghm.storeWrites
+			storeWrite = state.pendingStoreWrites[0]
+		}
+
+		select {
+		case command := <-ghm.stateCommands:
+			command.run(state)
+			close(command.done)
+		case events <- event:
+			state.pendingEvents = state.pendingEvents[1:]
+		case storeWrites <- storeWrite:
+			state.pendingStoreWrites = state.pendingStoreWrites[1:]
+		}
+	}
+}
+
+// runStoreWriter writes to the store in the order the writes were queued.  Pull requests and histories are only
+// written here, so a history is never read and written back by two goroutines at once.
+func (ghm *GHMon) runStoreWriter() {
+	for storeWrite := range ghm.storeWrites {
+		storeWrite()
+	}
+}
+
+// withState runs the function on the goroutine owning the state and waits for it.  The function must not call
+// withState itself, or anything that does.
+func (ghm *GHMon) withState(run func(state *monitorState)) {
+	command := &stateCommand{run: run, done: make(chan struct{})}
+	ghm.stateCommands <- command
+	<-command.done
+}
+
+func (state *monitorState) publish(event Event) {
+	state.pendingEvents = append(state.pendingEvents, event)
+}
+
+// publish queues an event from outside the state
+func (ghm *GHMon) publish(event Event) {
+	ghm.withState(func(state *monitorState) {
+		state.publish(event)
+	})
+}
+
+// queueStoreWrite has the store writer run the write once the writes queued before it are done
+func (state *monitorState) queueStoreWrite(storeWrite func()) {
+	state.pendingStoreWrites = append(state.pendingStoreWrites, storeWrite)
+}
+
+// writeStore has the store writer run the write and waits for it, the writes queued before it are done by then.  It
+// must not be called from the state or from a store write.
+func (ghm *GHMon) writeStore(storeWrite func()) {
+	written := make(chan struct{})
+	ghm.withState(func(state *monitorState) {
+		state.queueStoreWrite(func() {
+			storeWrite()
+			close(written)
+		})
+	})
+	<-written
+}
+
+// currentUser is the user once retrieved, nil until then
+func (ghm *GHMon) currentUser() *User {
+	var user *User
+	ghm.withState(func(state *monitorState) {
+		user = state.user
+	})
+	return user
+}
+
+func (ghm *GHMon) setUser(user *User) {
+	ghm.withState(func(state *monitorState) {
+		state.user = user
+	})
+}
+
+// GetPullRequestWrapper returns the current version of a known pull request, nil if it is not known
+func (ghm *GHMon) GetPullRequestWrapper(pullRequestId uint32) *PullRequestWrapper {
+	var pullRequestWrapper *PullRequestWrapper
+	ghm.withState(func(state *monitorState) {
+		pullRequestWrapper = state.pullRequestWrappers[pullRequestId]
+	})
+	return pullRequestWrapper
+}
+
+// GetPullRequestWrappers returns all known pull requests sorted by score, hidden, snoozed and filtered out ones included
+func (ghm *GHMon) GetPullRequestWrappers() []*PullRequestWrapper {
+	var pullRequestWrappers []*PullRequestWrapper
+	ghm.withState(func(state *monitorState) {
+		pullRequestWrappers = ghm.sortPullRequestWrappers(state.pullRequestWrappers)
+	})
+	return pullRequestWrappers
+}
+
+// scorePullRequestWrapper scores the pull request for the user, the score it has is kept until the user is known
+func (ghm *GHMon) scorePullRequestWrapper(state *monitorState, pullRequestWrapper *PullRequestWrapper) {
+	if state.user != nil {
+		pullRequestWrapper.Score = ghm.scoreCalculator.CalculateScore(state.user, pullRequestWrapper)
+	}
+}
+
+// replacePullRequestWrapper scores and stores a new version of a pull request and hands it out in place of the
+// previous one
+func (ghm *GHMon) replacePullRequestWrapper(state *monitorState, pullRequestWrapper *PullRequestWrapper) {
+	ghm.scorePullRequestWrapper(state, pullRequestWrapper)
+	// Never changed once handed out, so the store writer can read it later
+	if state.refreshWrites != nil {
+		state.refreshWrites.pullRequestWrappers[pullRequestWrapper.Id] = pullRequestWrapper
+	} else {
+		state.queueStoreWrite(func() {
+			ghm.store.StorePullRequestWrapper(pullRequestWrapper)
+		})
+	}
+	state.pullRequestWrappers[pullRequestWrapper.Id] = pullRequestWrapper
+	state.publish(Event{eventType: PullRequestUpdated, payload: pullRequestWrapper})
+}
+
+// changePullRequestWrapper applies the change to a copy of the current version of the pull request, which replaces
+// it.  The given wrapper is used when the pull request is not known.  Returns the new version.
+func (ghm *GHMon) changePullRequestWrapper(pullRequestWrapper *PullRequestWrapper, change func(pullRequestWrapper *PullRequestWrapper)) *PullRequestWrapper {
+	var changedPullRequestWrapper PullRequestWrapper
+	ghm.withState(func(state *monitorState) {
+		if currentPullRequestWrapper, ok := state.pullRequestWrappers[pullRequestWrapper.Id]; ok {
+			pullRequestWrapper = currentPullRequestWrapper
+		}
+		changedPullRequestWrapper = *pullRequestWrapper
+		change(&changedPullRequestWrapper)
+		ghm.replacePullRequestWrapper(state, &changedPullRequestWrapper)
+	})
+	return &changedPullRequestWrapper
+}
+
+// updatePullRequest takes a pull request retrieved from GitHub, keeping what the user set on the version known
+func (ghm *GHMon) updatePullRequest(pullRequest *PullRequest) {
+
+	// Loaded before taking the state, the state does not wait on the store
+	var storedPullRequestWrapper *PullRequestWrapper
+	if ghm.GetPullRequestWrapper(pullRequest.Id) == nil {
+		storedPullRequestWrapper = ghm.loadStoredPullRequestWrapper(pullRequest.Id)
+	}
+
+	ghm.withState(func(state *monitorState) {
+		currentPullRequestWrapper, ok := state.pullRequestWrappers[pullRequest.Id]
+		if !ok {
+			currentPullRequestWrapper = storedPullRequestWrapper
+		}
+		pullRequestWrapper := ghm.mergePullRequestWrappers(pullRequest, currentPullRequestWrapper)
+		if state.user != nil && pullRequestWrapper.ReviewRequestedAt.IsZero() {
+			for _, pullRequestReview := range pullRequest.PullRequestReviewsByUser[state.user.Id] {
+				if pullRequestReview.Status == PullRequestReviewStatusRequested {
+					pullRequestWrapper.ReviewRequestedAt = time.Now()
+					break
+				}
+			}
+		}
+		ghm.replacePullRequestWrapper(state, pullRequestWrapper)
+		user := state.user
+		if state.refreshWrites != nil {
+			state.refreshWrites.retrievedPullRequests = append(state.refreshWrites.retrievedPullRequests, retrievedPullRequest{user: user, pullRequestWrapper: pullRequestWrapper})
+			return
+		}
+		state.queueStoreWrite(func() {
+			ghm.recordPullRequestHistory(ghm.store, user, pullRequestWrapper)
+		})
+	})
+}
+
+// markPullRequestDeleted marks a pull request GitHub does not return anymore as deleted
+func (ghm *GHMon) markPullRequestDeleted(storedPullRequestWrapper *PullRequestWrapper) {
+	ghm.withState(func(state *monitorState) {
+		deletedPullRequestWrapper := *storedPullRequestWrapper
+		if currentPullRequestWrapper, ok := state.pullRequestWrappers[storedPullRequestWrapper.Id]; ok {
+			deletedPullRequestWrapper = *currentPullRequestWrapper
+		}
+		deletedPullRequestWrapper.Deleted = true
+		// Stored too, so it is found by state and can be purged from another process
+		ghm.replacePullRequestWrapper(state, &deletedPullRequestWrapper)
+	})
+}
+
+// startRefresh starts a refresh unless one is running already, the context returned is cancelled when the monitor stops
+func (ghm *GHMon) startRefresh() (context.Context, bool) {
+	var refreshContext context.Context
+	ghm.withState(func(state *monitorState) {
+		if state.cancelRefresh != nil {
+			state.publish(Event{eventType: Status, payload: "refresh already running"})
+			return
+		}
+		refreshContext, state.cancelRefresh = context.WithCancel(ghm.context)
+		state.refreshFinished = make(chan struct{})
+		state.retrievedPullRequestIds = make(map[uint32]bool)
+		state.refreshWrites = &refreshWrites{pullRequestWrappers: make(map[uint32]*PullRequestWrapper)}
+	})
+	return refreshContext, refreshContext != nil
+}
+
+// finishRefresh sends out the refreshed list of pull requests, letting the next refresh start.  The error tells why
+// the refresh did not retrieve everything, nil when it did.
+func (ghm *GHMon) finishRefresh(refreshError error) {
+	// What the refresh retrieved is written out before anyone is told it finished, the changes made from now on are
+	// queued after it
+	written := make(chan struct{})
+	ghm.withState(func(state *monitorState) {
+		writes := state.refreshWrites
+		state.refreshWrites = nil
+		state.queueStoreWrite(func() {
+			ghm.storeRefreshWrites(writes)
+			close(written)
+		})
+	})
+	<-written
+	ghm.withState(func(state *monitorState) {
+		state.cancelRefresh()
+		state.cancelRefresh = nil
+		close(state.refreshFinished)
+		if ghm.context.Err() != nil {
+			// Stopped, whoever reads the events is going away
+			return
+		}
+		sortedPullRequestWrappers := ghm.filterPullRequestWrappers(ghm.sortPullRequestWrappers(state.pullRequestWrappers))
+		metrics.refreshFinished(sortedPullRequestWrappers)
+		state.publish(Event{eventType: PullRequestsUpdates, payload: PullRequestsUpdatesEvent{pullRequestType: Reviewer, pullRequestWrappers: sortedPullRequestWrappers, refreshError: refreshError}})
+		if refreshError != nil {
+			state.publish(Event{eventType: Status, payload: fmt.Sprintf("Could not retrieve all pull requests: %s", refreshError)})
+		} else if ghm.storeLockError != nil {
+			// Nothing was stored, the other instance keeps the cache
+			state.publish(Event{eventType: Status, payload: fmt.Sprintf("idle, read-only: %s", ghm.storeLockError)})
+		} else {
+			state.publish(Event{eventType: Status, payload: "idle"})
+		}
+	})
+}
+
+// storeRefreshWrites stores what a refresh changed in one batch, along with the histories of the pull requests it
+// retrieved.  Nothing is stored while another process writes to the store.
+func (ghm *GHMon) storeRefreshWrites(writes *refreshWrites) {
+
+	if ghm.storeLock == nil || (len(writes.pullRequestWrappers) == 0 && len(writes.retrievedPullRequests) == 0) {
+		return
+	}
+
+	pullRequestWrappers := make([]*PullRequestWrapper, 0, len(writes.pullRequestWrappers))
+	for _, pullRequestWrapper := range writes.pullRequestWrappers {
+		pullRequestWrappers = append(pullRequestWrappers, pullRequestWrapper)
+	}
+	err := ghm.store.Batch(func(batch StoreBatch) error {
+		if err := batch.StorePullRequestWrappers(pullRequestWrappers); err != nil {
+			return err
+		}
+		for _, retrieved := range writes.retrievedPullRequests {
+			ghm.recordPullRequestHistory(batch, retrieved.user, retrieved.pullRequestWrapper)
+		}
+		return nil
+	})
+	if err != nil {
+		ghm.logger.Printf("Could not store the %d pull requests refreshed: %s", len(pullRequestWrappers), err)
+	}
+}
+
+// publishPullRequests sorts and filters the known pull requests again and sends the new list out
+func (ghm *GHMon) publishPullRequests(state *monitorState) []*PullRequestWrapper {
+	sortedPullRequestWrappers := ghm.filterPullRequestWrappers(ghm.sortPullRequestWrappers(state.pullRequestWrappers))
+	metrics.updatePullRequests(sortedPullRequestWrappers)
+	state.publish(Event{eventType: PullRequestsUpdates, payload: PullRequestsUpdatesEvent{pullRequestType: Reviewer, pullRequestWrappers: sortedPullRequestWrappers}})
+	return sortedPullRequestWrappers
+}
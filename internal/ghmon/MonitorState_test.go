@@ -0,0 +1,243 @@
+package ghmon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sync"
+	"testing"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// These are meant to be run with -race, the state, the store writer and the events are used from many goroutines
+
+const pullRequestsChanged = 20
+
+func newTestMonitor(t *testing.T) *GHMon {
+	t.Helper()
+	store, configPath := newTestStore(t, storageBolt)
+	configuration := &Configuration{}
+	if err := envconfig.Process("ghmon", configuration); err != nil {
+		t.Fatal(err)
+	}
+	ghm := newGHMon(configuration, configPath, store, log.New(ioutil.Discard, "", 0))
+	if err := ghm.LockStore(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ghm.Stop()
+		ghm.storeLock.Release()
+	})
+	ghm.setUser(&User{Id: 10, Username: "me"})
+	return ghm
+}
+
+// recordEvents reads the events as the UI does, until the given status
+func recordEvents(ghm *GHMon, lastStatus string) <-chan []Event {
+	recorded := make(chan []Event, 1)
+	go func() {
+		events := make([]Event, 0)
+		for event := range ghm.events {
+			if event.eventType == Status && event.payload == lastStatus {
+				recorded <- events
+				return
+			}
+			events = append(events, event)
+		}
+	}()
+	return recorded
+}
+
+// newRetrievedPullRequest is the pull request of the fixture as retrieved from GitHub under another id and title
+func newRetrievedPullRequest(t *testing.T, pullRequestId uint32, title string) *PullRequest {
+	t.Helper()
+	pullRequestWrapper, err := decodePullRequestWrapper(loadFixture(t, "pull-request-v2.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pullRequest := copyPullRequest(pullRequestWrapper.PullRequest)
+	pullRequest.Id = pullRequestId
+	pullRequest.Title = title
+	return pullRequest
+}
+
+func TestMonitorStateKeepsTheOrderOfConcurrentChanges(t *testing.T) {
+
+	ghm := newTestMonitor(t)
+	recorded := recordEvents(ghm, "done")
+
+	const rounds = 5
+	pullRequests := make(map[uint32][]*PullRequest)
+	for pullRequestId := uint32(1); pullRequestId <= pullRequestsChanged; pullRequestId++ {
+		for round := 0; round < rounds; round++ {
+			pullRequests[pullRequestId] = append(pullRequests[pullRequestId], newRetrievedPullRequest(t, pullRequestId, fmt.Sprintf("round %d", round)))
+		}
+	}
+
+	var waitGroup sync.WaitGroup
+	for pullRequestId := uint32(1); pullRequestId <= pullRequestsChanged; pullRequestId++ {
+		waitGroup.Add(1)
+		go func(pullRequestId uint32) {
+			defer waitGroup.Done()
+			for round, pullRequest := range pullRequests[pullRequestId] {
+				ghm.updatePullRequest(pullRequest)
+				ghm.UpdateSeen(ghm.GetPullRequestWrapper(pullRequestId), round%2 == 0)
+			}
+		}(pullRequestId)
+	}
+
+	// Read and published alongside, as the UI and the refresh do
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+		for i := 0; i < 100; i++ {
+			for _, pullRequestWrapper := range ghm.GetPullRequestWrappers() {
+				_ = pullRequestWrapper.PullRequest.Title
+			}
+			ghm.publish(Event{eventType: Status, payload: fmt.Sprintf("status %d", i)})
+		}
+	}()
+
+	waitGroup.Wait()
+	ghm.writeStore(func() {})
+	ghm.publish(Event{eventType: Status, payload: "done"})
+	events := <-recorded
+
+	lastUpdates := make(map[uint32]*PullRequestWrapper)
+	statuses := 0
+	for _, event := range events {
+		switch event.eventType {
+		case PullRequestUpdated:
+			pullRequestWrapper := event.payload.(*PullRequestWrapper)
+			lastUpdates[pullRequestWrapper.Id] = pullRequestWrapper
+		case Status:
+			if event.payload == fmt.Sprintf("status %d", statuses) {
+				statuses++
+			}
+		}
+	}
+	if statuses != 100 {
+		t.Errorf("only %d of the statuses came in the order they were published", statuses)
+	}
+
+	for pullRequestId := uint32(1); pullRequestId <= pullRequestsChanged; pullRequestId++ {
+
+		pullRequestWrapper := ghm.GetPullRequestWrapper(pullRequestId)
+		if pullRequestWrapper == nil || pullRequestWrapper.PullRequest.Title != "round 4" || !pullRequestWrapper.Seen {
+			t.Fatalf("%d: unexpected state %+v", pullRequestId, pullRequestWrapper)
+		}
+		if lastUpdates[pullRequestId] != pullRequestWrapper {
+			t.Errorf("%d: the last update sent out is not the current version", pullRequestId)
+		}
+
+		storedPullRequestWrapper, err := ghm.store.LoadPullRequestWrapper(pullRequestId)
+		if err != nil || storedPullRequestWrapper == nil || storedPullRequestWrapper.PullRequest.Title != "round 4" || !storedPullRequestWrapper.Seen {
+			t.Errorf("%d: stored out of order %+v (%v)", pullRequestId, storedPullRequestWrapper, err)
+		}
+
+		// Each history update saw the one before it
+		history, err := ghm.store.LoadPullRequestHistory(pullRequestId)
+		if err != nil || history == nil {
+			t.Fatalf("%d: no history (%v)", pullRequestId, err)
+		}
+		renames := make([]string, 0)
+		for _, event := range history.Events {
+			if event.Kind == HistoryEventRenamed {
+				renames = append(renames, event.Details)
+			}
+		}
+		if fmt.Sprint(renames) != `[from "round 0" from "round 1" from "round 2" from "round 3"]` {
+			t.Errorf("%d: renamed %v", pullRequestId, renames)
+		}
+	}
+}
+
+func TestPurgeKeepsThePullRequestsRetrievedMeanwhile(t *testing.T) {
+
+	ghm := newTestMonitor(t)
+	recorded := recordEvents(ghm, "done")
+
+	for pullRequestId := uint32(1); pullRequestId <= pullRequestsChanged; pullRequestId++ {
+		ghm.updatePullRequest(newRetrievedPullRequest(t, pullRequestId, "retrieved"))
+		ghm.markPullRequestDeleted(ghm.GetPullRequestWrapper(pullRequestId))
+	}
+
+	// Half of them come back while the others are purged
+	retrievedAgain := make([]*PullRequest, 0)
+	for pullRequestId := uint32(1); pullRequestId <= pullRequestsChanged; pullRequestId += 2 {
+		retrievedAgain = append(retrievedAgain, newRetrievedPullRequest(t, pullRequestId, "retrieved again"))
+	}
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(2)
+	go func() {
+		defer waitGroup.Done()
+		for _, pullRequest := range retrievedAgain {
+			ghm.updatePullRequest(pullRequest)
+		}
+	}()
+	go func() {
+		defer waitGroup.Done()
+		ghm.PurgeDeletedPullRequests()
+	}()
+	waitGroup.Wait()
+
+	// Whatever the first purge left is purged now
+	ghm.PurgeDeletedPullRequests()
+	ghm.writeStore(func() {})
+	ghm.publish(Event{eventType: Status, payload: "done"})
+	<-recorded
+
+	for pullRequestId := uint32(1); pullRequestId <= pullRequestsChanged; pullRequestId++ {
+		pullRequestWrapper := ghm.GetPullRequestWrapper(pullRequestId)
+		storedPullRequestWrapper, err := ghm.store.LoadPullRequestWrapper(pullRequestId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pullRequestId%2 == 1 {
+			if pullRequestWrapper == nil || pullRequestWrapper.Deleted || storedPullRequestWrapper == nil || storedPullRequestWrapper.Deleted {
+				t.Errorf("%d: retrieved again but known as %+v and stored as %+v", pullRequestId, pullRequestWrapper, storedPullRequestWrapper)
+			}
+		} else if pullRequestWrapper != nil || storedPullRequestWrapper != nil {
+			t.Errorf("%d: purged but known as %+v and stored as %+v", pullRequestId, pullRequestWrapper, storedPullRequestWrapper)
+		}
+	}
+}
+
+func TestRefreshStoresWhatItRetrievedWhenItFinishes(t *testing.T) {
+
+	ghm := newTestMonitor(t)
+	if _, started := ghm.startRefresh(); !started {
+		t.Fatal("the refresh did not start")
+	}
+
+	for pullRequestId := uint32(1); pullRequestId <= pullRequestsChanged; pullRequestId++ {
+		ghm.updatePullRequest(newRetrievedPullRequest(t, pullRequestId, "retrieved"))
+	}
+	ghm.UpdateSeen(ghm.GetPullRequestWrapper(1), true)
+	ghm.writeStore(func() {})
+
+	// Nothing is written one pull request at a time while the refresh runs
+	if storedPullRequestWrappers, err := ghm.store.LoadPullRequestWrappers(); err != nil || len(storedPullRequestWrappers) != 0 {
+		t.Fatalf("stored %d pull requests before the refresh finished (%v)", len(storedPullRequestWrappers), err)
+	}
+
+	ghm.finishRefresh(nil)
+
+	for pullRequestId := uint32(1); pullRequestId <= pullRequestsChanged; pullRequestId++ {
+		storedPullRequestWrapper, err := ghm.store.LoadPullRequestWrapper(pullRequestId)
+		if err != nil || storedPullRequestWrapper == nil || storedPullRequestWrapper.Seen != (pullRequestId == 1) {
+			t.Errorf("%d: stored %+v (%v)", pullRequestId, storedPullRequestWrapper, err)
+		}
+		if history, err := ghm.store.LoadPullRequestHistory(pullRequestId); err != nil || history == nil {
+			t.Errorf("%d: no history (%v)", pullRequestId, err)
+		}
+	}
+
+	// Changes made after the refresh are written straight away again
+	ghm.UpdateSeen(ghm.GetPullRequestWrapper(2), true)
+	ghm.writeStore(func() {})
+	if storedPullRequestWrapper, err := ghm.store.LoadPullRequestWrapper(2); err != nil || storedPullRequestWrapper == nil || !storedPullRequestWrapper.Seen {
+		t.Errorf("the change made after the refresh was not stored: %+v (%v)", storedPullRequestWrapper, err)
+	}
+}
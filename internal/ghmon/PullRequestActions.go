@@ -0,0 +1,350 @@
+package ghmon
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ConvertPullRequestReviewStateToEvent gives the event name the GitHub API expects when submitting a review
+func ConvertPullRequestReviewStateToEvent(pullRequestReviewStatus PullRequestReviewStatus) (string, error) {
+	switch pullRequestReviewStatus {
+	case PullRequestReviewStatusApproved:
+		return "APPROVE", nil
+	case PullRequestReviewStatusChangesRequested:
+		return "REQUEST_CHANGES", nil
+	case PullRequestReviewStatusCommented:
+		return "COMMENT", nil
+	default:
+		return "", fmt.Errorf("cannot submit a review with state %d", pullRequestReviewStatus)
+	}
+}
+
+// IsOwnPullRequest reports whether the pull request was created by the current user
+func (ghm *GHMon) IsOwnPullRequest(pullRequestWrapper *PullRequestWrapper) bool {
+	user := ghm.currentUser()
+	return user != nil && pullRequestWrapper.PullRequest.Creator != nil && pullRequestWrapper.PullRequest.Creator.Id == user.Id
+}
+
+// SubmitPullRequestReview posts a review as the current user.  The review is added to the pull request straight away
+// so that the UI reflects it, it is rolled back if GitHub rejects it and otherwise the pull request is refreshed.
+func (ghm *GHMon) SubmitPullRequestReview(pullRequestWrapper *PullRequestWrapper, pullRequestReviewStatus PullRequestReviewStatus, body string) error {
+
+	event, err := ConvertPullRequestReviewStateToEvent(pullRequestReviewStatus)
+	if err != nil {
+		return err
+	}
+	if body == "" && pullRequestReviewStatus != PullRequestReviewStatusApproved {
+		return fmt.Errorf("a comment is required to %s", ghm.ConvertPullRequestReviewStateToString(pullRequestReviewStatus))
+	}
+
+	user := ghm.RetrieveUser()
+	if user == nil {
+		// Not logged in yet, stopped, or the daemon attached to cannot be reached
+		return fmt.Errorf("the logged in user is not known yet")
+	}
+	pullRequest := pullRequestWrapper.PullRequest
+	pullRequestReview := &PullRequestReview{
+		User: user, Status: pullRequestReviewStatus, SubmittedAt: time.Now(),
+		Score: float32(ghm.scoreCalculator.PullRequestReviewStatusToInt(pullRequestReviewStatus)),
+	}
+
+	// The reviews of the user are swapped on copies of the pull request, the UI may still show the previous one
+	changePullRequestReviews := func(changePullRequestReviews func(pullRequest *PullRequest)) {
+		ghm.changePullRequestWrapper(pullRequestWrapper, func(pullRequestWrapper *PullRequestWrapper) {
+			pullRequestWrapper.PullRequest = copyPullRequest(pullRequestWrapper.PullRequest)
+			changePullRequestReviews(pullRequestWrapper.PullRequest)
+			ghm.sortPullRequestReviewers(pullRequestWrapper.PullRequest)
+		})
+	}
+
+	var previousPullRequestReviews []*PullRequestReview
+	var hadPullRequestReviews bool
+	changePullRequestReviews(func(pullRequest *PullRequest) {
+		previousPullRequestReviews, hadPullRequestReviews = pullRequest.PullRequestReviewsByUser[user.Id]
+		pullRequestReviews := make([]*PullRequestReview, 0, len(previousPullRequestReviews)+1)
+		pullRequestReviews = append(pullRequestReviews, previousPullRequestReviews...)
+		pullRequest.PullRequestReviewsByUser[user.Id] = append(pullRequestReviews, pullRequestReview)
+	})
+
+	ghm.logger.Printf("Submitting %s review for %d", event, pullRequest.Id)
+	_, err = runAPIRequest(ghm.context, pullRequest.PullRequestURL.Path+"/reviews", "--method", "POST", "-f", "event="+event, "-f", "body="+body)
+	if err != nil {
+		ghm.logger.Printf("Could not submit review for %d: %s", pullRequest.Id, err)
+
+		changePullRequestReviews(func(pullRequest *PullRequest) {
+			if hadPullRequestReviews {
+				pullRequest.PullRequestReviewsByUser[user.Id] = previousPullRequestReviews
+			} else {
+				delete(pullRequest.PullRequestReviewsByUser, user.Id)
+			}
+		})
+		return err
+	}
+
+	go ghm.RefreshPullRequest(pullRequestWrapper)
+	return nil
+}
+
+// RefreshPullRequest retrieves the details and reviews of a single pull request again
+func (ghm *GHMon) RefreshPullRequest(pullRequestWrapper *PullRequestWrapper) {
+	pullRequest := copyPullRequest(pullRequestWrapper.PullRequest)
+	if err := ghm.addPullRequestReviewers(ghm.context, pullRequest); err == nil {
+		ghm.updatePullRequest(pullRequest)
+	} else if ghm.context.Err() == nil {
+		ghm.reportStatus("Could not refresh %s: %s", pullRequest.Title, err)
+	}
+	if ghm.daemonClient != nil {
+		// The daemon refreshes its copy as well so that its other frontends see the change
+		go func() {
+			if err := ghm.daemonClient.RefreshPullRequest(pullRequestWrapper.Id); err != nil {
+				ghm.logger.Printf("Could not ask the daemon to refresh %d: %s", pullRequestWrapper.Id, err)
+			}
+		}()
+	}
+}
+
+type MergeMethod int
+
+const (
+	MergeMethodMerge MergeMethod = iota
+	MergeMethodSquash
+	MergeMethodRebase
+)
+
+func ConvertMergeMethodToString(mergeMethod MergeMethod) string {
+	switch mergeMethod {
+	case MergeMethodSquash:
+		return "squash"
+	case MergeMethodRebase:
+		return "rebase"
+	default:
+		return "merge"
+	}
+}
+
+// AllowedMergeMethods lists the merge methods enabled in the repository settings
+func (repo *Repo) AllowedMergeMethods() []MergeMethod {
+	mergeMethods := make([]MergeMethod, 0)
+	if repo.AllowMergeCommit {
+		mergeMethods = append(mergeMethods, MergeMethodMerge)
+	}
+	if repo.AllowSquashMerge {
+		mergeMethods = append(mergeMethods, MergeMethodSquash)
+	}
+	if repo.AllowRebaseMerge {
+		mergeMethods = append(mergeMethods, MergeMethodRebase)
+	}
+	return mergeMethods
+}
+
+const enableAutoMergeMutation = `mutation($pullRequestId: ID!, $mergeMethod: PullRequestMergeMethod!) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $pullRequestId, mergeMethod: $mergeMethod}) { clientMutationId }
+}`
+
+const markReadyForReviewMutation = `mutation($pullRequestId: ID!) {
+  markPullRequestReadyForReview(input: {pullRequestId: $pullRequestId}) { clientMutationId }
+}`
+
+// MergePullRequest merges the pull request with the given method.  The head commit is passed along so that GitHub
+// refuses the merge if something was pushed since the pull request was last retrieved.
+func (ghm *GHMon) MergePullRequest(pullRequestWrapper *PullRequestWrapper, mergeMethod MergeMethod) error {
+
+	pullRequest := pullRequestWrapper.PullRequest
+	arguments := []string{pullRequest.PullRequestURL.Path + "/merge", "--method", "PUT", "-f", "merge_method=" + ConvertMergeMethodToString(mergeMethod)}
+	if pullRequest.HeadSHA != "" {
+		arguments = append(arguments, "-f", "sha="+pullRequest.HeadSHA)
+	}
+
+	ghm.logger.Printf("Merging %d using %s", pullRequest.Id, ConvertMergeMethodToString(mergeMethod))
+	if _, err := runAPIRequest(ghm.context, arguments...); err != nil {
+		return err
+	}
+
+	go ghm.RetrievePullRequests()
+	return nil
+}
+
+// EnableAutoMerge has GitHub merge the pull request once all requirements (reviews, checks) are met
+func (ghm *GHMon) EnableAutoMerge(pullRequestWrapper *PullRequestWrapper, mergeMethod MergeMethod) error {
+
+	pullRequest := pullRequestWrapper.PullRequest
+	if pullRequest.NodeId == "" {
+		return fmt.Errorf("pull request details have not been retrieved yet")
+	}
+
+	ghm.logger.Printf("Enabling auto-merge for %d using %s", pullRequest.Id, ConvertMergeMethodToString(mergeMethod))
+	_, err := runGraphQLRequest(ghm.context, enableAutoMergeMutation, "pullRequestId="+pullRequest.NodeId, "mergeMethod="+strings.ToUpper(ConvertMergeMethodToString(mergeMethod)))
+	if err != nil {
+		return err
+	}
+
+	go ghm.RefreshPullRequest(pullRequestWrapper)
+	return nil
+}
+
+// MarkPullRequestReady converts a draft pull request to ready for review
+func (ghm *GHMon) MarkPullRequestReady(pullRequestWrapper *PullRequestWrapper) error {
+
+	pullRequest := pullRequestWrapper.PullRequest
+	if pullRequest.NodeId == "" {
+		return fmt.Errorf("pull request details have not been retrieved yet")
+	}
+
+	ghm.logger.Printf("Marking %d ready for review", pullRequest.Id)
+	if _, err := runGraphQLRequest(ghm.context, markReadyForReviewMutation, "pullRequestId="+pullRequest.NodeId); err != nil {
+		return err
+	}
+
+	go ghm.RefreshPullRequest(pullRequestWrapper)
+	return nil
+}
+
+func (ghm *GHMon) ClosePullRequest(pullRequestWrapper *PullRequestWrapper) error {
+
+	pullRequest := pullRequestWrapper.PullRequest
+
+	ghm.logger.Printf("Closing %d", pullRequest.Id)
+	if _, err := runAPIRequest(ghm.context, pullRequest.PullRequestURL.Path, "--method", "PATCH", "-f", "state=closed"); err != nil {
+		return err
+	}
+
+	go ghm.RetrievePullRequests()
+	return nil
+}
+
+// DeletePullRequestBranch deletes the head branch of the pull request, which may live in a fork
+func (ghm *GHMon) DeletePullRequestBranch(pullRequestWrapper *PullRequestWrapper) error {
+
+	pullRequest := pullRequestWrapper.PullRequest
+	if pullRequest.HeadRef == "" || pullRequest.HeadRepoFullName == "" {
+		return fmt.Errorf("the branch of the pull request is not known (it may have been deleted already)")
+	}
+
+	ghm.logger.Printf("Deleting branch %s of %s", pullRequest.HeadRef, pullRequest.HeadRepoFullName)
+	_, err := runAPIRequest(ghm.context, fmt.Sprintf("/repos/%s/git/refs/heads/%s", pullRequest.HeadRepoFullName, pullRequest.HeadRef), "--method", "DELETE")
+	return err
+}
+
+// ReviewerCandidates are the users and teams that can be asked to review pull requests in a repository
+type ReviewerCandidates struct {
+	Users []string
+	Teams []string
+}
+
+// LatestPullRequestReview gives the current state of a reviewer - an outstanding review request, or otherwise the most
+// recently submitted review
+func LatestPullRequestReview(pullRequestReviews []*PullRequestReview) *PullRequestReview {
+	var latestPullRequestReview *PullRequestReview
+	for _, pullRequestReview := range pullRequestReviews {
+		if pullRequestReview.Status == PullRequestReviewStatusRequested {
+			return pullRequestReview
+		}
+		if latestPullRequestReview == nil || pullRequestReview.SubmittedAt.After(latestPullRequestReview.SubmittedAt) {
+			latestPullRequestReview = pullRequestReview
+		}
+	}
+	return latestPullRequestReview
+}
+
+// ReviewersToReRequest lists the reviewers that commented or requested changes and have not been asked again since
+func ReviewersToReRequest(pullRequestWrapper *PullRequestWrapper) []*User {
+	users := make([]*User, 0)
+	for _, pullRequestReviews := range pullRequestWrapper.PullRequest.PullRequestReviewsByPriority {
+		latestPullRequestReview := LatestPullRequestReview(pullRequestReviews)
+		if latestPullRequestReview == nil {
+			continue
+		}
+		if latestPullRequestReview.Status == PullRequestReviewStatusCommented || latestPullRequestReview.Status == PullRequestReviewStatusChangesRequested {
+			users = append(users, latestPullRequestReview.User)
+		}
+	}
+	return users
+}
+
+// RetrieveReviewerCandidates lists who can review in the repository.  Collaborators are only visible to users with
+// push access, the assignable users are used otherwise.  Teams are best effort as they require organisation access.
+func (ghm *GHMon) RetrieveReviewerCandidates(repo *Repo) (*ReviewerCandidates, error) {
+
+	var reviewerCandidates *ReviewerCandidates
+	ghm.withState(func(state *monitorState) {
+		reviewerCandidates = state.reviewerCandidates[repo.FullName]
+	})
+	if reviewerCandidates != nil {
+		return reviewerCandidates, nil
+	}
+
+	reviewerCandidates = &ReviewerCandidates{Users: make([]string, 0), Teams: make([]string, 0)}
+
+	user := ghm.currentUser()
+	userItems, err := retrieveAllPages(ghm.context, "/repos/" + repo.FullName + "/collaborators")
+	if err != nil {
+		ghm.logger.Printf("Could not retrieve collaborators of %s, using assignees: %s", repo.FullName, err)
+		if userItems, err = retrieveAllPages(ghm.context, "/repos/" + repo.FullName + "/assignees"); err != nil {
+			return nil, err
+		}
+	}
+	for _, userItem := range userItems {
+		if login, ok := userItem["login"].(string); ok && (user == nil || login != user.Username) {
+			reviewerCandidates.Users = append(reviewerCandidates.Users, login)
+		}
+	}
+
+	if teamItems, err := retrieveAllPages(ghm.context, "/repos/" + repo.FullName + "/teams"); err == nil {
+		for _, teamItem := range teamItems {
+			if slug, ok := teamItem["slug"].(string); ok {
+				reviewerCandidates.Teams = append(reviewerCandidates.Teams, slug)
+			}
+		}
+	} else {
+		ghm.logger.Printf("Could not retrieve teams of %s: %s", repo.FullName, err)
+	}
+
+	ghm.withState(func(state *monitorState) {
+		state.reviewerCandidates[repo.FullName] = reviewerCandidates
+	})
+
+	return reviewerCandidates, nil
+}
+
+func createRequestedReviewersArguments(path string, method string, users []string, teams []string) []string {
+	arguments := []string{path, "--method", method}
+	for _, user := range users {
+		arguments = append(arguments, "-f", "reviewers[]="+user)
+	}
+	for _, team := range teams {
+		arguments = append(arguments, "-f", "team_reviewers[]="+team)
+	}
+	return arguments
+}
+
+// RequestReviewers asks users and teams to review the pull request, asking someone who already reviewed again is how
+// a review is re-requested.  The pull request is refreshed before returning.
+func (ghm *GHMon) RequestReviewers(pullRequestWrapper *PullRequestWrapper, users []string, teams []string) error {
+
+	pullRequest := pullRequestWrapper.PullRequest
+
+	ghm.logger.Printf("Requesting reviews on %d from %v and teams %v", pullRequest.Id, users, teams)
+	_, err := runAPIRequest(ghm.context, createRequestedReviewersArguments(pullRequest.PullRequestURL.Path+"/requested_reviewers", "POST", users, teams)...)
+	if err != nil {
+		return err
+	}
+
+	ghm.RefreshPullRequest(pullRequestWrapper)
+	return nil
+}
+
+// RemoveRequestedReviewers withdraws outstanding review requests.  The pull request is refreshed before returning.
+func (ghm *GHMon) RemoveRequestedReviewers(pullRequestWrapper *PullRequestWrapper, users []string, teams []string) error {
+
+	pullRequest := pullRequestWrapper.PullRequest
+
+	ghm.logger.Printf("Removing review requests on %d from %v and teams %v", pullRequest.Id, users, teams)
+	_, err := runAPIRequest(ghm.context, createRequestedReviewersArguments(pullRequest.PullRequestURL.Path+"/requested_reviewers", "DELETE", users, teams)...)
+	if err != nil {
+		return err
+	}
+
+	ghm.RefreshPullRequest(pullRequestWrapper)
+	return nil
+}
@@ -0,0 +1,127 @@
+package ghmon
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReviewersToReRequest(t *testing.T) {
+
+	commenter := &User{Id: 2, Username: "commenter"}
+	blocker := &User{Id: 3, Username: "blocker"}
+	approver := &User{Id: 4, Username: "approver"}
+	asked := &User{Id: 5, Username: "asked"}
+	earlier := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+
+	pullRequestWrapper := &PullRequestWrapper{PullRequest: &PullRequest{PullRequestReviewsByPriority: [][]*PullRequestReview{
+		{{User: commenter, Status: PullRequestReviewStatusCommented, SubmittedAt: earlier}},
+		{
+			{User: blocker, Status: PullRequestReviewStatusApproved, SubmittedAt: earlier},
+			{User: blocker, Status: PullRequestReviewStatusChangesRequested, SubmittedAt: later},
+		},
+		{
+			{User: approver, Status: PullRequestReviewStatusChangesRequested, SubmittedAt: earlier},
+			{User: approver, Status: PullRequestReviewStatusApproved, SubmittedAt: later},
+		},
+		// Asked again already, an outstanding request wins over any review
+		{
+			{User: asked, Status: PullRequestReviewStatusChangesRequested, SubmittedAt: later},
+			{User: asked, Status: PullRequestReviewStatusRequested},
+		},
+		{},
+	}}}
+
+	users := ReviewersToReRequest(pullRequestWrapper)
+	if !reflect.DeepEqual(users, []*User{commenter, blocker}) {
+		t.Errorf("re-requesting %v, expected the commenter and the blocker", users)
+	}
+}
+
+func TestCreateRequestedReviewersArguments(t *testing.T) {
+
+	arguments := createRequestedReviewersArguments("/repos/owner/repo/pulls/7/requested_reviewers", "DELETE", []string{"alice", "bob"}, []string{"core"})
+	expected := []string{"/repos/owner/repo/pulls/7/requested_reviewers", "--method", "DELETE",
+		"-f", "reviewers[]=alice", "-f", "reviewers[]=bob", "-f", "team_reviewers[]=core"}
+	if !reflect.DeepEqual(arguments, expected) {
+		t.Errorf("arguments %v, expected %v", arguments, expected)
+	}
+}
+
+func TestRetrieveReviewerCandidatesFallsBackToTheAssignees(t *testing.T) {
+	// Only users with push access see the collaborators, and the teams are not visible either
+	withFakeGH(t, fakeGHResponse{"repos/owner/repo/assignees", `[{"login": "alice"}, {"login": "me"}, {"login": "bob"}]`})
+	ghm := newTestMonitor(t)
+	repo := &Repo{Name: "repo", FullName: "owner/repo"}
+
+	reviewerCandidates, err := ghm.RetrieveReviewerCandidates(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &ReviewerCandidates{Users: []string{"alice", "bob"}, Teams: []string{}}
+	if !reflect.DeepEqual(reviewerCandidates, expected) {
+		t.Errorf("candidates %+v, expected %+v", reviewerCandidates, expected)
+	}
+
+	// The candidates of the repository are only retrieved once
+	withoutGH(t)
+	if cachedReviewerCandidates, err := ghm.RetrieveReviewerCandidates(repo); err != nil || cachedReviewerCandidates != reviewerCandidates {
+		t.Errorf("candidates retrieved again: %v", err)
+	}
+}
+
+func TestRetrieveReviewerCandidatesWithTeams(t *testing.T) {
+	withFakeGH(t,
+		fakeGHResponse{"repos/owner/repo/collaborators", `[{"login": "carol"}]`},
+		fakeGHResponse{"repos/owner/repo/teams", `[{"slug": "core"}, {"slug": "docs"}]`},
+	)
+	ghm := newTestMonitor(t)
+
+	reviewerCandidates, err := ghm.RetrieveReviewerCandidates(&Repo{Name: "repo", FullName: "owner/repo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &ReviewerCandidates{Users: []string{"carol"}, Teams: []string{"core", "docs"}}
+	if !reflect.DeepEqual(reviewerCandidates, expected) {
+		t.Errorf("candidates %+v, expected %+v", reviewerCandidates, expected)
+	}
+}
+
+func TestSuggestReviewers(t *testing.T) {
+
+	reviewersDialog := &ReviewersDialog{
+		pullRequestWrapper: &PullRequestWrapper{PullRequest: &PullRequest{Repo: &Repo{FullName: "owner/repo"}}},
+		reviewerCandidates: &ReviewerCandidates{
+			Users: []string{"zed", "Carol", "bob", "alice", "al", "a1", "a2", "a3", "a4", "a5"},
+			Teams: []string{"core"},
+		},
+	}
+
+	tests := []struct {
+		text        string
+		suggestions []string
+	}{
+		{"", []string{}},
+		{"  ", []string{}},
+		{"x", []string{}},
+		{"c", []string{"Carol", "@owner/core", "alice"}},
+		{"ce", []string{"@owner/core", "alice"}},
+		{"@own", []string{"@owner/core"}},
+		{"a", []string{"a1", "a2", "a3", "a4", "a5", "al", "alice", "Carol"}},
+	}
+	for _, test := range tests {
+		suggestions := make([]string, 0)
+		for _, listItem := range reviewersDialog.suggestReviewers(test.text) {
+			suggestions = append(suggestions, listItem.GetMainText())
+		}
+		if !reflect.DeepEqual(suggestions, test.suggestions) {
+			t.Errorf("%q suggests %v, expected %v", test.text, suggestions, test.suggestions)
+		}
+	}
+
+	reviewersDialog.reviewerCandidates = nil
+	if suggestions := reviewersDialog.suggestReviewers("a"); len(suggestions) > 0 {
+		t.Errorf("suggested %d reviewers before the candidates were retrieved", len(suggestions))
+	}
+}
@@ -0,0 +1,341 @@
+package ghmon
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+/* Output formats of a report */
+const (
+	reportFormatTable    = "table"
+	reportFormatMarkdown = "markdown"
+	reportFormatCSV      = "csv"
+)
+
+// DurationStatistics sums up how long something took over several pull requests
+type DurationStatistics struct {
+	Count  int
+	Median time.Duration
+	P95    time.Duration
+}
+
+// ReportCount is how many pull requests a reviewer or a repository had reviews on
+type ReportCount struct {
+	Name         string
+	PullRequests int
+}
+
+// Report measures the reviews recorded in the histories over a date range.  Times to review are those of the pull
+// requests opened in the range, the response time of the user is that of the reviews requested in the range and the
+// counts are those of the reviews submitted in the range.
+type Report struct {
+	Since time.Time
+	Until time.Time
+	User  string
+	/* Pull requests opened in the range */
+	PullRequests         int
+	TimeToFirstReview    DurationStatistics
+	TimeToApproval       DurationStatistics
+	ReviewResponseTime   DurationStatistics
+	ReviewedByPerson     []*ReportCount
+	ReviewedByRepository []*ReportCount
+}
+
+func isReviewHistoryEvent(kind HistoryEventKind) bool {
+	return kind == HistoryEventApproved || kind == HistoryEventChangesRequested || kind == HistoryEventCommented
+}
+
+func isInRange(at time.Time, since time.Time, until time.Time) bool {
+	return !at.Before(since) && at.Before(until)
+}
+
+// createDurationStatistics uses the nearest rank, so the median and the 95th percentile are always measured durations
+func createDurationStatistics(durations []time.Duration) DurationStatistics {
+	statistics := DurationStatistics{Count: len(durations)}
+	if len(durations) == 0 {
+		return statistics
+	}
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+	percentile := func(p float64) time.Duration {
+		return durations[int(math.Ceil(p*float64(len(durations))))-1]
+	}
+	statistics.Median = percentile(0.5)
+	statistics.P95 = percentile(0.95)
+	return statistics
+}
+
+func createReportCounts(pullRequestsByName map[string]map[uint32]bool) []*ReportCount {
+	counts := make([]*ReportCount, 0, len(pullRequestsByName))
+	for name, pullRequests := range pullRequestsByName {
+		counts = append(counts, &ReportCount{Name: name, PullRequests: len(pullRequests)})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].PullRequests == counts[j].PullRequests {
+			return strings.ToLower(counts[i].Name) < strings.ToLower(counts[j].Name)
+		}
+		return counts[i].PullRequests > counts[j].PullRequests
+	})
+	return counts
+}
+
+func addReportCount(pullRequestsByName map[string]map[uint32]bool, name string, id uint32) {
+	if _, ok := pullRequestsByName[name]; !ok {
+		pullRequestsByName[name] = make(map[uint32]bool)
+	}
+	pullRequestsByName[name][id] = true
+}
+
+func createReport(histories []*PullRequestHistory, username string, since time.Time, until time.Time) *Report {
+
+	report := &Report{Since: since, Until: until, User: username}
+	timesToFirstReview := make([]time.Duration, 0)
+	timesToApproval := make([]time.Duration, 0)
+	reviewResponseTimes := make([]time.Duration, 0)
+	reviewedByPerson := make(map[string]map[uint32]bool)
+	reviewedByRepository := make(map[string]map[uint32]bool)
+
+	for _, history := range histories {
+
+		if isInRange(history.CreatedAt, since, until) {
+			report.PullRequests++
+			var firstReview, firstApproval *PullRequestHistoryEvent
+			for _, event := range history.Events {
+				if !isReviewHistoryEvent(event.Kind) || event.Actor == history.Author || event.Time.Before(history.CreatedAt) {
+					continue
+				}
+				if firstReview == nil {
+					firstReview = event
+				}
+				if firstApproval == nil && event.Kind == HistoryEventApproved {
+					firstApproval = event
+				}
+			}
+			if firstReview != nil {
+				timesToFirstReview = append(timesToFirstReview, firstReview.Time.Sub(history.CreatedAt))
+			}
+			if firstApproval != nil {
+				timesToApproval = append(timesToApproval, firstApproval.Time.Sub(history.CreatedAt))
+			}
+		}
+
+		for i, event := range history.Events {
+			if isReviewHistoryEvent(event.Kind) && event.Actor != history.Author && isInRange(event.Time, since, until) {
+				addReportCount(reviewedByPerson, event.Actor, history.Id)
+				addReportCount(reviewedByRepository, history.Repository, history.Id)
+			}
+			if username == "" || event.Kind != HistoryEventReviewRequested || event.Details != username || !isInRange(event.Time, since, until) {
+				continue
+			}
+			// Answered by the first review of the user after the request, requests still waiting are not counted
+			for _, laterEvent := range history.Events[i+1:] {
+				if isReviewHistoryEvent(laterEvent.Kind) && laterEvent.Actor == username {
+					reviewResponseTimes = append(reviewResponseTimes, laterEvent.Time.Sub(event.Time))
+					break
+				}
+			}
+		}
+	}
+
+	report.TimeToFirstReview = createDurationStatistics(timesToFirstReview)
+	report.TimeToApproval = createDurationStatistics(timesToApproval)
+	report.ReviewResponseTime = createDurationStatistics(reviewResponseTimes)
+	report.ReviewedByPerson = createReportCounts(reviewedByPerson)
+	report.ReviewedByRepository = createReportCounts(reviewedByRepository)
+	return report
+}
+
+// CreateReport measures the recorded histories between since and until, username is the user whose response time is
+// measured
+func (ghm *GHMon) CreateReport(username string, since time.Time, until time.Time) (*Report, error) {
+	histories, err := ghm.store.LoadPullRequestHistories()
+	if err != nil {
+		return nil, err
+	}
+	return createReport(histories, username, since, until), nil
+}
+
+// FindUsername returns the GitHub user, found in the pull requests of the user when possible so that asking GitHub
+// is the last resort
+func (ghm *GHMon) FindUsername() (string, error) {
+	if user := ghm.currentUser(); user != nil {
+		return user.Username, nil
+	}
+	if pullRequestWrappers, err := ghm.store.LoadPullRequestWrappers(); err == nil {
+		for _, pullRequestWrapper := range pullRequestWrappers {
+			if pullRequestWrapper.PullRequestType == Own && pullRequestWrapper.PullRequest.Creator != nil {
+				return pullRequestWrapper.PullRequest.Creator.Username, nil
+			}
+		}
+	}
+	if err := ghm.CheckLoggedIn(); err != nil {
+		return "", fmt.Errorf("could not find out who the user is, give --user: %s", err)
+	}
+	user := ghm.RetrieveUser()
+	if user == nil {
+		return "", fmt.Errorf("could not retrieve the logged in user from GitHub")
+	}
+	return user.Username, nil
+}
+
+// ParseReportTime reads a date (2006-01-02) or a number of days before now (30d).  A date given as the end of the
+// range includes that day.
+func ParseReportTime(value string, endOfRange bool, now time.Time) (time.Time, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err == nil && days >= 0 {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %s, expected YYYY-MM-DD or a number of days such as 30d", value)
+	}
+	if endOfRange {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date, nil
+}
+
+// formatReportDuration keeps the two largest units, which is as precise as review times need to be
+func formatReportDuration(duration time.Duration) string {
+	duration = duration.Round(time.Minute)
+	days := duration / (24 * time.Hour)
+	hours := (duration % (24 * time.Hour)) / time.Hour
+	minutes := (duration % time.Hour) / time.Minute
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+func formatDurationStatistics(statistics DurationStatistics) (string, string) {
+	if statistics.Count == 0 {
+		return "-", "-"
+	}
+	return formatReportDuration(statistics.Median), formatReportDuration(statistics.P95)
+}
+
+func (report *Report) getTitle() string {
+	return fmt.Sprintf("Reviews from %s to %s, %d pull requests opened", report.Since.Format("2006-01-02"), report.Until.Add(-time.Nanosecond).Format("2006-01-02"), report.PullRequests)
+}
+
+type reportMeasure struct {
+	name       string
+	statistics DurationStatistics
+}
+
+func (report *Report) getMeasures() []*reportMeasure {
+	responseTimeName := "My review response time"
+	if report.User != "" {
+		responseTimeName = fmt.Sprintf("Review response time of %s", report.User)
+	}
+	return []*reportMeasure{
+		{"Time to first review", report.TimeToFirstReview},
+		{"Time to approval", report.TimeToApproval},
+		{responseTimeName, report.ReviewResponseTime},
+	}
+}
+
+// Write writes the report as a terminal table, Markdown or CSV
+func (report *Report) Write(writer io.Writer, format string) error {
+	switch format {
+	case reportFormatTable:
+		return report.writeTable(writer)
+	case reportFormatMarkdown:
+		return report.writeMarkdown(writer)
+	case reportFormatCSV:
+		return report.writeCSV(writer)
+	}
+	return fmt.Errorf("unknown format %s, expected %s, %s or %s", format, reportFormatTable, reportFormatMarkdown, reportFormatCSV)
+}
+
+func (report *Report) writeTable(writer io.Writer) error {
+
+	fmt.Fprintf(writer, "%s\n\n", report.getTitle())
+
+	tableWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tableWriter, "MEASURE\tCOUNT\tMEDIAN\t95TH\n")
+	for _, measure := range report.getMeasures() {
+		median, p95 := formatDurationStatistics(measure.statistics)
+		fmt.Fprintf(tableWriter, "%s\t%d\t%s\t%s\n", measure.name, measure.statistics.Count, median, p95)
+	}
+	if err := tableWriter.Flush(); err != nil {
+		return err
+	}
+
+	for _, section := range []struct {
+		name   string
+		counts []*ReportCount
+	}{{"REVIEWER", report.ReviewedByPerson}, {"REPOSITORY", report.ReviewedByRepository}} {
+		fmt.Fprintln(writer)
+		tableWriter = tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tableWriter, "%s\tREVIEWED\n", section.name)
+		for _, count := range section.counts {
+			fmt.Fprintf(tableWriter, "%s\t%d\n", count.Name, count.PullRequests)
+		}
+		if err := tableWriter.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func escapeMarkdownCell(value string) string {
+	return strings.ReplaceAll(value, "|", `\|`)
+}
+
+func (report *Report) writeMarkdown(writer io.Writer) error {
+
+	fmt.Fprintf(writer, "## %s\n\n", report.getTitle())
+	fmt.Fprintf(writer, "Measure | Count | Median | 95th percentile\n---- | ----: | ----: | ----:\n")
+	for _, measure := range report.getMeasures() {
+		median, p95 := formatDurationStatistics(measure.statistics)
+		fmt.Fprintf(writer, "%s | %d | %s | %s\n", escapeMarkdownCell(measure.name), measure.statistics.Count, median, p95)
+	}
+
+	fmt.Fprintf(writer, "\nReviewer | Pull requests reviewed\n---- | ----:\n")
+	for _, count := range report.ReviewedByPerson {
+		fmt.Fprintf(writer, "%s | %d\n", escapeMarkdownCell(count.Name), count.PullRequests)
+	}
+	fmt.Fprintf(writer, "\nRepository | Pull requests reviewed\n---- | ----:\n")
+	for _, count := range report.ReviewedByRepository {
+		fmt.Fprintf(writer, "%s | %d\n", escapeMarkdownCell(count.Name), count.PullRequests)
+	}
+	return nil
+}
+
+// writeCSV writes a single table for spreadsheets, durations in seconds
+func (report *Report) writeCSV(writer io.Writer) error {
+
+	csvWriter := csv.NewWriter(writer)
+	csvWriter.Write([]string{"section", "name", "count", "median_seconds", "p95_seconds"})
+	for _, measure := range report.getMeasures() {
+		statistics := measure.statistics
+		median, p95 := "", ""
+		if statistics.Count > 0 {
+			median, p95 = strconv.FormatFloat(statistics.Median.Seconds(), 'f', 0, 64), strconv.FormatFloat(statistics.P95.Seconds(), 'f', 0, 64)
+		}
+		csvWriter.Write([]string{"measure", measure.name, strconv.Itoa(statistics.Count), median, p95})
+	}
+	for _, count := range report.ReviewedByPerson {
+		csvWriter.Write([]string{"reviewer", count.Name, strconv.Itoa(count.PullRequests), "", ""})
+	}
+	for _, count := range report.ReviewedByRepository {
+		csvWriter.Write([]string{"repository", count.Name, strconv.Itoa(count.PullRequests), "", ""})
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
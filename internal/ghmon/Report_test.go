@@ -0,0 +1,227 @@
+package ghmon
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newReportHistory(id uint32, repository string, author string, createdAt time.Time, events ...*PullRequestHistoryEvent) *PullRequestHistory {
+	history := &PullRequestHistory{Id: id, Repository: repository, Author: author, CreatedAt: createdAt, Events: make([]*PullRequestHistoryEvent, 0)}
+	history.appendEvent(&PullRequestHistoryEvent{Time: createdAt, Kind: HistoryEventOpened, Actor: author})
+	for _, event := range events {
+		history.appendEvent(event)
+	}
+	return history
+}
+
+func newTestReport() *Report {
+
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2021, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	histories := []*PullRequestHistory{
+		newReportHistory(1, "acme/x", "alice", at(2, 9, 0),
+			&PullRequestHistoryEvent{Time: at(2, 9, 30), Kind: HistoryEventReviewRequested, Details: "me"},
+			// Answering in the own pull request is no review
+			&PullRequestHistoryEvent{Time: at(2, 10, 0), Kind: HistoryEventCommented, Actor: "alice"},
+			&PullRequestHistoryEvent{Time: at(2, 11, 0), Kind: HistoryEventCommented, Actor: "bob"},
+			&PullRequestHistoryEvent{Time: at(2, 12, 0), Kind: HistoryEventChangesRequested, Actor: "bob"},
+			&PullRequestHistoryEvent{Time: at(2, 13, 30), Kind: HistoryEventApproved, Actor: "me"},
+		),
+		newReportHistory(2, "acme/y", "carol", at(3, 9, 0),
+			// Still waiting on the user, not counted
+			&PullRequestHistoryEvent{Time: at(3, 9, 10), Kind: HistoryEventReviewRequested, Details: "me"},
+			&PullRequestHistoryEvent{Time: at(3, 10, 0), Kind: HistoryEventApproved, Actor: "bob"},
+		),
+		// Opened before the range, only the review in the range counts
+		newReportHistory(3, "acme/x", "dave", at(1, 0, 0).AddDate(0, 0, -9),
+			&PullRequestHistoryEvent{Time: at(1, 0, 0).AddDate(0, 0, -4), Kind: HistoryEventReviewRequested, Details: "me"},
+			&PullRequestHistoryEvent{Time: at(4, 9, 0), Kind: HistoryEventApproved, Actor: "me"},
+		),
+		newReportHistory(4, "acme/y", "erin", at(5, 9, 0)),
+		// Opened after the range
+		newReportHistory(5, "acme/z", "frank", at(8, 0, 0),
+			&PullRequestHistoryEvent{Time: at(8, 1, 0), Kind: HistoryEventApproved, Actor: "bob"},
+		),
+	}
+	return createReport(histories, "me", at(1, 0, 0), at(8, 0, 0))
+}
+
+func TestCreateReport(t *testing.T) {
+
+	report := newTestReport()
+
+	if report.PullRequests != 3 {
+		t.Errorf("%d pull requests opened, expected 3", report.PullRequests)
+	}
+	statisticsTests := []struct {
+		name       string
+		statistics DurationStatistics
+		expected   DurationStatistics
+	}{
+		{"time to first review", report.TimeToFirstReview, DurationStatistics{Count: 2, Median: time.Hour, P95: 2 * time.Hour}},
+		{"time to approval", report.TimeToApproval, DurationStatistics{Count: 2, Median: time.Hour, P95: 4*time.Hour + 30*time.Minute}},
+		{"review response time", report.ReviewResponseTime, DurationStatistics{Count: 1, Median: 4 * time.Hour, P95: 4 * time.Hour}},
+	}
+	for _, test := range statisticsTests {
+		if test.statistics != test.expected {
+			t.Errorf("%s is %+v, expected %+v", test.name, test.statistics, test.expected)
+		}
+	}
+
+	countTests := []struct {
+		name     string
+		counts   []*ReportCount
+		expected []ReportCount
+	}{
+		{"reviewed by person", report.ReviewedByPerson, []ReportCount{{"bob", 2}, {"me", 2}}},
+		{"reviewed by repository", report.ReviewedByRepository, []ReportCount{{"acme/x", 2}, {"acme/y", 1}}},
+	}
+	for _, test := range countTests {
+		if len(test.counts) != len(test.expected) {
+			t.Errorf("%s has %d counts, expected %d", test.name, len(test.counts), len(test.expected))
+			continue
+		}
+		for index, count := range test.counts {
+			if *count != test.expected[index] {
+				t.Errorf("%s %d is %+v, expected %+v", test.name, index, *count, test.expected[index])
+			}
+		}
+	}
+}
+
+func TestCreateDurationStatistics(t *testing.T) {
+
+	durations := make([]time.Duration, 0)
+	for minutes := 20; minutes > 0; minutes-- {
+		durations = append(durations, time.Duration(minutes)*time.Minute)
+	}
+
+	if statistics := createDurationStatistics(durations); statistics != (DurationStatistics{Count: 20, Median: 10 * time.Minute, P95: 19 * time.Minute}) {
+		t.Errorf("unexpected statistics %+v", statistics)
+	}
+	if statistics := createDurationStatistics([]time.Duration{}); statistics != (DurationStatistics{}) {
+		t.Errorf("unexpected statistics without durations %+v", statistics)
+	}
+}
+
+func TestParseReportTime(t *testing.T) {
+
+	now := time.Date(2021, 3, 10, 15, 30, 0, 0, time.Local)
+
+	tests := []struct {
+		value      string
+		endOfRange bool
+		expected   time.Time
+		valid      bool
+	}{
+		{"30d", false, now.AddDate(0, 0, -30), true},
+		{"0d", true, now, true},
+		{"2021-03-01", false, time.Date(2021, 3, 1, 0, 0, 0, 0, time.Local), true},
+		{"2021-03-01", true, time.Date(2021, 3, 2, 0, 0, 0, 0, time.Local), true},
+		{"-1d", false, time.Time{}, false},
+		{"2021-3-1", false, time.Time{}, false},
+		{"yesterday", false, time.Time{}, false},
+	}
+	for _, test := range tests {
+		parsed, err := ParseReportTime(test.value, test.endOfRange, now)
+		if (err == nil) != test.valid || !parsed.Equal(test.expected) {
+			t.Errorf("%q (end of range %v) parsed as %s (%v), expected %s", test.value, test.endOfRange, parsed, err, test.expected)
+		}
+	}
+}
+
+func TestFormatReportDuration(t *testing.T) {
+
+	tests := []struct {
+		duration time.Duration
+		text     string
+	}{
+		{0, "0m"},
+		{90 * time.Second, "2m"},
+		{61 * time.Minute, "1h1m"},
+		{25*time.Hour + 59*time.Minute, "1d1h"},
+	}
+	for _, test := range tests {
+		if text := formatReportDuration(test.duration); text != test.text {
+			t.Errorf("%s formatted as %s, expected %s", test.duration, text, test.text)
+		}
+	}
+}
+
+func TestReportWrite(t *testing.T) {
+
+	report := newTestReport()
+
+	tests := []struct {
+		format string
+		output string
+	}{
+		{reportFormatMarkdown, `## Reviews from 2021-03-01 to 2021-03-07, 3 pull requests opened
+
+Measure | Count | Median | 95th percentile
+---- | ----: | ----: | ----:
+Time to first review | 2 | 1h0m | 2h0m
+Time to approval | 2 | 1h0m | 4h30m
+Review response time of me | 1 | 4h0m | 4h0m
+
+Reviewer | Pull requests reviewed
+---- | ----:
+bob | 2
+me | 2
+
+Repository | Pull requests reviewed
+---- | ----:
+acme/x | 2
+acme/y | 1
+`},
+		{reportFormatCSV, `section,name,count,median_seconds,p95_seconds
+measure,Time to first review,2,3600,7200
+measure,Time to approval,2,3600,16200
+measure,Review response time of me,1,14400,14400
+reviewer,bob,2,,
+reviewer,me,2,,
+repository,acme/x,2,,
+repository,acme/y,1,,
+`},
+		{reportFormatTable, `Reviews from 2021-03-01 to 2021-03-07, 3 pull requests opened
+
+MEASURE                     COUNT  MEDIAN  95TH
+Time to first review        2      1h0m    2h0m
+Time to approval            2      1h0m    4h30m
+Review response time of me  1      4h0m    4h0m
+
+REVIEWER  REVIEWED
+bob       2
+me        2
+
+REPOSITORY  REVIEWED
+acme/x      2
+acme/y      1
+`},
+	}
+	for _, test := range tests {
+		var output bytes.Buffer
+		if err := report.Write(&output, test.format); err != nil {
+			t.Errorf("%s: %s", test.format, err)
+		} else if output.String() != test.output {
+			t.Errorf("%s: wrote\n%s\nexpected\n%s", test.format, output.String(), test.output)
+		}
+	}
+
+	if err := report.Write(&bytes.Buffer{}, "html"); err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Errorf("expected the unknown format to be refused, got %v", err)
+	}
+
+	// Nothing measured is shown as such rather than as a zero duration
+	var output bytes.Buffer
+	if err := createReport(nil, "", report.Since, report.Until).Write(&output, reportFormatMarkdown); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output.String(), "My review response time | 0 | - | -\n") {
+		t.Errorf("unexpected empty report\n%s", output.String())
+	}
+}
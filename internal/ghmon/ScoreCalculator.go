@@ -10,6 +10,7 @@ import (
 type ScoreCalculator struct {
 	user *User
 	logger *log.Logger
+	configuration *Configuration
 }
 
 type LoggerConsole struct {
@@ -43,17 +44,44 @@ func (scoreCalculator *ScoreCalculator) ExtractMostImportantFirst(pullRequestRev
 	// FIXME: Or should it be that the presence of any approval should be signalled differently and only be
 	// FIXME: cancelled if there is a request for change?
 
-	sort.Slice(pullRequestReviews, func (i, j int) bool {
-		if (pullRequestReviews[i].Status == PullRequestReviewStatusApproved || pullRequestReviews[i].Status == PullRequestReviewStatusChangesRequested) && (pullRequestReviews[j].Status == PullRequestReviewStatusApproved || pullRequestReviews[j].Status == PullRequestReviewStatusChangesRequested) {
-			return pullRequestReviews[i].SubmittedAt.After(pullRequestReviews[j].SubmittedAt)
+	// Sorted on a copy, the reviews belong to a pull request that may be read elsewhere
+	sortedPullRequestReviews := make([]*PullRequestReview, len(pullRequestReviews))
+	copy(sortedPullRequestReviews, pullRequestReviews)
+
+	sort.Slice(sortedPullRequestReviews, func (i, j int) bool {
+		if (sortedPullRequestReviews[i].Status == PullRequestReviewStatusApproved || sortedPullRequestReviews[i].Status == PullRequestReviewStatusChangesRequested) && (sortedPullRequestReviews[j].Status == PullRequestReviewStatusApproved || sortedPullRequestReviews[j].Status == PullRequestReviewStatusChangesRequested) {
+			return sortedPullRequestReviews[i].SubmittedAt.After(sortedPullRequestReviews[j].SubmittedAt)
 		}
-		return scoreCalculator.PullRequestReviewStatusToInt(pullRequestReviews[i].Status) < scoreCalculator.PullRequestReviewStatusToInt(pullRequestReviews[j].Status)
+		return scoreCalculator.PullRequestReviewStatusToInt(sortedPullRequestReviews[i].Status) < scoreCalculator.PullRequestReviewStatusToInt(sortedPullRequestReviews[j].Status)
 	})
 
-	return pullRequestReviews[0]
+	return sortedPullRequestReviews[0]
 
 }
 
+func (scoreCalculator *ScoreCalculator) CalculatePullRequestSize(pullRequest *PullRequest) PullRequestSize {
+
+	// Older cached pull requests have no size information at all
+	if pullRequest.ChangedFiles == 0 {
+		return PullRequestSizeUnknown
+	}
+
+	changedLines := pullRequest.Additions + pullRequest.Deletions
+
+	switch {
+	case changedLines < 10:
+		return PullRequestSizeXS
+	case changedLines < 100:
+		return PullRequestSizeS
+	case changedLines < 500:
+		return PullRequestSizeM
+	case changedLines < 1000:
+		return PullRequestSizeL
+	default:
+		return PullRequestSizeXL
+	}
+}
+
 func (scoreCalculator *ScoreCalculator) CalculateTotalScore(user *User, pullRequestWrapper *PullRequestWrapper) float32 {
 
 	if pullRequestWrapper.Deleted {
@@ -86,6 +114,14 @@ func (scoreCalculator *ScoreCalculator) CalculateTotalScore(user *User, pullRequ
 		totalScore += 75
 	}
 
+	// Labels such as 'urgent' or 'hotfix' push a pull request up, 'wip' and friends push it down
+	totalScore += float32(pullRequestScore.BoostedLabels * 25)
+	totalScore -= float32(pullRequestScore.PenalizedLabels * 25)
+
+	// So do the local tags of the user, e.g. 'later' or 'waiting'
+	totalScore += float32(pullRequestScore.BoostedTags * 25)
+	totalScore -= float32(pullRequestScore.PenalizedTags * 25)
+
 	if pullRequestScore.Approvals > 0 {
 		totalScore -= float32(pullRequestScore.Approvals * 10)
 	}
@@ -126,6 +162,20 @@ func (scoreCalculator *ScoreCalculator) CalculateTotalScore(user *User, pullRequ
 			} else if pullRequestScore.AgeSec > (60*60) {
 				totalScore += 10
 			}
+
+			// Small pull requests are quick wins, large ones can wait for a focused moment
+			if scoreCalculator.configuration != nil && scoreCalculator.configuration.PreferSmallPullRequests {
+				switch pullRequestScore.Size {
+				case PullRequestSizeXS:
+					totalScore += 20
+				case PullRequestSizeS:
+					totalScore += 10
+				case PullRequestSizeL:
+					totalScore -= 10
+				case PullRequestSizeXL:
+					totalScore -= 20
+				}
+			}
 		}
 
 	}
@@ -149,6 +199,13 @@ func (scoreCalculator *ScoreCalculator) CalculateScore(user *User, pullRequestWr
 	pullRequestScore.NumReviewers = uint(len(importantPullRequestReviews))
 	pullRequestScore.Seen = pullRequestWrapper.Seen
 	pullRequestScore.AgeSec = uint32(time.Now().Unix() - pullRequestWrapper.FirstSeen.Unix())
+	pullRequestScore.Size = scoreCalculator.CalculatePullRequestSize(pullRequestWrapper.PullRequest)
+	if scoreCalculator.configuration != nil {
+		pullRequestScore.BoostedLabels = CountLabels(pullRequestWrapper.PullRequest, scoreCalculator.configuration.BoostLabels)
+		pullRequestScore.PenalizedLabels = CountLabels(pullRequestWrapper.PullRequest, scoreCalculator.configuration.PenaltyLabels)
+		pullRequestScore.BoostedTags = CountTags(pullRequestWrapper.Tags, scoreCalculator.configuration.BoostTags)
+		pullRequestScore.PenalizedTags = CountTags(pullRequestWrapper.Tags, scoreCalculator.configuration.PenaltyTags)
+	}
 
 	for _, pullRequestReview := range importantPullRequestReviews {
 		switch pullRequestReview.Status {
@@ -160,7 +217,10 @@ func (scoreCalculator *ScoreCalculator) CalculateScore(user *User, pullRequestWr
 		}
 	}
 
-	pullRequestScore.Total = scoreCalculator.CalculateTotalScore(user, pullRequestWrapper)
+	// The total has to come from the counts above rather than from the previous score of the pull request
+	scoredPullRequestWrapper := *pullRequestWrapper
+	scoredPullRequestWrapper.Score = pullRequestScore
+	pullRequestScore.Total = scoreCalculator.CalculateTotalScore(user, &scoredPullRequestWrapper)
 
 	return pullRequestScore
 }
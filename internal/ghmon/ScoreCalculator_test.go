@@ -0,0 +1,103 @@
+package ghmon
+
+import (
+	"testing"
+	"time"
+)
+
+var scoredUser = &User{Id: 10, Username: "me"}
+
+// newFreshPullRequestWrapper is a pull request of someone else that was just retrieved and never scored
+func newFreshPullRequestWrapper(additions uint32) *PullRequestWrapper {
+	return &PullRequestWrapper{
+		Id:        1,
+		FirstSeen: time.Now(),
+		PullRequest: &PullRequest{
+			Id:                       1,
+			Creator:                  &User{Id: 20, Username: "someone"},
+			PullRequestReviewsByUser: make(map[uint32][]*PullRequestReview),
+			Additions:                additions,
+			ChangedFiles:             1,
+		},
+	}
+}
+
+func TestCalculateScorePrefersSmallPullRequests(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		additions  uint32
+		adjustment float32
+	}{
+		{"XS", 5, 20},
+		{"S", 50, 10},
+		{"M", 200, 0},
+		{"L", 700, -10},
+		{"XL", 2000, -20},
+	}
+
+	neutralCalculator := &ScoreCalculator{user: scoredUser, configuration: &Configuration{}}
+	preferringCalculator := &ScoreCalculator{user: scoredUser, configuration: &Configuration{PreferSmallPullRequests: true}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			neutralScore := neutralCalculator.CalculateScore(scoredUser, newFreshPullRequestWrapper(test.additions))
+			preferringScore := preferringCalculator.CalculateScore(scoredUser, newFreshPullRequestWrapper(test.additions))
+			if adjustment := preferringScore.Total - neutralScore.Total; adjustment != test.adjustment {
+				t.Errorf("adjusted by %v, expected %v", adjustment, test.adjustment)
+			}
+		})
+	}
+}
+
+func TestCalculateScoreBoostsAndPenalizesLabels(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		labels     []string
+		adjustment float32
+	}{
+		{"no label", nil, 0},
+		{"boost label", []string{"Urgent"}, 25},
+		{"penalty label", []string{"wip"}, -25},
+		{"boost and penalty label", []string{"hotfix", "wip"}, 0},
+		{"two boost labels", []string{"urgent", "hotfix"}, 50},
+	}
+
+	scoreCalculator := &ScoreCalculator{user: scoredUser, configuration: &Configuration{BoostLabels: []string{"urgent", "hotfix"}, PenaltyLabels: []string{"wip"}}}
+	unlabelledScore := scoreCalculator.CalculateScore(scoredUser, newFreshPullRequestWrapper(200))
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pullRequestWrapper := newFreshPullRequestWrapper(200)
+			for _, labelName := range test.labels {
+				pullRequestWrapper.PullRequest.Labels = append(pullRequestWrapper.PullRequest.Labels, &Label{Name: labelName})
+			}
+			pullRequestScore := scoreCalculator.CalculateScore(scoredUser, pullRequestWrapper)
+			if adjustment := pullRequestScore.Total - unlabelledScore.Total; adjustment != test.adjustment {
+				t.Errorf("adjusted by %v, expected %v", adjustment, test.adjustment)
+			}
+		})
+	}
+}
+
+func TestExtractMostImportantFirstKeepsTheOrderOfTheReviews(t *testing.T) {
+
+	submittedAt := time.Now()
+	pullRequestReviews := []*PullRequestReview{
+		{User: scoredUser, Status: PullRequestReviewStatusCommented, SubmittedAt: submittedAt.Add(-2 * time.Hour)},
+		{User: scoredUser, Status: PullRequestReviewStatusApproved, SubmittedAt: submittedAt.Add(-time.Hour)},
+		{User: scoredUser, Status: PullRequestReviewStatusChangesRequested, SubmittedAt: submittedAt},
+	}
+	unsortedPullRequestReviews := append([]*PullRequestReview(nil), pullRequestReviews...)
+
+	scoreCalculator := &ScoreCalculator{user: scoredUser}
+	if pullRequestReview := scoreCalculator.ExtractMostImportantFirst(pullRequestReviews); pullRequestReview != pullRequestReviews[2] {
+		t.Errorf("the latest request for changes is not the most important review: %+v", pullRequestReview)
+	}
+	for i := range pullRequestReviews {
+		if pullRequestReviews[i] != unsortedPullRequestReviews[i] {
+			t.Fatalf("the reviews of the pull request were reordered")
+		}
+	}
+}
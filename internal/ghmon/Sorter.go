@@ -0,0 +1,153 @@
+package ghmon
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+type SortMode int
+
+const (
+	SortByScore SortMode = iota
+	SortByLastActivity
+	SortByCreated
+	SortByRepository
+	SortByAuthor
+	SortByReviewRequestAge
+	SortBySize
+	numSortModes
+)
+
+func ConvertSortModeToString(sortMode SortMode) string {
+	switch sortMode {
+	case SortByScore:
+		return "score"
+	case SortByLastActivity:
+		return "last activity"
+	case SortByCreated:
+		return "created"
+	case SortByRepository:
+		return "repository"
+	case SortByAuthor:
+		return "author"
+	case SortByReviewRequestAge:
+		return "review requested"
+	case SortBySize:
+		return "size"
+	default:
+		return "unknown"
+	}
+}
+
+func ParseSortMode(sortModeString string) (SortMode, bool) {
+	for sortMode := SortByScore; sortMode < numSortModes; sortMode++ {
+		if strings.EqualFold(ConvertSortModeToString(sortMode), sortModeString) || strings.EqualFold(strings.ReplaceAll(ConvertSortModeToString(sortMode), " ", "-"), sortModeString) {
+			return sortMode, true
+		}
+	}
+	return SortByScore, false
+}
+
+// NextSortMode cycles through the available sort modes
+func NextSortMode(sortMode SortMode) SortMode {
+	return (sortMode + 1) % numSortModes
+}
+
+// DefaultSortDescending gives the natural direction of each sort mode - hottest, most recent, largest and longest
+// waiting first while names sort alphabetically
+func DefaultSortDescending(sortMode SortMode) bool {
+	switch sortMode {
+	case SortByRepository, SortByAuthor:
+		return false
+	default:
+		return true
+	}
+}
+
+// ReviewRequestAge is how long the pull request has been waiting on the current user, falling back to when it
+// was first seen for pull requests where the review request time is not known
+func ReviewRequestAge(pullRequestWrapper *PullRequestWrapper) time.Duration {
+	if !pullRequestWrapper.ReviewRequestedAt.IsZero() {
+		return time.Since(pullRequestWrapper.ReviewRequestedAt)
+	}
+	return time.Since(pullRequestWrapper.FirstSeen)
+}
+
+// comparePullRequestWrappers returns a negative number if left sorts before right in ascending order
+func comparePullRequestWrappers(sortMode SortMode, left *PullRequestWrapper, right *PullRequestWrapper) int {
+
+	compareTimes := func(leftTime time.Time, rightTime time.Time) int {
+		if leftTime.Before(rightTime) {
+			return -1
+		} else if leftTime.After(rightTime) {
+			return 1
+		}
+		return 0
+	}
+
+	switch sortMode {
+	case SortByLastActivity:
+		return compareTimes(left.PullRequest.UpdatedAt, right.PullRequest.UpdatedAt)
+	case SortByCreated:
+		return compareTimes(left.PullRequest.CreatedAt, right.PullRequest.CreatedAt)
+	case SortByRepository:
+		return strings.Compare(strings.ToLower(left.PullRequest.Repo.FullName), strings.ToLower(right.PullRequest.Repo.FullName))
+	case SortByAuthor:
+		return strings.Compare(strings.ToLower(left.PullRequest.Creator.Username), strings.ToLower(right.PullRequest.Creator.Username))
+	case SortByReviewRequestAge:
+		leftAge := ReviewRequestAge(left)
+		rightAge := ReviewRequestAge(right)
+		if leftAge < rightAge {
+			return -1
+		} else if leftAge > rightAge {
+			return 1
+		}
+		return 0
+	case SortBySize:
+		leftSize := left.PullRequest.Additions + left.PullRequest.Deletions
+		rightSize := right.PullRequest.Additions + right.PullRequest.Deletions
+		if leftSize < rightSize {
+			return -1
+		} else if leftSize > rightSize {
+			return 1
+		}
+		return 0
+	}
+
+	if left.Score.Total < right.Score.Total {
+		return -1
+	} else if left.Score.Total > right.Score.Total {
+		return 1
+	}
+	return 0
+}
+
+// SortPullRequestWrappers returns a sorted copy of the pull request wrappers.  Ties are broken by score (highest
+// first) and then by identifier so that the order is stable between refreshes.
+func SortPullRequestWrappers(pullRequestWrappers []*PullRequestWrapper, sortMode SortMode, descending bool) []*PullRequestWrapper {
+
+	sortedPullRequestWrappers := make([]*PullRequestWrapper, len(pullRequestWrappers))
+	copy(sortedPullRequestWrappers, pullRequestWrappers)
+
+	sort.SliceStable(sortedPullRequestWrappers, func(i, j int) bool {
+
+		left := sortedPullRequestWrappers[i]
+		right := sortedPullRequestWrappers[j]
+
+		comparison := comparePullRequestWrappers(sortMode, left, right)
+		if comparison != 0 {
+			if descending {
+				return comparison > 0
+			}
+			return comparison < 0
+		}
+
+		if left.Score.Total != right.Score.Total {
+			return left.Score.Total > right.Score.Total
+		}
+		return left.Id < right.Id
+	})
+
+	return sortedPullRequestWrappers
+}
@@ -0,0 +1,199 @@
+package ghmon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"text/template"
+)
+
+const defaultStatusTemplate = `{{.Pending}} to review{{if .ReadyToMerge}}, {{.ReadyToMerge}} ready to merge{{end}}{{if .Hottest}} | {{.Hottest.Name}}#{{.Hottest.Number}} {{truncate 30 .Hottest.Title}}{{end}}`
+
+const statusTooltipLength = 10
+
+type StatusFormat int
+
+const (
+	StatusFormatPlain StatusFormat = iota
+	StatusFormatTmux
+	StatusFormatWaybar
+	StatusFormatI3blocks
+)
+
+// StatusPullRequest is what a status template can show of a pull request
+type StatusPullRequest struct {
+	Id         uint32
+	Repository string
+	Name       string
+	Number     uint32
+	Title      string
+	Author     string
+	Score      float32
+	URL        string
+}
+
+// StatusSummary is what a status template is executed with, counted from the stored pull requests
+type StatusSummary struct {
+	/* Pull requests of others waiting on a review from the user */
+	Pending int
+	/* Pending pull requests that have not been looked at */
+	Unseen int
+	/* Open pull requests of the user */
+	Own int
+	/* Own pull requests that are approved and have no changes requested */
+	ReadyToMerge int
+	/* Own pull requests with changes requested */
+	ChangesRequested int
+	/* The pending pull request with the highest score */
+	Hottest *StatusPullRequest
+	/* hot, warm or cool following the score of the hottest pull request, idle when nothing is pending */
+	Heat    string
+	pending []*StatusPullRequest
+}
+
+func ParseStatusFormat(statusFormatString string) (StatusFormat, bool) {
+	switch strings.ToLower(statusFormatString) {
+	case "", "plain":
+		return StatusFormatPlain, true
+	case "tmux":
+		return StatusFormatTmux, true
+	case "waybar":
+		return StatusFormatWaybar, true
+	case "i3blocks":
+		return StatusFormatI3blocks, true
+	}
+	return StatusFormatPlain, false
+}
+
+func convertPullRequestToStatus(pullRequestWrapper *PullRequestWrapper) *StatusPullRequest {
+	pullRequest := pullRequestWrapper.PullRequest
+	statusPullRequest := &StatusPullRequest{
+		Id: pullRequestWrapper.Id, Repository: pullRequest.Repo.FullName, Name: pullRequest.Repo.Name, Number: pullRequest.Number,
+		Title: pullRequest.Title, Author: pullRequest.Creator.Username, Score: pullRequestWrapper.Score.Total,
+	}
+	if pullRequest.HtmlURL != nil {
+		statusPullRequest.URL = pullRequest.HtmlURL.String()
+	}
+	return statusPullRequest
+}
+
+// CreateStatusSummary counts the pull requests, which are expected hottest first
+func CreateStatusSummary(pullRequestWrappers []*PullRequestWrapper) *StatusSummary {
+
+	statusSummary := &StatusSummary{Heat: "idle", pending: make([]*StatusPullRequest, 0)}
+
+	for _, pullRequestWrapper := range pullRequestWrappers {
+		if pullRequestWrapper.Deleted {
+			continue
+		}
+		score := pullRequestWrapper.Score
+		if score.IsMyPullRequest {
+			statusSummary.Own++
+			if score.ChangesRequested > 0 {
+				statusSummary.ChangesRequested++
+			} else if score.Approvals > 0 {
+				statusSummary.ReadyToMerge++
+			}
+			continue
+		}
+		if score.ApprovedByMe {
+			continue
+		}
+		statusSummary.Pending++
+		if !pullRequestWrapper.Seen {
+			statusSummary.Unseen++
+		}
+		statusSummary.pending = append(statusSummary.pending, convertPullRequestToStatus(pullRequestWrapper))
+	}
+
+	if len(statusSummary.pending) > 0 {
+		statusSummary.Hottest = statusSummary.pending[0]
+		// Same thresholds as the heat column of the UI
+		switch {
+		case statusSummary.Hottest.Score > 75:
+			statusSummary.Heat = "hot"
+		case statusSummary.Hottest.Score > 50:
+			statusSummary.Heat = "warm"
+		default:
+			statusSummary.Heat = "cool"
+		}
+	}
+	return statusSummary
+}
+
+func truncateText(length int, text string) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length-1]) + "…"
+}
+
+// RenderStatus executes the template with the summary and wraps the result for the given status bar
+func RenderStatus(statusSummary *StatusSummary, statusTemplate string, statusFormat StatusFormat) (string, error) {
+
+	if statusTemplate == "" {
+		statusTemplate = defaultStatusTemplate
+	}
+	parsedTemplate, err := template.New("status").Funcs(template.FuncMap{"truncate": truncateText}).Parse(statusTemplate)
+	if err != nil {
+		return "", err
+	}
+	var buffer bytes.Buffer
+	if err = parsedTemplate.Execute(&buffer, statusSummary); err != nil {
+		return "", err
+	}
+	text := strings.TrimSpace(buffer.String())
+
+	switch statusFormat {
+	case StatusFormatTmux:
+		// '#' starts a tmux format, titles and pull request numbers are full of them
+		text = strings.ReplaceAll(text, "#", "##")
+		switch statusSummary.Heat {
+		case "hot":
+			return "#[fg=red]" + text + "#[default]", nil
+		case "warm":
+			return "#[fg=colour208]" + text + "#[default]", nil
+		}
+		return text, nil
+	case StatusFormatWaybar:
+		percentage := 0
+		if statusSummary.Hottest != nil {
+			percentage = int(statusSummary.Hottest.Score)
+		}
+		bytes, err := json.Marshal(map[string]interface{}{
+			"text":       html.EscapeString(text),
+			"tooltip":    html.EscapeString(statusSummary.tooltip()),
+			"class":      statusSummary.Heat,
+			"percentage": percentage,
+		})
+		return string(bytes), err
+	case StatusFormatI3blocks:
+		// full_text, short_text and color
+		shortText := fmt.Sprintf("%d", statusSummary.Pending)
+		color := ""
+		switch statusSummary.Heat {
+		case "hot":
+			color = "#FF0000"
+		case "warm":
+			color = "#FFA500"
+		}
+		return strings.TrimRight(text+"\n"+shortText+"\n"+color, "\n"), nil
+	}
+	return text, nil
+}
+
+// tooltip lists the hottest pending pull requests
+func (statusSummary *StatusSummary) tooltip() string {
+	lines := make([]string, 0)
+	for i, pullRequest := range statusSummary.pending {
+		if i == statusTooltipLength {
+			lines = append(lines, fmt.Sprintf("… and %d more", len(statusSummary.pending)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%3.0f %s#%d %s", pullRequest.Score, pullRequest.Repository, pullRequest.Number, pullRequest.Title))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,149 @@
+package ghmon
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func newStatusPullRequestWrapper(id uint32, title string, score PullRequestScore) *PullRequestWrapper {
+	return &PullRequestWrapper{
+		Id:    id,
+		Score: score,
+		PullRequest: &PullRequest{
+			Id: id, Number: id, Title: title,
+			Repo:    &Repo{Name: "ghmon", FullName: "nahojkap/ghmon"},
+			Creator: &User{Id: 2, Username: "author"},
+		},
+	}
+}
+
+func TestCreateStatusSummary(t *testing.T) {
+
+	hottest := newStatusPullRequestWrapper(1, "Fix the #1 crash", PullRequestScore{Total: 80})
+	seen := newStatusPullRequestWrapper(2, "Seen", PullRequestScore{Total: 60})
+	seen.Seen = true
+	approvedByMe := newStatusPullRequestWrapper(3, "Approved by me", PullRequestScore{Total: 55, ApprovedByMe: true})
+	deleted := newStatusPullRequestWrapper(4, "Closed", PullRequestScore{Total: 50})
+	deleted.Deleted = true
+	readyToMerge := newStatusPullRequestWrapper(5, "Mine, approved", PullRequestScore{Total: 40, IsMyPullRequest: true, Approvals: 1})
+	changesRequested := newStatusPullRequestWrapper(6, "Mine, blocked", PullRequestScore{Total: 30, IsMyPullRequest: true, Approvals: 1, ChangesRequested: 1})
+	waiting := newStatusPullRequestWrapper(7, "Mine, waiting", PullRequestScore{Total: 20, IsMyPullRequest: true})
+
+	statusSummary := CreateStatusSummary([]*PullRequestWrapper{hottest, seen, approvedByMe, deleted, readyToMerge, changesRequested, waiting})
+
+	if statusSummary.Pending != 2 || statusSummary.Unseen != 1 || statusSummary.Own != 3 || statusSummary.ReadyToMerge != 1 || statusSummary.ChangesRequested != 1 {
+		t.Errorf("unexpected counts %+v", statusSummary)
+	}
+	if statusSummary.Hottest == nil || statusSummary.Hottest.Id != hottest.Id || statusSummary.Hottest.Name != "ghmon" || statusSummary.Hottest.Repository != "nahojkap/ghmon" {
+		t.Errorf("unexpected hottest %+v", statusSummary.Hottest)
+	}
+
+	heatTests := []struct {
+		score float32
+		heat  string
+	}{
+		{76, "hot"},
+		{75, "warm"},
+		{51, "warm"},
+		{50, "cool"},
+	}
+	for _, test := range heatTests {
+		if heat := CreateStatusSummary([]*PullRequestWrapper{newStatusPullRequestWrapper(1, "Pending", PullRequestScore{Total: test.score})}).Heat; heat != test.heat {
+			t.Errorf("score %.0f is %s, expected %s", test.score, heat, test.heat)
+		}
+	}
+	if idle := CreateStatusSummary([]*PullRequestWrapper{waiting}); idle.Heat != "idle" || idle.Hottest != nil {
+		t.Errorf("nothing pending is %s with hottest %+v, expected idle", idle.Heat, idle.Hottest)
+	}
+}
+
+func TestRenderStatus(t *testing.T) {
+
+	statusSummary := CreateStatusSummary([]*PullRequestWrapper{
+		newStatusPullRequestWrapper(12, "Fix the #1 crash <quickly> in the event loop", PullRequestScore{Total: 80}),
+		newStatusPullRequestWrapper(13, "Second", PullRequestScore{Total: 30}),
+		newStatusPullRequestWrapper(14, "Mine", PullRequestScore{Total: 20, IsMyPullRequest: true, Approvals: 2}),
+	})
+
+	plainText := "2 to review, 1 ready to merge | ghmon#12 Fix the #1 crash <quickly> in…"
+	tests := []struct {
+		name           string
+		statusTemplate string
+		statusFormat   StatusFormat
+		status         string
+	}{
+		{"default template", "", StatusFormatPlain, plainText},
+		{"own template", "{{.Unseen}}/{{.Pending}} {{.Heat}} ", StatusFormatPlain, "2/2 hot"},
+		{"tmux", "", StatusFormatTmux, "#[fg=red]" + strings.ReplaceAll(plainText, "#", "##") + "#[default]"},
+		{"i3blocks", "", StatusFormatI3blocks, plainText + "\n2\n#FF0000"},
+	}
+	for _, test := range tests {
+		status, err := RenderStatus(statusSummary, test.statusTemplate, test.statusFormat)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if status != test.status {
+			t.Errorf("%s: rendered %q, expected %q", test.name, status, test.status)
+		}
+	}
+
+	status, err := RenderStatus(statusSummary, "", StatusFormatWaybar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var waybar struct {
+		Text       string
+		Tooltip    string
+		Class      string
+		Percentage int
+	}
+	if err = json.Unmarshal([]byte(status), &waybar); err != nil {
+		t.Fatal(err)
+	}
+	expectedTooltip := " 80 nahojkap/ghmon#12 Fix the #1 crash &lt;quickly&gt; in the event loop\n 30 nahojkap/ghmon#13 Second"
+	if waybar.Text != strings.ReplaceAll(strings.ReplaceAll(plainText, "<", "&lt;"), ">", "&gt;") || waybar.Tooltip != expectedTooltip || waybar.Class != "hot" || waybar.Percentage != 80 {
+		t.Errorf("unexpected waybar status %+v", waybar)
+	}
+
+	if _, err = RenderStatus(statusSummary, "{{.Missing}}", StatusFormatPlain); err == nil {
+		t.Error("expected an unknown field to fail")
+	}
+	if _, err = RenderStatus(statusSummary, "{{", StatusFormatPlain); err == nil {
+		t.Error("expected an unparsable template to fail")
+	}
+}
+
+func TestStatusTooltipIsLimited(t *testing.T) {
+
+	pullRequestWrappers := make([]*PullRequestWrapper, 0)
+	for id := uint32(1); id <= statusTooltipLength+3; id++ {
+		pullRequestWrappers = append(pullRequestWrappers, newStatusPullRequestWrapper(id, fmt.Sprintf("Pull request %d", id), PullRequestScore{Total: 10}))
+	}
+
+	lines := strings.Split(CreateStatusSummary(pullRequestWrappers).tooltip(), "\n")
+	if len(lines) != statusTooltipLength+1 || lines[statusTooltipLength] != "… and 3 more" {
+		t.Errorf("unexpected tooltip %q", lines)
+	}
+}
+
+func TestParseStatusFormat(t *testing.T) {
+
+	tests := []struct {
+		statusFormatString string
+		statusFormat       StatusFormat
+		ok                 bool
+	}{
+		{"", StatusFormatPlain, true},
+		{"plain", StatusFormatPlain, true},
+		{"TMUX", StatusFormatTmux, true},
+		{"waybar", StatusFormatWaybar, true},
+		{"i3blocks", StatusFormatI3blocks, true},
+		{"polybar", StatusFormatPlain, false},
+	}
+	for _, test := range tests {
+		if statusFormat, ok := ParseStatusFormat(test.statusFormatString); statusFormat != test.statusFormat || ok != test.ok {
+			t.Errorf("%q parsed as %d (%v), expected %d (%v)", test.statusFormatString, statusFormat, ok, test.statusFormat, test.ok)
+		}
+	}
+}
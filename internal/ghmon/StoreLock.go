@@ -0,0 +1,63 @@
+package ghmon
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errStoreLockHeld is returned by lockFile when another process holds the lock
+var errStoreLockHeld = errors.New("lock held by another process")
+
+// StoreLock is held by the one ghmon process writing to the store, for as long as it runs
+type StoreLock struct {
+	file *os.File
+}
+
+// StoreLockedError tells which process holds the lock of the store
+type StoreLockedError struct {
+	Pid int
+}
+
+func (storeLockedError *StoreLockedError) Error() string {
+	if storeLockedError.Pid == 0 {
+		return "the cache is in use by another ghmon"
+	}
+	return fmt.Sprintf("the cache is in use by another ghmon (pid %d)", storeLockedError.Pid)
+}
+
+// acquireStoreLock locks the lock file without waiting and writes the pid of this process in it
+func acquireStoreLock(path string) (*StoreLock, error) {
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = lockFile(file); err != nil {
+		defer file.Close()
+		if err == errStoreLockHeld {
+			bytes, _ := ioutil.ReadAll(file)
+			pid, _ := strconv.Atoi(strings.TrimSpace(string(bytes)))
+			return nil, &StoreLockedError{Pid: pid}
+		}
+		return nil, fmt.Errorf("could not lock %s: %s", path, err)
+	}
+
+	if err = file.Truncate(0); err == nil {
+		_, err = file.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &StoreLock{file: file}, nil
+}
+
+// Release lets another process lock the store
+func (storeLock *StoreLock) Release() {
+	storeLock.file.Close()
+}
@@ -0,0 +1,17 @@
+// +build !windows
+
+package ghmon
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func lockFile(file *os.File) error {
+	err := unix.Flock(int(file.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if err == unix.EWOULDBLOCK {
+		return errStoreLockHeld
+	}
+	return err
+}
@@ -0,0 +1,19 @@
+// +build windows
+
+package ghmon
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+func lockFile(file *os.File) error {
+	// Windows locks keep other processes from reading the locked bytes, lock one far past the pid
+	overlapped := &windows.Overlapped{Offset: 0xFFFFFFFF}
+	err := windows.LockFileEx(windows.Handle(file.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, overlapped)
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return errStoreLockHeld
+	}
+	return err
+}
@@ -10,11 +10,19 @@ func main() {
 
 	ghm := ghmon.NewGHMon()
 
-	if !ghm.HasValidSetup() {
-		log.Printf("ghmon reports invalid setup, will bail")
+	// Any arguments select one of the headless commands, each checks the setup it needs itself
+	if len(os.Args) > 1 {
+		os.Exit(ghmon.NewCommandLine(ghm).Run(os.Args[1:]))
+	}
+
+	if err := ghm.CheckSetup(); err != nil {
+		log.Printf("ghmon reports invalid setup, will bail: %s", err)
 		os.Exit(1)
 	}
 
+	// Only one instance writes the cache, another one follows it when it is a daemon
+	ghm.LockStoreOrAttach()
+
 	ghmui := ghmon.NewGHMonUI(ghm)
 
 	// Kick-off GHM
@@ -22,6 +30,12 @@ func main() {
 
 	// Loops until exit
 	ghmui.EventLoop()
+	ghm.Stop()
+
+	// The status bar may not have shown it for long
+	if notice := ghm.StoreNotice(); notice != "" {
+		log.Print(notice)
+	}
 
 	os.Exit(0)
 